@@ -0,0 +1,108 @@
+// This exports blueprints with their full history from a running composer
+// into a tarball, or imports them from one. It is meant for migrating
+// blueprints between hosts and for backing them up.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/osbuild/osbuild-composer/internal/client"
+)
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage:\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "  %s [-socket PATH] export [-o FILE] [BLUEPRINT...]\n", os.Args[0])
+	fmt.Fprintf(flag.CommandLine.Output(), "  %s [-socket PATH] import FILE\n", os.Args[0])
+	flag.PrintDefaults()
+}
+
+func fail(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
+
+func exportBlueprints(socket *http.Client, args []string) {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	var output string
+	flags.StringVar(&output, "o", "-", "write the tarball to this file instead of stdout")
+	_ = flags.Parse(args)
+
+	var w io.Writer = os.Stdout
+	if output != "-" {
+		f, err := os.Create(output)
+		if err != nil {
+			fail("%v", err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	resp, err := client.WriteBlueprintsArchiveV1(socket, w, flags.Args())
+	if err != nil {
+		fail("error exporting blueprints: %v", err)
+	}
+	if resp != nil {
+		fail("error exporting blueprints: %s", resp)
+	}
+}
+
+func importBlueprints(socket *http.Client, args []string) {
+	if len(args) != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	archive, err := ioutil.ReadFile(args[0])
+	if err != nil {
+		fail("%v", err)
+	}
+
+	names, resp, err := client.ImportBlueprintsArchiveV1(socket, archive)
+	if err != nil {
+		fail("error importing blueprints: %v", err)
+	}
+	if resp != nil {
+		fail("error importing blueprints: %s", resp)
+	}
+
+	for _, name := range names {
+		fmt.Printf("imported %s\n", name)
+	}
+}
+
+func main() {
+	var socketPath string
+	flag.StringVar(&socketPath, "socket", "/run/weldr/api.socket", "path to the weldr API socket")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	socket := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(_ context.Context, _, _ string) (net.Conn, error) {
+				return net.Dial("unix", socketPath)
+			},
+		},
+	}
+
+	switch flag.Arg(0) {
+	case "export":
+		exportBlueprints(socket, flag.Args()[1:])
+	case "import":
+		importBlueprints(socket, flag.Args()[1:])
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
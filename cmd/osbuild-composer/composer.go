@@ -8,12 +8,17 @@ import (
 	"io/ioutil"
 	"log"
 	"net"
+	"net/http"
 	"os"
 	"path"
+	"time"
 
+	"github.com/osbuild/osbuild-composer/internal/blueprintgit"
 	"github.com/osbuild/osbuild-composer/internal/common"
 	"github.com/osbuild/osbuild-composer/internal/jobqueue/fsjobqueue"
+	"github.com/osbuild/osbuild-composer/internal/jsondb"
 	"github.com/osbuild/osbuild-composer/internal/kojiapi"
+	"github.com/osbuild/osbuild-composer/internal/ostree"
 	"github.com/osbuild/osbuild-composer/internal/rpmmd"
 	"github.com/osbuild/osbuild-composer/internal/store"
 	"github.com/osbuild/osbuild-composer/internal/upload/koji"
@@ -40,7 +45,22 @@ type Composer struct {
 	weldr   *weldr.API
 	koji    *kojiapi.Server
 
-	weldrListener, localWorkerListener, workerListener, kojiListener net.Listener
+	weldrListener, localWorkerListener, workerListener, kojiListener, ostreeListener net.Listener
+
+	// Composes are collected every retentionInterval if retention limits
+	// any composes
+	retention         weldr.RetentionPolicy
+	retentionInterval time.Duration
+
+	// Blueprints are pulled from the upstream repository every
+	// blueprintsPullInterval, if one is configured
+	store                  *store.Store
+	blueprintsPullInterval time.Duration
+
+	// The commits of composes are pulled into ostreeRepo every
+	// ostreeSyncInterval, if it is enabled
+	ostreeRepo         *ostree.Repository
+	ostreeSyncInterval time.Duration
 }
 
 func NewComposer(config *ComposerConfigFile, stateDir, cacheDir string, logger *log.Logger) (*Composer, error) {
@@ -111,22 +131,237 @@ func (c *Composer) InitWeldr(repoPaths []string, weldrListener, localWorkerListe
 		name += "-beta"
 	}
 
-	repos, err := rpmmd.LoadRepositories(repoPaths, name)
+	hostRepos, err := rpmmd.LoadRepositories(repoPaths, name)
 	if err != nil {
 		return fmt.Errorf("Error loading repositories for %s: %v", hostDistro.Name(), err)
 	}
 
-	store := store.New(&c.stateDir, arch, c.logger)
+	// images of other distributions can be composed if they have
+	// repositories configured
+	repos := map[string]map[string][]rpmmd.RepoConfig{
+		hostDistro.Name(): hostRepos,
+	}
+	for _, distroName := range c.distros.List() {
+		if distroName == hostDistro.Name() {
+			continue
+		}
+		distroRepos, err := rpmmd.LoadRepositories(repoPaths, distroName)
+		if err != nil {
+			if _, ok := err.(*rpmmd.RepositoryError); ok {
+				continue
+			}
+			return fmt.Errorf("Error loading repositories for %s: %v", distroName, err)
+		}
+		repos[distroName] = distroRepos
+	}
+
+	c.store, err = store.New(&c.stateDir, arch, c.distros, c.logger)
+	if err != nil {
+		return fmt.Errorf("Error loading the store: %v", err)
+	}
 	compatOutputDir := path.Join(c.stateDir, "outputs")
 
-	c.weldr = weldr.New(c.rpm, arch, hostDistro, repos[archName], c.logger, store, c.workers, compatOutputDir)
+	err = c.initBlueprintRepository()
+	if err != nil {
+		return fmt.Errorf("Error initializing blueprint repository: %v", err)
+	}
+
+	c.weldr = weldr.New(c.rpm, arch, c.distros, repos, c.logger, c.store, c.workers, compatOutputDir)
 
 	c.weldrListener = weldrListener
 	c.localWorkerListener = localWorkerListener
 
+	c.retention, c.retentionInterval, err = c.retentionPolicy()
+	if err != nil {
+		return fmt.Errorf("Error in retention configuration: %v", err)
+	}
+
+	err = c.initOSTreeRepository()
+	if err != nil {
+		return fmt.Errorf("Error initializing OSTree repository: %v", err)
+	}
+
+	return nil
+}
+
+// Keeps the commits of composes in an OSTree repository, if that is enabled
+// in the configuration. New commits are pulled into it every minute by
+// default.
+func (c *Composer) initOSTreeRepository() error {
+	config := c.config.OSTree
+	if !config.Enabled {
+		return nil
+	}
+
+	c.ostreeSyncInterval = time.Minute
+	if config.SyncInterval != "" {
+		var err error
+		c.ostreeSyncInterval, err = time.ParseDuration(config.SyncInterval)
+		if err != nil {
+			return fmt.Errorf("invalid sync_interval: %v", err)
+		}
+		if c.ostreeSyncInterval <= 0 {
+			return errors.New("sync_interval must be positive")
+		}
+	}
+
+	repoPath := path.Join(c.stateDir, "ostree", "repo")
+	var err error
+	c.ostreeRepo, err = ostree.Open(repoPath)
+	if err != nil {
+		return err
+	}
+
+	// workers pull parent commits from the repository to generate static
+	// deltas. Local workers can read it directly, remote ones need the
+	// url it is served at.
+	url := config.URL
+	if url == "" {
+		url = "file://" + repoPath
+	}
+	db := jsondb.New(path.Join(c.stateDir, "ostree"), 0600)
+	return c.weldr.SetOSTreeRepository(c.ostreeRepo, url, db)
+}
+
+// Pulls the commits of finished composes into the OSTree repository every
+// ostreeSyncInterval
+func (c *Composer) syncOSTreeRepository() {
+	ticker := time.NewTicker(c.ostreeSyncInterval)
+	defer ticker.Stop()
+
+	for {
+		err := c.weldr.PullOSTreeCommits()
+		if err != nil {
+			log.Printf("Error pulling OSTree commits: %v", err)
+		}
+		<-ticker.C
+	}
+}
+
+// Serves the OSTree repository over HTTP on `l`. InitWeldr() must have been
+// called before.
+func (c *Composer) InitOSTree(l net.Listener) error {
+	if c.ostreeRepo == nil {
+		return errors.New("the OSTree repository is not enabled in the configuration")
+	}
+
+	c.ostreeListener = l
+
+	return nil
+}
+
+// Keeps the blueprints of the store in a git repository, if that is enabled
+// in the configuration. Blueprints are pulled from the configured remote
+// every five minutes by default.
+func (c *Composer) initBlueprintRepository() error {
+	config := c.config.Blueprints.Git
+	if !config.Enabled {
+		return nil
+	}
+
+	branch := config.Branch
+	if branch == "" {
+		branch = "main"
+	}
+
+	c.blueprintsPullInterval = 5 * time.Minute
+	if config.PullInterval != "" {
+		var err error
+		c.blueprintsPullInterval, err = time.ParseDuration(config.PullInterval)
+		if err != nil {
+			return fmt.Errorf("invalid pull_interval: %v", err)
+		}
+		if c.blueprintsPullInterval <= 0 {
+			return errors.New("pull_interval must be positive")
+		}
+	}
+
+	repo, err := blueprintgit.Open(path.Join(c.stateDir, "blueprints-git"), config.Remote, branch)
+	if err != nil {
+		return err
+	}
+	c.store.SetBlueprintRepository(repo)
+
 	return nil
 }
 
+// Pulls blueprints from the upstream repository every blueprintsPullInterval
+func (c *Composer) pullBlueprints() {
+	ticker := time.NewTicker(c.blueprintsPullInterval)
+	defer ticker.Stop()
+
+	for {
+		err := c.store.PullBlueprints()
+		if err != nil {
+			log.Printf("Error pulling blueprints: %v", err)
+		}
+		<-ticker.C
+	}
+}
+
+// Returns the retention policy from the configuration and how often composes
+// are collected. Collecting once per hour is the default.
+func (c *Composer) retentionPolicy() (weldr.RetentionPolicy, time.Duration, error) {
+	config := c.config.Retention
+	policy := weldr.RetentionPolicy{
+		MaxComposesPerBlueprint: config.MaxComposesPerBlueprint,
+		MaxDiskUsage:            config.MaxDiskUsage,
+		KeepLastSuccessful:      config.KeepLastSuccessful,
+		MaxSnapshots:            config.MaxSnapshots,
+	}
+
+	if config.MaxComposesPerBlueprint < 0 || config.MaxDiskUsage < 0 || config.KeepLastSuccessful < 0 || config.MaxSnapshots < 0 {
+		return policy, 0, errors.New("limits must not be negative")
+	}
+
+	if config.MaxAge != "" {
+		maxAge, err := time.ParseDuration(config.MaxAge)
+		if err != nil {
+			return policy, 0, fmt.Errorf("invalid max_age: %v", err)
+		}
+		policy.MaxAge = maxAge
+	}
+
+	interval := time.Hour
+	if config.Interval != "" {
+		var err error
+		interval, err = time.ParseDuration(config.Interval)
+		if err != nil {
+			return policy, 0, fmt.Errorf("invalid interval: %v", err)
+		}
+		if interval <= 0 {
+			return policy, 0, errors.New("interval must be positive")
+		}
+	}
+
+	return policy, interval, nil
+}
+
+// Deletes the composes and repository snapshots which the retention policy
+// does not retain every retentionInterval
+func (c *Composer) collectComposes() {
+	ticker := time.NewTicker(c.retentionInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		deleted, err := c.weldr.CollectComposes(c.retention, now)
+		if err != nil {
+			log.Printf("Error collecting composes: %v", err)
+		}
+		for _, id := range deleted {
+			log.Printf("Deleted compose %s, which is not retained", id)
+		}
+
+		deleted, err = c.weldr.CollectSnapshots(c.retention)
+		if err != nil {
+			log.Printf("Error collecting snapshots: %v", err)
+		}
+		for _, id := range deleted {
+			log.Printf("Deleted snapshot %s, which is not retained", id)
+		}
+	}
+}
+
 func (c *Composer) InitKoji(cert, key string, l net.Listener) error {
 	servers := make(map[string]koji.GSSAPICredentials)
 	for name, creds := range c.config.Koji.Servers {
@@ -206,6 +441,27 @@ func (c *Composer) Start() error {
 		}()
 	}
 
+	if !c.retention.IsEmpty() {
+		go c.collectComposes()
+	}
+
+	if c.config.Blueprints.Git.Enabled && c.config.Blueprints.Git.Remote != "" {
+		go c.pullBlueprints()
+	}
+
+	if c.ostreeRepo != nil {
+		go c.syncOSTreeRepository()
+	}
+
+	if c.ostreeListener != nil {
+		go func() {
+			err := http.Serve(c.ostreeListener, c.ostreeRepo)
+			if err != nil {
+				panic(err)
+			}
+		}()
+	}
+
 	return c.weldr.Serve(c.weldrListener)
 }
 
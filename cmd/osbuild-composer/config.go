@@ -21,6 +21,27 @@ type ComposerConfigFile struct {
 		AllowedDomains []string `toml:"allowed_domains"`
 		CA             string   `toml:"ca"`
 	} `toml:"worker"`
+	Blueprints struct {
+		Git struct {
+			Enabled      bool   `toml:"enabled"`
+			Remote       string `toml:"remote"`
+			Branch       string `toml:"branch"`
+			PullInterval string `toml:"pull_interval"`
+		} `toml:"git"`
+	} `toml:"blueprints"`
+	Retention struct {
+		MaxAge                  string `toml:"max_age"`
+		MaxComposesPerBlueprint int    `toml:"max_composes_per_blueprint"`
+		MaxDiskUsage            int64  `toml:"max_disk_usage"`
+		KeepLastSuccessful      int    `toml:"keep_last_successful"`
+		MaxSnapshots            int    `toml:"max_snapshots"`
+		Interval                string `toml:"interval"`
+	} `toml:"retention"`
+	OSTree struct {
+		Enabled      bool   `toml:"enabled"`
+		SyncInterval string `toml:"sync_interval"`
+		URL          string `toml:"url"`
+	} `toml:"ostree"`
 }
 
 func LoadConfig(name string) (*ComposerConfigFile, error) {
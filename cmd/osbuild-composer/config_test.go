@@ -16,6 +16,19 @@ func TestEmpty(t *testing.T) {
 	require.Empty(t, config.Koji.CA)
 	require.Empty(t, config.Worker.AllowedDomains)
 	require.Empty(t, config.Worker.CA)
+	require.False(t, config.Blueprints.Git.Enabled)
+	require.Empty(t, config.Blueprints.Git.Remote)
+	require.Empty(t, config.Blueprints.Git.Branch)
+	require.Empty(t, config.Blueprints.Git.PullInterval)
+	require.Empty(t, config.Retention.MaxAge)
+	require.Zero(t, config.Retention.MaxComposesPerBlueprint)
+	require.Zero(t, config.Retention.MaxDiskUsage)
+	require.Zero(t, config.Retention.KeepLastSuccessful)
+	require.Zero(t, config.Retention.MaxSnapshots)
+	require.Empty(t, config.Retention.Interval)
+	require.False(t, config.OSTree.Enabled)
+	require.Empty(t, config.OSTree.SyncInterval)
+	require.Empty(t, config.OSTree.URL)
 }
 
 func TestNonExisting(t *testing.T) {
@@ -41,4 +54,20 @@ func TestConfig(t *testing.T) {
 
 	require.Equal(t, config.Worker.AllowedDomains, []string{"osbuild.org"})
 	require.Equal(t, config.Worker.CA, "/etc/osbuild-composer/ca-crt.pem")
+
+	require.True(t, config.Blueprints.Git.Enabled)
+	require.Equal(t, config.Blueprints.Git.Remote, "https://example.com/blueprints.git")
+	require.Equal(t, config.Blueprints.Git.Branch, "main")
+	require.Equal(t, config.Blueprints.Git.PullInterval, "10m")
+
+	require.Equal(t, config.Retention.MaxAge, "720h")
+	require.Equal(t, config.Retention.MaxComposesPerBlueprint, 10)
+	require.Equal(t, config.Retention.MaxDiskUsage, int64(10737418240))
+	require.Equal(t, config.Retention.KeepLastSuccessful, 1)
+	require.Equal(t, config.Retention.MaxSnapshots, 20)
+	require.Equal(t, config.Retention.Interval, "30m")
+
+	require.True(t, config.OSTree.Enabled)
+	require.Equal(t, config.OSTree.SyncInterval, "1m")
+	require.Equal(t, config.OSTree.URL, "http://composer.example.com:8080/")
 }
@@ -99,6 +99,17 @@ func main() {
 		}
 	}
 
+	if l, exists := listeners["osbuild-composer-ostree.socket"]; exists {
+		if len(l) != 1 {
+			log.Fatal("The osbuild-composer-ostree.socket unit is misconfigured. It should contain only one socket.")
+		}
+
+		err = composer.InitOSTree(l[0])
+		if err != nil {
+			log.Fatalf("Error initializing OSTree repository: %v", err)
+		}
+	}
+
 	err = composer.Start()
 	if err != nil {
 		log.Fatalf("%v", err)
@@ -123,13 +123,13 @@ func main() {
 	}
 
 	rpmmd := rpmmd.NewRPMMD(path.Join(home, ".cache/osbuild-composer/rpmmd"), "/usr/libexec/osbuild-composer/dnf-json")
-	packageSpecs, checksums, err := rpmmd.Depsolve(packages, excludePkgs, repos, d.ModulePlatformID(), arch.Name())
+	packageSpecs, checksums, err := rpmmd.Depsolve(packages, excludePkgs, composeRequest.Blueprint.GetPackageSelectors(), repos, d.ModulePlatformID(), arch.Name())
 	if err != nil {
 		panic("Could not depsolve: " + err.Error())
 	}
 
 	buildPkgs := imageType.BuildPackages()
-	buildPackageSpecs, _, err := rpmmd.Depsolve(buildPkgs, nil, repos, d.ModulePlatformID(), arch.Name())
+	buildPackageSpecs, _, err := rpmmd.Depsolve(buildPkgs, nil, nil, repos, d.ModulePlatformID(), arch.Name())
 	if err != nil {
 		panic("Could not depsolve build packages: " + err.Error())
 	}
@@ -148,7 +148,8 @@ func main() {
 	} else {
 		manifest, err := imageType.Manifest(composeRequest.Blueprint.Customizations,
 			distro.ImageOptions{
-				Size: imageType.Size(0),
+				Size:    imageType.Size(0),
+				Modules: composeRequest.Blueprint.GetModuleStreams(),
 			},
 			repos,
 			packageSpecs,
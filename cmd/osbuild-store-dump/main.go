@@ -18,11 +18,11 @@ import (
 
 func getManifest(bp blueprint.Blueprint, t distro.ImageType, a distro.Arch, d distro.Distro, rpmmd rpmmd.RPMMD, repos []rpmmd.RepoConfig) distro.Manifest {
 	packages, excludePackages := t.Packages(bp)
-	pkgs, _, err := rpmmd.Depsolve(packages, excludePackages, repos, d.ModulePlatformID(), a.Name())
+	pkgs, _, err := rpmmd.Depsolve(packages, excludePackages, nil, repos, d.ModulePlatformID(), a.Name())
 	if err != nil {
 		panic(err)
 	}
-	buildPkgs, _, err := rpmmd.Depsolve(t.BuildPackages(), nil, repos, d.ModulePlatformID(), a.Name())
+	buildPkgs, _, err := rpmmd.Depsolve(t.BuildPackages(), nil, nil, repos, d.ModulePlatformID(), a.Name())
 	if err != nil {
 		panic(err)
 	}
@@ -139,9 +139,9 @@ func main() {
 	}
 	rpmmd := rpmmd.NewRPMMD(path.Join(homeDir, ".cache/osbuild-composer/rpmmd"), "/usr/libexec/osbuild-composer/dnf-json")
 
-	s := store.New(&cwd, a, nil)
-	if s == nil {
-		panic("could not create store")
+	s, err := store.New(&cwd, a, nil, nil)
+	if err != nil {
+		panic(err)
 	}
 	err = s.PushBlueprint(bp1, "message 1")
 	if err != nil {
@@ -155,29 +155,29 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
-	err = s.PushCompose(id1,
-		getManifest(bp2, t1, a, d, rpmmd, repos),
-		t1,
-		&bp2,
-		0,
-		[]*target.Target{
-			awsTarget,
+	err = s.PushCompose(id1, &bp2, nil, []store.ImageBuild{
+		{
+			Manifest:  getManifest(bp2, t1, a, d, rpmmd, repos),
+			ImageType: t1,
+			Targets: []*target.Target{
+				awsTarget,
+			},
+			JobID: id1,
 		},
-		id1,
-	)
+	})
 	if err != nil {
 		panic(err)
 	}
-	err = s.PushCompose(id2,
-		getManifest(bp2, t2, a, d, rpmmd, repos),
-		t2,
-		&bp2,
-		0,
-		[]*target.Target{
-			awsTarget,
+	err = s.PushCompose(id2, &bp2, nil, []store.ImageBuild{
+		{
+			Manifest:  getManifest(bp2, t2, a, d, rpmmd, repos),
+			ImageType: t2,
+			Targets: []*target.Target{
+				awsTarget,
+			},
+			JobID: id2,
 		},
-		id2,
-	)
+	})
 	if err != nil {
 		panic(err)
 	}
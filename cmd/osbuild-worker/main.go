@@ -20,10 +20,14 @@ import (
 
 	"github.com/osbuild/osbuild-composer/internal/common"
 	"github.com/osbuild/osbuild-composer/internal/osbuild"
+	"github.com/osbuild/osbuild-composer/internal/ostree"
 	"github.com/osbuild/osbuild-composer/internal/target"
 	"github.com/osbuild/osbuild-composer/internal/upload/awsupload"
 	"github.com/osbuild/osbuild-composer/internal/upload/azure"
+	"github.com/osbuild/osbuild-composer/internal/upload/container"
+	"github.com/osbuild/osbuild-composer/internal/upload/gcp"
 	"github.com/osbuild/osbuild-composer/internal/upload/koji"
+	"github.com/osbuild/osbuild-composer/internal/upload/openstack"
 	"github.com/osbuild/osbuild-composer/internal/upload/vmware"
 	"github.com/osbuild/osbuild-composer/internal/worker"
 )
@@ -96,10 +100,10 @@ func osbuildStagesToRPMs(stages []osbuild.StageResult) []koji.RPM {
 	return rpms
 }
 
-func RunJob(job worker.Job, store string, kojiServers map[string]koji.GSSAPICredentials) (*osbuild.Result, error) {
+func RunJob(job worker.Job, store string, kojiServers map[string]koji.GSSAPICredentials, containerAuthFile string) (*osbuild.Result, []*target.TargetResult, error) {
 	outputDirectory, err := ioutil.TempDir("/var/tmp", "osbuild-worker-*")
 	if err != nil {
-		return nil, fmt.Errorf("error creating temporary output directory: %v", err)
+		return nil, nil, fmt.Errorf("error creating temporary output directory: %v", err)
 	}
 	defer func() {
 		err := os.RemoveAll(outputDirectory)
@@ -110,19 +114,32 @@ func RunJob(job worker.Job, store string, kojiServers map[string]koji.GSSAPICred
 
 	manifest, targets, err := job.OSBuildArgs()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	staticDelta, err := job.OSTreeStaticDelta()
+	if err != nil {
+		return nil, nil, err
 	}
 
 	start_time := time.Now()
 
 	result, err := RunOSBuild(manifest, store, outputDirectory, os.Stderr)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	end_time := time.Now()
 
 	var r []error
+	var targetResults []*target.TargetResult
+
+	if staticDelta != nil && result.Success {
+		err = uploadStaticDelta(job, staticDelta, outputDirectory)
+		if err != nil {
+			r = append(r, err)
+		}
+	}
 
 	for _, t := range targets {
 		switch options := t.Options.(type) {
@@ -168,6 +185,16 @@ func RunJob(job worker.Job, store string, kojiServers map[string]koji.GSSAPICred
 				continue
 			}
 
+			// keep the static delta of a commit next to it
+			deltaPath := path.Join(outputDirectory, ostree.StaticDeltaFilename)
+			if _, err := os.Stat(deltaPath); err == nil {
+				_, err = a.Upload(deltaPath, options.Bucket, key+".delta")
+				if err != nil {
+					r = append(r, err)
+					continue
+				}
+			}
+
 			/* TODO: communicate back the AMI */
 			_, err = a.Register(t.ImageName, options.Bucket, key)
 			if err != nil {
@@ -197,6 +224,18 @@ func RunJob(job worker.Job, store string, kojiServers map[string]koji.GSSAPICred
 				r = append(r, err)
 				continue
 			}
+
+			if options.ResourceGroup == "" {
+				continue
+			}
+
+			result, err := createAzureImage(options, t.ImageName)
+			if err != nil {
+				r = append(r, err)
+				continue
+			}
+
+			targetResults = append(targetResults, target.NewAzureTargetResult(result))
 		case *target.KojiTargetOptions:
 			// Koji for some reason needs TLS renegotiation enabled.
 			// Clone the default http transport and enable renegotiation.
@@ -287,6 +326,113 @@ func RunJob(job worker.Job, store string, kojiServers map[string]koji.GSSAPICred
 				r = append(r, err)
 				continue
 			}
+		case *target.ContainerTargetOptions:
+			var credentials *container.Credentials
+			if options.Username != "" {
+				credentials = &container.Credentials{
+					Username: options.Username,
+					Password: options.Password,
+				}
+			} else if containerAuthFile != "" {
+				credentials, err = container.CredentialsFromAuthFile(containerAuthFile, options.URL)
+				if err != nil {
+					r = append(r, err)
+					continue
+				}
+			}
+
+			tlsVerify := true
+			if options.TLSVerify != nil {
+				tlsVerify = *options.TLSVerify
+			}
+
+			c, err := container.NewClient(options.URL, options.Repository, credentials, tlsVerify)
+			if err != nil {
+				r = append(r, err)
+				continue
+			}
+
+			tags := options.Tags
+			if len(tags) == 0 {
+				tags = []string{"latest"}
+			}
+
+			digest, err := c.PushArchive(path.Join(outputDirectory, options.Filename), tags)
+			if err != nil {
+				r = append(r, err)
+				continue
+			}
+
+			targetResults = append(targetResults, target.NewContainerTargetResult(&target.ContainerTargetResultOptions{
+				Digest: digest,
+			}))
+		case *target.GCPTargetOptions:
+			result, err := importGCPImage(options, t.ImageName, outputDirectory)
+			if err != nil {
+				r = append(r, err)
+				continue
+			}
+
+			targetResults = append(targetResults, target.NewGCPTargetResult(result))
+		case *target.VMwareTargetOptions:
+			tlsVerify := true
+			if options.TLSVerify != nil {
+				tlsVerify = *options.TLSVerify
+			}
+
+			template, err := vmware.UploadImage(vmware.Options{
+				Host:       options.Host,
+				Username:   options.Username,
+				Password:   options.Password,
+				Datacenter: options.Datacenter,
+				Cluster:    options.Cluster,
+				Datastore:  options.Datastore,
+				Folder:     options.Folder,
+				TLSVerify:  tlsVerify,
+				Hardware: vmware.Hardware{
+					CPUs:     options.CPUs,
+					MemoryMB: options.MemoryMB,
+					Version:  options.HardwareVersion,
+				},
+			}, path.Join(outputDirectory, options.Filename), t.ImageName)
+			if err != nil {
+				r = append(r, err)
+				continue
+			}
+
+			targetResults = append(targetResults, target.NewVMwareTargetResult(&target.VMwareTargetResultOptions{
+				TemplateName: template.Name,
+				TemplateID:   template.ID,
+			}))
+		case *target.OpenStackTargetOptions:
+			o, err := openstack.New(openstack.AuthOptions{
+				AuthURL:     options.AuthURL,
+				Username:    options.Username,
+				Password:    options.Password,
+				DomainName:  options.DomainName,
+				ProjectName: options.ProjectName,
+				ProjectID:   options.ProjectID,
+				Region:      options.Region,
+			})
+			if err != nil {
+				r = append(r, err)
+				continue
+			}
+
+			imageID, err := o.UploadImage(path.Join(outputDirectory, options.Filename), openstack.ImageOptions{
+				Name:       t.ImageName,
+				DiskFormat: options.DiskFormat,
+				Visibility: options.Visibility,
+				Properties: options.Properties,
+			})
+			if err != nil {
+				r = append(r, err)
+				continue
+			}
+
+			targetResults = append(targetResults, target.NewOpenStackTargetResult(&target.OpenStackTargetResultOptions{
+				ImageID: imageID,
+			}))
 		default:
 			r = append(r, fmt.Errorf("invalid target type"))
 		}
@@ -298,12 +444,120 @@ func RunJob(job worker.Job, store string, kojiServers map[string]koji.GSSAPICred
 	}
 
 	if len(r) > 0 {
-		return result, &TargetsError{r}
+		return result, targetResults, &TargetsError{r}
+	}
+
+	return result, targetResults, nil
+}
+
+// createAzureImage creates a managed image from the VHD uploaded for the
+// Azure target, publishes it to the gallery if one is given, and gives up
+// after azure.ImageTimeout.
+func createAzureImage(options *target.AzureTargetOptions, imageName string) (*target.AzureTargetResultOptions, error) {
+	c, err := azure.NewCompute(azure.ClientCredentials{
+		TenantID:       options.TenantID,
+		ClientID:       options.ClientID,
+		ClientSecret:   options.ClientSecret,
+		SubscriptionID: options.SubscriptionID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), azure.ImageTimeout)
+	defer cancel()
+
+	blobURL := azure.BlobURL(options.StorageAccount, options.Container, imageName)
+	imageID, err := c.CreateImage(ctx, options.ResourceGroup, options.Location, imageName, blobURL)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &target.AzureTargetResultOptions{
+		ImageID: imageID,
+	}
+	if options.Gallery != "" {
+		result.GalleryImageVersionID, err = c.CreateGalleryImageVersion(ctx, options.ResourceGroup, options.Location, imageID, azure.GalleryImage{
+			Gallery: options.Gallery,
+			Image:   options.GalleryImage,
+			Version: options.GalleryImageVersion,
+		})
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return result, nil
 }
 
+// importGCPImage uploads the image of the GCP target to Cloud Storage,
+// imports it into Compute Engine, and gives up after gcp.ImportTimeout. The
+// uploaded object is deleted again in any case.
+func importGCPImage(options *target.GCPTargetOptions, imageName, outputDirectory string) (*target.GCPTargetResultOptions, error) {
+	g, err := gcp.New(options.Credentials)
+	if err != nil {
+		return nil, err
+	}
+
+	project := options.Project
+	if project == "" {
+		project = g.ProjectID()
+	}
+	if project == "" {
+		return nil, errors.New("no GCP project given and the credentials do not name one")
+	}
+
+	archivePath := path.Join(outputDirectory, "image.tar.gz")
+	err = gcp.WriteImageArchive(path.Join(outputDirectory, options.Filename), archivePath)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), gcp.ImportTimeout)
+	defer cancel()
+
+	err = g.Upload(ctx, archivePath, options.Bucket, options.Object)
+	if err != nil {
+		return nil, err
+	}
+
+	err = g.Import(ctx, options.Bucket, options.Object, project, imageName, options.Region)
+
+	// the object is only needed for the import, also delete it when the
+	// import timed out
+	deleteErr := g.DeleteObject(context.Background(), options.Bucket, options.Object)
+	if deleteErr != nil {
+		log.Printf("Error deleting gs://%s/%s: %v", options.Bucket, options.Object, deleteErr)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &target.GCPTargetResultOptions{
+		ImageName: imageName,
+		ProjectID: project,
+	}, nil
+}
+
+// Generates the static delta of an OSTree commit in outputDirectory and
+// uploads it as an artifact of the job
+func uploadStaticDelta(job worker.Job, delta *worker.OSTreeStaticDelta, outputDirectory string) error {
+	deltaPath := path.Join(outputDirectory, ostree.StaticDeltaFilename)
+	err := ostree.GenerateStaticDelta(path.Join(outputDirectory, delta.Filename), delta.From, delta.URL, deltaPath)
+	if err != nil {
+		return fmt.Errorf("cannot generate static delta: %v", err)
+	}
+
+	f, err := os.Open(deltaPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return job.UploadArtifact(ostree.StaticDeltaFilename, f)
+}
+
 func FailJob(job worker.Job, kojiServers map[string]koji.GSSAPICredentials) {
 	_, targets, err := job.OSBuildArgs()
 	if err != nil {
@@ -381,6 +635,9 @@ func main() {
 				KeyTab    string `toml:"keytab"`
 			} `toml:"kerberos,omitempty"`
 		} `toml:"koji"`
+		Containers struct {
+			AuthFilePath string `toml:"auth_file_path"`
+		} `toml:"containers"`
 	}
 	var unix bool
 	flag.BoolVar(&unix, "unix", false, "Interpret 'address' as a path to a unix domain socket instead of a network address")
@@ -460,7 +717,7 @@ func main() {
 		go WatchJob(ctx, job)
 
 		var status common.ImageBuildState
-		result, err := RunJob(job, store, kojiServers)
+		result, targetResults, err := RunJob(job, store, kojiServers, config.Containers.AuthFilePath)
 		if err != nil {
 			log.Printf("  Job failed: %v", err)
 			status = common.IBFailed
@@ -496,7 +753,7 @@ func main() {
 		// signal to WatchJob() that it can stop watching
 		cancel()
 
-		err = job.Update(status, result)
+		err = job.Update(status, result, targetResults)
 		if err != nil {
 			log.Fatalf("Error reporting job result: %v", err)
 		}
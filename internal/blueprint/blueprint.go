@@ -4,19 +4,33 @@ package blueprint
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/coreos/go-semver/semver"
+
+	"github.com/osbuild/osbuild-composer/internal/rpmmd"
 )
 
-// A Blueprint is a high-level description of an image.
+// A Blueprint is a high-level description of an image. Distro names the
+// distribution the image is built from; it is the host's if unset.
+//
+// Include names other blueprints this one is based on. They are merged into
+// it in order, see Merge().
+//
+// Variables are values the customizations are parameterized with, which are
+// given per compose.
 type Blueprint struct {
 	Name           string          `json:"name" toml:"name"`
 	Description    string          `json:"description" toml:"description"`
 	Version        string          `json:"version,omitempty" toml:"version,omitempty"`
+	Distro         string          `json:"distro,omitempty" toml:"distro,omitempty"`
+	Include        []string        `json:"include,omitempty" toml:"include,omitempty"`
 	Packages       []Package       `json:"packages" toml:"packages"`
 	Modules        []Package       `json:"modules" toml:"modules"`
 	Groups         []Group         `json:"groups" toml:"groups"`
+	Exclude        []string        `json:"exclude,omitempty" toml:"exclude,omitempty"`
 	Customizations *Customizations `json:"customizations,omitempty" toml:"customizations,omitempty"`
+	Variables      []Variable      `json:"variables,omitempty" toml:"variables,omitempty"`
 }
 
 type Change struct {
@@ -28,9 +42,20 @@ type Change struct {
 }
 
 // A Package specifies an RPM package.
+//
+// Version is either a version glob ("1.2.*"), or a comma separated list of
+// constraints (">= 1.2, < 2.0, != 1.5"). If Repo is set, the package is only
+// taken from the repository (or source) of that name.
+//
+// Stream and Profile are only valid for modules. A module with a Stream
+// enables that stream of the module and installs the packages of Profile
+// (or of the default profile of the stream, if it is unset).
 type Package struct {
 	Name    string `json:"name" toml:"name"`
 	Version string `json:"version,omitempty" toml:"version,omitempty"`
+	Repo    string `json:"repo,omitempty" toml:"repo,omitempty"`
+	Stream  string `json:"stream,omitempty" toml:"stream,omitempty"`
+	Profile string `json:"profile,omitempty" toml:"profile,omitempty"`
 }
 
 // A group specifies an package group.
@@ -73,6 +98,41 @@ func (b *Blueprint) Initialize() error {
 	if err != nil {
 		return fmt.Errorf("Invalid 'version', must use Semantic Versioning: %s", err.Error())
 	}
+	for _, pkg := range b.packagesAndModules() {
+		_, err := pkg.VersionConstraints()
+		if err != nil {
+			return fmt.Errorf("Invalid 'version' of package '%s': %s", pkg.Name, err.Error())
+		}
+	}
+	for _, pkg := range b.Packages {
+		if pkg.Stream != "" || pkg.Profile != "" {
+			return fmt.Errorf("Invalid package '%s': only modules can have a 'stream' or 'profile'", pkg.Name)
+		}
+	}
+	for _, module := range b.Modules {
+		if module.Profile != "" && module.Stream == "" {
+			return fmt.Errorf("Invalid module '%s': 'profile' requires a 'stream'", module.Name)
+		}
+		if module.Stream != "" && (module.Version != "" || module.Repo != "") {
+			return fmt.Errorf("Invalid module '%s': a 'stream' cannot be combined with 'version' or 'repo'", module.Name)
+		}
+		if strings.ContainsAny(module.Stream, ":/ ") || strings.ContainsAny(module.Profile, ":/ ") {
+			return fmt.Errorf("Invalid module '%s': 'stream' and 'profile' must not contain ':', '/' or spaces", module.Name)
+		}
+	}
+	if err := b.validateVariables(); err != nil {
+		return err
+	}
+	for _, include := range b.Include {
+		if strings.TrimSpace(include) == "" {
+			return fmt.Errorf("Invalid 'include': entries must not be empty")
+		}
+	}
+	for _, exclude := range b.Exclude {
+		if strings.TrimSpace(exclude) == "" {
+			return fmt.Errorf("Invalid 'exclude': entries must not be empty")
+		}
+	}
 	return nil
 }
 
@@ -91,14 +151,22 @@ func (b *Blueprint) BumpVersion(old string) {
 }
 
 // packages, modules, and groups all resolve to rpm packages right now. This
-// function returns a combined list of "name-version" strings.
+// function returns a combined list of "name-version" strings. Packages which
+// need a selector (see GetPackageSelectors) are not part of the list. Modules
+// with a stream are returned as module specs ("@name:stream/profile").
 func (b *Blueprint) GetPackages() []string {
 	packages := []string{}
 	for _, pkg := range b.Packages {
-		packages = append(packages, pkg.ToNameVersion())
+		if !pkg.needsSelector() {
+			packages = append(packages, pkg.ToNameVersion())
+		}
 	}
 	for _, pkg := range b.Modules {
-		packages = append(packages, pkg.ToNameVersion())
+		if stream := pkg.ModuleStream(); stream != nil {
+			packages = append(packages, stream.Spec())
+		} else if !pkg.needsSelector() {
+			packages = append(packages, pkg.ToNameVersion())
+		}
 	}
 	for _, group := range b.Groups {
 		packages = append(packages, "@"+group.Name)
@@ -106,11 +174,120 @@ func (b *Blueprint) GetPackages() []string {
 	return packages
 }
 
+// packagesAndModules returns the packages and modules of the blueprint in a
+// new slice, so that appending to it doesn't write into b.Packages
+func (b *Blueprint) packagesAndModules() []Package {
+	packages := append([]Package{}, b.Packages...)
+	return append(packages, b.Modules...)
+}
+
+// GetPackageSelectors returns the packages and modules which are restricted
+// by version constraints or pinned to a repository. This assumes that the
+// blueprint has already been validated via Initialize.
+func (b *Blueprint) GetPackageSelectors() []rpmmd.PackageSelector {
+	var selectors []rpmmd.PackageSelector
+	for _, pkg := range b.packagesAndModules() {
+		if !pkg.needsSelector() {
+			continue
+		}
+		constraints, _ := pkg.VersionConstraints()
+		selectors = append(selectors, rpmmd.PackageSelector{
+			Spec:        pkg.ToNameVersion(),
+			Constraints: constraints,
+			Repo:        pkg.Repo,
+		})
+	}
+	return selectors
+}
+
+// GetModuleStreams returns the module streams enabled by the blueprint
+func (b *Blueprint) GetModuleStreams() []rpmmd.ModuleStream {
+	var streams []rpmmd.ModuleStream
+	for _, module := range b.Modules {
+		if stream := module.ModuleStream(); stream != nil {
+			streams = append(streams, *stream)
+		}
+	}
+	return streams
+}
+
+// GetExcludes returns the packages which must not be installed
+func (b *Blueprint) GetExcludes() []string {
+	return append([]string{}, b.Exclude...)
+}
+
 func (p Package) ToNameVersion() string {
 	// Omit version to prevent all packages with prefix of name to be installed
-	if p.Version == "*" || p.Version == "" {
+	if p.Version == "*" || p.Version == "" || p.hasVersionConstraints() {
 		return p.Name
 	}
 
 	return p.Name + "-" + p.Version
 }
+
+// ModuleStream returns the module stream of a module, or nil if it does not
+// name a stream
+func (p Package) ModuleStream() *rpmmd.ModuleStream {
+	if p.Stream == "" {
+		return nil
+	}
+	return &rpmmd.ModuleStream{
+		Name:    p.Name,
+		Stream:  p.Stream,
+		Profile: p.Profile,
+	}
+}
+
+func (p Package) hasVersionConstraints() bool {
+	version := strings.TrimSpace(p.Version)
+	return version != "" && strings.ContainsAny(version[:1], "<>=!")
+}
+
+func (p Package) needsSelector() bool {
+	return p.Repo != "" || p.hasVersionConstraints()
+}
+
+var versionOperators = []string{
+	// two character operators first, so that they take precedence
+	rpmmd.VersionGreaterOrEqual,
+	rpmmd.VersionLessOrEqual,
+	rpmmd.VersionNotEqual,
+	"==",
+	rpmmd.VersionGreater,
+	rpmmd.VersionLess,
+	rpmmd.VersionEqual,
+}
+
+// VersionConstraints parses the version of the package into a list of
+// constraints. It returns nil if the version is a plain version or glob.
+func (p Package) VersionConstraints() ([]rpmmd.VersionConstraint, error) {
+	if !p.hasVersionConstraints() {
+		return nil, nil
+	}
+
+	var constraints []rpmmd.VersionConstraint
+	for _, c := range strings.Split(p.Version, ",") {
+		c = strings.TrimSpace(c)
+
+		var constraint rpmmd.VersionConstraint
+		for _, op := range versionOperators {
+			if strings.HasPrefix(c, op) {
+				constraint.Operator = op
+				constraint.Version = strings.TrimSpace(strings.TrimPrefix(c, op))
+				break
+			}
+		}
+		if constraint.Operator == "" {
+			return nil, fmt.Errorf("constraint '%s' must start with one of >=, >, <=, <, !=, =", c)
+		}
+		if constraint.Operator == "==" {
+			constraint.Operator = rpmmd.VersionEqual
+		}
+		if constraint.Version == "" || strings.ContainsAny(constraint.Version, " *?<>=!") {
+			return nil, fmt.Errorf("constraint '%s' must compare against a single version", c)
+		}
+		constraints = append(constraints, constraint)
+	}
+
+	return constraints, nil
+}
@@ -5,6 +5,8 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/osbuild-composer/internal/rpmmd"
 )
 
 func TestDeepCopy(t *testing.T) {
@@ -43,6 +45,18 @@ func TestBlueprintInitialize(t *testing.T) {
 		{Blueprint{Name: "bp-test-5", Description: "Invalid version 5", Version: "foo"}, true},
 		{Blueprint{Name: "bp-test-7", Description: "Zero version", Version: "0.0.0"}, false},
 		{Blueprint{Name: "bp-test-8", Description: "X.Y.Z version", Version: "2.1.3"}, false},
+		{Blueprint{Name: "bp-test-9", Description: "Version range", Packages: []Package{{Name: "tmux", Version: ">= 2.9, < 3.0, != 2.9a"}}}, false},
+		{Blueprint{Name: "bp-test-10", Description: "Repo pinning", Packages: []Package{{Name: "kernel", Version: "5.8.*", Repo: "updates"}}}, false},
+		{Blueprint{Name: "bp-test-11", Description: "Invalid constraint", Packages: []Package{{Name: "tmux", Version: ">= 2.9, 3.0"}}}, true},
+		{Blueprint{Name: "bp-test-12", Description: "Constraint without version", Modules: []Package{{Name: "tmux", Version: "<"}}}, true},
+		{Blueprint{Name: "bp-test-13", Description: "Constraint with glob", Packages: []Package{{Name: "tmux", Version: ">= 2.*"}}}, true},
+		{Blueprint{Name: "bp-test-14", Description: "Excludes", Exclude: []string{"firewalld"}}, false},
+		{Blueprint{Name: "bp-test-15", Description: "Empty exclude", Exclude: []string{" "}}, true},
+		{Blueprint{Name: "bp-test-16", Description: "Module stream", Modules: []Package{{Name: "nodejs", Stream: "14", Profile: "minimal"}}}, false},
+		{Blueprint{Name: "bp-test-17", Description: "Package stream", Packages: []Package{{Name: "nodejs", Stream: "14"}}}, true},
+		{Blueprint{Name: "bp-test-18", Description: "Profile without stream", Modules: []Package{{Name: "nodejs", Profile: "minimal"}}}, true},
+		{Blueprint{Name: "bp-test-19", Description: "Stream with version", Modules: []Package{{Name: "nodejs", Stream: "14", Version: "14.1"}}}, true},
+		{Blueprint{Name: "bp-test-20", Description: "Invalid stream", Modules: []Package{{Name: "nodejs", Stream: "14/minimal"}}}, true},
 	}
 
 	for _, c := range cases {
@@ -93,3 +107,85 @@ func TestGetPackages(t *testing.T) {
 	Received_packages := bp.GetPackages()
 	assert.ElementsMatch(t, []string{"tmux-1.2", "openssh-server", "@anaconda-tools"}, Received_packages)
 }
+
+func TestVersionConstraints(t *testing.T) {
+	cases := []struct {
+		Version     string
+		Constraints []rpmmd.VersionConstraint
+		Error       bool
+	}{
+		{"", nil, false},
+		{"*", nil, false},
+		{"1.2.*", nil, false},
+		{">=1.2", []rpmmd.VersionConstraint{{Operator: ">=", Version: "1.2"}}, false},
+		{" > 1:1.2-3 , <= 2", []rpmmd.VersionConstraint{{Operator: ">", Version: "1:1.2-3"}, {Operator: "<=", Version: "2"}}, false},
+		{"== 1.2, != 1.3", []rpmmd.VersionConstraint{{Operator: "=", Version: "1.2"}, {Operator: "!=", Version: "1.3"}}, false},
+		{">= 1.2,", nil, true},
+		{"=> 1.2", nil, true},
+		{"< 1.2 1.3", nil, true},
+	}
+
+	for _, c := range cases {
+		constraints, err := Package{Name: "tmux", Version: c.Version}.VersionConstraints()
+		if c.Error {
+			assert.Errorf(t, err, "expected an error for %q", c.Version)
+			continue
+		}
+		require.NoErrorf(t, err, "unexpected error for %q", c.Version)
+		assert.Equalf(t, c.Constraints, constraints, "unexpected constraints for %q", c.Version)
+	}
+}
+
+func TestGetModuleStreams(t *testing.T) {
+	bp := Blueprint{
+		Name: "streams-test",
+		Modules: []Package{
+			{Name: "nodejs", Stream: "14", Profile: "minimal"},
+			{Name: "postgresql", Stream: "12"},
+			{Name: "tmux", Version: "2.9"}},
+	}
+	require.NoError(t, bp.Initialize())
+
+	assert.ElementsMatch(t, []string{"@nodejs:14/minimal", "@postgresql:12", "tmux-2.9"}, bp.GetPackages())
+	assert.Equal(t, []rpmmd.ModuleStream{
+		{Name: "nodejs", Stream: "14", Profile: "minimal"},
+		{Name: "postgresql", Stream: "12"},
+	}, bp.GetModuleStreams())
+	assert.Empty(t, bp.GetPackageSelectors())
+}
+
+func TestGetPackageSelectors(t *testing.T) {
+	bp := Blueprint{
+		Name: "selectors-test",
+		Packages: []Package{
+			{Name: "tmux", Version: "1.2"},
+			{Name: "kernel", Version: "5.8.*", Repo: "updates"},
+			{Name: "vim-enhanced", Version: ">= 8.2, != 8.2.1"}},
+		Modules: []Package{
+			{Name: "openssh-server", Repo: "base"}},
+		Exclude: []string{"firewalld"},
+	}
+	require.NoError(t, bp.Initialize())
+
+	assert.ElementsMatch(t, []string{"tmux-1.2"}, bp.GetPackages())
+	assert.Equal(t, []string{"firewalld"}, bp.GetExcludes())
+	assert.Equal(t, []rpmmd.PackageSelector{
+		{Spec: "kernel-5.8.*", Repo: "updates"},
+		{Spec: "vim-enhanced", Constraints: []rpmmd.VersionConstraint{{Operator: ">=", Version: "8.2"}, {Operator: "!=", Version: "8.2.1"}}},
+		{Spec: "openssh-server", Repo: "base"},
+	}, bp.GetPackageSelectors())
+}
+
+func TestGetPackageSelectorsKeepsPackages(t *testing.T) {
+	// packages with spare capacity, whose backing array is shared
+	all := []Package{{Name: "tmux"}, {Name: "vim-enhanced"}}
+	bp := Blueprint{
+		Name:     "selectors-test",
+		Packages: all[:1],
+		Modules:  []Package{{Name: "openssh-server", Repo: "base"}},
+	}
+	require.NoError(t, bp.Initialize())
+
+	assert.Equal(t, []rpmmd.PackageSelector{{Spec: "openssh-server", Repo: "base"}}, bp.GetPackageSelectors())
+	assert.Equal(t, "vim-enhanced", all[1].Name)
+}
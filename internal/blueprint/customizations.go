@@ -1,15 +1,16 @@
 package blueprint
 
 type Customizations struct {
-	Hostname *string                `json:"hostname,omitempty" toml:"hostname,omitempty"`
-	Kernel   *KernelCustomization   `json:"kernel,omitempty" toml:"kernel,omitempty"`
-	SSHKey   []SSHKeyCustomization  `json:"sshkey,omitempty" toml:"sshkey,omitempty"`
-	User     []UserCustomization    `json:"user,omitempty" toml:"user,omitempty"`
-	Group    []GroupCustomization   `json:"group,omitempty" toml:"group,omitempty"`
-	Timezone *TimezoneCustomization `json:"timezone,omitempty" toml:"timezone,omitempty"`
-	Locale   *LocaleCustomization   `json:"locale,omitempty" toml:"locale,omitempty"`
-	Firewall *FirewallCustomization `json:"firewall,omitempty" toml:"firewall,omitempty"`
-	Services *ServicesCustomization `json:"services,omitempty" toml:"services,omitempty"`
+	Hostname  *string                 `json:"hostname,omitempty" toml:"hostname,omitempty"`
+	Kernel    *KernelCustomization    `json:"kernel,omitempty" toml:"kernel,omitempty"`
+	SSHKey    []SSHKeyCustomization   `json:"sshkey,omitempty" toml:"sshkey,omitempty"`
+	User      []UserCustomization     `json:"user,omitempty" toml:"user,omitempty"`
+	Group     []GroupCustomization    `json:"group,omitempty" toml:"group,omitempty"`
+	Timezone  *TimezoneCustomization  `json:"timezone,omitempty" toml:"timezone,omitempty"`
+	Locale    *LocaleCustomization    `json:"locale,omitempty" toml:"locale,omitempty"`
+	Firewall  *FirewallCustomization  `json:"firewall,omitempty" toml:"firewall,omitempty"`
+	Services  *ServicesCustomization  `json:"services,omitempty" toml:"services,omitempty"`
+	Container *ContainerCustomization `json:"container,omitempty" toml:"container,omitempty"`
 }
 
 type KernelCustomization struct {
@@ -63,6 +64,14 @@ type ServicesCustomization struct {
 	Disabled []string `json:"disabled,omitempty" toml:"disabled,omitempty"`
 }
 
+// ContainerCustomization is the config of container images
+type ContainerCustomization struct {
+	Entrypoint []string          `json:"entrypoint,omitempty" toml:"entrypoint,omitempty" merge:"replace"`
+	Env        []string          `json:"env,omitempty" toml:"env,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty" toml:"labels,omitempty"`
+	User       string            `json:"user,omitempty" toml:"user,omitempty"`
+}
+
 type CustomizationError struct {
 	Message string
 }
@@ -176,3 +185,11 @@ func (c *Customizations) GetServices() *ServicesCustomization {
 
 	return c.Services
 }
+
+func (c *Customizations) GetContainer() *ContainerCustomization {
+	if c == nil {
+		return nil
+	}
+
+	return c.Container
+}
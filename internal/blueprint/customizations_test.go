@@ -195,6 +195,24 @@ func TestGetServices(t *testing.T) {
 	assert.ElementsMatch(t, expectedServices.Disabled, retServices.Disabled)
 }
 
+func TestGetContainer(t *testing.T) {
+
+	expectedContainer := ContainerCustomization{
+		Entrypoint: []string{"/usr/bin/httpd", "-DFOREGROUND"},
+		Env:        []string{"LANG=C.UTF-8"},
+		Labels:     map[string]string{"vendor": "test"},
+		User:       "apache",
+	}
+
+	TestCustomizations := Customizations{
+		Container: &expectedContainer,
+	}
+
+	retContainer := TestCustomizations.GetContainer()
+
+	assert.Equal(t, &expectedContainer, retContainer)
+}
+
 func TestError(t *testing.T) {
 	expectedError := CustomizationError{
 		Message: "test error",
@@ -217,6 +235,7 @@ func TestNoCustomizationsInBlueprint(t *testing.T) {
 	assert.Nil(t, TestBP.Customizations.GetKernel())
 	assert.Nil(t, TestBP.Customizations.GetFirewall())
 	assert.Nil(t, TestBP.Customizations.GetServices())
+	assert.Nil(t, TestBP.Customizations.GetContainer())
 
 	nilLanguage, nilKeyboard := TestBP.Customizations.GetPrimaryLocale()
 	assert.Nil(t, nilLanguage)
@@ -0,0 +1,196 @@
+package blueprint
+
+import (
+	"reflect"
+	"strings"
+)
+
+// DiffType is the kind of a difference between two blueprints
+type DiffType string
+
+const (
+	DiffAdded   DiffType = "added"
+	DiffRemoved DiffType = "removed"
+	DiffChanged DiffType = "changed"
+)
+
+// A DiffEntry is a single difference between two blueprints.
+//
+// Section names the part of the blueprint which differs, in the format
+// lorax-composer used: "Name", "Description", and "Version" for the fields
+// of the same name, "Package", "Module", and "Group" for entries of the
+// respective lists, and "Customizations.<key>" for customizations, with a
+// dot-separated path for nested ones (for example,
+// "Customizations.firewall.ports").
+//
+// Old is nil for added entries, and New is nil for removed ones. Entries of
+// lists are compared by their name. Entries of lists without names, like SSH
+// keys, and of lists of strings are either added or removed.
+type DiffEntry struct {
+	Type    DiffType
+	Section string
+	Old     interface{}
+	New     interface{}
+}
+
+// Diff returns the differences between two blueprints, in the order of the
+// fields of the blueprint
+func Diff(old, new *Blueprint) []DiffEntry {
+	var entries []DiffEntry
+	diffStruct(&entries, "", reflect.ValueOf(*old), reflect.ValueOf(*new))
+	return entries
+}
+
+// sectionName returns the name of the section of a field in a struct which
+// has the section `prefix`
+func sectionName(prefix string, field reflect.StructField) string {
+	if prefix != "" {
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		return prefix + "." + name
+	}
+
+	// the lists of the blueprint are named after their entries
+	if field.Type.Kind() == reflect.Slice {
+		return strings.TrimSuffix(field.Name, "s")
+	}
+	return field.Name
+}
+
+func diffStruct(entries *[]DiffEntry, prefix string, old, new reflect.Value) {
+	for i := 0; i < old.NumField(); i++ {
+		field := old.Type().Field(i)
+		if field.Tag.Get("json") == "-" {
+			continue
+		}
+		diffValue(entries, sectionName(prefix, field), old.Field(i), new.Field(i))
+	}
+}
+
+func diffValue(entries *[]DiffEntry, section string, old, new reflect.Value) {
+	switch old.Kind() {
+	case reflect.Ptr:
+		if old.IsNil() && new.IsNil() {
+			return
+		}
+
+		// Compare nested customizations field by field, as if the missing
+		// one was empty
+		if old.Type().Elem().Kind() == reflect.Struct {
+			zero := reflect.Zero(old.Type().Elem())
+			oldElem, newElem := zero, zero
+			if !old.IsNil() {
+				oldElem = old.Elem()
+			}
+			if !new.IsNil() {
+				newElem = new.Elem()
+			}
+			diffStruct(entries, section, oldElem, newElem)
+			return
+		}
+
+		var oldValue, newValue interface{}
+		if !old.IsNil() {
+			oldValue = old.Elem().Interface()
+		}
+		if !new.IsNil() {
+			newValue = new.Elem().Interface()
+		}
+		diffScalar(entries, section, oldValue, newValue)
+
+	case reflect.Slice:
+		if isNamed(old.Type().Elem()) {
+			diffKeyedList(entries, section, old, new)
+		} else {
+			diffSet(entries, section, old, new)
+		}
+
+	default:
+		var oldValue, newValue interface{}
+		if !old.IsZero() {
+			oldValue = old.Interface()
+		}
+		if !new.IsZero() {
+			newValue = new.Interface()
+		}
+		diffScalar(entries, section, oldValue, newValue)
+	}
+}
+
+// diffScalar compares two values, which are nil if they are not set
+func diffScalar(entries *[]DiffEntry, section string, old, new interface{}) {
+	switch {
+	case old == nil && new == nil:
+		return
+	case old == nil:
+		*entries = append(*entries, DiffEntry{DiffAdded, section, nil, new})
+	case new == nil:
+		*entries = append(*entries, DiffEntry{DiffRemoved, section, old, nil})
+	case !reflect.DeepEqual(old, new):
+		*entries = append(*entries, DiffEntry{DiffChanged, section, old, new})
+	}
+}
+
+// isNamed returns true if values of type `t` are structs with a Name field
+func isNamed(t reflect.Type) bool {
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+	_, ok := t.FieldByName("Name")
+	return ok
+}
+
+// diffKeyedList compares two lists of structs, whose entries are identified
+// by their Name field. Added and changed entries are returned in the order
+// of the new list, followed by removed entries in the order of the old one.
+func diffKeyedList(entries *[]DiffEntry, section string, old, new reflect.Value) {
+	key := func(v reflect.Value) interface{} {
+		return v.FieldByName("Name").Interface()
+	}
+
+	oldEntries := make(map[interface{}]reflect.Value)
+	for i := 0; i < old.Len(); i++ {
+		oldEntries[key(old.Index(i))] = old.Index(i)
+	}
+	newKeys := make(map[interface{}]bool)
+
+	for i := 0; i < new.Len(); i++ {
+		entry := new.Index(i)
+		newKeys[key(entry)] = true
+		oldEntry, exists := oldEntries[key(entry)]
+		if !exists {
+			*entries = append(*entries, DiffEntry{DiffAdded, section, nil, entry.Interface()})
+		} else if !reflect.DeepEqual(oldEntry.Interface(), entry.Interface()) {
+			*entries = append(*entries, DiffEntry{DiffChanged, section, oldEntry.Interface(), entry.Interface()})
+		}
+	}
+
+	for i := 0; i < old.Len(); i++ {
+		entry := old.Index(i)
+		if !newKeys[key(entry)] {
+			*entries = append(*entries, DiffEntry{DiffRemoved, section, entry.Interface(), nil})
+		}
+	}
+}
+
+// diffSet compares two lists of values, whose order doesn't matter
+func diffSet(entries *[]DiffEntry, section string, old, new reflect.Value) {
+	contains := func(list reflect.Value, v interface{}) bool {
+		for i := 0; i < list.Len(); i++ {
+			if reflect.DeepEqual(list.Index(i).Interface(), v) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for i := 0; i < new.Len(); i++ {
+		if v := new.Index(i).Interface(); !contains(old, v) {
+			*entries = append(*entries, DiffEntry{DiffAdded, section, nil, v})
+		}
+	}
+	for i := 0; i < old.Len(); i++ {
+		if v := old.Index(i).Interface(); !contains(new, v) {
+			*entries = append(*entries, DiffEntry{DiffRemoved, section, v, nil})
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package blueprint
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	hostname := "my-host"
+	uid := 1000
+	newUID := 1001
+
+	old := Blueprint{
+		Name:        "test",
+		Description: "Test",
+		Version:     "0.0.1",
+		Packages: []Package{
+			{Name: "httpd", Version: "2.4.*"},
+			{Name: "tmux", Version: "*"},
+		},
+		Exclude: []string{"nano"},
+		Customizations: &Customizations{
+			Hostname: &hostname,
+			User:     []UserCustomization{{Name: "admin", UID: &uid}},
+			Firewall: &FirewallCustomization{Ports: []string{"22:tcp"}},
+		},
+	}
+
+	new := Blueprint{
+		Name:        "test",
+		Description: "Test",
+		Version:     "0.0.2",
+		Packages: []Package{
+			{Name: "tmux", Version: "3.*"},
+			{Name: "systemd", Version: "*"},
+		},
+		Exclude: []string{"nano"},
+		Customizations: &Customizations{
+			User:     []UserCustomization{{Name: "admin", UID: &newUID}},
+			SSHKey:   []SSHKeyCustomization{{User: "root", Key: "ssh-rsa"}},
+			Firewall: &FirewallCustomization{Ports: []string{"443:tcp"}},
+			Services: &ServicesCustomization{Enabled: []string{"sshd"}},
+		},
+	}
+
+	expected := []DiffEntry{
+		{DiffChanged, "Version", "0.0.1", "0.0.2"},
+		{DiffChanged, "Package", Package{Name: "tmux", Version: "*"}, Package{Name: "tmux", Version: "3.*"}},
+		{DiffAdded, "Package", nil, Package{Name: "systemd", Version: "*"}},
+		{DiffRemoved, "Package", Package{Name: "httpd", Version: "2.4.*"}, nil},
+		{DiffRemoved, "Customizations.hostname", "my-host", nil},
+		{DiffAdded, "Customizations.sshkey", nil, SSHKeyCustomization{User: "root", Key: "ssh-rsa"}},
+		{DiffChanged, "Customizations.user", UserCustomization{Name: "admin", UID: &uid}, UserCustomization{Name: "admin", UID: &newUID}},
+		{DiffAdded, "Customizations.firewall.ports", nil, "443:tcp"},
+		{DiffRemoved, "Customizations.firewall.ports", "22:tcp", nil},
+		{DiffAdded, "Customizations.services.enabled", nil, "sshd"},
+	}
+	require.Equal(t, expected, Diff(&old, &new))
+
+	// a user can have several SSH keys
+	withKeys := func(keys ...SSHKeyCustomization) *Blueprint {
+		return &Blueprint{Customizations: &Customizations{SSHKey: keys}}
+	}
+	first := SSHKeyCustomization{User: "root", Key: "ssh-rsa first"}
+	second := SSHKeyCustomization{User: "root", Key: "ssh-rsa second"}
+	require.Equal(t, []DiffEntry{
+		{DiffAdded, "Customizations.sshkey", nil, second},
+	}, Diff(withKeys(first), withKeys(first, second)))
+	require.Equal(t, []DiffEntry{
+		{DiffAdded, "Customizations.sshkey", nil, second},
+		{DiffRemoved, "Customizations.sshkey", first, nil},
+	}, Diff(withKeys(first), withKeys(second)))
+	require.Empty(t, Diff(withKeys(first, second), withKeys(second, first)))
+
+	require.Empty(t, Diff(&old, &old))
+	require.Empty(t, Diff(&Blueprint{}, &Blueprint{Customizations: &Customizations{}}))
+}
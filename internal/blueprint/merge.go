@@ -0,0 +1,127 @@
+package blueprint
+
+import (
+	"reflect"
+)
+
+// Merge returns bp with the blueprint it includes, base, merged into it:
+//
+//   - Name, Description, Version, and Include are always bp's.
+//   - Other values, like Distro or the hostname, are bp's if it sets them,
+//     and base's otherwise.
+//   - Lists of entries with a name (packages, modules, groups, users, ...)
+//     contain the entries of both blueprints. An entry of bp replaces the
+//     entry of base with the same name.
+//   - Other lists (SSH keys, excluded packages, firewall ports, enabled
+//     services, ...) contain the values of both blueprints.
+//   - Lists whose order matters, like the entrypoint of containers, are
+//     bp's if it sets them, and base's otherwise.
+//   - Maps, like the labels of containers, contain the entries of both
+//     blueprints. bp's entries replace base's entries with the same key.
+//   - Customizations are merged section by section, following these rules.
+//
+// Entries which only base has come first in lists.
+func Merge(base, bp Blueprint) Blueprint {
+	base = base.DeepCopy()
+	merged := bp.DeepCopy()
+
+	mergedValue := reflect.ValueOf(&merged).Elem()
+	baseValue := reflect.ValueOf(base)
+	for i := 0; i < mergedValue.NumField(); i++ {
+		switch mergedValue.Type().Field(i).Name {
+		case "Name", "Description", "Version", "Include":
+			continue
+		}
+		mergeValue(mergedValue.Field(i), baseValue.Field(i))
+	}
+
+	return merged
+}
+
+// mergeValue merges base into dst, which must be settable
+func mergeValue(dst, base reflect.Value) {
+	switch dst.Kind() {
+	case reflect.Ptr:
+		if base.IsNil() {
+			return
+		}
+		if dst.IsNil() {
+			dst.Set(base)
+			return
+		}
+		if dst.Elem().Kind() == reflect.Struct {
+			for i := 0; i < dst.Elem().NumField(); i++ {
+				field := dst.Elem().Field(i)
+				if dst.Elem().Type().Field(i).Tag.Get("merge") == "replace" {
+					if field.IsZero() {
+						field.Set(base.Elem().Field(i))
+					}
+					continue
+				}
+				mergeValue(field, base.Elem().Field(i))
+			}
+		}
+
+	case reflect.Slice:
+		if base.Len() == 0 {
+			return
+		}
+		if isNamed(dst.Type().Elem()) {
+			mergeKeyedList(dst, base)
+		} else {
+			mergeSet(dst, base)
+		}
+
+	case reflect.Map:
+		if base.Len() == 0 {
+			return
+		}
+		if dst.IsNil() {
+			dst.Set(reflect.MakeMap(dst.Type()))
+		}
+		iter := base.MapRange()
+		for iter.Next() {
+			if !dst.MapIndex(iter.Key()).IsValid() {
+				dst.SetMapIndex(iter.Key(), iter.Value())
+			}
+		}
+
+	default:
+		if dst.IsZero() {
+			dst.Set(base)
+		}
+	}
+}
+
+// mergeKeyedList prepends the entries of base to dst, whose name doesn't
+// match the one of any entry of dst
+func mergeKeyedList(dst, base reflect.Value) {
+	keys := make(map[interface{}]bool)
+	for i := 0; i < dst.Len(); i++ {
+		keys[dst.Index(i).FieldByName("Name").Interface()] = true
+	}
+
+	merged := reflect.MakeSlice(dst.Type(), 0, dst.Len()+base.Len())
+	for i := 0; i < base.Len(); i++ {
+		if !keys[base.Index(i).FieldByName("Name").Interface()] {
+			merged = reflect.Append(merged, base.Index(i))
+		}
+	}
+	dst.Set(reflect.AppendSlice(merged, dst))
+}
+
+// mergeSet prepends the values of base to dst, which dst doesn't contain
+func mergeSet(dst, base reflect.Value) {
+	values := make(map[interface{}]bool)
+	for i := 0; i < dst.Len(); i++ {
+		values[dst.Index(i).Interface()] = true
+	}
+
+	merged := reflect.MakeSlice(dst.Type(), 0, dst.Len()+base.Len())
+	for i := 0; i < base.Len(); i++ {
+		if !values[base.Index(i).Interface()] {
+			merged = reflect.Append(merged, base.Index(i))
+		}
+	}
+	dst.Set(reflect.AppendSlice(merged, dst))
+}
@@ -0,0 +1,130 @@
+package blueprint
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMerge(t *testing.T) {
+	baseHostname := "base-host"
+	baseKeyboard := "us"
+	shell := "/bin/zsh"
+
+	base := Blueprint{
+		Name:        "base",
+		Description: "Base",
+		Version:     "1.0.0",
+		Distro:      "fedora-32",
+		Packages: []Package{
+			{Name: "httpd", Version: "2.4.*"},
+			{Name: "tmux", Version: "*"},
+		},
+		Groups:  []Group{{Name: "core"}},
+		Exclude: []string{"nano"},
+		Customizations: &Customizations{
+			Hostname: &baseHostname,
+			User:     []UserCustomization{{Name: "admin"}, {Name: "monitor"}},
+			Locale:   &LocaleCustomization{Languages: []string{"en_US.UTF-8"}, Keyboard: &baseKeyboard},
+			Firewall: &FirewallCustomization{Ports: []string{"22:tcp"}},
+		},
+	}
+
+	bp := Blueprint{
+		Name:     "test",
+		Version:  "0.0.1",
+		Include:  []string{"base"},
+		Packages: []Package{{Name: "tmux", Version: "3.*"}},
+		Exclude:  []string{"vim", "nano"},
+		Customizations: &Customizations{
+			User:     []UserCustomization{{Name: "admin", Shell: &shell}},
+			Locale:   &LocaleCustomization{Languages: []string{"de_DE.UTF-8"}},
+			Firewall: &FirewallCustomization{Ports: []string{"443:tcp"}},
+		},
+	}
+
+	expected := Blueprint{
+		Name:     "test",
+		Version:  "0.0.1",
+		Distro:   "fedora-32",
+		Include:  []string{"base"},
+		Packages: []Package{{Name: "httpd", Version: "2.4.*"}, {Name: "tmux", Version: "3.*"}},
+		Groups:   []Group{{Name: "core"}},
+		Exclude:  []string{"vim", "nano"},
+		Customizations: &Customizations{
+			Hostname: &baseHostname,
+			User:     []UserCustomization{{Name: "monitor"}, {Name: "admin", Shell: &shell}},
+			Locale:   &LocaleCustomization{Languages: []string{"en_US.UTF-8", "de_DE.UTF-8"}, Keyboard: &baseKeyboard},
+			Firewall: &FirewallCustomization{Ports: []string{"22:tcp", "443:tcp"}},
+		},
+	}
+
+	merged := Merge(base, bp)
+	require.Equal(t, expected, merged)
+
+	// neither blueprint is modified
+	require.Len(t, base.Packages, 2)
+	require.Equal(t, "3.*", bp.Packages[0].Version)
+	require.Nil(t, bp.Customizations.Hostname)
+	merged.Customizations.User[0].Name = "changed"
+	require.Equal(t, "monitor", base.Customizations.User[1].Name)
+
+	// merging an empty base doesn't change the blueprint
+	require.Equal(t, bp, Merge(Blueprint{}, bp))
+}
+
+func TestMergeSSHKeys(t *testing.T) {
+	base := Blueprint{
+		Customizations: &Customizations{
+			SSHKey: []SSHKeyCustomization{{User: "root", Key: "ssh-rsa base"}, {User: "admin", Key: "ssh-rsa admin"}},
+		},
+	}
+	bp := Blueprint{
+		Customizations: &Customizations{
+			SSHKey: []SSHKeyCustomization{{User: "root", Key: "ssh-rsa test"}, {User: "admin", Key: "ssh-rsa admin"}},
+		},
+	}
+
+	// a user keeps the keys of both blueprints
+	merged := Merge(base, bp)
+	require.Equal(t, []SSHKeyCustomization{
+		{User: "root", Key: "ssh-rsa base"},
+		{User: "root", Key: "ssh-rsa test"},
+		{User: "admin", Key: "ssh-rsa admin"},
+	}, merged.Customizations.SSHKey)
+}
+
+func TestMergeContainer(t *testing.T) {
+	base := Blueprint{
+		Customizations: &Customizations{
+			Container: &ContainerCustomization{
+				Entrypoint: []string{"/bin/sh", "-c"},
+				Env:        []string{"LANG=C.UTF-8"},
+				Labels:     map[string]string{"vendor": "base", "license": "MIT"},
+				User:       "nobody",
+			},
+		},
+	}
+
+	bp := Blueprint{
+		Customizations: &Customizations{
+			Container: &ContainerCustomization{
+				Entrypoint: []string{"/usr/bin/httpd", "-DFOREGROUND"},
+				Labels:     map[string]string{"vendor": "test"},
+			},
+		},
+	}
+
+	merged := Merge(base, bp)
+	require.Equal(t, &ContainerCustomization{
+		Entrypoint: []string{"/usr/bin/httpd", "-DFOREGROUND"},
+		Env:        []string{"LANG=C.UTF-8"},
+		Labels:     map[string]string{"vendor": "test", "license": "MIT"},
+		User:       "nobody",
+	}, merged.Customizations.Container)
+	require.Equal(t, map[string]string{"vendor": "test"}, bp.Customizations.Container.Labels)
+
+	merged = Merge(base, Blueprint{Customizations: &Customizations{Container: &ContainerCustomization{User: "root"}}})
+	require.Equal(t, []string{"/bin/sh", "-c"}, merged.Customizations.Container.Entrypoint)
+	require.Equal(t, "root", merged.Customizations.Container.User)
+}
@@ -0,0 +1,209 @@
+package blueprint
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Types of blueprint variables
+const (
+	VariableTypeString  = "string"
+	VariableTypeInteger = "integer"
+	VariableTypeBoolean = "boolean"
+)
+
+// A Variable is a value a blueprint is parameterized with. Customizations
+// reference variables as ${name} in their strings, and the values are given
+// when composing the blueprint. Type is one of "string" (the default),
+// "integer", or "boolean", and is checked before the value is substituted.
+// Variables without a Default must be given a value.
+type Variable struct {
+	Name        string  `json:"name" toml:"name"`
+	Type        string  `json:"type,omitempty" toml:"type,omitempty"`
+	Description string  `json:"description,omitempty" toml:"description,omitempty"`
+	Default     *string `json:"default,omitempty" toml:"default,omitempty"`
+}
+
+var variableNameRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// variableReferenceRegex matches references to variables in customizations
+var variableReferenceRegex = regexp.MustCompile(`\$\{([a-zA-Z_][a-zA-Z0-9_]*)\}`)
+
+// validateType returns an error if the variable has an unknown type
+func (v *Variable) validateType() error {
+	switch v.Type {
+	case "", VariableTypeString, VariableTypeInteger, VariableTypeBoolean:
+		return nil
+	}
+	return fmt.Errorf("variable '%s' has unknown type '%s'", v.Name, v.Type)
+}
+
+// validate returns an error if `value` is not of the variable's type
+func (v *Variable) validate(value string) error {
+	if err := v.validateType(); err != nil {
+		return err
+	}
+
+	switch v.Type {
+	case VariableTypeInteger:
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return fmt.Errorf("variable '%s' must be an integer, not '%s'", v.Name, value)
+		}
+	case VariableTypeBoolean:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("variable '%s' must be a boolean, not '%s'", v.Name, value)
+		}
+	}
+	return nil
+}
+
+// validateVariables checks the declarations of the blueprint's variables and
+// that its customizations only reference declared variables
+func (b *Blueprint) validateVariables() error {
+	declared := make(map[string]bool)
+	for _, v := range b.Variables {
+		if !variableNameRegex.MatchString(v.Name) {
+			return fmt.Errorf("Invalid variable name '%s'", v.Name)
+		}
+		if declared[v.Name] {
+			return fmt.Errorf("Variable '%s' is declared more than once", v.Name)
+		}
+		declared[v.Name] = true
+
+		err := v.validateType()
+		if err == nil && v.Default != nil {
+			err = v.validate(*v.Default)
+		}
+		if err != nil {
+			return fmt.Errorf("Invalid variable: %v", err)
+		}
+	}
+
+	for _, name := range b.variableReferences() {
+		if !declared[name] {
+			return fmt.Errorf("Customizations reference undeclared variable '%s'", name)
+		}
+	}
+	return nil
+}
+
+// variableReferences returns the names of the variables the customizations
+// of the blueprint reference, sorted
+func (b *Blueprint) variableReferences() []string {
+	seen := make(map[string]bool)
+	if b.Customizations != nil {
+		forEachString(reflect.ValueOf(b.Customizations).Elem(), func(s reflect.Value) {
+			for _, match := range variableReferenceRegex.FindAllStringSubmatch(s.String(), -1) {
+				seen[match[1]] = true
+			}
+		})
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// VariableValues returns the values of all variables of the blueprint, given
+// the values of a compose request. It returns an error if a value is given
+// for a variable the blueprint does not declare, if a variable without a
+// default is missing, or if a value is not of the variable's type. It
+// returns nil for blueprints without variables.
+func (b *Blueprint) VariableValues(values map[string]string) (map[string]string, error) {
+	var resolved map[string]string
+	if len(b.Variables) > 0 {
+		resolved = make(map[string]string)
+	}
+	var errs []string
+
+	declared := make(map[string]bool)
+	for _, v := range b.Variables {
+		declared[v.Name] = true
+
+		value, ok := values[v.Name]
+		if !ok {
+			if v.Default == nil {
+				errs = append(errs, fmt.Sprintf("variable '%s' requires a value", v.Name))
+				continue
+			}
+			value = *v.Default
+		}
+		if err := v.validate(value); err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		resolved[v.Name] = value
+	}
+
+	var unknown []string
+	for name := range values {
+		if !declared[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		errs = append(errs, fmt.Sprintf("blueprint has no variable '%s'", name))
+	}
+
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return resolved, nil
+}
+
+// SubstituteVariables returns a copy of the blueprint, in whose
+// customizations the references to variables are replaced by their values.
+// The values should be the ones VariableValues() returned.
+func (b *Blueprint) SubstituteVariables(values map[string]string) (Blueprint, error) {
+	bp := b.DeepCopy()
+	if bp.Customizations == nil {
+		return bp, nil
+	}
+
+	var missing []string
+	forEachString(reflect.ValueOf(bp.Customizations).Elem(), func(s reflect.Value) {
+		s.SetString(variableReferenceRegex.ReplaceAllStringFunc(s.String(), func(ref string) string {
+			name := variableReferenceRegex.FindStringSubmatch(ref)[1]
+			value, ok := values[name]
+			if !ok {
+				missing = append(missing, name)
+				return ref
+			}
+			return value
+		}))
+	})
+
+	if len(missing) > 0 {
+		return Blueprint{}, fmt.Errorf("no value for variable '%s'", missing[0])
+	}
+	return bp, nil
+}
+
+// forEachString calls f on every settable string in v, which is a struct or
+// a value in one
+func forEachString(v reflect.Value, f func(reflect.Value)) {
+	switch v.Kind() {
+	case reflect.String:
+		f(v)
+	case reflect.Ptr:
+		if !v.IsNil() {
+			forEachString(v.Elem(), f)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			forEachString(v.Index(i), f)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			forEachString(v.Field(i), f)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package blueprint
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVariablesInitialize(t *testing.T) {
+	zero := "0"
+	notANumber := "many"
+	reference := "${hostname}"
+
+	cases := []struct {
+		Name      string
+		Variables []Variable
+		Hostname  *string
+		Error     string
+	}{
+		{"valid", []Variable{{Name: "hostname"}, {Name: "count", Type: VariableTypeInteger, Default: &zero}}, &reference, ""},
+		{"invalid name", []Variable{{Name: "host-name"}}, nil, "Invalid variable name 'host-name'"},
+		{"duplicate", []Variable{{Name: "hostname"}, {Name: "hostname"}}, nil, "Variable 'hostname' is declared more than once"},
+		{"unknown type", []Variable{{Name: "hostname", Type: "float"}}, nil, "Invalid variable: variable 'hostname' has unknown type 'float'"},
+		{"invalid default", []Variable{{Name: "count", Type: VariableTypeInteger, Default: &notANumber}}, nil, "Invalid variable: variable 'count' must be an integer, not 'many'"},
+		{"undeclared", nil, &reference, "Customizations reference undeclared variable 'hostname'"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			bp := Blueprint{
+				Name:           "test",
+				Variables:      c.Variables,
+				Customizations: &Customizations{Hostname: c.Hostname},
+			}
+			err := bp.Initialize()
+			if c.Error == "" {
+				require.NoError(t, err)
+			} else {
+				require.EqualError(t, err, c.Error)
+			}
+		})
+	}
+}
+
+func TestVariableSubstitution(t *testing.T) {
+	defaultNTP := "ntp.example.com"
+	hostname := "${hostname}"
+	bp := Blueprint{
+		Name: "test",
+		Variables: []Variable{
+			{Name: "hostname"},
+			{Name: "ntp_server", Default: &defaultNTP},
+			{Name: "admin_key"},
+			{Name: "ports", Type: VariableTypeInteger},
+		},
+		Customizations: &Customizations{
+			Hostname: &hostname,
+			Timezone: &TimezoneCustomization{NTPServers: []string{"${ntp_server}", "pool.example.com"}},
+			SSHKey:   []SSHKeyCustomization{{User: "admin", Key: "${admin_key}"}},
+			Firewall: &FirewallCustomization{Ports: []string{"${ports}:tcp"}},
+		},
+	}
+	require.NoError(t, bp.Initialize())
+
+	_, err := bp.VariableValues(map[string]string{"hostname": "web-1", "ports": "http"})
+	require.EqualError(t, err, "variable 'admin_key' requires a value; variable 'ports' must be an integer, not 'http'")
+
+	values, err := bp.VariableValues(map[string]string{"hostname": "web-1", "admin_key": "ssh-ed25519 AAAA", "ports": "8080"})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"hostname":   "web-1",
+		"ntp_server": "ntp.example.com",
+		"admin_key":  "ssh-ed25519 AAAA",
+		"ports":      "8080",
+	}, values)
+
+	substituted, err := bp.SubstituteVariables(values)
+	require.NoError(t, err)
+	require.Equal(t, "web-1", *substituted.Customizations.Hostname)
+	require.Equal(t, []string{"ntp.example.com", "pool.example.com"}, substituted.Customizations.Timezone.NTPServers)
+	require.Equal(t, "ssh-ed25519 AAAA", substituted.Customizations.SSHKey[0].Key)
+	require.Equal(t, []string{"8080:tcp"}, substituted.Customizations.Firewall.Ports)
+
+	// the blueprint itself is not modified
+	require.Equal(t, "${hostname}", *bp.Customizations.Hostname)
+
+	_, err = bp.SubstituteVariables(map[string]string{"hostname": "web-1"})
+	require.EqualError(t, err, "no value for variable 'admin_key'")
+
+	values, err = (&Blueprint{}).VariableValues(nil)
+	require.NoError(t, err)
+	require.Nil(t, values)
+}
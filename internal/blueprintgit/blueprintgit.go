@@ -0,0 +1,376 @@
+// Package blueprintgit keeps blueprints in a git repository, like
+// lorax-composer did: each blueprint is a TOML file named after it in the
+// top-level directory of the repository, each change to it is a commit, and
+// each of its revisions is a tag. It implements store.BlueprintRepository.
+//
+// A repository can follow a branch of an upstream repository. Pulling merges
+// the upstream changes into the local branch, with the upstream version of
+// each changed blueprint taking precedence over the local one.
+package blueprintgit
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/osbuild/osbuild-composer/internal/blueprint"
+	"github.com/osbuild/osbuild-composer/internal/store"
+)
+
+const (
+	// the branch blueprints are committed to
+	localBranch = "master"
+
+	// points to the upstream commit which was pulled last
+	pulledRef = "refs/osbuild-composer/pulled"
+
+	// points to the upstream commit which was fetched last
+	fetchedRef = "refs/osbuild-composer/fetched"
+
+	// how long fetching from the upstream repository may take
+	fetchTimeout = 5 * time.Minute
+
+	// the hash of git's empty tree
+	emptyTree = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+)
+
+type Repository struct {
+	dir    string
+	remote string
+	branch string
+
+	mu      sync.Mutex
+	fetchMu sync.Mutex
+}
+
+// Open opens the git repository in dir, initializing it if it doesn't exist
+// yet. If remote is not empty, Fetch() and Merge() follow `branch` of the repository at
+// that path or URL.
+func Open(dir, remote, branch string) (*Repository, error) {
+	r := &Repository{
+		dir:    dir,
+		remote: remote,
+		branch: branch,
+	}
+
+	_, err := os.Stat(path.Join(dir, ".git"))
+	if err == nil {
+		return r, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+	_, err = r.git("init", "-q")
+	if err != nil {
+		return nil, err
+	}
+	_, err = r.git("symbolic-ref", "HEAD", "refs/heads/"+localBranch)
+	if err != nil {
+		return nil, err
+	}
+	_, err = r.git("commit", "-q", "--allow-empty", "-m", "Initialize blueprint repository")
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func fileName(name string) string {
+	return name + ".toml"
+}
+
+// Commit writes bp to its file and commits it, even if it did not change
+func (r *Repository) Commit(bp blueprint.Blueprint, message string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var buf bytes.Buffer
+	err := toml.NewEncoder(&buf).Encode(bp)
+	if err != nil {
+		return "", err
+	}
+	err = ioutil.WriteFile(path.Join(r.dir, fileName(bp.Name)), buf.Bytes(), 0600)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = r.git("add", "--", fileName(bp.Name))
+	if err != nil {
+		return "", err
+	}
+	_, err = r.git("commit", "-q", "--allow-empty", "-m", message)
+	if err != nil {
+		return "", err
+	}
+
+	return r.revParse("HEAD")
+}
+
+// Delete removes the file of a blueprint in a new commit, if the repository
+// has it
+func (r *Repository) Delete(name, message string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	files, err := r.git("ls-files", "--", fileName(name))
+	if err != nil || files == "" {
+		return err
+	}
+
+	_, err = r.git("rm", "-q", "--", fileName(name))
+	if err != nil {
+		return err
+	}
+	_, err = r.git("commit", "-q", "-m", message)
+	return err
+}
+
+// Tag tags a commit with the revision of a blueprint, in the format lorax
+// used: "master/<name>.toml/r<revision>". Commits which are not part of the
+// repository, because they were made before the store had a repository, are
+// not tagged.
+func (r *Repository) Tag(name, commit string, revision int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, err := r.git("cat-file", "-e", commit+"^{commit}")
+	if err != nil {
+		return nil
+	}
+
+	tag := fmt.Sprintf("%s/%s/r%d", localBranch, fileName(name), revision)
+	_, err = r.git("tag", tag, commit)
+	return err
+}
+
+// Fetch fetches the upstream branch and returns the changes to blueprints
+// of each upstream commit since the last pull, following the first parent
+// of merge commits, and the upstream commit. The commit is empty if there
+// is nothing new to pull. Fetching is aborted after fetchTimeout.
+func (r *Repository) Fetch() (string, []store.BlueprintRepositoryChange, error) {
+	if r.remote == "" {
+		return "", nil, nil
+	}
+
+	// fetching doesn't touch the work tree, so commits can be made in the
+	// meantime
+	r.fetchMu.Lock()
+	defer r.fetchMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+	defer cancel()
+	_, err := r.gitContext(ctx, "fetch", "-q", "--no-tags", r.remote, "+"+r.branch+":"+fetchedRef)
+	if err != nil {
+		return "", nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	upstream, err := r.revParse(fetchedRef)
+	if err != nil {
+		return "", nil, err
+	}
+	pulled := r.pulled()
+	if pulled == upstream {
+		return "", nil, nil
+	}
+
+	changes, _, err := r.upstreamChanges(pulled, upstream)
+	if err != nil {
+		return "", nil, err
+	}
+	return upstream, changes, nil
+}
+
+// Merge merges the upstream commit returned by Fetch into the local branch
+// and remembers that it was pulled. The upstream version of each blueprint
+// changed since the last pull replaces the local one.
+func (r *Repository) Merge(upstream string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, changed, err := r.upstreamChanges(r.pulled(), upstream)
+	if err != nil {
+		return err
+	}
+
+	err = r.merge(upstream, changed)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.git("update-ref", pulledRef, upstream)
+	return err
+}
+
+// pulled returns the upstream commit which was pulled last, or "" if
+// nothing was pulled yet
+func (r *Repository) pulled() string {
+	pulled, err := r.revParse(pulledRef)
+	if err != nil {
+		return ""
+	}
+	return pulled
+}
+
+// upstreamChanges returns the changes of the commits after `pulled` up to
+// `upstream`, oldest first, and the last status of each changed file
+func (r *Repository) upstreamChanges(pulled, upstream string) ([]store.BlueprintRepositoryChange, map[string]string, error) {
+	revisions := upstream
+	previous := emptyTree
+	if pulled != "" {
+		revisions = pulled + ".." + upstream
+		previous = pulled
+	}
+	out, err := r.git("rev-list", "--reverse", "--first-parent", revisions)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var changes []store.BlueprintRepositoryChange
+	changed := make(map[string]string)
+	for _, commit := range strings.Fields(out) {
+		commitChanges, err := r.commitChanges(previous, commit, changed)
+		if err != nil {
+			return nil, nil, err
+		}
+		changes = append(changes, commitChanges...)
+		previous = commit
+	}
+
+	return changes, changed, nil
+}
+
+// commitChanges returns the changes to blueprints between the `previous`
+// commit and `commit` and records the status of each changed file in
+// `changed`
+func (r *Repository) commitChanges(previous, commit string, changed map[string]string) ([]store.BlueprintRepositoryChange, error) {
+	out, err := r.git("show", "-s", "--format=%ct%n%B", commit)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.SplitN(out, "\n", 2)
+	seconds, err := strconv.ParseInt(lines[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid commit time of %s: %v", commit, err)
+	}
+	timestamp := time.Unix(seconds, 0).UTC().Format("2006-01-02T15:04:05Z")
+	var message string
+	if len(lines) > 1 {
+		message = strings.TrimSpace(lines[1])
+	}
+
+	out, err = r.git("diff", "--no-renames", "--name-status", "-z", previous, commit)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []store.BlueprintRepositoryChange
+	fields := strings.Split(strings.TrimSuffix(out, "\x00"), "\x00")
+	for i := 0; i+1 < len(fields); i += 2 {
+		status, file := fields[i], fields[i+1]
+		if strings.Contains(file, "/") || !strings.HasSuffix(file, ".toml") {
+			continue
+		}
+		changed[file] = status
+
+		change := store.BlueprintRepositoryChange{
+			Name: strings.TrimSuffix(file, ".toml"),
+			Change: blueprint.Change{
+				Commit:    commit,
+				Message:   message,
+				Timestamp: timestamp,
+			},
+		}
+		if status == "D" {
+			change.Deleted = true
+		} else {
+			content, err := r.git("show", commit+":"+file)
+			if err != nil {
+				return nil, err
+			}
+			// Files which aren't valid blueprints are passed on without
+			// one, the store rejects them
+			_, _ = toml.Decode(content, &change.Change.Blueprint)
+		}
+		changes = append(changes, change)
+	}
+
+	return changes, nil
+}
+
+// merge merges `upstream` into the local branch. The upstream version of
+// each file in `changed` replaces the local one, all other files are kept.
+func (r *Repository) merge(upstream string, changed map[string]string) error {
+	_, err := r.git("merge-base", "--is-ancestor", upstream, "HEAD")
+	if err == nil {
+		return nil
+	}
+
+	_, err = r.git("merge", "-q", "--no-ff", "--no-commit", "-s", "ours", "--allow-unrelated-histories", upstream)
+	if err != nil {
+		return err
+	}
+	for file, status := range changed {
+		if status == "D" {
+			_, err = r.git("rm", "-q", "--ignore-unmatch", "--", file)
+		} else {
+			_, err = r.git("checkout", upstream, "--", file)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	_, err = r.git("commit", "-q", "-m", fmt.Sprintf("Merge %s of %s", r.branch, r.remote))
+	return err
+}
+
+func (r *Repository) revParse(rev string) (string, error) {
+	out, err := r.git("rev-parse", "-q", "--verify", rev)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// git runs git in the repository and returns its output
+func (r *Repository) git(args ...string) (string, error) {
+	return r.gitContext(context.Background(), args...)
+}
+
+// gitContext runs git like git(), killing it when ctx is done
+func (r *Repository) gitContext(ctx context.Context, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", r.dir}, args...)...)
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=osbuild-composer",
+		"GIT_AUTHOR_EMAIL=osbuild-composer@localhost",
+		"GIT_COMMITTER_NAME=osbuild-composer",
+		"GIT_COMMITTER_EMAIL=osbuild-composer@localhost",
+		"GIT_TERMINAL_PROMPT=0",
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s failed: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return string(out), nil
+}
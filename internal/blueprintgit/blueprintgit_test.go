@@ -0,0 +1,194 @@
+package blueprintgit
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/osbuild-composer/internal/blueprint"
+	"github.com/osbuild/osbuild-composer/internal/store"
+)
+
+func newTestRepository(t *testing.T, remote string) (*Repository, string) {
+	dir, err := ioutil.TempDir("", "blueprintgit-test-")
+	require.NoError(t, err)
+
+	r, err := Open(path.Join(dir, "repo"), remote, "main")
+	require.NoError(t, err)
+	return r, dir
+}
+
+// upstream is a repository the tests commit to directly, like a user would
+type upstream struct {
+	*Repository
+}
+
+func newUpstream(t *testing.T) (*upstream, string) {
+	dir, err := ioutil.TempDir("", "blueprintgit-upstream-")
+	require.NoError(t, err)
+
+	u := &upstream{&Repository{dir: dir}}
+	u.run(t, "init", "-q")
+	u.run(t, "symbolic-ref", "HEAD", "refs/heads/main")
+	return u, dir
+}
+
+func (u *upstream) run(t *testing.T, args ...string) string {
+	out, err := u.git(args...)
+	require.NoError(t, err)
+	return strings.TrimSpace(out)
+}
+
+func (u *upstream) commitFile(t *testing.T, file, content, message string) string {
+	require.NoError(t, ioutil.WriteFile(path.Join(u.dir, file), []byte(content), 0600))
+	u.run(t, "add", "--", file)
+	u.run(t, "commit", "-q", "-m", message)
+	return u.run(t, "rev-parse", "HEAD")
+}
+
+func TestCommit(t *testing.T) {
+	r, dir := newTestRepository(t, "")
+	defer os.RemoveAll(dir)
+
+	bp := blueprint.Blueprint{Name: "test", Version: "0.0.1"}
+	first, err := r.Commit(bp, "first")
+	require.NoError(t, err)
+	require.Len(t, first, 40)
+
+	content, err := ioutil.ReadFile(path.Join(r.dir, "test.toml"))
+	require.NoError(t, err)
+	require.Contains(t, string(content), `version = "0.0.1"`)
+
+	// unchanged blueprints are committed, too
+	second, err := r.Commit(bp, "second")
+	require.NoError(t, err)
+	require.NotEqual(t, first, second)
+
+	out, err := r.git("log", "--format=%s", "-n", "2")
+	require.NoError(t, err)
+	require.Equal(t, "second\nfirst\n", out)
+
+	require.NoError(t, r.Tag("test", first, 1))
+	tagged, err := r.revParse("master/test.toml/r1^{commit}")
+	require.NoError(t, err)
+	require.Equal(t, first, tagged)
+
+	// commits from before the repository existed are not tagged
+	require.NoError(t, r.Tag("test", "0123456789abcdef0123456789abcdef01234567", 2))
+
+	require.NoError(t, r.Delete("test", "deleted"))
+	_, err = os.Stat(path.Join(r.dir, "test.toml"))
+	require.True(t, os.IsNotExist(err))
+	require.NoError(t, r.Delete("unknown", "deleted"))
+	out, err = r.git("log", "--format=%s", "-n", "1")
+	require.NoError(t, err)
+	require.Equal(t, "deleted\n", out)
+
+	// reopening keeps the history
+	r, err = Open(r.dir, "", "main")
+	require.NoError(t, err)
+	head, err := r.revParse("HEAD~1")
+	require.NoError(t, err)
+	require.Equal(t, second, head)
+}
+
+// pull fetches and merges the upstream changes of r
+func pull(t *testing.T, r *Repository) ([]store.BlueprintRepositoryChange, error) {
+	t.Helper()
+	upstream, changes, err := r.Fetch()
+	if err != nil || upstream == "" {
+		return changes, err
+	}
+	return changes, r.Merge(upstream)
+}
+
+func TestFetchWithoutMerge(t *testing.T) {
+	u, upstreamDir := newUpstream(t)
+	defer os.RemoveAll(upstreamDir)
+	r, dir := newTestRepository(t, upstreamDir)
+	defer os.RemoveAll(dir)
+
+	first := u.commitFile(t, "http.toml", "name = \"http\"\nversion = \"0.0.1\"\n", "Add http")
+
+	// changes are fetched again until they are merged
+	upstream, changes, err := r.Fetch()
+	require.NoError(t, err)
+	require.Equal(t, first, upstream)
+	require.Len(t, changes, 1)
+	_, err = os.Stat(path.Join(r.dir, "http.toml"))
+	require.True(t, os.IsNotExist(err))
+
+	upstream, changes, err = r.Fetch()
+	require.NoError(t, err)
+	require.Equal(t, first, upstream)
+	require.Len(t, changes, 1)
+
+	require.NoError(t, r.Merge(upstream))
+	upstream, changes, err = r.Fetch()
+	require.NoError(t, err)
+	require.Empty(t, upstream)
+	require.Empty(t, changes)
+}
+
+func TestPull(t *testing.T) {
+	u, upstreamDir := newUpstream(t)
+	defer os.RemoveAll(upstreamDir)
+	r, dir := newTestRepository(t, upstreamDir)
+	defer os.RemoveAll(dir)
+
+	// a local blueprint, which upstream doesn't know
+	_, err := r.Commit(blueprint.Blueprint{Name: "local", Version: "0.0.1"}, "local")
+	require.NoError(t, err)
+
+	first := u.commitFile(t, "http.toml", "name = \"http\"\nversion = \"0.0.1\"\n", "Add http")
+	u.commitFile(t, "README.md", "blueprints", "Add readme")
+	second := u.commitFile(t, "http.toml", "name = \"http\"\nversion = \"0.0.2\"\n", "Update http\n\nwith a body")
+
+	changes, err := pull(t, r)
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+	require.Equal(t, "http", changes[0].Name)
+	require.Equal(t, first, changes[0].Change.Commit)
+	require.Equal(t, "Add http", changes[0].Change.Message)
+	require.Equal(t, "0.0.1", changes[0].Change.Blueprint.Version)
+	require.NotEmpty(t, changes[0].Change.Timestamp)
+	require.Equal(t, second, changes[1].Change.Commit)
+	require.Equal(t, "Update http\n\nwith a body", changes[1].Change.Message)
+	require.Equal(t, "0.0.2", changes[1].Change.Blueprint.Version)
+
+	// the upstream branch is merged, local blueprints are kept
+	content, err := ioutil.ReadFile(path.Join(r.dir, "http.toml"))
+	require.NoError(t, err)
+	require.Contains(t, string(content), `version = "0.0.2"`)
+	_, err = os.Stat(path.Join(r.dir, "local.toml"))
+	require.NoError(t, err)
+	_, err = r.git("merge-base", "--is-ancestor", second, "HEAD")
+	require.NoError(t, err)
+
+	// nothing changed
+	changes, err = pull(t, r)
+	require.NoError(t, err)
+	require.Empty(t, changes)
+
+	// local changes are overwritten by upstream changes
+	_, err = r.Commit(blueprint.Blueprint{Name: "http", Version: "1.0.0"}, "local http")
+	require.NoError(t, err)
+	third := u.commitFile(t, "http.toml", "name = \"http\"\nversion = \"0.0.3\"\n", "Update http again")
+	u.run(t, "rm", "-q", "http.toml")
+	u.run(t, "commit", "-q", "-m", "Remove http")
+	removed := u.run(t, "rev-parse", "HEAD")
+
+	changes, err = pull(t, r)
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+	require.Equal(t, third, changes[0].Change.Commit)
+	require.False(t, changes[0].Deleted)
+	require.Equal(t, removed, changes[1].Change.Commit)
+	require.True(t, changes[1].Deleted)
+	_, err = os.Stat(path.Join(r.dir, "http.toml"))
+	require.True(t, os.IsNotExist(err))
+}
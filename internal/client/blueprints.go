@@ -5,6 +5,7 @@ package client
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"strings"
 
@@ -168,3 +169,32 @@ func FreezeBlueprintV0(socket *http.Client, blueprint string) (weldr.BlueprintsF
 	}
 	return frozen, nil, nil
 }
+
+// WriteBlueprintsArchiveV1 exports the listed blueprints, or all blueprints
+// if none are listed, with their history as a tarball to an io.Writer
+func WriteBlueprintsArchiveV1(socket *http.Client, w io.Writer, blueprints []string) (*APIResponse, error) {
+	body, resp, err := GetRawBody(socket, "GET", "/api/v1/blueprints/export/"+strings.Join(blueprints, ","))
+	if resp != nil || err != nil {
+		return resp, err
+	}
+	_, err = io.Copy(w, body)
+	body.Close()
+
+	return nil, err
+}
+
+// ImportBlueprintsArchiveV1 imports the blueprints of a tarball written by
+// WriteBlueprintsArchiveV1 and returns their names
+func ImportBlueprintsArchiveV1(socket *http.Client, archive []byte) ([]string, *APIResponse, error) {
+	headers := map[string]string{"Content-Type": "application/x-tar"}
+	body, resp, err := PostRaw(socket, "/api/v1/blueprints/import", string(archive), headers)
+	if resp != nil || err != nil {
+		return nil, resp, err
+	}
+	var imported weldr.BlueprintsImportV1
+	err = json.Unmarshal(body, &imported)
+	if err != nil {
+		return nil, nil, err
+	}
+	return imported.Blueprints, nil, nil
+}
@@ -11,6 +11,7 @@
 package client
 
 import (
+	"bytes"
 	"encoding/json"
 	"sort"
 	"strings"
@@ -1080,4 +1081,45 @@ func TestFreezeInvalidBlueprintV0(t *testing.T) {
 	require.Contains(t, api.Errors[0].Msg, "Invalid characters in API path")
 }
 
+// Export a blueprint with its history and import it again
+func TestBlueprintsArchiveV1(t *testing.T) {
+	bp := `{
+		"name": "test-archive-blueprint-v1",
+		"description": "TestBlueprintsArchiveV1",
+		"version": "0.0.1",
+		"packages": [{"name": "bash", "version": "*"}]
+	}`
+	resp, err := PostJSONBlueprintV0(testState.socket, bp)
+	require.NoError(t, err, "POST blueprint failed with a client error")
+	require.True(t, resp.Status, "POST blueprint failed: %#v", resp)
+
+	var archive bytes.Buffer
+	resp, err = WriteBlueprintsArchiveV1(testState.socket, &archive, []string{"test-archive-blueprint-v1"})
+	require.NoError(t, err, "failed with a client error")
+	require.Nil(t, resp)
+	require.NotZero(t, archive.Len())
+
+	names, resp, err := ImportBlueprintsArchiveV1(testState.socket, archive.Bytes())
+	require.NoError(t, err, "failed with a client error")
+	require.Nil(t, resp)
+	require.Equal(t, []string{"test-archive-blueprint-v1"}, names)
+
+	// importing again does not add changes
+	changes, api, err := GetBlueprintsChangesV0(testState.socket, []string{"test-archive-blueprint-v1"})
+	require.NoError(t, err, "failed with a client error")
+	require.Nil(t, api)
+	require.Len(t, changes.BlueprintsChanges, 1)
+	require.Len(t, changes.BlueprintsChanges[0].Changes, 1)
+}
+
+// Export an unknown blueprint
+func TestBlueprintsArchiveUnknownV1(t *testing.T) {
+	var archive bytes.Buffer
+	resp, err := WriteBlueprintsArchiveV1(testState.socket, &archive, []string{"unknown-blueprint-v1"})
+	require.NoError(t, err, "failed with a client error")
+	require.NotNil(t, resp, "did not return an error")
+	require.False(t, resp.Status, "wrong Status (true)")
+	require.Equal(t, "UnknownBlueprint", resp.Errors[0].ID)
+}
+
 // TODO diff of blueprint changes
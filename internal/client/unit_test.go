@@ -13,6 +13,7 @@ import (
 	"os"
 	"testing"
 
+	"github.com/osbuild/osbuild-composer/internal/distro"
 	"github.com/osbuild/osbuild-composer/internal/distro/fedoratest"
 	rpmmd_mock "github.com/osbuild/osbuild-composer/internal/mocks/rpmmd"
 	"github.com/osbuild/osbuild-composer/internal/rpmmd"
@@ -39,14 +40,20 @@ func executeTests(m *testing.M) int {
 	// Create a mock API server listening on the temporary socket
 	fixture := rpmmd_mock.BaseFixture()
 	rpm := rpmmd_mock.NewRPMMDMock(fixture)
-	distro := fedoratest.New()
-	arch, err := distro.GetArch("x86_64")
+	d := fedoratest.New()
+	arch, err := d.GetArch("x86_64")
 	if err != nil {
 		panic(err)
 	}
-	repos := []rpmmd.RepoConfig{{Name: "test-system-repo", BaseURL: "http://example.com/test/os/test_arch"}}
+	distros, err := distro.NewRegistry(d)
+	if err != nil {
+		panic(err)
+	}
+	repos := map[string]map[string][]rpmmd.RepoConfig{
+		d.Name(): {"x86_64": {{Name: "test-system-repo", BaseURL: "http://example.com/test/os/test_arch"}}},
+	}
 	logger := log.New(os.Stdout, "", 0)
-	api := weldr.New(rpm, arch, distro, repos, logger, fixture.Store, fixture.Workers, "")
+	api := weldr.New(rpm, arch, distros, repos, logger, fixture.Store, fixture.Workers, "")
 	server := http.Server{Handler: api}
 	defer server.Close()
 
@@ -45,9 +45,16 @@ type AWSUploadStatus struct {
 
 // ComposeRequest defines model for ComposeRequest.
 type ComposeRequest struct {
-	Customizations *Customizations `json:"customizations,omitempty"`
-	Distribution   string          `json:"distribution"`
-	ImageRequests  []ImageRequest  `json:"image_requests"`
+
+	// A blueprint in the format of the weldr API. Its packages and
+	// customizations are added to every image.
+	Blueprint      *map[string]interface{} `json:"blueprint,omitempty"`
+	Customizations *Customizations         `json:"customizations,omitempty"`
+	Distribution   string                  `json:"distribution"`
+	ImageRequests  []ImageRequest          `json:"image_requests"`
+
+	// Values of the variables of the blueprint
+	Variables *[]Variable `json:"variables,omitempty"`
 }
 
 // ComposeResult defines model for ComposeResult.
@@ -59,6 +66,32 @@ type ComposeResult struct {
 type ComposeStatus struct {
 	ImageStatuses *[]ImageStatus `json:"image_statuses,omitempty"`
 	Status        string         `json:"status"`
+
+	// Values of the variables of the blueprint the compose was built with
+	Variables *[]Variable `json:"variables,omitempty"`
+}
+
+// ContainerUploadRequestOptions defines model for ContainerUploadRequestOptions.
+type ContainerUploadRequestOptions struct {
+	Password   *string `json:"password,omitempty"`
+	Repository string  `json:"repository"`
+
+	// The tags of the pushed image, defaults to latest
+	Tags *[]string `json:"tags,omitempty"`
+
+	// Verify the certificate of the registry, defaults to true
+	TlsVerify *bool `json:"tls_verify,omitempty"`
+
+	// The registry to push to, either a host name or a URL
+	Url      string  `json:"url"`
+	Username *string `json:"username,omitempty"`
+}
+
+// ContainerUploadStatus defines model for ContainerUploadStatus.
+type ContainerUploadStatus struct {
+
+	// The digest of the pushed manifest
+	Digest *string `json:"digest,omitempty"`
 }
 
 // Customizations defines model for Customizations.
@@ -66,10 +99,51 @@ type Customizations struct {
 	Subscription *Subscription `json:"subscription,omitempty"`
 }
 
+// DepsolveError defines model for DepsolveError.
+type DepsolveError struct {
+	Message  string             `json:"message"`
+	Problems *[]DepsolveProblem `json:"problems,omitempty"`
+}
+
+// DepsolveProblem defines model for DepsolveProblem.
+type DepsolveProblem struct {
+	Conflicts   *[]string `json:"conflicts,omitempty"`
+	Kind        string    `json:"kind"`
+	Message     string    `json:"message"`
+	Package     *string   `json:"package,omitempty"`
+	Requirement *string   `json:"requirement,omitempty"`
+	Spec        *string   `json:"spec,omitempty"`
+}
+
+// GCPUploadRequestOptions defines model for GCPUploadRequestOptions.
+type GCPUploadRequestOptions struct {
+
+	// The bucket the image is uploaded to before it is imported
+	Bucket string `json:"bucket"`
+
+	// Base64 encoded service account key file
+	Credentials *string `json:"credentials,omitempty"`
+	ImageName   *string `json:"image_name,omitempty"`
+
+	// The project to import the image into, defaults to the project of the credentials
+	ProjectId *string `json:"project_id,omitempty"`
+
+	// The region to store the image in
+	Region *string `json:"region,omitempty"`
+}
+
+// GCPUploadStatus defines model for GCPUploadStatus.
+type GCPUploadStatus struct {
+	ImageName *string `json:"image_name,omitempty"`
+	ProjectId *string `json:"project_id,omitempty"`
+}
+
 // ImageRequest defines model for ImageRequest.
 type ImageRequest struct {
 	Architecture   string          `json:"architecture"`
 	ImageType      string          `json:"image_type"`
+	Installer      *Installer      `json:"installer,omitempty"`
+	Ostree         *OSTree         `json:"ostree,omitempty"`
 	Repositories   []Repository    `json:"repositories"`
 	UploadRequests []UploadRequest `json:"upload_requests"`
 }
@@ -80,6 +154,54 @@ type ImageStatus struct {
 	UploadStatuses *[]UploadStatus `json:"upload_statuses,omitempty"`
 }
 
+// Installer defines model for Installer.
+type Installer struct {
+
+	// The tarball or disk image live installer images install, such as the tar image of another compose
+	Url *string `json:"url,omitempty"`
+}
+
+// OSTree defines model for OSTree.
+type OSTree struct {
+
+	// The commit the new commit is based on
+	Parent *string `json:"parent,omitempty"`
+	Ref    *string `json:"ref,omitempty"`
+
+	// Generate a static delta from the parent to the new commit
+	StaticDelta *bool `json:"static_delta,omitempty"`
+
+	// The repository the parent commit is pulled from to generate a static delta, or installer images install the commit of ref from
+	Url *string `json:"url,omitempty"`
+}
+
+// OpenStackUploadRequestOptions defines model for OpenStackUploadRequestOptions.
+type OpenStackUploadRequestOptions struct {
+
+	// The URL of the identity service
+	AuthUrl string `json:"auth_url"`
+
+	// The domain of the user
+	DomainName  *string `json:"domain_name,omitempty"`
+	ImageName   *string `json:"image_name,omitempty"`
+	Password    string  `json:"password"`
+	ProjectId   *string `json:"project_id,omitempty"`
+	ProjectName *string `json:"project_name,omitempty"`
+
+	// Properties set on the image
+	Properties *map[string]interface{} `json:"properties,omitempty"`
+	Region     *string                 `json:"region,omitempty"`
+	Username   string                  `json:"username"`
+
+	// Defaults to the default visibility of the image service
+	Visibility *string `json:"visibility,omitempty"`
+}
+
+// OpenStackUploadStatus defines model for OpenStackUploadStatus.
+type OpenStackUploadStatus struct {
+	ImageId *string `json:"image_id,omitempty"`
+}
+
 // Repository defines model for Repository.
 type Repository struct {
 	Baseurl string `json:"baseurl"`
@@ -104,6 +226,54 @@ type UploadRequest struct {
 // UploadStatus defines model for UploadStatus.
 type UploadStatus interface{}
 
+// VMwareUploadRequestOptions defines model for VMwareUploadRequestOptions.
+type VMwareUploadRequestOptions struct {
+
+	// The cluster whose resource pool is used, defaults to the default resource pool
+	Cluster *string `json:"cluster,omitempty"`
+
+	// Number of virtual CPUs of the template, defaults to 2
+	Cpus *int `json:"cpus,omitempty"`
+
+	// Defaults to the only datacenter of the host
+	Datacenter *string `json:"datacenter,omitempty"`
+
+	// Defaults to the only datastore of the datacenter
+	Datastore *string `json:"datastore,omitempty"`
+
+	// The folder the template is created in, defaults to the VM folder of the datacenter
+	Folder *string `json:"folder,omitempty"`
+
+	// Virtual hardware version of the template, defaults to vmx-13
+	HardwareVersion *string `json:"hardware_version,omitempty"`
+
+	// The vCenter or ESXi host to import the image to
+	Host string `json:"host"`
+
+	// Memory of the template in MiB, defaults to 2048
+	MemoryMb     *int    `json:"memory_mb,omitempty"`
+	Password     string  `json:"password"`
+	TemplateName *string `json:"template_name,omitempty"`
+
+	// Verify the certificate of the host, defaults to true
+	TlsVerify *bool  `json:"tls_verify,omitempty"`
+	Username  string `json:"username"`
+}
+
+// VMwareUploadStatus defines model for VMwareUploadStatus.
+type VMwareUploadStatus struct {
+
+	// The managed object ID of the template
+	TemplateId   *string `json:"template_id,omitempty"`
+	TemplateName *string `json:"template_name,omitempty"`
+}
+
+// Variable defines model for Variable.
+type Variable struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
 // ComposeJSONBody defines parameters for Compose.
 type ComposeJSONBody ComposeRequest
 
@@ -350,6 +520,7 @@ type ComposeResponse struct {
 	Body         []byte
 	HTTPResponse *http.Response
 	JSON201      *ComposeResult
+	JSON500      *DepsolveError
 }
 
 // Status returns HTTPResponse.Status
@@ -437,6 +608,13 @@ func ParseComposeResponse(rsp *http.Response) (*ComposeResponse, error) {
 		}
 		response.JSON201 = &dest
 
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 500:
+		var dest DepsolveError
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON500 = &dest
+
 	}
 
 	return response, nil
@@ -3,10 +3,13 @@
 package cloudapi
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
+	"sort"
 
 	"github.com/google/uuid"
 
@@ -46,6 +49,64 @@ func (server *Server) Serve(listener net.Listener) error {
 	return nil
 }
 
+// ostreeStaticDelta returns the static delta from `parent` a worker should
+// generate for a commit of imageType, pulling the parent from url
+func ostreeStaticDelta(imageType distro.ImageType, parent string, url *string) (*worker.OSTreeStaticDelta, error) {
+	if imageType.Filename() != "commit.tar" {
+		return nil, fmt.Errorf("Static deltas can only be generated for OSTree commits, not %s", imageType.Name())
+	}
+	if parent == "" {
+		return nil, errors.New("Static deltas require a parent commit")
+	}
+	if url == nil || *url == "" {
+		return nil, errors.New("Static deltas require the url of a repository containing the parent commit")
+	}
+
+	return &worker.OSTreeStaticDelta{
+		Filename: imageType.Filename(),
+		From:     parent,
+		URL:      *url,
+	}, nil
+}
+
+// depsolveError writes a DepsolveError reply, including the structured
+// problems reported by dnf, if any
+func depsolveError(w http.ResponseWriter, message string, err error) {
+	reply := DepsolveError{Message: message}
+
+	if dnfProblems := rpmmd.DepsolveProblems(err); len(dnfProblems) > 0 {
+		problems := make([]DepsolveProblem, len(dnfProblems))
+		for i, p := range dnfProblems {
+			problems[i].Kind = p.Kind
+			problems[i].Message = p.Message
+			if p.Spec != "" {
+				spec := p.Spec
+				problems[i].Spec = &spec
+			}
+			if p.Package != "" {
+				pkg := p.Package
+				problems[i].Package = &pkg
+			}
+			if p.Requirement != "" {
+				requirement := p.Requirement
+				problems[i].Requirement = &requirement
+			}
+			if len(p.Conflicts) > 0 {
+				conflicts := p.Conflicts
+				problems[i].Conflicts = &conflicts
+			}
+		}
+		reply.Problems = &problems
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusInternalServerError)
+	err = json.NewEncoder(w).Encode(reply)
+	if err != nil {
+		panic("Failed to write depsolve error")
+	}
+}
+
 // Compose handles a new /compose POST request
 func (server *Server) Compose(w http.ResponseWriter, r *http.Request) {
 	contentType := r.Header["Content-Type"]
@@ -67,9 +128,16 @@ func (server *Server) Compose(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	bp, variables, err := composeRequestBlueprint(request)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	type imageRequest struct {
-		manifest distro.Manifest
-		arch     string
+		manifest    distro.Manifest
+		arch        string
+		staticDelta *worker.OSTreeStaticDelta
 	}
 	imageRequests := make([]imageRequest, len(request.ImageRequests))
 	var targets []*target.Target
@@ -91,27 +159,45 @@ func (server *Server) Compose(w http.ResponseWriter, r *http.Request) {
 			repositories[j].RHSM = repo.Rhsm
 		}
 
-		var bp = blueprint.Blueprint{}
-		err = bp.Initialize()
+		packageSpecs, excludeSpecs := imageType.Packages(bp)
+		packages, _, err := server.rpmMetadata.Depsolve(packageSpecs, excludeSpecs, bp.GetPackageSelectors(), repositories, distribution.ModulePlatformID(), arch.Name())
 		if err != nil {
-			http.Error(w, "Unable to initialize blueprint", http.StatusInternalServerError)
-			return
-		}
-
-		packageSpecs, _ := imageType.Packages(bp)
-		packages, _, err := server.rpmMetadata.Depsolve(packageSpecs, nil, repositories, distribution.ModulePlatformID(), arch.Name())
-		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to depsolve base packages for %s/%s/%s: %s", ir.ImageType, ir.Architecture, request.Distribution, err), http.StatusInternalServerError)
+			depsolveError(w, fmt.Sprintf("Failed to depsolve base packages for %s/%s/%s: %s", ir.ImageType, ir.Architecture, request.Distribution, err), err)
 			return
 		}
 		buildPackageSpecs := imageType.BuildPackages()
-		buildPackages, _, err := server.rpmMetadata.Depsolve(buildPackageSpecs, nil, repositories, distribution.ModulePlatformID(), arch.Name())
+		buildPackages, _, err := server.rpmMetadata.Depsolve(buildPackageSpecs, nil, nil, repositories, distribution.ModulePlatformID(), arch.Name())
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to depsolve build packages for %s/%s/%s: %s", ir.ImageType, ir.Architecture, request.Distribution, err), http.StatusInternalServerError)
+			depsolveError(w, fmt.Sprintf("Failed to depsolve build packages for %s/%s/%s: %s", ir.ImageType, ir.Architecture, request.Distribution, err), err)
 			return
 		}
 
-		imageOptions := distro.ImageOptions{Size: imageType.Size(0)}
+		imageOptions := distro.ImageOptions{
+			Size:    imageType.Size(0),
+			Modules: bp.GetModuleStreams(),
+		}
+		if ir.Ostree != nil {
+			if ir.Ostree.Ref != nil {
+				imageOptions.OSTree.Ref = *ir.Ostree.Ref
+			}
+			if ir.Ostree.Parent != nil {
+				imageOptions.OSTree.Parent = *ir.Ostree.Parent
+			}
+			if ir.Ostree.Url != nil {
+				imageOptions.OSTree.URL = *ir.Ostree.Url
+			}
+			if ir.Ostree.StaticDelta != nil && *ir.Ostree.StaticDelta {
+				staticDelta, err := ostreeStaticDelta(imageType, imageOptions.OSTree.Parent, ir.Ostree.Url)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				imageRequests[i].staticDelta = staticDelta
+			}
+		}
+		if ir.Installer != nil && ir.Installer.Url != nil {
+			imageOptions.Installer.URL = *ir.Installer.Url
+		}
 		if request.Customizations != nil && request.Customizations.Subscription != nil {
 			imageOptions.Subscription = &distro.SubscriptionImageOptions{
 				Organization:  request.Customizations.Subscription.Organization,
@@ -122,7 +208,7 @@ func (server *Server) Compose(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 
-		manifest, err := imageType.Manifest(nil, imageOptions, repositories, packages, buildPackages)
+		manifest, err := imageType.Manifest(bp.Customizations, imageOptions, repositories, packages, buildPackages)
 		if err != nil {
 			http.Error(w, fmt.Sprintf("Failed to get manifest for for %s/%s/%s: %s", ir.ImageType, ir.Architecture, request.Distribution, err), http.StatusBadRequest)
 			return
@@ -165,9 +251,188 @@ func (server *Server) Compose(w http.ResponseWriter, r *http.Request) {
 				t.ImageName = key
 			}
 
+			targets = append(targets, t)
+		} else if uploadRequest.Type == "container" {
+			var containerUploadOptions ContainerUploadRequestOptions
+			jsonUploadOptions, err := json.Marshal(uploadRequest.Options)
+			if err != nil {
+				http.Error(w, "Unable to marshal container upload request", http.StatusInternalServerError)
+				return
+			}
+			err = json.Unmarshal(jsonUploadOptions, &containerUploadOptions)
+			if err != nil {
+				http.Error(w, "Unable to unmarshal container upload request", http.StatusInternalServerError)
+				return
+			}
+
+			options := &target.ContainerTargetOptions{
+				Filename:   imageType.Filename(),
+				URL:        containerUploadOptions.Url,
+				Repository: containerUploadOptions.Repository,
+				TLSVerify:  containerUploadOptions.TlsVerify,
+			}
+			if containerUploadOptions.Tags != nil {
+				options.Tags = *containerUploadOptions.Tags
+			}
+			if containerUploadOptions.Username != nil {
+				options.Username = *containerUploadOptions.Username
+			}
+			if containerUploadOptions.Password != nil {
+				options.Password = *containerUploadOptions.Password
+			}
+			t := target.NewContainerTarget(options)
+			t.ImageName = containerUploadOptions.Repository
+
+			targets = append(targets, t)
+		} else if uploadRequest.Type == "gcp" {
+			var gcpUploadOptions GCPUploadRequestOptions
+			jsonUploadOptions, err := json.Marshal(uploadRequest.Options)
+			if err != nil {
+				http.Error(w, "Unable to marshal gcp upload request", http.StatusInternalServerError)
+				return
+			}
+			err = json.Unmarshal(jsonUploadOptions, &gcpUploadOptions)
+			if err != nil {
+				http.Error(w, "Unable to unmarshal gcp upload request", http.StatusInternalServerError)
+				return
+			}
+
+			imageName := fmt.Sprintf("composer-cloudapi-%s", uuid.New().String())
+			if gcpUploadOptions.ImageName != nil {
+				imageName = *gcpUploadOptions.ImageName
+			}
+			options := &target.GCPTargetOptions{
+				Filename: imageType.Filename(),
+				Bucket:   gcpUploadOptions.Bucket,
+				Object:   imageName + ".tar.gz",
+			}
+			if gcpUploadOptions.ProjectId != nil {
+				options.Project = *gcpUploadOptions.ProjectId
+			}
+			if gcpUploadOptions.Region != nil {
+				options.Region = *gcpUploadOptions.Region
+			}
+			if gcpUploadOptions.Credentials != nil {
+				options.Credentials, err = base64.StdEncoding.DecodeString(*gcpUploadOptions.Credentials)
+				if err != nil {
+					http.Error(w, "Invalid gcp credentials, expected base64 encoded service account key", http.StatusBadRequest)
+					return
+				}
+			}
+			t := target.NewGCPTarget(options)
+			t.ImageName = imageName
+
+			targets = append(targets, t)
+		} else if uploadRequest.Type == "vmware" {
+			var vmwareUploadOptions VMwareUploadRequestOptions
+			jsonUploadOptions, err := json.Marshal(uploadRequest.Options)
+			if err != nil {
+				http.Error(w, "Unable to marshal vmware upload request", http.StatusInternalServerError)
+				return
+			}
+			err = json.Unmarshal(jsonUploadOptions, &vmwareUploadOptions)
+			if err != nil {
+				http.Error(w, "Unable to unmarshal vmware upload request", http.StatusInternalServerError)
+				return
+			}
+
+			options := &target.VMwareTargetOptions{
+				Filename:  imageType.Filename(),
+				Host:      vmwareUploadOptions.Host,
+				Username:  vmwareUploadOptions.Username,
+				Password:  vmwareUploadOptions.Password,
+				TLSVerify: vmwareUploadOptions.TlsVerify,
+			}
+			if vmwareUploadOptions.Datacenter != nil {
+				options.Datacenter = *vmwareUploadOptions.Datacenter
+			}
+			if vmwareUploadOptions.Cluster != nil {
+				options.Cluster = *vmwareUploadOptions.Cluster
+			}
+			if vmwareUploadOptions.Datastore != nil {
+				options.Datastore = *vmwareUploadOptions.Datastore
+			}
+			if vmwareUploadOptions.Folder != nil {
+				options.Folder = *vmwareUploadOptions.Folder
+			}
+			if vmwareUploadOptions.Cpus != nil {
+				options.CPUs = *vmwareUploadOptions.Cpus
+			}
+			if vmwareUploadOptions.MemoryMb != nil {
+				options.MemoryMB = *vmwareUploadOptions.MemoryMb
+			}
+			if vmwareUploadOptions.HardwareVersion != nil {
+				options.HardwareVersion = *vmwareUploadOptions.HardwareVersion
+			}
+			t := target.NewVMwareTarget(options)
+			if vmwareUploadOptions.TemplateName != nil {
+				t.ImageName = *vmwareUploadOptions.TemplateName
+			} else {
+				t.ImageName = fmt.Sprintf("composer-cloudapi-%s", uuid.New().String())
+			}
+
+			targets = append(targets, t)
+		} else if uploadRequest.Type == "openstack" {
+			var openstackUploadOptions OpenStackUploadRequestOptions
+			jsonUploadOptions, err := json.Marshal(uploadRequest.Options)
+			if err != nil {
+				http.Error(w, "Unable to marshal openstack upload request", http.StatusInternalServerError)
+				return
+			}
+			err = json.Unmarshal(jsonUploadOptions, &openstackUploadOptions)
+			if err != nil {
+				http.Error(w, "Unable to unmarshal openstack upload request", http.StatusInternalServerError)
+				return
+			}
+
+			diskFormat, err := target.OpenStackDiskFormat(imageType.Filename())
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Images of type %s cannot be uploaded to OpenStack", imageType.Name()), http.StatusBadRequest)
+				return
+			}
+			options := &target.OpenStackTargetOptions{
+				Filename:   imageType.Filename(),
+				DiskFormat: diskFormat,
+				AuthURL:    openstackUploadOptions.AuthUrl,
+				Username:   openstackUploadOptions.Username,
+				Password:   openstackUploadOptions.Password,
+			}
+			if openstackUploadOptions.DomainName != nil {
+				options.DomainName = *openstackUploadOptions.DomainName
+			}
+			if openstackUploadOptions.ProjectName != nil {
+				options.ProjectName = *openstackUploadOptions.ProjectName
+			}
+			if openstackUploadOptions.ProjectId != nil {
+				options.ProjectID = *openstackUploadOptions.ProjectId
+			}
+			if openstackUploadOptions.Region != nil {
+				options.Region = *openstackUploadOptions.Region
+			}
+			if openstackUploadOptions.Visibility != nil {
+				options.Visibility = *openstackUploadOptions.Visibility
+			}
+			if openstackUploadOptions.Properties != nil {
+				options.Properties = make(map[string]string)
+				for key, value := range *openstackUploadOptions.Properties {
+					str, ok := value.(string)
+					if !ok {
+						http.Error(w, fmt.Sprintf("Invalid openstack image property %s, values must be strings", key), http.StatusBadRequest)
+						return
+					}
+					options.Properties[key] = str
+				}
+			}
+			t := target.NewOpenStackTarget(options)
+			if openstackUploadOptions.ImageName != nil {
+				t.ImageName = *openstackUploadOptions.ImageName
+			} else {
+				t.ImageName = fmt.Sprintf("composer-cloudapi-%s", uuid.New().String())
+			}
+
 			targets = append(targets, t)
 		} else {
-			http.Error(w, "Unknown upload request type, only aws is supported", http.StatusBadRequest)
+			http.Error(w, "Unknown upload request type, only aws, container, gcp, vmware and openstack are supported", http.StatusBadRequest)
 			return
 		}
 	}
@@ -181,7 +446,12 @@ func (server *Server) Compose(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	id, err := server.workers.Enqueue(ir.arch, ir.manifest, targets)
+	id, err := server.workers.EnqueueOSBuild(ir.arch, &worker.OSBuildJob{
+		Manifest:          ir.manifest,
+		Targets:           targets,
+		OSTreeStaticDelta: ir.staticDelta,
+		Variables:         variables,
+	})
 	if err != nil {
 		http.Error(w, "Failed to enqueue manifest", http.StatusInternalServerError)
 		return
@@ -197,6 +467,45 @@ func (server *Server) Compose(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// composeRequestBlueprint returns the blueprint of a compose request, with
+// the values of its variables substituted, and those values. Requests
+// without a blueprint are built from an empty one.
+func composeRequestBlueprint(request ComposeRequest) (blueprint.Blueprint, map[string]string, error) {
+	var bp blueprint.Blueprint
+	if request.Blueprint != nil {
+		/* the blueprint is free-form in the openapi spec, so marshal and unmarshal it */
+		jsonBlueprint, err := json.Marshal(request.Blueprint)
+		if err != nil {
+			return blueprint.Blueprint{}, nil, errors.New("Unable to marshal blueprint")
+		}
+		err = json.Unmarshal(jsonBlueprint, &bp)
+		if err != nil {
+			return blueprint.Blueprint{}, nil, fmt.Errorf("Invalid blueprint: %v", err)
+		}
+	}
+
+	err := bp.Initialize()
+	if err != nil {
+		return blueprint.Blueprint{}, nil, fmt.Errorf("Invalid blueprint: %v", err)
+	}
+
+	values := make(map[string]string)
+	if request.Variables != nil {
+		for _, v := range *request.Variables {
+			values[v.Name] = v.Value
+		}
+	}
+	variables, err := bp.VariableValues(values)
+	if err != nil {
+		return blueprint.Blueprint{}, nil, fmt.Errorf("Invalid variables: %v", err)
+	}
+	bp, err = bp.SubstituteVariables(variables)
+	if err != nil {
+		return blueprint.Blueprint{}, nil, err
+	}
+	return bp, variables, nil
+}
+
 // ComposeStatus handles a /compose/{id} GET request
 func (server *Server) ComposeStatus(w http.ResponseWriter, r *http.Request, id string) {
 	composeId, err := uuid.Parse(id)
@@ -212,13 +521,61 @@ func (server *Server) ComposeStatus(w http.ResponseWriter, r *http.Request, id s
 		return
 	}
 
-	response := ComposeStatus{
+	imageStatus := ImageStatus{
 		Status: status.State.ToString(), // TODO: map the status correctly
-		ImageStatuses: &[]ImageStatus{
-			{
-				Status: status.State.ToString(), // TODO: map the status correctly
-			},
-		},
+	}
+	var uploadStatuses []UploadStatus
+	for _, tr := range status.Result.TargetResults {
+		switch options := tr.Options.(type) {
+		case *target.ContainerTargetResultOptions:
+			digest := options.Digest
+			uploadStatuses = append(uploadStatuses, ContainerUploadStatus{
+				Digest: &digest,
+			})
+		case *target.GCPTargetResultOptions:
+			imageName := options.ImageName
+			projectID := options.ProjectID
+			uploadStatuses = append(uploadStatuses, GCPUploadStatus{
+				ImageName: &imageName,
+				ProjectId: &projectID,
+			})
+		case *target.OpenStackTargetResultOptions:
+			imageID := options.ImageID
+			uploadStatuses = append(uploadStatuses, OpenStackUploadStatus{
+				ImageId: &imageID,
+			})
+		case *target.VMwareTargetResultOptions:
+			templateName := options.TemplateName
+			templateID := options.TemplateID
+			uploadStatuses = append(uploadStatuses, VMwareUploadStatus{
+				TemplateName: &templateName,
+				TemplateId:   &templateID,
+			})
+		}
+	}
+	if len(uploadStatuses) > 0 {
+		imageStatus.UploadStatuses = &uploadStatuses
+	}
+
+	response := ComposeStatus{
+		Status:        status.State.ToString(), // TODO: map the status correctly
+		ImageStatuses: &[]ImageStatus{imageStatus},
+	}
+
+	job, err := server.workers.JobArgs(composeId)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Job %s not found: %s", id, err), http.StatusNotFound)
+		return
+	}
+	if len(job.Variables) > 0 {
+		variables := make([]Variable, 0, len(job.Variables))
+		for name, value := range job.Variables {
+			variables = append(variables, Variable{Name: name, Value: value})
+		}
+		sort.Slice(variables, func(i, j int) bool {
+			return variables[i].Name < variables[j].Name
+		})
+		response.Variables = &variables
 	}
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	err = json.NewEncoder(w).Encode(response)
@@ -84,14 +84,24 @@ type ImageType interface {
 // The ImageOptions specify options for a specific image build
 type ImageOptions struct {
 	OSTree       OSTreeImageOptions
+	Installer    InstallerImageOptions
 	Size         uint64
 	Subscription *SubscriptionImageOptions
+	Modules      []rpmmd.ModuleStream
 }
 
 // The OSTreeImageOptions specify ostree-specific image options
 type OSTreeImageOptions struct {
 	Ref    string
 	Parent string
+	// URL of the repository installer images pull the commit of Ref from
+	URL string
+}
+
+// The InstallerImageOptions specify what live installer images install
+type InstallerImageOptions struct {
+	// URL of the tarball or disk image to install
+	URL string
 }
 
 // The SubscriptionImageOptions specify subscription-specific image options
@@ -155,7 +155,10 @@ func (t *imageType) Size(size uint64) uint64 {
 }
 
 func (t *imageType) Packages(bp blueprint.Blueprint) ([]string, []string) {
-	packages := append(t.packages, bp.GetPackages()...)
+	// the package lists of the image type are shared by all calls, so
+	// append to copies of them
+	packages := append([]string{}, t.packages...)
+	packages = append(packages, bp.GetPackages()...)
 	timezone, _ := bp.Customizations.GetTimezoneSettings()
 	if timezone != nil {
 		packages = append(packages, "chrony")
@@ -164,7 +167,8 @@ func (t *imageType) Packages(bp blueprint.Blueprint) ([]string, []string) {
 		packages = append(packages, t.arch.bootloaderPackages...)
 	}
 
-	return packages, t.excludedPackages
+	excludes := append([]string{}, t.excludedPackages...)
+	return packages, append(excludes, bp.GetExcludes()...)
 }
 
 func (t *imageType) BuildPackages() []string {
@@ -176,7 +180,7 @@ func (t *imageType) Manifest(c *blueprint.Customizations,
 	repos []rpmmd.RepoConfig,
 	packageSpecs,
 	buildPackageSpecs []rpmmd.PackageSpec) (distro.Manifest, error) {
-	pipeline, err := t.pipeline(c, repos, packageSpecs, buildPackageSpecs, options.Size)
+	pipeline, err := t.pipeline(c, options, repos, packageSpecs, buildPackageSpecs)
 	if err != nil {
 		return distro.Manifest{}, err
 	}
@@ -428,11 +432,14 @@ func sources(packages []rpmmd.PackageSpec) *osbuild.Sources {
 	}
 }
 
-func (t *imageType) pipeline(c *blueprint.Customizations, repos []rpmmd.RepoConfig, packageSpecs, buildPackageSpecs []rpmmd.PackageSpec, size uint64) (*osbuild.Pipeline, error) {
+func (t *imageType) pipeline(c *blueprint.Customizations, options distro.ImageOptions, repos []rpmmd.RepoConfig, packageSpecs, buildPackageSpecs []rpmmd.PackageSpec) (*osbuild.Pipeline, error) {
 	p := &osbuild.Pipeline{}
 	p.SetBuild(t.buildPipeline(repos, *t.arch, buildPackageSpecs), "org.osbuild.fedora31")
 
 	p.AddStage(osbuild.NewRPMStage(t.rpmStageOptions(repos, packageSpecs)))
+	for _, module := range options.Modules {
+		p.AddStage(osbuild.NewDNFModuleConfigStage(t.dnfModuleConfigStageOptions(module)))
+	}
 	p.AddStage(osbuild.NewFixBLSStage())
 
 	// TODO support setting all languages and install corresponding langpack-* package
@@ -489,7 +496,7 @@ func (t *imageType) pipeline(c *blueprint.Customizations, repos []rpmmd.RepoConf
 
 	p.AddStage(osbuild.NewSELinuxStage(t.selinuxStageOptions()))
 
-	p.Assembler = t.assembler(t.arch.uefi, size)
+	p.Assembler = t.assembler(t.arch.uefi, options.Size)
 
 	return p, nil
 }
@@ -524,6 +531,21 @@ func (r *imageType) rpmStageOptions(repos []rpmmd.RepoConfig, specs []rpmmd.Pack
 	}
 }
 
+func (r *imageType) dnfModuleConfigStageOptions(module rpmmd.ModuleStream) *osbuild.DNFModuleConfigStageOptions {
+	var profiles []string
+	if module.Profile != "" {
+		profiles = []string{module.Profile}
+	}
+	return &osbuild.DNFModuleConfigStageOptions{
+		Conf: &osbuild.DNFModuleConfig{
+			Name:     module.Name,
+			Stream:   module.Stream,
+			Profiles: profiles,
+			State:    "enabled",
+		},
+	}
+}
+
 func (r *imageType) userStageOptions(users []blueprint.UserCustomization) (*osbuild.UsersStageOptions, error) {
 	options := osbuild.UsersStageOptions{
 		Users: make(map[string]osbuild.UsersStageOptionsUser),
@@ -159,7 +159,10 @@ func (t *imageType) Size(size uint64) uint64 {
 }
 
 func (t *imageType) Packages(bp blueprint.Blueprint) ([]string, []string) {
-	packages := append(t.packages, bp.GetPackages()...)
+	// the package lists of the image type are shared by all calls, so
+	// append to copies of them
+	packages := append([]string{}, t.packages...)
+	packages = append(packages, bp.GetPackages()...)
 	timezone, _ := bp.Customizations.GetTimezoneSettings()
 	if timezone != nil {
 		packages = append(packages, "chrony")
@@ -168,7 +171,8 @@ func (t *imageType) Packages(bp blueprint.Blueprint) ([]string, []string) {
 		packages = append(packages, t.arch.bootloaderPackages...)
 	}
 
-	return packages, t.excludedPackages
+	excludes := append([]string{}, t.excludedPackages...)
+	return packages, append(excludes, bp.GetExcludes()...)
 }
 
 func (t *imageType) BuildPackages() []string {
@@ -225,6 +229,9 @@ func (t *imageType) pipeline(c *blueprint.Customizations, options distro.ImageOp
 	p.SetBuild(t.buildPipeline(repos, *t.arch, buildPackageSpecs), "org.osbuild.fedora32")
 
 	p.AddStage(osbuild.NewRPMStage(t.rpmStageOptions(*t.arch, repos, packageSpecs)))
+	for _, module := range options.Modules {
+		p.AddStage(osbuild.NewDNFModuleConfigStage(t.dnfModuleConfigStageOptions(module)))
+	}
 	p.AddStage(osbuild.NewFixBLSStage())
 
 	// TODO support setting all languages and install corresponding langpack-* package
@@ -334,6 +341,21 @@ func (t *imageType) rpmStageOptions(arch architecture, repos []rpmmd.RepoConfig,
 	}
 }
 
+func (t *imageType) dnfModuleConfigStageOptions(module rpmmd.ModuleStream) *osbuild.DNFModuleConfigStageOptions {
+	var profiles []string
+	if module.Profile != "" {
+		profiles = []string{module.Profile}
+	}
+	return &osbuild.DNFModuleConfigStageOptions{
+		Conf: &osbuild.DNFModuleConfig{
+			Name:     module.Name,
+			Stream:   module.Stream,
+			Profiles: profiles,
+			State:    "enabled",
+		},
+	}
+}
+
 func (t *imageType) userStageOptions(users []blueprint.UserCustomization) (*osbuild.UsersStageOptions, error) {
 	options := osbuild.UsersStageOptions{
 		Users: make(map[string]osbuild.UsersStageOptionsUser),
@@ -287,6 +287,25 @@ func TestImageType_BasePackages(t *testing.T) {
 	}
 }
 
+func TestImageType_BlueprintExcludes(t *testing.T) {
+	distro := fedora32.New()
+	arch, err := distro.GetArch("x86_64")
+	assert.NoError(t, err)
+	imgType, err := arch.GetImageType("qcow2")
+	assert.NoError(t, err)
+
+	_, excludedPackages := imgType.Packages(blueprint.Blueprint{Exclude: []string{"cloud-init"}})
+	assert.Contains(t, excludedPackages, "dracut-config-rescue")
+	assert.Contains(t, excludedPackages, "cloud-init")
+
+	// the excludes of one blueprint don't end up in those of another
+	_, otherExcludedPackages := imgType.Packages(blueprint.Blueprint{Exclude: []string{"vim-minimal"}})
+	assert.Contains(t, otherExcludedPackages, "dracut-config-rescue")
+	assert.Contains(t, otherExcludedPackages, "vim-minimal")
+	assert.NotContains(t, otherExcludedPackages, "cloud-init")
+	assert.NotContains(t, excludedPackages, "vim-minimal")
+}
+
 func TestDistro_Manifest(t *testing.T) {
 	distro_test_common.TestDistro_Manifest(t, "../../../test/data/cases/", "fedora_32*", fedora32.New())
 }
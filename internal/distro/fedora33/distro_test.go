@@ -26,6 +26,36 @@ func TestFilenameFromType(t *testing.T) {
 			want:  "image.raw",
 			want1: "application/octet-stream",
 		},
+		{
+			name:  "fedora-iot-installer",
+			args:  args{"fedora-iot-installer"},
+			want:  "installer.iso",
+			want1: "application/x-iso9660-image",
+		},
+		{
+			name:  "container",
+			args:  args{"container"},
+			want:  "container.tar",
+			want1: "application/x-tar",
+		},
+		{
+			name:  "gce",
+			args:  args{"gce"},
+			want:  "disk.raw",
+			want1: "application/octet-stream",
+		},
+		{
+			name:  "image-installer",
+			args:  args{"image-installer"},
+			want:  "image-installer.iso",
+			want1: "application/x-iso9660-image",
+		},
+		{
+			name:  "liveiso",
+			args:  args{"liveiso"},
+			want:  "live.iso",
+			want1: "application/x-iso9660-image",
+		},
 		{
 			name:  "openstack",
 			args:  args{"openstack"},
@@ -125,6 +155,16 @@ func TestImageType_BuildPackages(t *testing.T) {
 				// to reconsider. The only reason to specia-case it is that it might pull in a lot of dependencies
 				// for a niche usecase.
 				assert.ElementsMatch(t, append(buildPackages[archLabel], "rpm-ostree"), itStruct.BuildPackages())
+			} else if itLabel == "fedora-iot-installer" {
+				// Installers are assembled into ISOs and pull the commit they install
+				installerPackages := []string{"isomd5sum", "lorax-templates-generic", "ostree", "squashfs-tools", "syslinux", "xorriso"}
+				assert.ElementsMatch(t, append(buildPackages[archLabel], installerPackages...), itStruct.BuildPackages())
+			} else if itLabel == "image-installer" {
+				installerPackages := []string{"isomd5sum", "lorax-templates-generic", "squashfs-tools", "syslinux", "xorriso"}
+				assert.ElementsMatch(t, append(buildPackages[archLabel], installerPackages...), itStruct.BuildPackages())
+			} else if itLabel == "liveiso" {
+				isoPackages := []string{"isomd5sum", "squashfs-tools", "syslinux", "xorriso"}
+				assert.ElementsMatch(t, append(buildPackages[archLabel], isoPackages...), itStruct.BuildPackages())
 			} else {
 				assert.ElementsMatch(t, buildPackages[archLabel], itStruct.BuildPackages())
 			}
@@ -293,6 +333,25 @@ func TestImageType_BasePackages(t *testing.T) {
 	}
 }
 
+func TestImageType_BlueprintExcludes(t *testing.T) {
+	distro := fedora33.New()
+	arch, err := distro.GetArch("x86_64")
+	assert.NoError(t, err)
+	imgType, err := arch.GetImageType("qcow2")
+	assert.NoError(t, err)
+
+	_, excludedPackages := imgType.Packages(blueprint.Blueprint{Exclude: []string{"cloud-init"}})
+	assert.Contains(t, excludedPackages, "dracut-config-rescue")
+	assert.Contains(t, excludedPackages, "cloud-init")
+
+	// the excludes of one blueprint don't end up in those of another
+	_, otherExcludedPackages := imgType.Packages(blueprint.Blueprint{Exclude: []string{"vim-minimal"}})
+	assert.Contains(t, otherExcludedPackages, "dracut-config-rescue")
+	assert.Contains(t, otherExcludedPackages, "vim-minimal")
+	assert.NotContains(t, otherExcludedPackages, "cloud-init")
+	assert.NotContains(t, excludedPackages, "vim-minimal")
+}
+
 func TestDistro_Manifest(t *testing.T) {
 	distro_test_common.TestDistro_Manifest(t, "../../../test/data/cases/", "fedora_33*", fedora33.New())
 }
@@ -34,11 +34,11 @@ func (t *imageType) Arch() distro.Arch {
 }
 
 func (d *FedoraTestDistro) ListArches() []string {
-	return []string{"x86_64"}
+	return []string{"aarch64", "x86_64"}
 }
 
 func (d *FedoraTestDistro) GetArch(name string) (distro.Arch, error) {
-	if name != "x86_64" {
+	if name != "x86_64" && name != "aarch64" {
 		return nil, errors.New("invalid architecture: " + name)
 	}
 
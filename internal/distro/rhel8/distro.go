@@ -48,6 +48,10 @@ type imageType struct {
 	kernelOptions    string
 	bootable         bool
 	rpmOstree        bool
+	ostreeInstaller  bool
+	liveInstaller    bool
+	container        bool
+	buildPackages    []string
 	defaultSize      uint64
 	assembler        func(uefi bool, options distro.ImageOptions, arch distro.Arch) *osbuild.Assembler
 }
@@ -130,6 +134,10 @@ func (a *architecture) setImageTypes(imageTypes ...imageType) {
 			kernelOptions:    it.kernelOptions,
 			bootable:         it.bootable,
 			rpmOstree:        it.rpmOstree,
+			ostreeInstaller:  it.ostreeInstaller,
+			liveInstaller:    it.liveInstaller,
+			container:        it.container,
+			buildPackages:    it.buildPackages,
 			defaultSize:      it.defaultSize,
 			assembler:        it.assembler,
 		}
@@ -161,7 +169,10 @@ func (t *imageType) Size(size uint64) uint64 {
 }
 
 func (t *imageType) Packages(bp blueprint.Blueprint) ([]string, []string) {
-	packages := append(t.packages, bp.GetPackages()...)
+	// the package lists of the image type are shared by all calls, so
+	// append to copies of them
+	packages := append([]string{}, t.packages...)
+	packages = append(packages, bp.GetPackages()...)
 	timezone, _ := bp.Customizations.GetTimezoneSettings()
 	if timezone != nil {
 		packages = append(packages, "chrony")
@@ -170,7 +181,8 @@ func (t *imageType) Packages(bp blueprint.Blueprint) ([]string, []string) {
 		packages = append(packages, t.arch.bootloaderPackages...)
 	}
 
-	return packages, t.excludedPackages
+	excludes := append([]string{}, t.excludedPackages...)
+	return packages, append(excludes, bp.GetExcludes()...)
 }
 
 func (t *imageType) BuildPackages() []string {
@@ -178,7 +190,7 @@ func (t *imageType) BuildPackages() []string {
 	if t.rpmOstree {
 		packages = append(packages, "rpm-ostree")
 	}
-	return packages
+	return append(packages, t.buildPackages...)
 }
 
 func (t *imageType) Manifest(c *blueprint.Customizations,
@@ -228,6 +240,13 @@ func sources(packages []rpmmd.PackageSpec) *osbuild.Sources {
 }
 
 func (t *imageType) pipeline(c *blueprint.Customizations, options distro.ImageOptions, repos []rpmmd.RepoConfig, packageSpecs, buildPackageSpecs []rpmmd.PackageSpec) (*osbuild.Pipeline, error) {
+	if t.ostreeInstaller {
+		return t.installerPipeline(options, repos, packageSpecs, buildPackageSpecs)
+	}
+	if t.liveInstaller {
+		return t.liveInstallerPipeline(options, repos, packageSpecs, buildPackageSpecs)
+	}
+
 	p := &osbuild.Pipeline{}
 	p.SetBuild(t.buildPipeline(repos, *t.arch, buildPackageSpecs), "org.osbuild.rhel82")
 
@@ -239,6 +258,9 @@ func (t *imageType) pipeline(c *blueprint.Customizations, options distro.ImageOp
 	}
 
 	p.AddStage(osbuild.NewRPMStage(t.rpmStageOptions(*t.arch, repos, packageSpecs)))
+	for _, module := range options.Modules {
+		p.AddStage(osbuild.NewDNFModuleConfigStage(t.dnfModuleConfigStageOptions(module)))
+	}
 	p.AddStage(osbuild.NewFixBLSStage())
 
 	if t.bootable {
@@ -325,11 +347,99 @@ func (t *imageType) pipeline(c *blueprint.Customizations, options distro.ImageOp
 		))
 	}
 
+	if t.container {
+		p.Assembler = ociArchiveAssembler(t.filename, c.GetContainer(), t.arch)
+	} else {
+		p.Assembler = t.assembler(t.arch.uefi, options, t.arch)
+	}
+
+	return p, nil
+}
+
+// installerPipeline builds an Anaconda installer root which deploys the
+// latest commit of the OSTree ref in options, and assembles it into an ISO.
+// The commit is pulled into the installer and its kickstart installs it from
+// there, so that the ISO can install without network access.
+func (t *imageType) installerPipeline(options distro.ImageOptions, repos []rpmmd.RepoConfig, packageSpecs, buildPackageSpecs []rpmmd.PackageSpec) (*osbuild.Pipeline, error) {
+	if options.OSTree.URL == "" {
+		return nil, fmt.Errorf("%s images require the url of the repository of the commit to install", t.name)
+	}
+	ref := ostreeRef(options, t.arch)
+
+	p := &osbuild.Pipeline{}
+	p.SetBuild(t.buildPipeline(repos, *t.arch, buildPackageSpecs), "org.osbuild.rhel82")
+	p.AddStage(osbuild.NewRPMStage(t.rpmStageOptions(*t.arch, repos, packageSpecs)))
+	p.AddStage(osbuild.NewLocaleStage(&osbuild.LocaleStageOptions{Language: "en_US.UTF-8"}))
+	p.AddStage(osbuild.NewOSTreePullStage(&osbuild.OSTreePullStageOptions{
+		Repo: "/ostree/repo",
+		URL:  options.OSTree.URL,
+		Ref:  ref,
+	}))
+	anacondaStages := t.anacondaStages(&osbuild.KickstartStageOptions{
+		Path: "/usr/share/anaconda/interactive-defs.ks",
+		OSTree: &osbuild.KickstartOSTreeOptions{
+			OSName: "rhel",
+			Remote: "rhel",
+			URL:    "file:///ostree/repo",
+			Ref:    ref,
+			GPG:    false,
+		},
+	})
+	for _, stage := range anacondaStages {
+		p.AddStage(stage)
+	}
+	p.AddStage(osbuild.NewSELinuxStage(t.selinuxStageOptions()))
 	p.Assembler = t.assembler(t.arch.uefi, options, t.arch)
 
 	return p, nil
 }
 
+// liveInstallerPipeline builds an Anaconda installer root which installs
+// the tarball or disk image at the installer URL in options, such as the tar
+// image of a compose of the same blueprint, and assembles it into an ISO.
+func (t *imageType) liveInstallerPipeline(options distro.ImageOptions, repos []rpmmd.RepoConfig, packageSpecs, buildPackageSpecs []rpmmd.PackageSpec) (*osbuild.Pipeline, error) {
+	if options.Installer.URL == "" {
+		return nil, fmt.Errorf("%s images require the url of the image to install", t.name)
+	}
+
+	p := &osbuild.Pipeline{}
+	p.SetBuild(t.buildPipeline(repos, *t.arch, buildPackageSpecs), "org.osbuild.rhel82")
+	p.AddStage(osbuild.NewRPMStage(t.rpmStageOptions(*t.arch, repos, packageSpecs)))
+	p.AddStage(osbuild.NewLocaleStage(&osbuild.LocaleStageOptions{Language: "en_US.UTF-8"}))
+	anacondaStages := t.anacondaStages(&osbuild.KickstartStageOptions{
+		Path: "/usr/share/anaconda/interactive-defs.ks",
+		LiveImg: &osbuild.KickstartLiveImgOptions{
+			URL: options.Installer.URL,
+		},
+	})
+	for _, stage := range anacondaStages {
+		p.AddStage(stage)
+	}
+	p.AddStage(osbuild.NewSELinuxStage(t.selinuxStageOptions()))
+	p.Assembler = t.assembler(t.arch.uefi, options, t.arch)
+
+	return p, nil
+}
+
+// anacondaStages turn the tree into an Anaconda installer root, which
+// installs the system described by kickstart
+func (t *imageType) anacondaStages(kickstart *osbuild.KickstartStageOptions) []*osbuild.Stage {
+	return []*osbuild.Stage{
+		osbuild.NewKickstartStage(kickstart),
+		osbuild.NewAnacondaStage(&osbuild.AnacondaStageOptions{
+			KickstartModules: []string{
+				"org.fedoraproject.Anaconda.Modules.Network",
+				"org.fedoraproject.Anaconda.Modules.Payloads",
+				"org.fedoraproject.Anaconda.Modules.Storage",
+			},
+		}),
+		osbuild.NewLoraxScriptStage(&osbuild.LoraxScriptStageOptions{
+			Path:     "99-generic/runtime-postinstall.tmpl",
+			BaseArch: t.arch.Name(),
+		}),
+	}
+}
+
 func (t *imageType) buildPipeline(repos []rpmmd.RepoConfig, arch architecture, buildPackageSpecs []rpmmd.PackageSpec) *osbuild.Pipeline {
 	p := &osbuild.Pipeline{}
 	p.AddStage(osbuild.NewRPMStage(t.rpmStageOptions(arch, repos, buildPackageSpecs)))
@@ -361,6 +471,21 @@ func (t *imageType) rpmStageOptions(arch architecture, repos []rpmmd.RepoConfig,
 	}
 }
 
+func (t *imageType) dnfModuleConfigStageOptions(module rpmmd.ModuleStream) *osbuild.DNFModuleConfigStageOptions {
+	var profiles []string
+	if module.Profile != "" {
+		profiles = []string{module.Profile}
+	}
+	return &osbuild.DNFModuleConfigStageOptions{
+		Conf: &osbuild.DNFModuleConfig{
+			Name:     module.Name,
+			Stream:   module.Stream,
+			Profiles: profiles,
+			State:    "enabled",
+		},
+	}
+}
+
 func (t *imageType) userStageOptions(users []blueprint.UserCustomization) (*osbuild.UsersStageOptions, error) {
 	options := osbuild.UsersStageOptions{
 		Users: make(map[string]osbuild.UsersStageOptionsUser),
@@ -591,14 +716,18 @@ func tarAssembler(filename, compression string) *osbuild.Assembler {
 		})
 }
 
-func ostreeCommitAssembler(options distro.ImageOptions, arch distro.Arch) *osbuild.Assembler {
-	ref := options.OSTree.Ref
-	if ref == "" {
-		ref = fmt.Sprintf("rhel/8/%s/edge", arch.Name())
+// ostreeRef returns the ref of the commits of edge images
+func ostreeRef(options distro.ImageOptions, arch distro.Arch) string {
+	if options.OSTree.Ref != "" {
+		return options.OSTree.Ref
 	}
+	return fmt.Sprintf("rhel/8/%s/edge", arch.Name())
+}
+
+func ostreeCommitAssembler(options distro.ImageOptions, arch distro.Arch) *osbuild.Assembler {
 	return osbuild.NewOSTreeCommitAssembler(
 		&osbuild.OSTreeCommitAssemblerOptions{
-			Ref:    ref,
+			Ref:    ostreeRef(options, arch),
 			Parent: options.OSTree.Parent,
 			Tar: osbuild.OSTreeCommitAssemblerTarOptions{
 				Filename: "commit.tar",
@@ -607,6 +736,65 @@ func ostreeCommitAssembler(options distro.ImageOptions, arch distro.Arch) *osbui
 	)
 }
 
+// ociArchitecture returns the name OCI images use for arch
+func ociArchitecture(arch distro.Arch) string {
+	switch arch.Name() {
+	case "x86_64":
+		return "amd64"
+	case "aarch64":
+		return "arm64"
+	default:
+		return arch.Name()
+	}
+}
+
+// ociArchiveAssembler assembles the tree into an OCI image archive, which
+// runs with the config of container
+func ociArchiveAssembler(filename string, container *blueprint.ContainerCustomization, arch distro.Arch) *osbuild.Assembler {
+	options := osbuild.OCIArchiveAssemblerOptions{
+		Filename:     filename,
+		Architecture: ociArchitecture(arch),
+	}
+	if container != nil {
+		options.Config = &osbuild.OCIArchiveAssemblerConfig{
+			Entrypoint: container.Entrypoint,
+			Env:        container.Env,
+			Labels:     container.Labels,
+			User:       container.User,
+		}
+	}
+	return osbuild.NewOCIArchiveAssembler(&options)
+}
+
+// isoLabel returns the volume label of ISO images, which they boot their
+// squashfs image by
+func isoLabel(arch distro.Arch) string {
+	return fmt.Sprintf("RHEL-8-%s", arch.Name())
+}
+
+func bootISOAssembler(filename, kernelOpts string, arch distro.Arch) *osbuild.Assembler {
+	return osbuild.NewBootISOAssembler(
+		&osbuild.BootISOAssemblerOptions{
+			Filename: filename,
+			Product: osbuild.BootISOProductOptions{
+				Name:    "Red Hat Enterprise Linux",
+				Version: "8",
+			},
+			ISOLabel:   isoLabel(arch),
+			KernelOpts: kernelOpts,
+			EFI: &osbuild.BootISOEFIOptions{
+				Architectures: []string{"IA32", "X64"},
+				Vendor:        "redhat",
+			},
+			ISOLinux: true,
+			Hybrid:   true,
+			RootFS: &osbuild.BootISORootFSOptions{
+				Compression: "xz",
+			},
+		},
+	)
+}
+
 // New creates a new distro object, defining the supported architectures and image types
 func New() distro.Distro {
 	const GigaByte = 1024 * 1024 * 1024
@@ -721,6 +909,97 @@ func New() distro.Distro {
 			return ostreeCommitAssembler(options, arch)
 		},
 	}
+	edgeInstallerImgType := imageType{
+		name:     "rhel-edge-installer",
+		filename: "installer.iso",
+		mimeType: "application/x-iso9660-image",
+		packages: []string{
+			"anaconda", "anaconda-dracut", "anaconda-install-env-deps", "anaconda-widgets",
+			"redhat-release", "redhat-release-eula",
+			"kernel", "kernel-modules", "kernel-modules-extra",
+			"dracut-config-generic", "dracut-network",
+			"biosdevname", "glibc-all-langpacks", "kbd", "tmux",
+			"NetworkManager", "ostree", "rpm-ostree",
+			"lvm2", "cryptsetup", "xfsprogs",
+			"lorax-templates-generic", "lorax-templates-rhel",
+			// x86 specific
+			"grub2-efi-ia32-cdboot", "grub2-efi-x64-cdboot", "grub2-tools", "grub2-tools-extra",
+			"shim-ia32", "shim-x64", "efibootmgr", "syslinux", "memtest86+",
+		},
+		buildPackages: []string{
+			"isomd5sum", "lorax-templates-generic", "ostree", "squashfs-tools", "syslinux", "xorriso",
+		},
+		ostreeInstaller: true,
+		assembler: func(uefi bool, options distro.ImageOptions, arch distro.Arch) *osbuild.Assembler {
+			return bootISOAssembler("installer.iso", "inst.stage2=hd:LABEL="+isoLabel(arch), arch)
+		},
+	}
+	liveISOImgType := imageType{
+		name:     "liveiso",
+		filename: "live.iso",
+		mimeType: "application/x-iso9660-image",
+		packages: []string{
+			"@core",
+			"kernel",
+			"dracut-config-generic", "dracut-live",
+			"redhat-release", "redhat-release-eula",
+			"NetworkManager", "chrony", "langpacks-en",
+			// x86 specific
+			"grub2-efi-ia32-cdboot", "grub2-efi-x64-cdboot", "grub2-tools",
+			"shim-ia32", "shim-x64", "efibootmgr", "syslinux", "memtest86+",
+		},
+		excludedPackages: []string{
+			"dracut-config-rescue",
+		},
+		buildPackages: []string{
+			"isomd5sum", "squashfs-tools", "syslinux", "xorriso",
+		},
+		assembler: func(uefi bool, options distro.ImageOptions, arch distro.Arch) *osbuild.Assembler {
+			return bootISOAssembler("live.iso", fmt.Sprintf("root=live:CDLABEL=%s rd.live.image", isoLabel(arch)), arch)
+		},
+	}
+	imageInstallerImgType := imageType{
+		name:     "image-installer",
+		filename: "image-installer.iso",
+		mimeType: "application/x-iso9660-image",
+		packages: []string{
+			"@core",
+			"kernel",
+			"dracut-config-generic", "dracut-live",
+			"redhat-release", "redhat-release-eula",
+			"NetworkManager", "chrony", "langpacks-en",
+			// x86 specific
+			"grub2-efi-ia32-cdboot", "grub2-efi-x64-cdboot", "grub2-tools",
+			"shim-ia32", "shim-x64", "efibootmgr", "syslinux", "memtest86+",
+			"anaconda", "anaconda-dracut", "anaconda-install-env-deps", "anaconda-widgets",
+			"lorax-templates-generic", "lorax-templates-rhel",
+		},
+		excludedPackages: []string{
+			"dracut-config-rescue",
+		},
+		buildPackages: []string{
+			"isomd5sum", "lorax-templates-generic", "squashfs-tools", "syslinux", "xorriso",
+		},
+		liveInstaller: true,
+		assembler: func(uefi bool, options distro.ImageOptions, arch distro.Arch) *osbuild.Assembler {
+			return bootISOAssembler("image-installer.iso", "inst.stage2=hd:LABEL="+isoLabel(arch), arch)
+		},
+	}
+	containerImgType := imageType{
+		name:     "container",
+		filename: "container.tar",
+		mimeType: "application/x-tar",
+		packages: []string{
+			"bash", "coreutils-single", "glibc-minimal-langpack",
+			"redhat-release",
+			"dnf", "rpm", "rootfiles", "tar", "vim-minimal",
+			"policycoreutils", "selinux-policy-targeted",
+		},
+		excludedPackages: []string{
+			"kernel", "kernel-core", "dracut",
+		},
+		container: true,
+	}
 	amiImgType := imageType{
 		name:     "ami",
 		filename: "image.raw",
@@ -964,6 +1243,68 @@ func New() distro.Distro {
 		},
 	}
 
+	gceImgType := imageType{
+		name:     "gce",
+		filename: "disk.raw",
+		mimeType: "application/octet-stream",
+		packages: []string{
+			"@core",
+			"chrony",
+			"kernel",
+			"langpacks-en",
+			"selinux-policy-targeted",
+
+			// Google guest environment
+			"gce-disk-expand",
+			"google-compute-engine",
+			"google-osconfig-agent",
+
+			"acpid",
+			"dnf-automatic",
+			"net-tools",
+			"python3",
+			"rng-tools",
+			"tar",
+		},
+		excludedPackages: []string{
+			"dracut-config-rescue",
+
+			// setfiles fails because of usr/sbin/timedatex, exclude it until
+			// https://errata.devel.redhat.com/advisory/47339 lands
+			"timedatex",
+
+			// there is no sound or wireless hardware in Compute Engine
+			"alsa-utils",
+			"b43-fwcutter",
+			"iwl100-firmware",
+			"iwl1000-firmware",
+			"iwl105-firmware",
+			"iwl135-firmware",
+			"iwl2000-firmware",
+			"iwl2030-firmware",
+			"iwl3160-firmware",
+			"iwl5000-firmware",
+			"iwl5150-firmware",
+			"iwl6000-firmware",
+			"iwl6050-firmware",
+			"iwl7260-firmware",
+		},
+		enabledServices: []string{
+			"sshd",
+			"rngd",
+			"dnf-automatic.timer",
+		},
+		defaultTarget: "multi-user.target",
+		// These kernel parameters are recommended by the Compute Engine
+		// documentation for importing images
+		kernelOptions: "ro net.ifnames=0 biosdevname=0 scsi_mod.use_blk_mq=Y crashkernel=auto console=ttyS0,38400n8d",
+		bootable:      true,
+		defaultSize:   20 * GigaByte,
+		assembler: func(uefi bool, options distro.ImageOptions, arch distro.Arch) *osbuild.Assembler {
+			return qemuAssembler("raw", "disk.raw", uefi, options, arch)
+		},
+	}
+
 	vmdkImgType := imageType{
 		name:     "vmdk",
 		filename: "disk.vmdk",
@@ -1023,7 +1364,12 @@ func New() distro.Distro {
 	}
 	x8664.setImageTypes(
 		amiImgType,
+		containerImgType,
 		edgeImgTypeX86_64,
+		edgeInstallerImgType,
+		gceImgType,
+		imageInstallerImgType,
+		liveISOImgType,
 		qcow2ImageType,
 		openstackImgType,
 		tarImgType,
@@ -1045,6 +1391,7 @@ func New() distro.Distro {
 	}
 	aarch64.setImageTypes(
 		amiImgType,
+		containerImgType,
 		edgeImgTypeAarch64,
 		qcow2ImageType,
 		openstackImgType,
@@ -1068,6 +1415,7 @@ func New() distro.Distro {
 		uefi:   false,
 	}
 	ppc64le.setImageTypes(
+		containerImgType,
 		qcow2ImageType,
 		tarImgType,
 	)
@@ -1,11 +1,15 @@
 package rhel8_test
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/osbuild/osbuild-composer/internal/blueprint"
+	"github.com/osbuild/osbuild-composer/internal/distro"
 	"github.com/osbuild/osbuild-composer/internal/distro/distro_test_common"
 	"github.com/osbuild/osbuild-composer/internal/distro/rhel8"
+	"github.com/osbuild/osbuild-composer/internal/osbuild"
+	"github.com/osbuild/osbuild-composer/internal/rpmmd"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -26,6 +30,36 @@ func TestFilenameFromType(t *testing.T) {
 			want:  "image.raw",
 			want1: "application/octet-stream",
 		},
+		{
+			name:  "rhel-edge-installer",
+			args:  args{"rhel-edge-installer"},
+			want:  "installer.iso",
+			want1: "application/x-iso9660-image",
+		},
+		{
+			name:  "container",
+			args:  args{"container"},
+			want:  "container.tar",
+			want1: "application/x-tar",
+		},
+		{
+			name:  "gce",
+			args:  args{"gce"},
+			want:  "disk.raw",
+			want1: "application/octet-stream",
+		},
+		{
+			name:  "image-installer",
+			args:  args{"image-installer"},
+			want:  "image-installer.iso",
+			want1: "application/x-iso9660-image",
+		},
+		{
+			name:  "liveiso",
+			args:  args{"liveiso"},
+			want:  "live.iso",
+			want1: "application/x-iso9660-image",
+		},
 		{
 			name:  "openstack",
 			args:  args{"openstack"},
@@ -346,6 +380,200 @@ func TestImageType_BasePackages(t *testing.T) {
 	}
 }
 
+func TestImageType_BlueprintExcludes(t *testing.T) {
+	distro := rhel8.New()
+	arch, err := distro.GetArch("x86_64")
+	assert.NoError(t, err)
+	imgType, err := arch.GetImageType("openstack")
+	assert.NoError(t, err)
+
+	bp := blueprint.Blueprint{
+		Exclude: []string{"cloud-init"},
+	}
+	_, excludedPackages := imgType.Packages(bp)
+	assert.Equal(t, []string{"dracut-config-rescue", "cloud-init"}, excludedPackages)
+
+	// the excludes of one blueprint don't end up in those of another
+	_, otherExcludedPackages := imgType.Packages(blueprint.Blueprint{Exclude: []string{"vim-minimal"}})
+	assert.Equal(t, []string{"dracut-config-rescue", "vim-minimal"}, otherExcludedPackages)
+	assert.Equal(t, []string{"dracut-config-rescue", "cloud-init"}, excludedPackages)
+}
+
+func TestImageType_ModuleStreams(t *testing.T) {
+	options := distro.ImageOptions{
+		Size:    2 * 1024 * 1024 * 1024,
+		Modules: []rpmmd.ModuleStream{{Name: "nodejs", Stream: "14", Profile: "minimal"}},
+	}
+
+	distro := rhel8.New()
+	arch, err := distro.GetArch("x86_64")
+	assert.NoError(t, err)
+	imgType, err := arch.GetImageType("qcow2")
+	assert.NoError(t, err)
+
+	manifestJSON, err := imgType.Manifest(nil, options, nil, nil, nil)
+	assert.NoError(t, err)
+
+	var manifest osbuild.Manifest
+	err = json.Unmarshal(manifestJSON, &manifest)
+	assert.NoError(t, err)
+
+	var configs []*osbuild.DNFModuleConfig
+	for _, stage := range manifest.Pipeline.Stages {
+		if stage.Name == "org.osbuild.dnf.module-config" {
+			configs = append(configs, stage.Options.(*osbuild.DNFModuleConfigStageOptions).Conf)
+		}
+	}
+	assert.Equal(t, []*osbuild.DNFModuleConfig{
+		{Name: "nodejs", Stream: "14", Profiles: []string{"minimal"}, State: "enabled"},
+	}, configs)
+}
+
+func TestImageType_EdgeInstaller(t *testing.T) {
+	d := rhel8.New()
+	arch, err := d.GetArch("x86_64")
+	assert.NoError(t, err)
+	imgType, err := arch.GetImageType("rhel-edge-installer")
+	assert.NoError(t, err)
+
+	_, err = imgType.Manifest(nil, distro.ImageOptions{}, nil, nil, nil)
+	assert.EqualError(t, err, "rhel-edge-installer images require the url of the repository of the commit to install")
+
+	options := distro.ImageOptions{
+		OSTree: distro.OSTreeImageOptions{URL: "http://example.com/repo"},
+	}
+	manifestJSON, err := imgType.Manifest(nil, options, nil, nil, nil)
+	assert.NoError(t, err)
+
+	var manifest osbuild.Manifest
+	err = json.Unmarshal(manifestJSON, &manifest)
+	assert.NoError(t, err)
+
+	stages := make(map[string]osbuild.StageOptions)
+	for _, stage := range manifest.Pipeline.Stages {
+		stages[stage.Name] = stage.Options
+	}
+	assert.Equal(t, &osbuild.OSTreePullStageOptions{
+		Repo: "/ostree/repo",
+		URL:  "http://example.com/repo",
+		Ref:  "rhel/8/x86_64/edge",
+	}, stages["org.osbuild.ostree.pull"])
+	assert.Equal(t, &osbuild.KickstartStageOptions{
+		Path: "/usr/share/anaconda/interactive-defs.ks",
+		OSTree: &osbuild.KickstartOSTreeOptions{
+			OSName: "rhel",
+			Remote: "rhel",
+			URL:    "file:///ostree/repo",
+			Ref:    "rhel/8/x86_64/edge",
+		},
+	}, stages["org.osbuild.kickstart"])
+	assert.Equal(t, "org.osbuild.bootiso", manifest.Pipeline.Assembler.Name)
+	assert.Equal(t, "installer.iso", manifest.Pipeline.Assembler.Options.(*osbuild.BootISOAssemblerOptions).Filename)
+}
+
+func TestImageType_Container(t *testing.T) {
+	d := rhel8.New()
+	arch, err := d.GetArch("aarch64")
+	assert.NoError(t, err)
+	imgType, err := arch.GetImageType("container")
+	assert.NoError(t, err)
+
+	// containers don't boot, so they don't need a kernel or bootloader
+	packages, excludedPackages := imgType.Packages(blueprint.Blueprint{})
+	assert.NotContains(t, packages, "grub2-efi-aa64")
+	assert.Contains(t, excludedPackages, "kernel")
+
+	c := &blueprint.Customizations{
+		Container: &blueprint.ContainerCustomization{
+			Entrypoint: []string{"/usr/bin/httpd", "-DFOREGROUND"},
+			Env:        []string{"LANG=C.UTF-8"},
+			Labels:     map[string]string{"vendor": "test"},
+			User:       "apache",
+		},
+	}
+	manifestJSON, err := imgType.Manifest(c, distro.ImageOptions{}, nil, nil, nil)
+	assert.NoError(t, err)
+
+	var manifest osbuild.Manifest
+	err = json.Unmarshal(manifestJSON, &manifest)
+	assert.NoError(t, err)
+	assert.Equal(t, &osbuild.Assembler{
+		Name: "org.osbuild.oci-archive",
+		Options: &osbuild.OCIArchiveAssemblerOptions{
+			Filename:     "container.tar",
+			Architecture: "arm64",
+			Config: &osbuild.OCIArchiveAssemblerConfig{
+				Entrypoint: []string{"/usr/bin/httpd", "-DFOREGROUND"},
+				Env:        []string{"LANG=C.UTF-8"},
+				Labels:     map[string]string{"vendor": "test"},
+				User:       "apache",
+			},
+		},
+	}, manifest.Pipeline.Assembler)
+}
+
+func TestImageType_GCE(t *testing.T) {
+	d := rhel8.New()
+	arch, err := d.GetArch("x86_64")
+	assert.NoError(t, err)
+	imgType, err := arch.GetImageType("gce")
+	assert.NoError(t, err)
+
+	packages, _ := imgType.Packages(blueprint.Blueprint{})
+	assert.Contains(t, packages, "google-compute-engine")
+
+	manifestJSON, err := imgType.Manifest(nil, distro.ImageOptions{Size: imgType.Size(0)}, nil, nil, nil)
+	assert.NoError(t, err)
+
+	var manifest osbuild.Manifest
+	err = json.Unmarshal(manifestJSON, &manifest)
+	assert.NoError(t, err)
+	assert.Equal(t, "org.osbuild.qemu", manifest.Pipeline.Assembler.Name)
+	options := manifest.Pipeline.Assembler.Options.(*osbuild.QEMUAssemblerOptions)
+	assert.Equal(t, "raw", options.Format)
+	assert.Equal(t, "disk.raw", options.Filename)
+	assert.Equal(t, uint64(20*1024*1024*1024), options.Size)
+}
+
+func TestImageType_ImageInstaller(t *testing.T) {
+	d := rhel8.New()
+	arch, err := d.GetArch("x86_64")
+	assert.NoError(t, err)
+	imgType, err := arch.GetImageType("image-installer")
+	assert.NoError(t, err)
+
+	_, err = imgType.Manifest(nil, distro.ImageOptions{}, nil, nil, nil)
+	assert.EqualError(t, err, "image-installer images require the url of the image to install")
+
+	options := distro.ImageOptions{
+		Installer: distro.InstallerImageOptions{URL: "http://example.com/root.tar.xz"},
+	}
+	manifestJSON, err := imgType.Manifest(nil, options, nil, nil, nil)
+	assert.NoError(t, err)
+
+	var manifest osbuild.Manifest
+	err = json.Unmarshal(manifestJSON, &manifest)
+	assert.NoError(t, err)
+
+	stages := make(map[string]osbuild.StageOptions)
+	for _, stage := range manifest.Pipeline.Stages {
+		stages[stage.Name] = stage.Options
+	}
+	// the installer installs the given image, not its own tree
+	assert.Equal(t, &osbuild.KickstartStageOptions{
+		Path: "/usr/share/anaconda/interactive-defs.ks",
+		LiveImg: &osbuild.KickstartLiveImgOptions{
+			URL: "http://example.com/root.tar.xz",
+		},
+	}, stages["org.osbuild.kickstart"])
+	assert.Contains(t, stages, "org.osbuild.anaconda")
+
+	assemblerOptions := manifest.Pipeline.Assembler.Options.(*osbuild.BootISOAssemblerOptions)
+	assert.Equal(t, "image-installer.iso", assemblerOptions.Filename)
+	assert.Equal(t, "inst.stage2=hd:LABEL=RHEL-8-x86_64", assemblerOptions.KernelOpts)
+	assert.True(t, assemblerOptions.Hybrid)
+}
+
 func TestDistro_Manifest(t *testing.T) {
 	distro_test_common.TestDistro_Manifest(t, "../../../test/data/cases/", "rhel_8*", rhel8.New())
 }
@@ -177,6 +177,10 @@ func (q *fsJobQueue) Dequeue(ctx context.Context, jobTypes []string, args interf
 		}
 
 		j, err = q.readJob(id)
+		if err == jobqueue.ErrNotExist {
+			// the job was deleted after it was canceled
+			continue
+		}
 		if err != nil {
 			return uuid.Nil, err
 		}
@@ -269,6 +273,27 @@ func (q *fsJobQueue) CancelJob(id uuid.UUID) error {
 	return nil
 }
 
+func (q *fsJobQueue) DeleteJob(id uuid.UUID) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	j, err := q.readJob(id)
+	if err != nil {
+		return err
+	}
+
+	if j.FinishedAt.IsZero() && !j.Canceled {
+		return jobqueue.ErrNotFinished
+	}
+
+	err = q.db.Delete(id.String())
+	if err != nil {
+		return fmt.Errorf("error deleting job %s: %v", id, err)
+	}
+
+	return nil
+}
+
 func (q *fsJobQueue) JobStatus(id uuid.UUID, result interface{}) (queued, started, finished time.Time, canceled bool, err error) {
 	j, err := q.readJob(id)
 	if err != nil {
@@ -291,6 +316,20 @@ func (q *fsJobQueue) JobStatus(id uuid.UUID, result interface{}) (queued, starte
 	return
 }
 
+func (q *fsJobQueue) JobArgs(id uuid.UUID, args interface{}) error {
+	j, err := q.readJob(id)
+	if err != nil {
+		return err
+	}
+
+	err = json.Unmarshal(j.Args, args)
+	if err != nil {
+		return fmt.Errorf("error unmarshaling arguments for job '%s': %v", id, err)
+	}
+
+	return nil
+}
+
 // Reads job with `id`. This is a thin wrapper around `q.db.Read`, which
 // returns the job directly, or and error if a job with `id` does not exist.
 func (q *fsJobQueue) readJob(id uuid.UUID) (*job, error) {
@@ -317,6 +356,10 @@ func (q *fsJobQueue) maybeEnqueue(j *job, updateDependants bool) error {
 	depsFinished := true
 	for _, id := range j.Dependencies {
 		j, err := q.readJob(id)
+		if err == jobqueue.ErrNotExist {
+			// only finished jobs are deleted
+			continue
+		}
 		if err != nil {
 			return err
 		}
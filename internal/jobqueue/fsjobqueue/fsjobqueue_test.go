@@ -90,6 +90,13 @@ func TestArgs(t *testing.T) {
 	two := pushTestJob(t, q, "octopus", twoargs, nil)
 
 	var args argument
+	err := q.JobArgs(one, &args)
+	require.NoError(t, err)
+	require.Equal(t, oneargs, args)
+
+	err = q.JobArgs(uuid.New(), &args)
+	require.Equal(t, jobqueue.ErrNotExist, err)
+
 	id, err := q.Dequeue(context.Background(), []string{"octopus"}, &args)
 	require.NoError(t, err)
 	require.Equal(t, two, id)
@@ -255,3 +262,53 @@ func TestCancel(t *testing.T) {
 	require.NoError(t, err)
 	require.False(t, canceled)
 }
+
+func TestDeleteJob(t *testing.T) {
+	q, dir := newTemporaryQueue(t, []string{"octopus", "clownfish"})
+	defer cleanupTempDir(t, dir)
+
+	// Delete a non-existing job
+	err := q.DeleteJob(uuid.New())
+	require.Equal(t, jobqueue.ErrNotExist, err)
+
+	// Pending and running jobs cannot be deleted
+	one := pushTestJob(t, q, "octopus", nil, nil)
+	err = q.DeleteJob(one)
+	require.Equal(t, jobqueue.ErrNotFinished, err)
+	two := pushTestJob(t, q, "clownfish", nil, []uuid.UUID{one})
+	r, err := q.Dequeue(context.Background(), []string{"octopus"}, &json.RawMessage{})
+	require.NoError(t, err)
+	require.Equal(t, one, r)
+	err = q.DeleteJob(one)
+	require.Equal(t, jobqueue.ErrNotFinished, err)
+
+	// Delete a finished job
+	err = q.FinishJob(one, &testResult{})
+	require.NoError(t, err)
+	err = q.DeleteJob(one)
+	require.NoError(t, err)
+	_, _, _, _, err = q.JobStatus(one, &testResult{})
+	require.Equal(t, jobqueue.ErrNotExist, err)
+
+	// Delete a canceled job, which is not dequeued anymore
+	three := pushTestJob(t, q, "clownfish", nil, nil)
+	err = q.CancelJob(three)
+	require.NoError(t, err)
+	err = q.DeleteJob(three)
+	require.NoError(t, err)
+	r, err = q.Dequeue(context.Background(), []string{"clownfish"}, &json.RawMessage{})
+	require.NoError(t, err)
+	require.Equal(t, two, r)
+	err = q.FinishJob(two, &testResult{})
+	require.NoError(t, err)
+
+	// Dependencies of jobs may have been deleted when reloading the queue
+	four := pushTestJob(t, q, "octopus", nil, []uuid.UUID{two})
+	err = q.DeleteJob(two)
+	require.NoError(t, err)
+	q, err = fsjobqueue.New(dir, []string{"octopus", "clownfish"})
+	require.NoError(t, err)
+	r, err = q.Dequeue(context.Background(), []string{"octopus"}, &json.RawMessage{})
+	require.NoError(t, err)
+	require.Equal(t, four, r)
+}
@@ -58,10 +58,18 @@ type JobQueue interface {
 	//
 	// If the job is finished, its result will be returned in `result`.
 	JobStatus(id uuid.UUID, result interface{}) (queued, started, finished time.Time, canceled bool, err error)
+
+	// Returns the arguments the job with `id` was enqueued with in `args`.
+	JobArgs(id uuid.UUID, args interface{}) error
+
+	// Delete a job which has finished or was canceled. Jobs depending on a
+	// deleted job treat it as finished.
+	DeleteJob(id uuid.UUID) error
 }
 
 var (
-	ErrNotExist   = errors.New("job does not exist")
-	ErrNotRunning = errors.New("job is not running")
-	ErrCanceled   = errors.New("job ws canceled")
+	ErrNotExist    = errors.New("job does not exist")
+	ErrNotRunning  = errors.New("job is not running")
+	ErrCanceled    = errors.New("job ws canceled")
+	ErrNotFinished = errors.New("job is not finished")
 )
@@ -146,6 +146,21 @@ func (q *testJobQueue) CancelJob(id uuid.UUID) error {
 	return nil
 }
 
+func (q *testJobQueue) DeleteJob(id uuid.UUID) error {
+	j, exists := q.jobs[id]
+	if !exists {
+		return jobqueue.ErrNotExist
+	}
+
+	if j.FinishedAt.IsZero() && !j.Canceled {
+		return jobqueue.ErrNotFinished
+	}
+
+	delete(q.jobs, id)
+
+	return nil
+}
+
 func (q *testJobQueue) JobStatus(id uuid.UUID, result interface{}) (queued, started, finished time.Time, canceled bool, err error) {
 	j, exists := q.jobs[id]
 	if !exists {
@@ -168,6 +183,15 @@ func (q *testJobQueue) JobStatus(id uuid.UUID, result interface{}) (queued, star
 	return
 }
 
+func (q *testJobQueue) JobArgs(id uuid.UUID, args interface{}) error {
+	j, exists := q.jobs[id]
+	if !exists {
+		return jobqueue.ErrNotExist
+	}
+
+	return json.Unmarshal(j.Args, args)
+}
+
 // Returns the number of finished jobs in `ids`.
 func (q *testJobQueue) countFinishedJobs(ids []uuid.UUID) (int, error) {
 	n := 0
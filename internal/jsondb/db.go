@@ -1,8 +1,8 @@
 // Package jsondb implements a simple database of JSON documents, backed by the
 // file system.
 //
-// It supports two operations: Read() and Write(). Their signatures mirror
-// those of json.Unmarshal() and json.Marshal():
+// It supports two main operations: Read() and Write(). Their signatures
+// mirror those of json.Unmarshal() and json.Marshal():
 //
 //     err := db.Write("my-string", "octopus")
 //
@@ -72,14 +72,28 @@ func (db *JSONDatabase) List() ([]string, error) {
 		return nil, err
 	}
 
-	names := make([]string, len(infos))
-	for i, info := range infos {
-		names[i] = strings.TrimSuffix(info.Name(), ".json")
+	names := make([]string, 0, len(infos))
+	for _, info := range infos {
+		// skip temporary files of interrupted writes
+		if !strings.HasSuffix(info.Name(), ".json") {
+			continue
+		}
+		names = append(names, strings.TrimSuffix(info.Name(), ".json"))
 	}
 
 	return names, nil
 }
 
+// Deletes the document at `name`. Deleting a document which does not exist is
+// not an error.
+func (db *JSONDatabase) Delete(name string) error {
+	err := os.Remove(path.Join(db.dir, name+".json"))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error deleting db file %s: %v", name, err)
+	}
+	return nil
+}
+
 // Writes `document` to `name`, overwriting a previous document if it exists.
 // `document` must be serializable to JSON.
 func (db *JSONDatabase) Write(name string, document interface{}) error {
@@ -123,6 +123,11 @@ func TestMultiple(t *testing.T) {
 		err = db.Write(name, doc)
 		require.NoError(t, err)
 	}
+
+	// leftovers of interrupted writes are not documents
+	err = ioutil.WriteFile(path.Join(dir, "four.json-123.tmp"), []byte("{"), perm)
+	require.NoError(t, err)
+
 	names, err := db.List()
 	require.NoError(t, err)
 	require.ElementsMatch(t, []string{"one", "two", "three"}, names)
@@ -135,3 +140,23 @@ func TestMultiple(t *testing.T) {
 		require.Equalf(t, doc, d, "error retrieving document '%s'", name)
 	}
 }
+
+func TestDelete(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jsondb-test-")
+	require.NoError(t, err)
+	defer cleanupTempDir(t, dir)
+
+	db := jsondb.New(dir, 0600)
+	err = db.Write("one", document{"octopus", true})
+	require.NoError(t, err)
+
+	err = db.Delete("one")
+	require.NoError(t, err)
+	exists, err := db.Read("one", nil)
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	// deleting a document twice is fine
+	err = db.Delete("one")
+	require.NoError(t, err)
+}
@@ -120,12 +120,12 @@ func (h *apiHandlers) PostCompose(ctx echo.Context) error {
 			panic("Could not initialize empty blueprint.")
 		}
 		packageSpecs, _ := imageType.Packages(*bp)
-		packages, _, err := h.server.rpmMetadata.Depsolve(packageSpecs, nil, repositories, d.ModulePlatformID(), arch.Name())
+		packages, _, err := h.server.rpmMetadata.Depsolve(packageSpecs, nil, nil, repositories, d.ModulePlatformID(), arch.Name())
 		if err != nil {
 			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Failed to depsolve base base packages for %s/%s/%s: %s", ir.ImageType, ir.Architecture, request.Distribution, err))
 		}
 		buildPackageSpecs := imageType.BuildPackages()
-		buildPackages, _, err := h.server.rpmMetadata.Depsolve(buildPackageSpecs, nil, repositories, d.ModulePlatformID(), arch.Name())
+		buildPackages, _, err := h.server.rpmMetadata.Depsolve(buildPackageSpecs, nil, nil, repositories, d.ModulePlatformID(), arch.Name())
 		if err != nil {
 			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Failed to depsolve build packages for %s/%s/%s: %s", ir.ImageType, ir.Architecture, request.Distribution, err))
 		}
@@ -86,12 +86,12 @@ func BaseFixture() Fixture {
 	return Fixture{
 		fetchPackageList{
 			generatePackageList(),
-			map[string]string{"base": "sha256:f34848ca92665c342abd5816c9e3eda0e82180671195362bcd0080544a3bc2ac"},
+			map[string]string{"test-id": "sha256:f34848ca92665c342abd5816c9e3eda0e82180671195362bcd0080544a3bc2ac"},
 			nil,
 		},
 		depsolve{
 			createBaseDepsolveFixture(),
-			map[string]string{"base": "sha256:f34848ca92665c342abd5816c9e3eda0e82180671195362bcd0080544a3bc2ac"},
+			map[string]string{"0": "sha256:f34848ca92665c342abd5816c9e3eda0e82180671195362bcd0080544a3bc2ac"},
 			nil,
 		},
 		store.FixtureBase(),
@@ -99,16 +99,60 @@ func BaseFixture() Fixture {
 	}
 }
 
+// LockableFixture is like BaseFixture, but the depsolved packages are also
+// available in the repositories, so that they can be locked and composed
+func LockableFixture() Fixture {
+	packageList := generatePackageList()
+	for _, dep := range createBaseDepsolveFixture() {
+		packageList = append(packageList, rpmmd.Package{
+			Name:    dep.Name,
+			Epoch:   dep.Epoch,
+			Version: dep.Version,
+			Release: dep.Release,
+			Arch:    dep.Arch,
+		})
+	}
+
+	return Fixture{
+		fetchPackageList{
+			packageList,
+			map[string]string{"test-id": "sha256:f34848ca92665c342abd5816c9e3eda0e82180671195362bcd0080544a3bc2ac"},
+			nil,
+		},
+		depsolve{
+			createBaseDepsolveFixture(),
+			map[string]string{"0": "sha256:f34848ca92665c342abd5816c9e3eda0e82180671195362bcd0080544a3bc2ac"},
+			nil,
+		},
+		store.FixtureBase(),
+		createBaseWorkersFixture(),
+	}
+}
+
+// RebuiltPackagesFixture is like LockableFixture, but the depsolved packages
+// were rebuilt in the repositories with the same NEVRAs, so that their
+// checksums differ
+func RebuiltPackagesFixture() Fixture {
+	fixture := LockableFixture()
+	for i := range fixture.depsolve.ret {
+		fixture.depsolve.ret[i].Checksum = "sha256:locked"
+	}
+	for i := range fixture.fetchPackageList.ret {
+		fixture.fetchPackageList.ret[i].Checksum = "sha256:rebuilt"
+	}
+	return fixture
+}
+
 func NoComposesFixture() Fixture {
 	return Fixture{
 		fetchPackageList{
 			generatePackageList(),
-			map[string]string{"base": "sha256:f34848ca92665c342abd5816c9e3eda0e82180671195362bcd0080544a3bc2ac"},
+			map[string]string{"test-id": "sha256:f34848ca92665c342abd5816c9e3eda0e82180671195362bcd0080544a3bc2ac"},
 			nil,
 		},
 		depsolve{
 			createBaseDepsolveFixture(),
-			map[string]string{"base": "sha256:f34848ca92665c342abd5816c9e3eda0e82180671195362bcd0080544a3bc2ac"},
+			map[string]string{"0": "sha256:f34848ca92665c342abd5816c9e3eda0e82180671195362bcd0080544a3bc2ac"},
 			nil,
 		},
 		store.FixtureEmpty(),
@@ -120,7 +164,7 @@ func NonExistingPackage() Fixture {
 	return Fixture{
 		fetchPackageList{
 			generatePackageList(),
-			map[string]string{"base": "sha256:f34848ca92665c342abd5816c9e3eda0e82180671195362bcd0080544a3bc2ac"},
+			map[string]string{"test-id": "sha256:f34848ca92665c342abd5816c9e3eda0e82180671195362bcd0080544a3bc2ac"},
 			nil,
 		},
 		depsolve{
@@ -140,7 +184,7 @@ func BadDepsolve() Fixture {
 	return Fixture{
 		fetchPackageList{
 			generatePackageList(),
-			map[string]string{"base": "sha256:f34848ca92665c342abd5816c9e3eda0e82180671195362bcd0080544a3bc2ac"},
+			map[string]string{"test-id": "sha256:f34848ca92665c342abd5816c9e3eda0e82180671195362bcd0080544a3bc2ac"},
 			nil,
 		},
 		depsolve{
@@ -156,6 +200,46 @@ func BadDepsolve() Fixture {
 	}
 }
 
+func DepsolveProblems() Fixture {
+	return Fixture{
+		fetchPackageList{
+			generatePackageList(),
+			map[string]string{"test-id": "sha256:f34848ca92665c342abd5816c9e3eda0e82180671195362bcd0080544a3bc2ac"},
+			nil,
+		},
+		depsolve{
+			nil,
+			nil,
+			&rpmmd.DNFError{
+				Kind:   "DepsolveError",
+				Reason: "There was a problem depsolving ['dep-package1', 'dep-package3']: \n Problem: conflicting requests\n  - nothing provides libdep.so.2 needed by dep-package1-1.33-2.fc30.x86_64",
+				Problems: []rpmmd.DepsolveProblem{
+					{
+						Kind:        rpmmd.ProblemMissingRequirement,
+						Message:     "nothing provides libdep.so.2 needed by dep-package1-1.33-2.fc30.x86_64",
+						Spec:        "dep-package1",
+						Package:     "dep-package1-1.33-2.fc30.x86_64",
+						Requirement: "libdep.so.2",
+					},
+					{
+						Kind:      rpmmd.ProblemConflict,
+						Message:   "package dep-package3-7:3.0.3-1.fc30.x86_64 conflicts with dep-package2 provided by dep-package2-2.9-1.fc30.x86_64",
+						Spec:      "dep-package3",
+						Package:   "dep-package3-7:3.0.3-1.fc30.x86_64",
+						Conflicts: []string{"dep-package2-2.9-1.fc30.x86_64"},
+					},
+					{
+						Kind:    rpmmd.ProblemOther,
+						Message: "conflicting requests",
+					},
+				},
+			},
+		},
+		store.FixtureBase(),
+		createBaseWorkersFixture(),
+	}
+}
+
 func BadFetch() Fixture {
 	return Fixture{
 		fetchPackageList{
@@ -0,0 +1,17 @@
+package osbuild
+
+// The AnacondaStageOptions configure the Anaconda installer in the tree.
+type AnacondaStageOptions struct {
+	// The kickstart modules Anaconda enables
+	KickstartModules []string `json:"kickstart-modules"`
+}
+
+func (AnacondaStageOptions) isStageOptions() {}
+
+// NewAnacondaStage creates a new Anaconda Stage object.
+func NewAnacondaStage(options *AnacondaStageOptions) *Stage {
+	return &Stage{
+		Name:    "org.osbuild.anaconda",
+		Options: options,
+	}
+}
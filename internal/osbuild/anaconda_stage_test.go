@@ -0,0 +1,16 @@
+package osbuild
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewAnacondaStage(t *testing.T) {
+	expectedStage := &Stage{
+		Name:    "org.osbuild.anaconda",
+		Options: &AnacondaStageOptions{},
+	}
+	actualStage := NewAnacondaStage(&AnacondaStageOptions{})
+	assert.Equal(t, expectedStage, actualStage)
+}
@@ -32,6 +32,10 @@ func (assembler *Assembler) UnmarshalJSON(data []byte) error {
 	}
 	var options AssemblerOptions
 	switch rawAssembler.Name {
+	case "org.osbuild.bootiso":
+		options = new(BootISOAssemblerOptions)
+	case "org.osbuild.oci-archive":
+		options = new(OCIArchiveAssemblerOptions)
 	case "org.osbuild.ostree.commit":
 		options = new(OSTreeCommitAssemblerOptions)
 	case "org.osbuild.qemu":
@@ -108,6 +108,64 @@ func TestAssembler_UnmarshalJSON(t *testing.T) {
 			},
 			data: []byte(`{"name":"org.osbuild.rawfs","options":{"filename":"filesystem.img","root_fs_uuid":"76a22bf4-f153-4541-b6c7-0332c0dfaeac","size":2147483648}}`),
 		},
+		{
+			name: "live bootiso assembler",
+			assembler: Assembler{
+				Name: "org.osbuild.bootiso",
+				Options: &BootISOAssemblerOptions{
+					Filename: "live.iso",
+					Product: BootISOProductOptions{
+						Name:    "Fedora",
+						Version: "33",
+					},
+					ISOLabel:   "Fedora-33-x86_64",
+					KernelOpts: "root=live:CDLABEL=Fedora-33-x86_64 rd.live.image",
+					ISOLinux:   true,
+					Hybrid:     true,
+					RootFS: &BootISORootFSOptions{
+						Compression: "xz",
+					},
+				},
+			},
+			data: []byte(`{"name":"org.osbuild.bootiso","options":{"filename":"live.iso","product":{"name":"Fedora","version":"33"},"isolabel":"Fedora-33-x86_64","kernel_opts":"root=live:CDLABEL=Fedora-33-x86_64 rd.live.image","isolinux":true,"hybrid":true,"rootfs":{"compression":"xz"}}}`),
+		},
+		{
+			name: "bootiso assembler",
+			assembler: Assembler{
+				Name: "org.osbuild.bootiso",
+				Options: &BootISOAssemblerOptions{
+					Filename: "installer.iso",
+					Product: BootISOProductOptions{
+						Name:    "Red Hat Enterprise Linux",
+						Version: "8",
+					},
+					ISOLabel: "RHEL-8-x86_64",
+					EFI: &BootISOEFIOptions{
+						Architectures: []string{"IA32", "X64"},
+						Vendor:        "redhat",
+					},
+					ISOLinux: true,
+				},
+			},
+			data: []byte(`{"name":"org.osbuild.bootiso","options":{"filename":"installer.iso","product":{"name":"Red Hat Enterprise Linux","version":"8"},"isolabel":"RHEL-8-x86_64","efi":{"architectures":["IA32","X64"],"vendor":"redhat"},"isolinux":true}}`),
+		},
+		{
+			name: "oci-archive assembler",
+			assembler: Assembler{
+				Name: "org.osbuild.oci-archive",
+				Options: &OCIArchiveAssemblerOptions{
+					Filename:     "container.tar",
+					Architecture: "amd64",
+					Config: &OCIArchiveAssemblerConfig{
+						Entrypoint: []string{"/usr/bin/httpd", "-DFOREGROUND"},
+						Env:        []string{"LANG=C.UTF-8"},
+						Labels:     map[string]string{"vendor": "test"},
+						User:       "apache",
+					},
+				},
+			},
+			data: []byte(`{"name":"org.osbuild.oci-archive","options":{"filename":"container.tar","architecture":"amd64","config":{"Entrypoint":["/usr/bin/httpd","-DFOREGROUND"],"Env":["LANG=C.UTF-8"],"Labels":{"vendor":"test"},"User":"apache"}}}`),
+		},
 		{
 			name: "ostree commit assembler",
 			assembler: Assembler{
@@ -169,3 +227,21 @@ func TestNewRawFSAssembler(t *testing.T) {
 	}
 	assert.Equal(t, expectedAssembler, NewRawFSAssembler(options))
 }
+
+func TestNewBootISOAssembler(t *testing.T) {
+	options := &BootISOAssemblerOptions{}
+	expectedAssembler := &Assembler{
+		Name:    "org.osbuild.bootiso",
+		Options: &BootISOAssemblerOptions{},
+	}
+	assert.Equal(t, expectedAssembler, NewBootISOAssembler(options))
+}
+
+func TestNewOCIArchiveAssembler(t *testing.T) {
+	options := &OCIArchiveAssemblerOptions{}
+	expectedAssembler := &Assembler{
+		Name:    "org.osbuild.oci-archive",
+		Options: &OCIArchiveAssemblerOptions{},
+	}
+	assert.Equal(t, expectedAssembler, NewOCIArchiveAssembler(options))
+}
@@ -0,0 +1,46 @@
+package osbuild
+
+// BootISOAssemblerOptions describe how to assemble a tree into a bootable
+// ISO image. The tree is compressed into the squashfs image
+// LiveOS/squashfs.img of the ISO, which boots the kernel and initrd of the
+// tree from it.
+type BootISOAssemblerOptions struct {
+	Filename string                `json:"filename"`
+	Product  BootISOProductOptions `json:"product"`
+	ISOLabel string                `json:"isolabel"`
+	// The kernel to boot, the latest one in the tree if empty
+	Kernel     string             `json:"kernel,omitempty"`
+	KernelOpts string             `json:"kernel_opts,omitempty"`
+	EFI        *BootISOEFIOptions `json:"efi,omitempty"`
+	ISOLinux   bool               `json:"isolinux,omitempty"`
+	// Make the ISO bootable from USB drives as well, by adding a hybrid MBR
+	Hybrid bool                  `json:"hybrid,omitempty"`
+	RootFS *BootISORootFSOptions `json:"rootfs,omitempty"`
+}
+
+// BootISOProductOptions describe the product the ISO installs
+type BootISOProductOptions struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// BootISOEFIOptions make the ISO bootable on UEFI systems
+type BootISOEFIOptions struct {
+	Architectures []string `json:"architectures"`
+	Vendor        string   `json:"vendor"`
+}
+
+// BootISORootFSOptions describe the squashfs image of the tree
+type BootISORootFSOptions struct {
+	Compression string `json:"compression"`
+}
+
+func (BootISOAssemblerOptions) isAssemblerOptions() {}
+
+// NewBootISOAssembler creates a new Boot ISO Assembler object.
+func NewBootISOAssembler(options *BootISOAssemblerOptions) *Assembler {
+	return &Assembler{
+		Name:    "org.osbuild.bootiso",
+		Options: options,
+	}
+}
@@ -0,0 +1,23 @@
+package osbuild
+
+// The DNFModuleConfigStageOptions describe the state of a module stream, as
+// it is written to /etc/dnf/modules.d/<name>.module in the image.
+type DNFModuleConfigStageOptions struct {
+	Conf *DNFModuleConfig `json:"conf"`
+}
+
+func (DNFModuleConfigStageOptions) isStageOptions() {}
+
+type DNFModuleConfig struct {
+	Name     string   `json:"name"`
+	Stream   string   `json:"stream,omitempty"`
+	Profiles []string `json:"profiles,omitempty"`
+	State    string   `json:"state,omitempty"`
+}
+
+func NewDNFModuleConfigStage(options *DNFModuleConfigStageOptions) *Stage {
+	return &Stage{
+		Name:    "org.osbuild.dnf.module-config",
+		Options: options,
+	}
+}
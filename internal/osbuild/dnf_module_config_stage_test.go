@@ -0,0 +1,24 @@
+package osbuild
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewDNFModuleConfigStage(t *testing.T) {
+	options := &DNFModuleConfigStageOptions{
+		Conf: &DNFModuleConfig{
+			Name:     "nodejs",
+			Stream:   "14",
+			Profiles: []string{"default"},
+			State:    "enabled",
+		},
+	}
+	expectedStage := &Stage{
+		Name:    "org.osbuild.dnf.module-config",
+		Options: options,
+	}
+	actualStage := NewDNFModuleConfigStage(options)
+	assert.Equal(t, expectedStage, actualStage)
+}
@@ -0,0 +1,35 @@
+package osbuild
+
+// The KickstartStageOptions describe the kickstart file to write into the
+// tree, for Anaconda to install the system it describes.
+type KickstartStageOptions struct {
+	// Path of the kickstart file in the tree
+	Path    string                   `json:"path"`
+	OSTree  *KickstartOSTreeOptions  `json:"ostree,omitempty"`
+	LiveImg *KickstartLiveImgOptions `json:"liveimg,omitempty"`
+}
+
+// KickstartOSTreeOptions make the kickstart deploy an OSTree commit.
+type KickstartOSTreeOptions struct {
+	OSName string `json:"osname"`
+	URL    string `json:"url"`
+	Ref    string `json:"ref"`
+	Remote string `json:"remote,omitempty"`
+	GPG    bool   `json:"gpg"`
+}
+
+// KickstartLiveImgOptions make the kickstart install the disk image or
+// tarball at URL.
+type KickstartLiveImgOptions struct {
+	URL string `json:"url"`
+}
+
+func (KickstartStageOptions) isStageOptions() {}
+
+// NewKickstartStage creates a new Kickstart Stage object.
+func NewKickstartStage(options *KickstartStageOptions) *Stage {
+	return &Stage{
+		Name:    "org.osbuild.kickstart",
+		Options: options,
+	}
+}
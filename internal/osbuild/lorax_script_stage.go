@@ -0,0 +1,19 @@
+package osbuild
+
+// The LoraxScriptStageOptions specify a lorax template to run on the tree,
+// as lorax does to turn an installed system into an installer root.
+type LoraxScriptStageOptions struct {
+	// Path of the template, relative to the lorax templates directory
+	Path     string `json:"path"`
+	BaseArch string `json:"basearch,omitempty"`
+}
+
+func (LoraxScriptStageOptions) isStageOptions() {}
+
+// NewLoraxScriptStage creates a new Lorax Script Stage object.
+func NewLoraxScriptStage(options *LoraxScriptStageOptions) *Stage {
+	return &Stage{
+		Name:    "org.osbuild.lorax-script",
+		Options: options,
+	}
+}
@@ -0,0 +1,16 @@
+package osbuild
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewLoraxScriptStage(t *testing.T) {
+	expectedStage := &Stage{
+		Name:    "org.osbuild.lorax-script",
+		Options: &LoraxScriptStageOptions{},
+	}
+	actualStage := NewLoraxScriptStage(&LoraxScriptStageOptions{})
+	assert.Equal(t, expectedStage, actualStage)
+}
@@ -0,0 +1,32 @@
+package osbuild
+
+// OCIArchiveAssemblerOptions describe how to assemble a tree into an OCI
+// image archive.
+//
+// The assembler makes the tree the only layer of the image, and stores the
+// archive with the given filename.
+type OCIArchiveAssemblerOptions struct {
+	Filename     string                     `json:"filename"`
+	Architecture string                     `json:"architecture"`
+	Config       *OCIArchiveAssemblerConfig `json:"config,omitempty"`
+}
+
+// OCIArchiveAssemblerConfig is the config of the image, which container
+// runtimes run it with. The names of the fields are the ones of the OCI
+// image specification.
+type OCIArchiveAssemblerConfig struct {
+	Entrypoint []string          `json:"Entrypoint,omitempty"`
+	Env        []string          `json:"Env,omitempty"`
+	Labels     map[string]string `json:"Labels,omitempty"`
+	User       string            `json:"User,omitempty"`
+}
+
+func (OCIArchiveAssemblerOptions) isAssemblerOptions() {}
+
+// NewOCIArchiveAssembler creates a new OCI Archive Assembler object.
+func NewOCIArchiveAssembler(options *OCIArchiveAssemblerOptions) *Assembler {
+	return &Assembler{
+		Name:    "org.osbuild.oci-archive",
+		Options: options,
+	}
+}
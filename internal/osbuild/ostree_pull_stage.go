@@ -0,0 +1,22 @@
+package osbuild
+
+// The OSTreePullStageOptions describe the OSTree commit to pull into a
+// repository in the tree.
+type OSTreePullStageOptions struct {
+	// Path of the repository in the tree, which is created if it doesn't exist
+	Repo string `json:"repo"`
+	// URL of the repository the commit is pulled from
+	URL string `json:"url"`
+	// The ref whose latest commit is pulled
+	Ref string `json:"ref"`
+}
+
+func (OSTreePullStageOptions) isStageOptions() {}
+
+// NewOSTreePullStage creates a new OSTree Pull Stage object.
+func NewOSTreePullStage(options *OSTreePullStageOptions) *Stage {
+	return &Stage{
+		Name:    "org.osbuild.ostree.pull",
+		Options: options,
+	}
+}
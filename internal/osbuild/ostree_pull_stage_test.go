@@ -0,0 +1,16 @@
+package osbuild
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewOSTreePullStage(t *testing.T) {
+	expectedStage := &Stage{
+		Name:    "org.osbuild.ostree.pull",
+		Options: &OSTreePullStageOptions{},
+	}
+	actualStage := NewOSTreePullStage(&OSTreePullStageOptions{})
+	assert.Equal(t, expectedStage, actualStage)
+}
@@ -56,6 +56,8 @@ func (stage *Stage) UnmarshalJSON(data []byte) error {
 		options = new(TimezoneStageOptions)
 	case "org.osbuild.chrony":
 		options = new(ChronyStageOptions)
+	case "org.osbuild.dnf.module-config":
+		options = new(DNFModuleConfigStageOptions)
 	case "org.osbuild.keymap":
 		options = new(KeymapStageOptions)
 	case "org.osbuild.firewall":
@@ -68,6 +70,14 @@ func (stage *Stage) UnmarshalJSON(data []byte) error {
 		options = new(SystemdStageOptions)
 	case "org.osbuild.script":
 		options = new(ScriptStageOptions)
+	case "org.osbuild.ostree.pull":
+		options = new(OSTreePullStageOptions)
+	case "org.osbuild.kickstart":
+		options = new(KickstartStageOptions)
+	case "org.osbuild.anaconda":
+		options = new(AnacondaStageOptions)
+	case "org.osbuild.lorax-script":
+		options = new(LoraxScriptStageOptions)
 	default:
 		return fmt.Errorf("unexpected stage name: %s", rawStage.Name)
 	}
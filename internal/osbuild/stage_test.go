@@ -52,6 +52,18 @@ func TestStage_UnmarshalJSON(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "anaconda",
+			fields: fields{
+				Name: "org.osbuild.anaconda",
+				Options: &AnacondaStageOptions{
+					KickstartModules: []string{"org.fedoraproject.Anaconda.Modules.Network"},
+				},
+			},
+			args: args{
+				data: []byte(`{"name":"org.osbuild.anaconda","options":{"kickstart-modules":["org.fedoraproject.Anaconda.Modules.Network"]}}`),
+			},
+		},
 		{
 			name: "chrony",
 			fields: fields{
@@ -62,6 +74,23 @@ func TestStage_UnmarshalJSON(t *testing.T) {
 				data: []byte(`{"name":"org.osbuild.chrony","options":{"timeservers":null}}`),
 			},
 		},
+		{
+			name: "dnf.module-config",
+			fields: fields{
+				Name: "org.osbuild.dnf.module-config",
+				Options: &DNFModuleConfigStageOptions{
+					Conf: &DNFModuleConfig{
+						Name:     "nodejs",
+						Stream:   "14",
+						Profiles: []string{"default"},
+						State:    "enabled",
+					},
+				},
+			},
+			args: args{
+				data: []byte(`{"name":"org.osbuild.dnf.module-config","options":{"conf":{"name":"nodejs","stream":"14","profiles":["default"],"state":"enabled"}}}`),
+			},
+		},
 		{
 			name: "firewall",
 			fields: fields{
@@ -203,6 +232,65 @@ func TestStage_UnmarshalJSON(t *testing.T) {
 				data: []byte(`{"name":"org.osbuild.rpm","options":{"gpgkeys":["key1","key2"],"packages":[{"checksum":"checksum1"},{"checksum":"checksum2","check_gpg":true}]}}`),
 			},
 		},
+		{
+			name: "kickstart",
+			fields: fields{
+				Name: "org.osbuild.kickstart",
+				Options: &KickstartStageOptions{
+					Path: "/osbuild.ks",
+					OSTree: &KickstartOSTreeOptions{
+						OSName: "rhel",
+						URL:    "file:///ostree/repo",
+						Ref:    "rhel/8/x86_64/edge",
+					},
+				},
+			},
+			args: args{
+				data: []byte(`{"name":"org.osbuild.kickstart","options":{"path":"/osbuild.ks","ostree":{"osname":"rhel","url":"file:///ostree/repo","ref":"rhel/8/x86_64/edge","gpg":false}}}`),
+			},
+		},
+		{
+			name: "kickstart liveimg",
+			fields: fields{
+				Name: "org.osbuild.kickstart",
+				Options: &KickstartStageOptions{
+					Path: "/osbuild.ks",
+					LiveImg: &KickstartLiveImgOptions{
+						URL: "file:///run/install/repo/LiveOS/squashfs.img",
+					},
+				},
+			},
+			args: args{
+				data: []byte(`{"name":"org.osbuild.kickstart","options":{"path":"/osbuild.ks","liveimg":{"url":"file:///run/install/repo/LiveOS/squashfs.img"}}}`),
+			},
+		},
+		{
+			name: "lorax-script",
+			fields: fields{
+				Name: "org.osbuild.lorax-script",
+				Options: &LoraxScriptStageOptions{
+					Path:     "99-generic/runtime-postinstall.tmpl",
+					BaseArch: "x86_64",
+				},
+			},
+			args: args{
+				data: []byte(`{"name":"org.osbuild.lorax-script","options":{"path":"99-generic/runtime-postinstall.tmpl","basearch":"x86_64"}}`),
+			},
+		},
+		{
+			name: "ostree.pull",
+			fields: fields{
+				Name: "org.osbuild.ostree.pull",
+				Options: &OSTreePullStageOptions{
+					Repo: "/ostree/repo",
+					URL:  "http://example.com/repo",
+					Ref:  "rhel/8/x86_64/edge",
+				},
+			},
+			args: args{
+				data: []byte(`{"name":"org.osbuild.ostree.pull","options":{"repo":"/ostree/repo","url":"http://example.com/repo","ref":"rhel/8/x86_64/edge"}}`),
+			},
+		},
 		{
 			name: "rpm-ostree",
 			fields: fields{
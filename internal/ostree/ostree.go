@@ -0,0 +1,327 @@
+// Package ostree manages the OSTree repository composer keeps the commits of
+// edge images in. Commits are pulled into it from the commit.tar of finished
+// builds (as created by the org.osbuild.ostree.commit assembler), and the
+// repository is served over HTTP for devices to upgrade from.
+//
+// The repository is an archive-mode repository which the `ostree` command
+// manages, and keeps the history of every ref.
+package ostree
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Commit is a commit of a ref
+type Commit struct {
+	Checksum string
+	// The parent commit, empty for the first commit of a ref
+	Parent    string
+	Timestamp time.Time
+	Version   string
+	Subject   string
+}
+
+type Repository struct {
+	dir string
+
+	mu sync.Mutex
+}
+
+// Open opens the repository in dir, initializing it if it doesn't exist yet
+func Open(dir string) (*Repository, error) {
+	r := &Repository{dir: dir}
+
+	_, err := os.Stat(path.Join(dir, "config"))
+	if err == nil {
+		return r, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	_, err = ostree("init", "--repo="+dir, "--mode=archive")
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// PullCommitTar pulls the commit in tarball, which is the commit.tar of an
+// OSTree commit build, into the repository and makes it the head of its ref.
+// Commits which are in the repository already are not pulled again. It
+// returns the ref and the checksum of the commit.
+func (r *Repository) PullCommitTar(tarball io.Reader) (string, string, error) {
+	tmpDir, err := ioutil.TempDir("", "osbuild-composer-ostree-")
+	if err != nil {
+		return "", "", err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	err = extractTar(tarball, tmpDir)
+	if err != nil {
+		return "", "", fmt.Errorf("cannot extract commit: %v", err)
+	}
+	source := path.Join(tmpDir, "repo")
+
+	out, err := ostree("refs", "--repo="+source)
+	if err != nil {
+		return "", "", err
+	}
+	refs := strings.Fields(out)
+	if len(refs) != 1 {
+		return "", "", fmt.Errorf("commit archive contains %d refs instead of one", len(refs))
+	}
+	ref := refs[0]
+
+	out, err = ostree("rev-parse", "--repo="+source, ref)
+	if err != nil {
+		return "", "", err
+	}
+	checksum := strings.TrimSpace(out)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Pulling a commit again would reset its ref to it
+	if _, err = ostree("show", "--repo="+r.dir, checksum); err == nil {
+		return ref, checksum, nil
+	}
+
+	_, err = ostree("pull-local", "--repo="+r.dir, source, ref)
+	if err != nil {
+		return "", "", err
+	}
+	_, err = ostree("summary", "--repo="+r.dir, "--update")
+	if err != nil {
+		return "", "", err
+	}
+
+	return ref, checksum, nil
+}
+
+// Head returns the checksum of the latest commit of ref, or an empty string
+// if the repository doesn't have that ref
+func (r *Repository) Head(ref string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.head(ref)
+}
+
+func (r *Repository) head(ref string) (string, error) {
+	out, err := ostree("rev-parse", "--repo="+r.dir, ref)
+	if err != nil {
+		exists, refsErr := r.hasRef(ref)
+		if refsErr == nil && !exists {
+			return "", nil
+		}
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+func (r *Repository) hasRef(ref string) (bool, error) {
+	out, err := ostree("refs", "--repo="+r.dir)
+	if err != nil {
+		return false, err
+	}
+	for _, existing := range strings.Fields(out) {
+		if existing == ref {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Log returns the commits of ref, newest first, or nil if the repository
+// doesn't have that ref
+func (r *Repository) Log(ref string) ([]Commit, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	exists, err := r.hasRef(ref)
+	if err != nil || !exists {
+		return nil, err
+	}
+
+	out, err := ostree("log", "--repo="+r.dir, ref)
+	if err != nil {
+		return nil, err
+	}
+	return parseLog(out)
+}
+
+// ServeHTTP serves the files of the repository, for ostree clients to pull
+// from
+func (r *Repository) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	http.FileServer(http.Dir(r.dir)).ServeHTTP(writer, request)
+}
+
+// StaticDeltaFilename is the name of the artifact static deltas are kept in
+const StaticDeltaFilename = "commit.delta"
+
+// GenerateStaticDelta writes the static delta from the commit `from` to the
+// commit in commitTar, which is the commit.tar of an OSTree commit build, to
+// deltaPath. The objects of `from` are pulled from the repository at url.
+func GenerateStaticDelta(commitTar, from, url, deltaPath string) error {
+	tmpDir, err := ioutil.TempDir("", "osbuild-composer-ostree-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	f, err := os.Open(commitTar)
+	if err != nil {
+		return err
+	}
+	err = extractTar(f, tmpDir)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("cannot extract commit: %v", err)
+	}
+	repo := path.Join(tmpDir, "repo")
+
+	out, err := ostree("refs", "--repo="+repo)
+	if err != nil {
+		return err
+	}
+	refs := strings.Fields(out)
+	if len(refs) != 1 {
+		return fmt.Errorf("commit archive contains %d refs instead of one", len(refs))
+	}
+	out, err = ostree("rev-parse", "--repo="+repo, refs[0])
+	if err != nil {
+		return err
+	}
+	to := strings.TrimSpace(out)
+
+	_, err = ostree("remote", "add", "--repo="+repo, "--no-gpg-verify", "parent", url)
+	if err != nil {
+		return err
+	}
+	_, err = ostree("pull", "--repo="+repo, "--depth=0", "parent", from)
+	if err != nil {
+		return err
+	}
+
+	_, err = ostree("static-delta", "generate", "--repo="+repo, "--from="+from, "--to="+to, "--inline", "--min-fallback-size=0", "--filename="+deltaPath)
+	return err
+}
+
+// parseLog parses the output of `ostree log`
+func parseLog(out string) ([]Commit, error) {
+	var commits []Commit
+	var commit *Commit
+
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "commit ") {
+			commits = append(commits, Commit{Checksum: strings.TrimSpace(strings.TrimPrefix(line, "commit "))})
+			commit = &commits[len(commits)-1]
+			continue
+		}
+		if commit == nil {
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "Parent:"):
+			commit.Parent = strings.TrimSpace(strings.TrimPrefix(line, "Parent:"))
+		case strings.HasPrefix(line, "Date:"):
+			date := strings.TrimSpace(strings.TrimPrefix(line, "Date:"))
+			timestamp, err := time.Parse("2006-01-02 15:04:05 -0700", date)
+			if err != nil {
+				return nil, fmt.Errorf("invalid date of commit %s: %s", commit.Checksum, date)
+			}
+			commit.Timestamp = timestamp.UTC()
+		case strings.HasPrefix(line, "Version:"):
+			commit.Version = strings.TrimSpace(strings.TrimPrefix(line, "Version:"))
+		case strings.HasPrefix(line, "    ") && commit.Subject == "":
+			commit.Subject = strings.TrimSpace(line)
+		}
+	}
+
+	return commits, scanner.Err()
+}
+
+// extractTar extracts the directories and regular files of a tar archive
+// into dir
+func extractTar(r io.Reader, dir string) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		name := filepath.Clean(hdr.Name)
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return fmt.Errorf("invalid path in archive: %s", hdr.Name)
+		}
+		p := path.Join(dir, name)
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(p, 0755)
+		case tar.TypeReg:
+			err = extractFile(tr, p)
+		default:
+			return fmt.Errorf("unsupported file type in archive: %s", hdr.Name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func extractFile(r io.Reader, p string) error {
+	err := os.MkdirAll(path.Dir(p), 0755)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func ostree(args ...string) (string, error) {
+	cmd := exec.Command("ostree", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("ostree %s failed: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return string(out), nil
+}
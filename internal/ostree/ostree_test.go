@@ -0,0 +1,176 @@
+package ostree
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLog(t *testing.T) {
+	out := `commit 6b2a8d05e5e1b4d1a6f2e1b0d1c3f1e6c8d9a3b4f5e6d7c8b9a0f1e2d3c4b5a6
+Parent:  1f4c2d9a0b3e5f6a7b8c9d0e1f2a3b4c5d6e7f8a9b0c1d2e3f4a5b6c7d8e9f0a
+ContentChecksum:  0a1b2c3d4e5f6a7b8c9d0e1f2a3b4c5d6e7f8a9b0c1d2e3f4a5b6c7d8e9f0a1b
+Date:  2020-06-02 09:15:30 +0000
+Version: 8.2.1
+
+    Second commit
+
+commit 1f4c2d9a0b3e5f6a7b8c9d0e1f2a3b4c5d6e7f8a9b0c1d2e3f4a5b6c7d8e9f0a
+ContentChecksum:  f0e1d2c3b4a5968778695a4b3c2d1e0f0e1d2c3b4a5968778695a4b3c2d1e0f0e
+Date:  2020-06-01 18:00:00 +0200
+Version: 8.2.0
+
+    First commit
+
+    with a longer description
+`
+
+	commits, err := parseLog(out)
+	require.NoError(t, err)
+	require.Equal(t, []Commit{
+		{
+			Checksum:  "6b2a8d05e5e1b4d1a6f2e1b0d1c3f1e6c8d9a3b4f5e6d7c8b9a0f1e2d3c4b5a6",
+			Parent:    "1f4c2d9a0b3e5f6a7b8c9d0e1f2a3b4c5d6e7f8a9b0c1d2e3f4a5b6c7d8e9f0a",
+			Timestamp: time.Date(2020, 6, 2, 9, 15, 30, 0, time.UTC),
+			Version:   "8.2.1",
+			Subject:   "Second commit",
+		},
+		{
+			Checksum:  "1f4c2d9a0b3e5f6a7b8c9d0e1f2a3b4c5d6e7f8a9b0c1d2e3f4a5b6c7d8e9f0a",
+			Timestamp: time.Date(2020, 6, 1, 16, 0, 0, 0, time.UTC),
+			Version:   "8.2.0",
+			Subject:   "First commit",
+		},
+	}, commits)
+
+	_, err = parseLog("commit abc\nDate: yesterday\n")
+	require.EqualError(t, err, "invalid date of commit abc: yesterday")
+}
+
+func TestExtractTar(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ostree-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "repo/", Typeflag: tar.TypeDir, Mode: 0755}))
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "repo/config", Typeflag: tar.TypeReg, Mode: 0644, Size: 4}))
+	_, err = tw.Write([]byte("test"))
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+
+	require.NoError(t, extractTar(&buf, dir))
+	content, err := ioutil.ReadFile(path.Join(dir, "repo", "config"))
+	require.NoError(t, err)
+	require.Equal(t, "test", string(content))
+
+	buf.Reset()
+	tw = tar.NewWriter(&buf)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "../escape", Typeflag: tar.TypeReg, Mode: 0644}))
+	require.NoError(t, tw.Close())
+	require.EqualError(t, extractTar(&buf, dir), "invalid path in archive: ../escape")
+}
+
+// buildCommitTar builds a commit.tar the way the ostree.commit assembler
+// does, with a commit of ref "test/x86_64/edge" in dir, and returns its path
+// and the checksum of the commit
+func buildCommitTar(t *testing.T, dir, version, parent string) (string, string) {
+	t.Helper()
+
+	source := path.Join(dir, "build", "repo")
+	tree := path.Join(dir, "tree")
+	require.NoError(t, os.MkdirAll(path.Join(tree, "usr", "etc"), 0755))
+	require.NoError(t, ioutil.WriteFile(path.Join(tree, "usr", "etc", "os-release"), []byte("VERSION="+version+"\n"), 0644))
+	_, err := ostree("init", "--repo="+source, "--mode=archive")
+	require.NoError(t, err)
+	args := []string{"commit", "--repo=" + source, "--branch=test/x86_64/edge", "--subject=Commit " + version, "--add-metadata-string=version=" + version}
+	if parent != "" {
+		args = append(args, "--parent="+parent)
+	}
+	checksum, err := ostree(append(args, tree)...)
+	require.NoError(t, err)
+
+	commitTar := path.Join(dir, "commit.tar")
+	require.NoError(t, exec.Command("tar", "-C", path.Join(dir, "build"), "-cf", commitTar, "repo").Run())
+	return commitTar, strings.TrimSpace(checksum)
+}
+
+func TestRepository(t *testing.T) {
+	if _, err := exec.LookPath("ostree"); err != nil {
+		t.Skip("ostree is not installed")
+	}
+
+	dir, err := ioutil.TempDir("", "ostree-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	repo, err := Open(path.Join(dir, "repo"))
+	require.NoError(t, err)
+
+	head, err := repo.Head("test/x86_64/edge")
+	require.NoError(t, err)
+	require.Empty(t, head)
+	commits, err := repo.Log("test/x86_64/edge")
+	require.NoError(t, err)
+	require.Nil(t, commits)
+
+	commitTar, _ := buildCommitTar(t, path.Join(dir, "first"), "1", "")
+	f, err := os.Open(commitTar)
+	require.NoError(t, err)
+	defer f.Close()
+
+	ref, checksum, err := repo.PullCommitTar(f)
+	require.NoError(t, err)
+	require.Equal(t, "test/x86_64/edge", ref)
+
+	head, err = repo.Head(ref)
+	require.NoError(t, err)
+	require.Equal(t, checksum, head)
+
+	commits, err = repo.Log(ref)
+	require.NoError(t, err)
+	require.Len(t, commits, 1)
+	require.Equal(t, checksum, commits[0].Checksum)
+	require.Equal(t, "1", commits[0].Version)
+	require.Equal(t, "Commit 1", commits[0].Subject)
+}
+
+func TestGenerateStaticDelta(t *testing.T) {
+	if _, err := exec.LookPath("ostree"); err != nil {
+		t.Skip("ostree is not installed")
+	}
+
+	dir, err := ioutil.TempDir("", "ostree-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	repo, err := Open(path.Join(dir, "repo"))
+	require.NoError(t, err)
+	commitTar, _ := buildCommitTar(t, path.Join(dir, "first"), "1", "")
+	f, err := os.Open(commitTar)
+	require.NoError(t, err)
+	_, parent, err := repo.PullCommitTar(f)
+	f.Close()
+	require.NoError(t, err)
+
+	commitTar, _ = buildCommitTar(t, path.Join(dir, "second"), "2", parent)
+	deltaPath := path.Join(dir, StaticDeltaFilename)
+	err = GenerateStaticDelta(commitTar, parent, "file://"+path.Join(dir, "repo"), deltaPath)
+	require.NoError(t, err)
+
+	info, err := os.Stat(deltaPath)
+	require.NoError(t, err)
+	require.NotZero(t, info.Size())
+
+	err = GenerateStaticDelta(commitTar, "0000000000000000000000000000000000000000000000000000000000000000", "file://"+path.Join(dir, "repo"), deltaPath)
+	require.Error(t, err)
+}
@@ -24,6 +24,7 @@ type repository struct {
 	CheckGPG       bool   `json:"check_gpg,omitempty"`
 	RHSM           bool   `json:"rhsm,omitempty"`
 	MetadataExpire string `json:"metadata_expire,omitempty"`
+	SnapshotURL    string `json:"snapshot_url,omitempty"`
 }
 
 type dnfRepoConfig struct {
@@ -49,6 +50,30 @@ type RepoConfig struct {
 	IgnoreSSL      bool
 	MetadataExpire string
 	RHSM           bool
+	// SnapshotURL is the URL of dated snapshots of the repository. "{date}"
+	// is replaced by the date of the snapshot (YYYY-MM-DD). If it does not
+	// contain "{date}", the date is appended as a path component.
+	SnapshotURL string
+}
+
+// Snapshot returns the configuration of the repository as it was on date,
+// as served by its snapshot mirror
+func (r RepoConfig) Snapshot(date time.Time) (RepoConfig, error) {
+	if r.SnapshotURL == "" {
+		return RepoConfig{}, &RepositoryError{fmt.Sprintf("repository %s does not support snapshots", r.Name)}
+	}
+
+	day := date.Format("2006-01-02")
+	url := strings.Replace(r.SnapshotURL, "{date}", day, -1)
+	if url == r.SnapshotURL {
+		url = strings.TrimSuffix(url, "/") + "/" + day + "/"
+	}
+
+	snapshot := r
+	snapshot.BaseURL = url
+	snapshot.Metalink = ""
+	snapshot.MirrorList = ""
+	return snapshot, nil
 }
 
 type PackageList []Package
@@ -64,6 +89,7 @@ type Package struct {
 	Arch        string
 	BuildTime   time.Time
 	License     string
+	Checksum    string
 }
 
 func (pkg Package) ToPackageBuild() PackageBuild {
@@ -156,15 +182,101 @@ type RPMMD interface {
 	// list of packages and dictionary of checksums of the repositories.
 	FetchMetadata(repos []RepoConfig, modulePlatformID string, arch string) (PackageList, map[string]string, error)
 
-	// Depsolve takes a list of required content (specs), explicitly unwanted content (excludeSpecs), list
-	// or repositories, and platform ID for modularity. It returns a list of all packages (with solved
-	// dependencies) that will be installed into the system.
-	Depsolve(specs, excludeSpecs []string, repos []RepoConfig, modulePlatformID, arch string) ([]PackageSpec, map[string]string, error)
+	// Depsolve takes a list of required content (specs), explicitly unwanted content (excludeSpecs),
+	// required packages restricted by version or repository (selectors), list or repositories, and
+	// platform ID for modularity. It returns a list of all packages (with solved dependencies) that
+	// will be installed into the system.
+	Depsolve(specs, excludeSpecs []string, selectors []PackageSelector, repos []RepoConfig, modulePlatformID, arch string) ([]PackageSpec, map[string]string, error)
+}
+
+// Operators allowed in a VersionConstraint
+const (
+	VersionEqual          = "="
+	VersionNotEqual       = "!="
+	VersionLess           = "<"
+	VersionLessOrEqual    = "<="
+	VersionGreater        = ">"
+	VersionGreaterOrEqual = ">="
+)
+
+// VersionConstraint restricts the version of a package, for example ">= 1.2"
+type VersionConstraint struct {
+	Operator string `json:"operator"`
+	Version  string `json:"version"`
+}
+
+func (c VersionConstraint) String() string {
+	return c.Operator + " " + c.Version
+}
+
+// PackageSelector selects the packages matching Spec (a name or name-version
+// glob), optionally restricted to the versions matching all of Constraints
+// and to the repository named Repo.
+type PackageSelector struct {
+	Spec        string              `json:"spec"`
+	Constraints []VersionConstraint `json:"constraints,omitempty"`
+	Repo        string              `json:"repo,omitempty"`
+}
+
+// A ModuleStream is a modularity stream to enable during a depsolve. If
+// Profile is set, the packages of that profile are installed as well.
+type ModuleStream struct {
+	Name    string `json:"name"`
+	Stream  string `json:"stream"`
+	Profile string `json:"profile,omitempty"`
+}
+
+// Spec returns the module spec of the stream, as passed to depsolve among
+// the package specs ("@name:stream/profile").
+func (m ModuleStream) Spec() string {
+	spec := "@" + m.Name + ":" + m.Stream
+	if m.Profile != "" {
+		spec += "/" + m.Profile
+	}
+	return spec
+}
+
+type dnfPackageSelector struct {
+	Spec        string              `json:"spec"`
+	Constraints []VersionConstraint `json:"constraints,omitempty"`
+	RepoID      string              `json:"repo_id,omitempty"`
 }
 
 type DNFError struct {
-	Kind   string `json:"kind"`
-	Reason string `json:"reason"`
+	Kind     string            `json:"kind"`
+	Reason   string            `json:"reason"`
+	Problems []DepsolveProblem `json:"problems,omitempty"`
+}
+
+// Kinds of problems reported by dnf-json when a depsolve fails
+const (
+	ProblemUnresolvablePackage = "unresolvable-package"
+	ProblemUnresolvableGroup   = "unresolvable-group"
+	ProblemUnresolvableModule  = "unresolvable-module"
+	ProblemMissingRequirement  = "missing-requirement"
+	ProblemConflict            = "conflict"
+	ProblemOther               = "other"
+)
+
+// DepsolveProblem is a single machine-readable explanation of why a
+// depsolve failed. Spec is the requested package spec the problem was
+// traced back to, if any.
+type DepsolveProblem struct {
+	Kind        string   `json:"kind"`
+	Message     string   `json:"message"`
+	Spec        string   `json:"spec,omitempty"`
+	Package     string   `json:"package,omitempty"`
+	Requirement string   `json:"requirement,omitempty"`
+	Conflicts   []string `json:"conflicts,omitempty"`
+}
+
+// DepsolveProblems returns the structured problems attached to err, or nil
+// if err is not a DNFError.
+func DepsolveProblems(err error) []DepsolveProblem {
+	if dnfError, ok := err.(*DNFError); ok {
+		return dnfError.Problems
+	}
+	return nil
 }
 
 func (err *DNFError) Error() string {
@@ -240,6 +352,7 @@ func LoadRepositories(confPaths []string, distro string) (map[string][]RepoConfi
 				CheckGPG:       repo.CheckGPG,
 				RHSM:           repo.RHSM,
 				MetadataExpire: repo.MetadataExpire,
+				SnapshotURL:    repo.SnapshotURL,
 			}
 
 			repoConfigs[arch] = append(repoConfigs[arch], config)
@@ -377,7 +490,7 @@ func (r *rpmmdImpl) FetchMetadata(repos []RepoConfig, modulePlatformID string, a
 	return reply.Packages, checksums, err
 }
 
-func (r *rpmmdImpl) Depsolve(specs, excludeSpecs []string, repos []RepoConfig, modulePlatformID, arch string) ([]PackageSpec, map[string]string, error) {
+func (r *rpmmdImpl) Depsolve(specs, excludeSpecs []string, selectors []PackageSelector, repos []RepoConfig, modulePlatformID, arch string) ([]PackageSpec, map[string]string, error) {
 	var dnfRepoConfigs []dnfRepoConfig
 
 	for i, repo := range repos {
@@ -388,19 +501,25 @@ func (r *rpmmdImpl) Depsolve(specs, excludeSpecs []string, repos []RepoConfig, m
 		dnfRepoConfigs = append(dnfRepoConfigs, dnfRepo)
 	}
 
+	dnfSelectors, err := toDNFPackageSelectors(selectors, repos)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	var arguments = struct {
-		PackageSpecs     []string        `json:"package-specs"`
-		ExcludSpecs      []string        `json:"exclude-specs"`
-		Repos            []dnfRepoConfig `json:"repos"`
-		CacheDir         string          `json:"cachedir"`
-		ModulePlatformID string          `json:"module_platform_id"`
-		Arch             string          `json:"arch"`
-	}{specs, excludeSpecs, dnfRepoConfigs, r.CacheDir, modulePlatformID, arch}
+		PackageSpecs     []string             `json:"package-specs"`
+		ExcludSpecs      []string             `json:"exclude-specs"`
+		PackageSelectors []dnfPackageSelector `json:"package-selectors,omitempty"`
+		Repos            []dnfRepoConfig      `json:"repos"`
+		CacheDir         string               `json:"cachedir"`
+		ModulePlatformID string               `json:"module_platform_id"`
+		Arch             string               `json:"arch"`
+	}{specs, excludeSpecs, dnfSelectors, dnfRepoConfigs, r.CacheDir, modulePlatformID, arch}
 	var reply struct {
 		Checksums    map[string]string `json:"checksums"`
 		Dependencies []dnfPackageSpec  `json:"dependencies"`
 	}
-	err := runDNF(r.dnfJsonPath, "depsolve", arguments, &reply)
+	err = runDNF(r.dnfJsonPath, "depsolve", arguments, &reply)
 
 	dependencies := make([]PackageSpec, len(reply.Dependencies))
 	for i, pack := range reply.Dependencies {
@@ -426,6 +545,31 @@ func (r *rpmmdImpl) Depsolve(specs, excludeSpecs []string, repos []RepoConfig, m
 	return dependencies, reply.Checksums, err
 }
 
+// toDNFPackageSelectors resolves the repository names of the selectors to
+// the ids of the repositories passed to dnf-json
+func toDNFPackageSelectors(selectors []PackageSelector, repos []RepoConfig) ([]dnfPackageSelector, error) {
+	var dnfSelectors []dnfPackageSelector
+	for _, selector := range selectors {
+		dnfSelector := dnfPackageSelector{
+			Spec:        selector.Spec,
+			Constraints: selector.Constraints,
+		}
+		if selector.Repo != "" {
+			for i, repo := range repos {
+				if repo.Name == selector.Repo {
+					dnfSelector.RepoID = strconv.Itoa(i)
+					break
+				}
+			}
+			if dnfSelector.RepoID == "" {
+				return nil, &RepositoryError{fmt.Sprintf("package %s is pinned to unknown repository %s", selector.Spec, selector.Repo)}
+			}
+		}
+		dnfSelectors = append(dnfSelectors, dnfSelector)
+	}
+	return dnfSelectors, nil
+}
+
 func (packages PackageList) Search(globPatterns ...string) (PackageList, error) {
 	var globs []glob.Glob
 
@@ -479,6 +623,6 @@ func (packages PackageList) ToPackageInfos() []PackageInfo {
 }
 
 func (pkg *PackageInfo) FillDependencies(rpmmd RPMMD, repos []RepoConfig, modulePlatformID string, arch string) (err error) {
-	pkg.Dependencies, _, err = rpmmd.Depsolve([]string{pkg.Name}, nil, repos, modulePlatformID, arch)
+	pkg.Dependencies, _, err = rpmmd.Depsolve([]string{pkg.Name}, nil, nil, repos, modulePlatformID, arch)
 	return
 }
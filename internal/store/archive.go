@@ -0,0 +1,337 @@
+package store
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/osbuild/osbuild-composer/internal/blueprint"
+)
+
+// A BlueprintHistory is everything the store knows about a blueprint: its
+// committed version, its workspace copy, and all of its changes, including
+// their tags. Blueprint is nil if the blueprint was deleted and Workspace is
+// nil if there is no workspace copy.
+type BlueprintHistory struct {
+	Name      string
+	Blueprint *blueprint.Blueprint
+	Workspace *blueprint.Blueprint
+	// oldest first
+	Changes []blueprint.Change
+}
+
+// ExportBlueprint returns the history of a blueprint, or false if the store
+// does not know a blueprint of that name
+func (s *Store) ExportBlueprint(name string) (*BlueprintHistory, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	history := BlueprintHistory{Name: name}
+	if bp, exists := s.blueprints[name]; exists {
+		bp = bp.DeepCopy()
+		history.Blueprint = &bp
+	}
+	if bp, exists := s.workspace[name]; exists {
+		bp = bp.DeepCopy()
+		history.Workspace = &bp
+	}
+	for _, commit := range s.blueprintsCommits[name] {
+		change := s.blueprintsChanges[name][commit]
+		change.Blueprint = change.Blueprint.DeepCopy()
+		history.Changes = append(history.Changes, change)
+	}
+
+	if history.Blueprint == nil && history.Workspace == nil && len(history.Changes) == 0 {
+		return nil, false
+	}
+	return &history, true
+}
+
+// ExportBlueprints returns the histories of all blueprints the store knows,
+// including the ones which were deleted but still have changes, sorted by
+// name
+func (s *Store) ExportBlueprints() []BlueprintHistory {
+	s.mu.RLock()
+	names := make(map[string]bool)
+	for name := range s.blueprints {
+		names[name] = true
+	}
+	for name := range s.workspace {
+		names[name] = true
+	}
+	for name := range s.blueprintsCommits {
+		names[name] = true
+	}
+	s.mu.RUnlock()
+
+	histories := make([]BlueprintHistory, 0, len(names))
+	for name := range names {
+		if history, exists := s.ExportBlueprint(name); exists {
+			histories = append(histories, *history)
+		}
+	}
+	sort.Slice(histories, func(i, j int) bool {
+		return histories[i].Name < histories[j].Name
+	})
+	return histories
+}
+
+// ImportBlueprint replays the history of a blueprint into the store. Changes
+// which the store already has (by commit) are replaced, all others are
+// appended in order, so that importing the same history again does not change
+// the store. The committed and workspace versions are replaced when the
+// history has them.
+func (s *Store) ImportBlueprint(history BlueprintHistory) error {
+	return s.ImportBlueprints([]BlueprintHistory{history})
+}
+
+// ImportBlueprints replays the histories of several blueprints into the store
+// like ImportBlueprint. Nothing is imported if any of the histories is
+// invalid.
+func (s *Store) ImportBlueprints(histories []BlueprintHistory) error {
+	for i := range histories {
+		err := histories[i].validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.change(func() error {
+		for _, history := range histories {
+			s.importBlueprint(history)
+		}
+		return nil
+	})
+}
+
+// validate checks that all blueprints of the history are valid and named
+// like it, and gives them default values
+func (history *BlueprintHistory) validate() error {
+	var blueprints []*blueprint.Blueprint
+	if history.Blueprint != nil {
+		blueprints = append(blueprints, history.Blueprint)
+	}
+	if history.Workspace != nil {
+		blueprints = append(blueprints, history.Workspace)
+	}
+	for i := range history.Changes {
+		if history.Changes[i].Commit == "" {
+			return fmt.Errorf("%s: change without commit", history.Name)
+		}
+		blueprints = append(blueprints, &history.Changes[i].Blueprint)
+	}
+	for _, bp := range blueprints {
+		if bp.Name != history.Name {
+			return fmt.Errorf("%s: history contains blueprint %s", history.Name, bp.Name)
+		}
+		// Make sure the blueprint has default values and that the version is valid
+		err := bp.Initialize()
+		if err != nil {
+			return fmt.Errorf("%s: %v", history.Name, err)
+		}
+	}
+	return nil
+}
+
+// importBlueprint replays a validated history into the store. It must only
+// be called from the function passed to change().
+func (s *Store) importBlueprint(history BlueprintHistory) {
+	name := history.Name
+	if len(history.Changes) > 0 {
+		s.touch(kindChanges, name)
+		s.touch(kindCommits, name)
+		if s.blueprintsChanges[name] == nil {
+			s.blueprintsChanges[name] = make(map[string]blueprint.Change)
+		}
+		for _, change := range history.Changes {
+			if _, exists := s.blueprintsChanges[name][change.Commit]; !exists {
+				s.blueprintsCommits[name] = append(s.blueprintsCommits[name], change.Commit)
+			}
+			s.blueprintsChanges[name][change.Commit] = change
+		}
+	}
+
+	if history.Blueprint != nil {
+		s.touch(kindBlueprints, name)
+		s.blueprints[name] = *history.Blueprint
+	}
+
+	if history.Workspace != nil {
+		s.touch(kindWorkspace, name)
+		s.workspace[name] = *history.Workspace
+	}
+}
+
+// The files of a blueprint in a blueprint archive, below a directory named
+// like the blueprint. Changes are numbered, oldest first.
+const (
+	archiveBlueprintFile = "blueprint.toml"
+	archiveWorkspaceFile = "workspace.toml"
+	archiveChangesDir    = "changes"
+)
+
+// archiveChange is a blueprint change as it is written to an archive
+type archiveChange struct {
+	Commit    string              `toml:"commit"`
+	Message   string              `toml:"message"`
+	Revision  *int                `toml:"revision,omitempty"`
+	Timestamp string              `toml:"timestamp"`
+	Blueprint blueprint.Blueprint `toml:"blueprint"`
+}
+
+// WriteBlueprintArchive writes the histories of blueprints as a tarball of
+// TOML files to w
+func WriteBlueprintArchive(w io.Writer, histories []BlueprintHistory) error {
+	tw := tar.NewWriter(w)
+
+	for _, history := range histories {
+		if history.Blueprint != nil {
+			err := writeArchiveFile(tw, path.Join(history.Name, archiveBlueprintFile), history.Blueprint)
+			if err != nil {
+				return err
+			}
+		}
+		if history.Workspace != nil {
+			err := writeArchiveFile(tw, path.Join(history.Name, archiveWorkspaceFile), history.Workspace)
+			if err != nil {
+				return err
+			}
+		}
+		for i, change := range history.Changes {
+			name := path.Join(history.Name, archiveChangesDir, fmt.Sprintf("%04d.toml", i+1))
+			err := writeArchiveFile(tw, name, archiveChange{
+				Commit:    change.Commit,
+				Message:   change.Message,
+				Revision:  change.Revision,
+				Timestamp: change.Timestamp,
+				Blueprint: change.Blueprint,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return tw.Close()
+}
+
+func writeArchiveFile(tw *tar.Writer, name string, v interface{}) error {
+	var buf bytes.Buffer
+	err := toml.NewEncoder(&buf).Encode(v)
+	if err != nil {
+		return fmt.Errorf("cannot encode %s: %v", name, err)
+	}
+
+	err = tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0644,
+		Size:     int64(buf.Len()),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = tw.Write(buf.Bytes())
+	return err
+}
+
+// ReadBlueprintArchive reads the histories of blueprints from a tarball
+// written by WriteBlueprintArchive
+func ReadBlueprintArchive(r io.Reader) ([]BlueprintHistory, error) {
+	histories := make(map[string]*BlueprintHistory)
+	// changes by their number, for each blueprint
+	changes := make(map[string]map[int]blueprint.Change)
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot read archive: %v", err)
+		}
+		if header.Typeflag == tar.TypeDir {
+			continue
+		}
+		if header.Typeflag != tar.TypeReg {
+			return nil, fmt.Errorf("%s: not a regular file", header.Name)
+		}
+
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read %s: %v", header.Name, err)
+		}
+
+		parts := strings.Split(path.Clean(header.Name), "/")
+		name := parts[0]
+		history, exists := histories[name]
+		if !exists {
+			history = &BlueprintHistory{Name: name}
+			histories[name] = history
+			changes[name] = make(map[int]blueprint.Change)
+		}
+
+		switch {
+		case len(parts) == 2 && parts[1] == archiveBlueprintFile:
+			history.Blueprint = &blueprint.Blueprint{}
+			err = toml.Unmarshal(data, history.Blueprint)
+
+		case len(parts) == 2 && parts[1] == archiveWorkspaceFile:
+			history.Workspace = &blueprint.Blueprint{}
+			err = toml.Unmarshal(data, history.Workspace)
+
+		case len(parts) == 3 && parts[1] == archiveChangesDir && strings.HasSuffix(parts[2], ".toml"):
+			n, convErr := strconv.Atoi(strings.TrimSuffix(parts[2], ".toml"))
+			if convErr != nil {
+				return nil, fmt.Errorf("%s: invalid change number", header.Name)
+			}
+			var change archiveChange
+			err = toml.Unmarshal(data, &change)
+			changes[name][n] = blueprint.Change{
+				Commit:    change.Commit,
+				Message:   change.Message,
+				Revision:  change.Revision,
+				Timestamp: change.Timestamp,
+				Blueprint: change.Blueprint,
+			}
+
+		default:
+			return nil, fmt.Errorf("%s: unexpected file in blueprint archive", header.Name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot decode %s: %v", header.Name, err)
+		}
+	}
+
+	if len(histories) == 0 {
+		return nil, errors.New("archive does not contain any blueprints")
+	}
+
+	result := make([]BlueprintHistory, 0, len(histories))
+	for name, history := range histories {
+		numbers := make([]int, 0, len(changes[name]))
+		for n := range changes[name] {
+			numbers = append(numbers, n)
+		}
+		sort.Ints(numbers)
+		for _, n := range numbers {
+			history.Changes = append(history.Changes, changes[name][n])
+		}
+		result = append(result, *history)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
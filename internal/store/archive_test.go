@@ -0,0 +1,156 @@
+package store
+
+import (
+	"archive/tar"
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/osbuild-composer/internal/blueprint"
+	"github.com/osbuild/osbuild-composer/internal/distro/test_distro"
+)
+
+func newArchiveTestStore(t *testing.T) *Store {
+	arch, err := test_distro.New().GetArch("test_arch")
+	require.NoError(t, err)
+	s, err := New(nil, arch, nil, nil)
+	require.NoError(t, err)
+	return s
+}
+
+func TestBlueprintArchive(t *testing.T) {
+	s := newArchiveTestStore(t)
+
+	bp := blueprint.Blueprint{
+		Name:     "test",
+		Version:  "0.0.1",
+		Packages: []blueprint.Package{{Name: "tmux", Version: "*"}},
+		Customizations: &blueprint.Customizations{
+			Hostname: &[]string{"my-host"}[0],
+		},
+	}
+	require.NoError(t, s.PushBlueprint(bp, "first commit"))
+	require.NoError(t, s.TagBlueprint("test"))
+	bp.Version = "0.0.2"
+	require.NoError(t, s.PushBlueprint(bp, "second commit"))
+	bp.Version = "0.0.3"
+	require.NoError(t, s.PushBlueprintToWorkspace(bp))
+	require.NoError(t, s.PushBlueprintToWorkspace(blueprint.Blueprint{Name: "workspace-only"}))
+
+	// deleted blueprints keep their history
+	require.NoError(t, s.PushBlueprint(blueprint.Blueprint{Name: "deleted"}, "deleted commit"))
+	require.NoError(t, s.DeleteBlueprint("deleted"))
+	deleted, exists := s.ExportBlueprint("deleted")
+	require.True(t, exists)
+	require.Nil(t, deleted.Blueprint)
+	require.Len(t, deleted.Changes, 1)
+
+	_, exists = s.ExportBlueprint("unknown")
+	require.False(t, exists)
+
+	histories := s.ExportBlueprints()
+	require.Len(t, histories, 3)
+	require.Equal(t, "deleted", histories[0].Name)
+	require.Equal(t, "test", histories[1].Name)
+	require.Equal(t, "workspace-only", histories[2].Name)
+	require.Nil(t, histories[0].Blueprint)
+	require.Len(t, histories[0].Changes, 1)
+	require.Len(t, histories[1].Changes, 2)
+	require.Equal(t, 1, *histories[1].Changes[0].Revision)
+	require.Nil(t, histories[1].Changes[1].Revision)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteBlueprintArchive(&buf, histories))
+	read, err := ReadBlueprintArchive(&buf)
+	require.NoError(t, err)
+	require.Equal(t, histories, read)
+
+	// importing into an empty store recreates the same blueprints
+	imported := newArchiveTestStore(t)
+	require.NoError(t, imported.ImportBlueprints(read))
+	require.Equal(t, histories, imported.ExportBlueprints())
+	require.Nil(t, imported.GetBlueprintCommitted("deleted"))
+
+	// importing again does not duplicate changes
+	for _, history := range read {
+		require.NoError(t, imported.ImportBlueprint(history))
+	}
+	require.Equal(t, histories, imported.ExportBlueprints())
+
+	// new changes are appended to the existing history
+	bp.Version = "0.0.4"
+	require.NoError(t, s.PushBlueprint(bp, "third commit"))
+	history, exists := s.ExportBlueprint("test")
+	require.True(t, exists)
+	require.NoError(t, imported.ImportBlueprint(*history))
+	changes := imported.GetBlueprintChanges("test")
+	require.Len(t, changes, 3)
+	require.Equal(t, "third commit", changes[2].Message)
+	committed := imported.GetBlueprintCommitted("test")
+	require.Equal(t, "0.0.4", committed.Version)
+}
+
+func TestImportBlueprintErrors(t *testing.T) {
+	s := newArchiveTestStore(t)
+
+	err := s.ImportBlueprint(BlueprintHistory{
+		Name:      "test",
+		Blueprint: &blueprint.Blueprint{Name: "other"},
+	})
+	require.EqualError(t, err, "test: history contains blueprint other")
+
+	err = s.ImportBlueprint(BlueprintHistory{
+		Name:    "test",
+		Changes: []blueprint.Change{{Blueprint: blueprint.Blueprint{Name: "test"}}},
+	})
+	require.EqualError(t, err, "test: change without commit")
+
+	err = s.ImportBlueprint(BlueprintHistory{
+		Name:      "test",
+		Workspace: &blueprint.Blueprint{Name: "test", Version: "not-semver"},
+	})
+	require.Error(t, err)
+
+	// nothing is imported if one of the histories is invalid
+	err = s.ImportBlueprints([]BlueprintHistory{
+		{Name: "valid", Blueprint: &blueprint.Blueprint{Name: "valid"}},
+		{Name: "test", Blueprint: &blueprint.Blueprint{Name: "other"}},
+	})
+	require.EqualError(t, err, "test: history contains blueprint other")
+
+	require.Empty(t, s.ListBlueprints())
+}
+
+func TestReadBlueprintArchiveErrors(t *testing.T) {
+	var cases = []struct {
+		Name  string
+		Files map[string]string
+		Error string
+	}{
+		{"empty", nil, "archive does not contain any blueprints"},
+		{"unexpected file", map[string]string{"test/README": ""}, "test/README: unexpected file in blueprint archive"},
+		{"invalid change", map[string]string{"test/changes/first.toml": ""}, "test/changes/first.toml: invalid change number"},
+		{"invalid toml", map[string]string{"test/blueprint.toml": "name = "}, ""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tw := tar.NewWriter(&buf)
+			for name, content := range c.Files {
+				require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))}))
+				_, err := tw.Write([]byte(content))
+				require.NoError(t, err)
+			}
+			require.NoError(t, tw.Close())
+
+			_, err := ReadBlueprintArchive(&buf)
+			if c.Error != "" {
+				require.EqualError(t, err, c.Error)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
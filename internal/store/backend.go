@@ -0,0 +1,185 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+
+	"github.com/osbuild/osbuild-composer/internal/jsondb"
+)
+
+// A Backend persists the state of a Store. The state is split into
+// documents, each identified by its kind (a section of the state, such as
+// "composes") and its key in that section (such as the ID of a compose).
+// Changing the store only writes the documents which were touched.
+type Backend interface {
+	// List returns the keys of all documents of a kind
+	List(kind string) ([]string, error)
+
+	// Read deserializes a document into v. It returns false if the
+	// document does not exist.
+	Read(kind, key string, v interface{}) (bool, error)
+
+	// Write serializes v into a document, replacing a previous one
+	Write(kind, key string, v interface{}) error
+
+	// Delete removes a document. Deleting a document which does not exist
+	// is not an error.
+	Delete(kind, key string) error
+}
+
+// The kinds of documents a store is split into. They are named like the
+// sections of storeV0.
+const (
+	kindBlueprints = "blueprints"
+	kindWorkspace  = "workspace"
+	kindComposes   = "composes"
+	kindSources    = "sources"
+	kindChanges    = "changes"
+	kindCommits    = "commits"
+	kindLockfiles  = "lockfiles"
+	kindSnapshots  = "snapshots"
+)
+
+type jsonBackend struct {
+	dir string
+}
+
+// NewJSONBackend returns a Backend which keeps each document in a JSON file,
+// in a directory per kind below dir
+func NewJSONBackend(dir string) Backend {
+	return &jsonBackend{dir}
+}
+
+func (b *jsonBackend) db(kind string) *jsondb.JSONDatabase {
+	return jsondb.New(path.Join(b.dir, kind), 0600)
+}
+
+func (b *jsonBackend) List(kind string) ([]string, error) {
+	names, err := b.db(kind).List()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(names))
+	for _, name := range names {
+		key, err := url.PathUnescape(name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid document name %s/%s: %v", kind, name, err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (b *jsonBackend) Read(kind, key string, v interface{}) (bool, error) {
+	return b.db(kind).Read(url.PathEscape(key), v)
+}
+
+func (b *jsonBackend) Write(kind, key string, v interface{}) error {
+	err := os.MkdirAll(path.Join(b.dir, kind), 0700)
+	if err != nil {
+		return err
+	}
+	return b.db(kind).Write(url.PathEscape(key), v)
+}
+
+func (b *jsonBackend) Delete(kind, key string) error {
+	return b.db(kind).Delete(url.PathEscape(key))
+}
+
+// sections returns pointers to the sections of the store struct by kind
+func (storeStruct *storeV0) sections() map[string]interface{} {
+	return map[string]interface{}{
+		kindBlueprints: &storeStruct.Blueprints,
+		kindWorkspace:  &storeStruct.Workspace,
+		kindComposes:   &storeStruct.Composes,
+		kindSources:    &storeStruct.Sources,
+		kindChanges:    &storeStruct.Changes,
+		kindCommits:    &storeStruct.Commits,
+		kindLockfiles:  &storeStruct.Lockfiles,
+		kindSnapshots:  &storeStruct.Snapshots,
+	}
+}
+
+// readStoreV0 reads all documents of a backend into a store struct
+func readStoreV0(backend Backend) (*storeV0, error) {
+	var storeStruct storeV0
+	for kind, section := range storeStruct.sections() {
+		keys, err := backend.List(kind)
+		if err != nil {
+			return nil, fmt.Errorf("cannot list %s: %v", kind, err)
+		}
+
+		// Collect the documents into one JSON object, so that they are
+		// decoded like the section of a state file
+		documents := make(map[string]json.RawMessage, len(keys))
+		for _, key := range keys {
+			var document json.RawMessage
+			exists, err := backend.Read(kind, key, &document)
+			if err != nil {
+				return nil, err
+			}
+			if exists {
+				documents[key] = document
+			}
+		}
+
+		data, err := json.Marshal(documents)
+		if err != nil {
+			return nil, err
+		}
+		err = json.Unmarshal(data, section)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read %s: %v", kind, err)
+		}
+	}
+	return &storeStruct, nil
+}
+
+// writeStoreV0 writes every entry of each section of a store struct as a
+// document to a backend
+func writeStoreV0(backend Backend, storeStruct *storeV0) error {
+	for kind, section := range storeStruct.sections() {
+		data, err := json.Marshal(section)
+		if err != nil {
+			return err
+		}
+		var documents map[string]json.RawMessage
+		err = json.Unmarshal(data, &documents)
+		if err != nil {
+			return err
+		}
+		for key, document := range documents {
+			err = backend.Write(kind, key, document)
+			if err != nil {
+				return fmt.Errorf("cannot write %s/%s: %v", kind, key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// migrateStoreV0 moves the state which was kept in a single state file in
+// stateDir before stores had backends into backend. The state file is kept
+// with a ".migrated" suffix.
+func migrateStoreV0(stateDir string, backend Backend) error {
+	var storeStruct storeV0
+	exists, err := jsondb.New(stateDir, 0600).Read(StoreDBName, &storeStruct)
+	if err != nil || !exists {
+		return err
+	}
+
+	err = writeStoreV0(backend, &storeStruct)
+	if err != nil {
+		return err
+	}
+
+	stateFile := path.Join(stateDir, StoreDBName+".json")
+	return os.Rename(stateFile, stateFile+".migrated")
+}
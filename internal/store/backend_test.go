@@ -0,0 +1,225 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/osbuild-composer/internal/blueprint"
+	"github.com/osbuild/osbuild-composer/internal/distro/fedora32"
+	"github.com/osbuild/osbuild-composer/internal/distro/test_distro"
+)
+
+// requireEqualStores compares the serialized state of two stores
+func requireEqualStores(t *testing.T, expected, actual *Store) {
+	expectedJSON, err := json.Marshal(expected.toStoreV0())
+	require.NoError(t, err)
+	actualJSON, err := json.Marshal(actual.toStoreV0())
+	require.NoError(t, err)
+	require.JSONEq(t, string(expectedJSON), string(actualJSON))
+}
+
+func TestJSONBackend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store-backend-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	backend := NewJSONBackend(dir)
+
+	keys, err := backend.List(kindSources)
+	require.NoError(t, err)
+	require.Empty(t, keys)
+
+	// keys are escaped to be valid file names
+	source := sourceV0{Name: "my/source", Type: "yum-baseurl", URL: "http://example.com"}
+	require.NoError(t, backend.Write(kindSources, "my/source", source))
+	_, err = os.Stat(path.Join(dir, kindSources, "my%2Fsource.json"))
+	require.NoError(t, err)
+
+	keys, err = backend.List(kindSources)
+	require.NoError(t, err)
+	require.Equal(t, []string{"my/source"}, keys)
+
+	var read sourceV0
+	exists, err := backend.Read(kindSources, "my/source", &read)
+	require.NoError(t, err)
+	require.True(t, exists)
+	require.Equal(t, source, read)
+
+	require.NoError(t, backend.Delete(kindSources, "my/source"))
+	exists, err = backend.Read(kindSources, "my/source", &read)
+	require.NoError(t, err)
+	require.False(t, exists)
+}
+
+func TestStoreBackendPersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store-backend-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	arch, err := test_distro.New().GetArch("test_arch")
+	require.NoError(t, err)
+	imageType, err := arch.GetImageType("test_type")
+	require.NoError(t, err)
+
+	s, err := New(&dir, arch, nil, nil)
+	require.NoError(t, err)
+	bp := blueprint.Blueprint{Name: "test", Version: "0.0.1"}
+	require.NoError(t, s.PushBlueprint(bp, "first commit"))
+	require.NoError(t, s.TagBlueprint("test"))
+	bp.Version = "0.0.2"
+	require.NoError(t, s.PushBlueprintToWorkspace(bp))
+	require.NoError(t, s.PushSource("test-source", SourceConfig{Name: "test-source", Type: "yum-baseurl", URL: "http://example.com"}))
+	composeID := uuid.New()
+	require.NoError(t, s.PushTestCompose(composeID, []byte(`{}`), imageType, &bp, 0, nil, true))
+	require.NoError(t, s.PushSnapshot(NewSnapshot(composeID, "")))
+
+	// every object is its own document
+	for _, document := range []string{
+		"blueprints/test.json",
+		"workspace/test.json",
+		"changes/test.json",
+		"commits/test.json",
+		"sources/test-source.json",
+		"composes/" + composeID.String() + ".json",
+		"snapshots/" + composeID.String() + ".json",
+	} {
+		_, err = os.Stat(path.Join(dir, "store", document))
+		require.NoError(t, err, document)
+	}
+
+	reloaded, err := New(&dir, arch, nil, nil)
+	require.NoError(t, err)
+	requireEqualStores(t, s, reloaded)
+
+	// deleted objects are removed from the backend
+	require.NoError(t, s.DeleteCompose(composeID))
+	require.NoError(t, s.DeleteSourceByID("test-source"))
+	require.NoError(t, s.DeleteBlueprintFromWorkspace("test"))
+	_, err = os.Stat(path.Join(dir, "store", "composes", composeID.String()+".json"))
+	require.True(t, os.IsNotExist(err))
+
+	reloaded, err = New(&dir, arch, nil, nil)
+	require.NoError(t, err)
+	requireEqualStores(t, s, reloaded)
+	require.Empty(t, reloaded.composes)
+	require.Empty(t, reloaded.sources)
+	require.Empty(t, reloaded.workspace)
+}
+
+func TestMigrateStoreV0(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store-backend-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	data, err := ioutil.ReadFile("test/state-v13.json")
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(path.Join(dir, StoreDBName+".json"), data, 0600))
+
+	arch, err := fedora32.New().GetArch("x86_64")
+	require.NoError(t, err)
+	var storeStruct storeV0
+	require.NoError(t, json.Unmarshal(data, &storeStruct))
+	expected := newStoreFromV0(storeStruct, arch, nil, nil)
+
+	migrated, err := New(&dir, arch, nil, nil)
+	require.NoError(t, err)
+	requireEqualStores(t, expected, migrated)
+
+	// the state file is kept, but not migrated again
+	_, err = os.Stat(path.Join(dir, StoreDBName+".json"))
+	require.True(t, os.IsNotExist(err))
+	_, err = os.Stat(path.Join(dir, StoreDBName+".json.migrated"))
+	require.NoError(t, err)
+
+	reloaded, err := New(&dir, arch, nil, nil)
+	require.NoError(t, err)
+	requireEqualStores(t, expected, reloaded)
+}
+
+// failingBackend fails to write documents of kind, or of any kind if it is
+// empty
+type failingBackend struct {
+	Backend
+	kind string
+}
+
+func (b *failingBackend) Write(kind, key string, v interface{}) error {
+	if b.kind != "" && b.kind != kind {
+		return b.Backend.Write(kind, key, v)
+	}
+	return errors.New("disk full")
+}
+
+func TestStoreBackendError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store-backend-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	arch, err := test_distro.New().GetArch("test_arch")
+	require.NoError(t, err)
+
+	s, err := NewWithBackend(&failingBackend{NewJSONBackend(dir), ""}, arch, nil, nil)
+	require.NoError(t, err)
+
+	err = s.PushSource("test-source", SourceConfig{Name: "test-source"})
+	require.EqualError(t, err, "cannot write sources/test-source: disk full")
+	require.Empty(t, s.GetAllSourcesByID())
+
+	// errors of the change itself take precedence
+	err = s.DeleteBlueprint("test")
+	require.EqualError(t, err, "Unknown blueprint: test")
+}
+
+func TestStoreBackendErrorUndo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store-backend-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	arch, err := test_distro.New().GetArch("test_arch")
+	require.NoError(t, err)
+
+	backend := &failingBackend{NewJSONBackend(dir), kindCommits}
+	s, err := NewWithBackend(backend, arch, nil, nil)
+	require.NoError(t, err)
+
+	bp := blueprint.Blueprint{Name: "test", Version: "0.0.1"}
+	require.NoError(t, s.PushBlueprintToWorkspace(bp))
+
+	// the workspace and changes are written before the commits fail
+	bp.Version = "0.0.2"
+	err = s.PushBlueprint(bp, "commit")
+	require.EqualError(t, err, "cannot write commits/test: disk full")
+
+	workspace, inWorkspace := s.GetBlueprint("test")
+	require.True(t, inWorkspace)
+	require.Equal(t, "0.0.1", workspace.Version)
+	require.Nil(t, s.GetBlueprintCommitted("test"))
+	require.Empty(t, s.GetBlueprintChanges("test"))
+
+	reloaded, err := NewWithBackend(NewJSONBackend(dir), arch, nil, nil)
+	require.NoError(t, err)
+	requireEqualStores(t, s, reloaded)
+}
+
+func TestStoreUnreadableState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store-backend-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	arch, err := test_distro.New().GetArch("test_arch")
+	require.NoError(t, err)
+
+	sources := path.Join(dir, "store", kindSources)
+	require.NoError(t, os.MkdirAll(sources, 0700))
+	require.NoError(t, ioutil.WriteFile(path.Join(sources, "broken.json"), []byte("{"), 0600))
+
+	_, err = New(&dir, arch, nil, nil)
+	require.Error(t, err)
+}
@@ -72,8 +72,10 @@ func (ib *ImageBuild) GetLocalTargetOptions() *target.LocalTargetOptions {
 // It contains all the information necessary to generate the inputs for the job, as
 // well as the job's state.
 type Compose struct {
-	Blueprint  *blueprint.Blueprint
-	ImageBuild ImageBuild
+	Blueprint   *blueprint.Blueprint
+	ImageBuilds []ImageBuild
+	// The values of the blueprint's variables the compose was built with
+	Variables map[string]string
 }
 
 // DeepCopy creates a copy of the Compose structure
@@ -83,8 +85,31 @@ func (c *Compose) DeepCopy() Compose {
 		bpCopy := *c.Blueprint
 		newBpPtr = &bpCopy
 	}
+	var newImageBuilds []ImageBuild
+	for _, ib := range c.ImageBuilds {
+		newImageBuilds = append(newImageBuilds, ib.DeepCopy())
+	}
+	var newVariables map[string]string
+	if c.Variables != nil {
+		newVariables = make(map[string]string)
+		for name, value := range c.Variables {
+			newVariables[name] = value
+		}
+	}
 	return Compose{
-		Blueprint:  newBpPtr,
-		ImageBuild: c.ImageBuild.DeepCopy(),
+		Blueprint:   newBpPtr,
+		ImageBuilds: newImageBuilds,
+		Variables:   newVariables,
+	}
+}
+
+// ImageBuild returns the image build with the given ID, or nil if the
+// compose doesn't contain one
+func (c *Compose) ImageBuild(id int) *ImageBuild {
+	for i := range c.ImageBuilds {
+		if c.ImageBuilds[i].ID == id {
+			return &c.ImageBuilds[i]
+		}
 	}
+	return nil
 }
@@ -61,53 +61,64 @@ func FixtureBase() *Store {
 	if err != nil {
 		panic("could not create manifest")
 	}
-	s := New(nil, arch, nil)
+	s, err := New(nil, arch, nil, nil)
+	if err != nil {
+		panic(err)
+	}
 
 	s.blueprints[bName] = b
 	s.composes = map[uuid.UUID]Compose{
 		uuid.MustParse("30000000-0000-0000-0000-000000000000"): {
 			Blueprint: &b,
-			ImageBuild: ImageBuild{
-				QueueStatus: common.IBWaiting,
-				ImageType:   imgType,
-				Manifest:    manifest,
-				Targets:     []*target.Target{localTarget, awsTarget},
-				JobCreated:  date,
+			ImageBuilds: []ImageBuild{
+				{
+					QueueStatus: common.IBWaiting,
+					ImageType:   imgType,
+					Manifest:    manifest,
+					Targets:     []*target.Target{localTarget, awsTarget},
+					JobCreated:  date,
+				},
 			},
 		},
 		uuid.MustParse("30000000-0000-0000-0000-000000000001"): {
 			Blueprint: &b,
-			ImageBuild: ImageBuild{
-				QueueStatus: common.IBRunning,
-				ImageType:   imgType,
-				Manifest:    manifest,
-				Targets:     []*target.Target{localTarget},
-				JobCreated:  date,
-				JobStarted:  date,
+			ImageBuilds: []ImageBuild{
+				{
+					QueueStatus: common.IBRunning,
+					ImageType:   imgType,
+					Manifest:    manifest,
+					Targets:     []*target.Target{localTarget},
+					JobCreated:  date,
+					JobStarted:  date,
+				},
 			},
 		},
 		uuid.MustParse("30000000-0000-0000-0000-000000000002"): {
 			Blueprint: &b,
-			ImageBuild: ImageBuild{
-				QueueStatus: common.IBFinished,
-				ImageType:   imgType,
-				Manifest:    manifest,
-				Targets:     []*target.Target{localTarget, awsTarget},
-				JobCreated:  date,
-				JobStarted:  date,
-				JobFinished: date,
+			ImageBuilds: []ImageBuild{
+				{
+					QueueStatus: common.IBFinished,
+					ImageType:   imgType,
+					Manifest:    manifest,
+					Targets:     []*target.Target{localTarget, awsTarget},
+					JobCreated:  date,
+					JobStarted:  date,
+					JobFinished: date,
+				},
 			},
 		},
 		uuid.MustParse("30000000-0000-0000-0000-000000000003"): {
 			Blueprint: &b,
-			ImageBuild: ImageBuild{
-				QueueStatus: common.IBFailed,
-				ImageType:   imgType,
-				Manifest:    manifest,
-				Targets:     []*target.Target{localTarget, awsTarget},
-				JobCreated:  date,
-				JobStarted:  date,
-				JobFinished: date,
+			ImageBuilds: []ImageBuild{
+				{
+					QueueStatus: common.IBFailed,
+					ImageType:   imgType,
+					Manifest:    manifest,
+					Targets:     []*target.Target{localTarget, awsTarget},
+					JobCreated:  date,
+					JobStarted:  date,
+					JobFinished: date,
+				},
 			},
 		},
 	}
@@ -164,41 +175,50 @@ func FixtureFinished() *Store {
 	if err != nil {
 		panic("could not create manifest")
 	}
-	s := New(nil, arch, nil)
+	s, err := New(nil, arch, nil, nil)
+	if err != nil {
+		panic(err)
+	}
 
 	s.blueprints[bName] = b
 	s.composes = map[uuid.UUID]Compose{
 		uuid.MustParse("30000000-0000-0000-0000-000000000000"): {
 			Blueprint: &b,
-			ImageBuild: ImageBuild{
-				QueueStatus: common.IBFinished,
-				ImageType:   imgType,
-				Manifest:    manifest,
-				Targets:     []*target.Target{localTarget, awsTarget},
-				JobCreated:  date,
+			ImageBuilds: []ImageBuild{
+				{
+					QueueStatus: common.IBFinished,
+					ImageType:   imgType,
+					Manifest:    manifest,
+					Targets:     []*target.Target{localTarget, awsTarget},
+					JobCreated:  date,
+				},
 			},
 		},
 		uuid.MustParse("30000000-0000-0000-0000-000000000001"): {
 			Blueprint: &b,
-			ImageBuild: ImageBuild{
-				QueueStatus: common.IBFinished,
-				ImageType:   imgType,
-				Manifest:    manifest,
-				Targets:     []*target.Target{localTarget},
-				JobCreated:  date,
-				JobStarted:  date,
+			ImageBuilds: []ImageBuild{
+				{
+					QueueStatus: common.IBFinished,
+					ImageType:   imgType,
+					Manifest:    manifest,
+					Targets:     []*target.Target{localTarget},
+					JobCreated:  date,
+					JobStarted:  date,
+				},
 			},
 		},
 		uuid.MustParse("30000000-0000-0000-0000-000000000003"): {
 			Blueprint: &b,
-			ImageBuild: ImageBuild{
-				QueueStatus: common.IBFailed,
-				ImageType:   imgType,
-				Manifest:    manifest,
-				Targets:     []*target.Target{localTarget, awsTarget},
-				JobCreated:  date,
-				JobStarted:  date,
-				JobFinished: date,
+			ImageBuilds: []ImageBuild{
+				{
+					QueueStatus: common.IBFailed,
+					ImageType:   imgType,
+					Manifest:    manifest,
+					Targets:     []*target.Target{localTarget, awsTarget},
+					JobCreated:  date,
+					JobStarted:  date,
+					JobFinished: date,
+				},
 			},
 		},
 	}
@@ -222,7 +242,10 @@ func FixtureEmpty() *Store {
 	if err != nil {
 		panic("invalid architecture x86_64 for fedoratest")
 	}
-	s := New(nil, arch, nil)
+	s, err := New(nil, arch, nil, nil)
+	if err != nil {
+		panic(err)
+	}
 
 	s.blueprints[bName] = b
 
@@ -0,0 +1,113 @@
+package store
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/osbuild/osbuild-composer/internal/blueprint"
+)
+
+// ResolveBlueprint returns bp with the committed versions of the blueprints
+// it includes merged into it, recursively. It returns an error if an
+// included blueprint does not exist, or if blueprints include each other.
+func (s *Store) ResolveBlueprint(bp blueprint.Blueprint) (blueprint.Blueprint, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.resolveBlueprint(bp)
+}
+
+// resolveBlueprint is ResolveBlueprint for callers which hold the lock
+func (s *Store) resolveBlueprint(bp blueprint.Blueprint) (blueprint.Blueprint, error) {
+	return s.resolveIncludes(bp, []string{bp.Name})
+}
+
+// resolveIncludes resolves the includes of bp. `path` contains the names of
+// the blueprints which include bp, ending with bp itself.
+func (s *Store) resolveIncludes(bp blueprint.Blueprint, path []string) (blueprint.Blueprint, error) {
+	if len(bp.Include) == 0 {
+		return bp, nil
+	}
+
+	var base blueprint.Blueprint
+	for _, name := range bp.Include {
+		includePath := append(path[:len(path):len(path)], name)
+		for _, n := range path {
+			if n == name {
+				return blueprint.Blueprint{}, fmt.Errorf("blueprint include cycle: %s", strings.Join(includePath, " -> "))
+			}
+		}
+
+		included, exists := s.blueprints[name]
+		if !exists {
+			return blueprint.Blueprint{}, fmt.Errorf("blueprint %s includes unknown blueprint %s", path[len(path)-1], name)
+		}
+
+		included, err := s.resolveIncludes(included, includePath)
+		if err != nil {
+			return blueprint.Blueprint{}, err
+		}
+		base = blueprint.Merge(base, included)
+	}
+
+	return blueprint.Merge(base, bp), nil
+}
+
+// flattenBlueprint returns bp with its includes resolved. Blueprints which
+// cannot be resolved (because they were imported or pulled with includes
+// that don't exist) are returned as they are.
+func (s *Store) flattenBlueprint(bp blueprint.Blueprint) blueprint.Blueprint {
+	resolved, err := s.resolveBlueprint(bp)
+	if err != nil {
+		return bp
+	}
+	return resolved
+}
+
+// GetBlueprintIncludes returns the names of the blueprints the committed
+// blueprint `name` includes, directly or indirectly, sorted by name
+func (s *Store) GetBlueprintIncludes(name string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	seen := map[string]bool{name: true}
+	var includes []string
+	var collect func(string)
+	collect = func(name string) {
+		for _, include := range s.blueprints[name].Include {
+			if !seen[include] {
+				seen[include] = true
+				includes = append(includes, include)
+				collect(include)
+			}
+		}
+	}
+	collect(name)
+
+	sort.Strings(includes)
+	return includes
+}
+
+// getBlueprintDependants returns the names of the blueprints whose committed
+// or workspace version directly includes the blueprint `name`, sorted by name
+func (s *Store) getBlueprintDependants(name string) []string {
+	found := make(map[string]bool)
+	for _, blueprints := range []map[string]blueprint.Blueprint{s.blueprints, s.workspace} {
+		for dependant, bp := range blueprints {
+			for _, include := range bp.Include {
+				if include == name {
+					found[dependant] = true
+					break
+				}
+			}
+		}
+	}
+
+	dependants := make([]string, 0, len(found))
+	for dependant := range found {
+		dependants = append(dependants, dependant)
+	}
+	sort.Strings(dependants)
+	return dependants
+}
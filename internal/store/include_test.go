@@ -0,0 +1,78 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/osbuild-composer/internal/blueprint"
+)
+
+func TestBlueprintIncludes(t *testing.T) {
+	s := newArchiveTestStore(t)
+
+	require.NoError(t, s.PushBlueprint(blueprint.Blueprint{
+		Name:     "base",
+		Packages: []blueprint.Package{{Name: "httpd", Version: "*"}},
+	}, "base"))
+	require.NoError(t, s.PushBlueprint(blueprint.Blueprint{
+		Name:     "monitoring",
+		Include:  []string{"base"},
+		Packages: []blueprint.Package{{Name: "collectd", Version: "*"}},
+	}, "monitoring"))
+	require.NoError(t, s.PushBlueprint(blueprint.Blueprint{
+		Name:     "test",
+		Include:  []string{"monitoring"},
+		Packages: []blueprint.Package{{Name: "httpd", Version: "2.4.*"}},
+	}, "test"))
+
+	// blueprints are returned as they were pushed
+	bp := s.GetBlueprintCommitted("test")
+	require.Equal(t, []blueprint.Package{{Name: "httpd", Version: "2.4.*"}}, bp.Packages)
+	require.Equal(t, []string{"monitoring"}, bp.Include)
+	require.Equal(t, []string{"base", "monitoring"}, s.GetBlueprintIncludes("test"))
+
+	resolved, err := s.ResolveBlueprint(*bp)
+	require.NoError(t, err)
+	require.Equal(t, []blueprint.Package{
+		{Name: "collectd", Version: "*"},
+		{Name: "httpd", Version: "2.4.*"},
+	}, resolved.Packages)
+
+	// changes to included blueprints are picked up when resolving
+	require.NoError(t, s.PushBlueprint(blueprint.Blueprint{
+		Name:     "base",
+		Packages: []blueprint.Package{{Name: "tmux", Version: "*"}},
+	}, "base"))
+	resolved, err = s.ResolveBlueprint(*bp)
+	require.NoError(t, err)
+	require.Equal(t, []blueprint.Package{
+		{Name: "tmux", Version: "*"},
+		{Name: "collectd", Version: "*"},
+		{Name: "httpd", Version: "2.4.*"},
+	}, resolved.Packages)
+
+	// changes keep the blueprint as it was pushed
+	changes := s.GetBlueprintChanges("test")
+	require.Len(t, changes[0].Blueprint.Packages, 1)
+
+	err = s.PushBlueprint(blueprint.Blueprint{Name: "base", Include: []string{"test"}}, "cycle")
+	require.EqualError(t, err, "blueprint include cycle: base -> test -> monitoring -> base")
+	err = s.PushBlueprintToWorkspace(blueprint.Blueprint{Name: "self", Include: []string{"self"}})
+	require.EqualError(t, err, "blueprint include cycle: self -> self")
+	err = s.PushBlueprint(blueprint.Blueprint{Name: "other", Include: []string{"unknown"}}, "unknown")
+	require.EqualError(t, err, "blueprint other includes unknown blueprint unknown")
+
+	err = s.DeleteBlueprint("base")
+	require.EqualError(t, err, "Blueprint base is included by: monitoring")
+	require.NotNil(t, s.GetBlueprintCommitted("base"))
+	require.NoError(t, s.DeleteBlueprint("test"))
+	require.NoError(t, s.DeleteBlueprint("monitoring"))
+
+	// workspace copies keep included blueprints as well
+	require.NoError(t, s.PushBlueprintToWorkspace(blueprint.Blueprint{Name: "draft", Include: []string{"base"}}))
+	err = s.DeleteBlueprint("base")
+	require.EqualError(t, err, "Blueprint base is included by: draft")
+	require.NoError(t, s.DeleteBlueprintFromWorkspace("draft"))
+	require.NoError(t, s.DeleteBlueprint("base"))
+}
@@ -20,6 +20,8 @@ type storeV0 struct {
 	Sources    sourcesV0    `json:"sources"`
 	Changes    changesV0    `json:"changes"`
 	Commits    commitsV0    `json:"commits"`
+	Lockfiles  lockfilesV0  `json:"lockfiles,omitempty"`
+	Snapshots  snapshotsV0  `json:"snapshots,omitempty"`
 }
 
 type blueprintsV0 map[string]blueprint.Blueprint
@@ -31,6 +33,7 @@ type workspaceV0 map[string]blueprint.Blueprint
 type composeV0 struct {
 	Blueprint   *blueprint.Blueprint `json:"blueprint"`
 	ImageBuilds []imageBuildV0       `json:"image_builds"`
+	Variables   map[string]string    `json:"variables,omitempty"`
 }
 
 type composesV0 map[uuid.UUID]composeV0
@@ -39,6 +42,8 @@ type composesV0 map[uuid.UUID]composeV0
 type imageBuildV0 struct {
 	ID          int              `json:"id"`
 	ImageType   string           `json:"image_type"`
+	Distro      string           `json:"distro,omitempty"`
+	Arch        string           `json:"arch,omitempty"`
 	Manifest    distro.Manifest  `json:"manifest"`
 	Targets     []*target.Target `json:"targets"`
 	JobCreated  time.Time        `json:"job_created"`
@@ -60,6 +65,8 @@ type sourceV0 struct {
 	CheckGPG bool   `json:"check_gpg"`
 	CheckSSL bool   `json:"check_ssl"`
 	System   bool   `json:"system"`
+
+	SnapshotURL string `json:"snapshot_url,omitempty"`
 }
 
 type sourcesV0 map[string]sourceV0
@@ -76,6 +83,10 @@ type changesV0 map[string]map[string]changeV0
 
 type commitsV0 map[string][]string
 
+type lockfilesV0 map[string]map[string]Lockfile
+
+type snapshotsV0 map[uuid.UUID]Snapshot
+
 func newBlueprintsFromV0(blueprintsStruct blueprintsV0) map[string]blueprint.Blueprint {
 	blueprints := make(map[string]blueprint.Blueprint)
 	for name, blueprint := range blueprintsStruct {
@@ -92,11 +103,11 @@ func newWorkspaceFromV0(workspaceStruct workspaceV0) map[string]blueprint.Bluepr
 	return workspace
 }
 
-func newComposesFromV0(composesStruct composesV0, arch distro.Arch, log *log.Logger) map[uuid.UUID]Compose {
+func newComposesFromV0(composesStruct composesV0, arch distro.Arch, distros *distro.Registry, log *log.Logger) map[uuid.UUID]Compose {
 	composes := make(map[uuid.UUID]Compose)
 
 	for composeID, composeStruct := range composesStruct {
-		c, err := newComposeFromV0(composeStruct, arch)
+		c, err := newComposeFromV0(composeStruct, arch, distros)
 		if err != nil {
 			if log != nil {
 				log.Printf("ignoring compose: %v", err)
@@ -109,7 +120,29 @@ func newComposesFromV0(composesStruct composesV0, arch distro.Arch, log *log.Log
 	return composes
 }
 
-func newImageBuildFromV0(imageBuildStruct imageBuildV0, arch distro.Arch) (ImageBuild, error) {
+func newImageBuildFromV0(imageBuildStruct imageBuildV0, arch distro.Arch, distros *distro.Registry) (ImageBuild, error) {
+	// Image builds without a distribution or architecture were built for
+	// the host
+	d := arch.Distro()
+	if imageBuildStruct.Distro != "" && imageBuildStruct.Distro != d.Name() {
+		if distros != nil {
+			d = distros.GetDistro(imageBuildStruct.Distro)
+		}
+		if d == nil || d.Name() != imageBuildStruct.Distro {
+			return ImageBuild{}, errors.New("unknown distribution: " + imageBuildStruct.Distro)
+		}
+	}
+	archName := imageBuildStruct.Arch
+	if archName == "" {
+		archName = arch.Name()
+	}
+	if d.Name() != arch.Distro().Name() || archName != arch.Name() {
+		var err error
+		arch, err = d.GetArch(archName)
+		if err != nil {
+			return ImageBuild{}, err
+		}
+	}
 	imgType := imageTypeFromCompatString(imageBuildStruct.ImageType, arch)
 	if imgType == nil {
 		// Invalid type strings in serialization format, this may happen
@@ -139,18 +172,23 @@ func newImageBuildFromV0(imageBuildStruct imageBuildV0, arch distro.Arch) (Image
 	}, nil
 }
 
-func newComposeFromV0(composeStruct composeV0, arch distro.Arch) (Compose, error) {
-	if len(composeStruct.ImageBuilds) != 1 {
+func newComposeFromV0(composeStruct composeV0, arch distro.Arch, distros *distro.Registry) (Compose, error) {
+	if len(composeStruct.ImageBuilds) == 0 {
 		return Compose{}, errors.New("compose with unsupported number of image builds")
 	}
-	ib, err := newImageBuildFromV0(composeStruct.ImageBuilds[0], arch)
-	if err != nil {
-		return Compose{}, err
+	var imageBuilds []ImageBuild
+	for _, imageBuildStruct := range composeStruct.ImageBuilds {
+		ib, err := newImageBuildFromV0(imageBuildStruct, arch, distros)
+		if err != nil {
+			return Compose{}, err
+		}
+		imageBuilds = append(imageBuilds, ib)
 	}
 	bp := composeStruct.Blueprint.DeepCopy()
 	return Compose{
-		Blueprint:  &bp,
-		ImageBuild: ib,
+		Blueprint:   &bp,
+		ImageBuilds: imageBuilds,
+		Variables:   composeStruct.Variables,
 	}, nil
 }
 
@@ -225,14 +263,38 @@ func newCommitsFromV0(commitsMapStruct commitsV0, changesMapStruct changesV0) ma
 	return commitsMap
 }
 
-func newStoreFromV0(storeStruct storeV0, arch distro.Arch, log *log.Logger) *Store {
+func newLockfilesFromV0(lockfilesStruct lockfilesV0) map[string]map[string]Lockfile {
+	lockfiles := make(map[string]map[string]Lockfile)
+	for name, commits := range lockfilesStruct {
+		lockfiles[name] = make(map[string]Lockfile)
+		for commit, lockfile := range commits {
+			lockfiles[name][commit] = lockfile.DeepCopy()
+		}
+	}
+	return lockfiles
+}
+
+func newSnapshotsFromV0(snapshotsStruct snapshotsV0) map[uuid.UUID]Snapshot {
+	snapshots := make(map[uuid.UUID]Snapshot)
+	for id, snapshot := range snapshotsStruct {
+		snapshots[id] = snapshot.DeepCopy()
+	}
+	return snapshots
+}
+
+func newStoreFromV0(storeStruct storeV0, arch distro.Arch, distros *distro.Registry, log *log.Logger) *Store {
 	return &Store{
-		blueprints:        newBlueprintsFromV0(storeStruct.Blueprints),
-		workspace:         newWorkspaceFromV0(storeStruct.Workspace),
-		composes:          newComposesFromV0(storeStruct.Composes, arch, log),
-		sources:           newSourceConfigsFromV0(storeStruct.Sources),
-		blueprintsChanges: newChangesFromV0(storeStruct.Changes),
-		blueprintsCommits: newCommitsFromV0(storeStruct.Commits, storeStruct.Changes),
+		blueprints:          newBlueprintsFromV0(storeStruct.Blueprints),
+		workspace:           newWorkspaceFromV0(storeStruct.Workspace),
+		composes:            newComposesFromV0(storeStruct.Composes, arch, distros, log),
+		sources:             newSourceConfigsFromV0(storeStruct.Sources),
+		blueprintsChanges:   newChangesFromV0(storeStruct.Changes),
+		blueprintsCommits:   newCommitsFromV0(storeStruct.Commits, storeStruct.Changes),
+		blueprintsLockfiles: newLockfilesFromV0(storeStruct.Lockfiles),
+		snapshots:           newSnapshotsFromV0(storeStruct.Snapshots),
+		arch:                arch,
+		distros:             distros,
+		log:                 log,
 	}
 }
 
@@ -254,22 +316,27 @@ func newWorkspaceV0(workspace map[string]blueprint.Blueprint) workspaceV0 {
 
 func newComposeV0(compose Compose) composeV0 {
 	bp := compose.Blueprint.DeepCopy()
+	var imageBuilds []imageBuildV0
+	for _, ib := range compose.ImageBuilds {
+		imageBuilds = append(imageBuilds, imageBuildV0{
+			ID:          ib.ID,
+			ImageType:   imageTypeToCompatString(ib.ImageType),
+			Distro:      ib.ImageType.Arch().Distro().Name(),
+			Arch:        ib.ImageType.Arch().Name(),
+			Manifest:    ib.Manifest,
+			Targets:     ib.Targets,
+			JobCreated:  ib.JobCreated,
+			JobStarted:  ib.JobStarted,
+			JobFinished: ib.JobFinished,
+			Size:        ib.Size,
+			JobID:       ib.JobID,
+			QueueStatus: ib.QueueStatus,
+		})
+	}
 	return composeV0{
-		Blueprint: &bp,
-		ImageBuilds: []imageBuildV0{
-			{
-				ID:          compose.ImageBuild.ID,
-				ImageType:   imageTypeToCompatString(compose.ImageBuild.ImageType),
-				Manifest:    compose.ImageBuild.Manifest,
-				Targets:     compose.ImageBuild.Targets,
-				JobCreated:  compose.ImageBuild.JobCreated,
-				JobStarted:  compose.ImageBuild.JobStarted,
-				JobFinished: compose.ImageBuild.JobFinished,
-				Size:        compose.ImageBuild.Size,
-				JobID:       compose.ImageBuild.JobID,
-				QueueStatus: compose.ImageBuild.QueueStatus,
-			},
-		},
+		Blueprint:   &bp,
+		ImageBuilds: imageBuilds,
+		Variables:   compose.Variables,
 	}
 }
 
@@ -314,6 +381,25 @@ func newCommitsV0(commits map[string][]string) commitsV0 {
 	return commitsStruct
 }
 
+func newLockfilesV0(lockfiles map[string]map[string]Lockfile) lockfilesV0 {
+	lockfilesStruct := make(lockfilesV0)
+	for name, commits := range lockfiles {
+		lockfilesStruct[name] = make(map[string]Lockfile)
+		for commit, lockfile := range commits {
+			lockfilesStruct[name][commit] = lockfile.DeepCopy()
+		}
+	}
+	return lockfilesStruct
+}
+
+func newSnapshotsV0(snapshots map[uuid.UUID]Snapshot) snapshotsV0 {
+	snapshotsStruct := make(snapshotsV0)
+	for id, snapshot := range snapshots {
+		snapshotsStruct[id] = snapshot.DeepCopy()
+	}
+	return snapshotsStruct
+}
+
 func (store *Store) toStoreV0() *storeV0 {
 	return &storeV0{
 		Blueprints: newBlueprintsV0(store.blueprints),
@@ -322,23 +408,30 @@ func (store *Store) toStoreV0() *storeV0 {
 		Sources:    newSourcesV0(store.sources),
 		Changes:    newChangesV0(store.blueprintsChanges),
 		Commits:    newCommitsV0(store.blueprintsCommits),
+		Lockfiles:  newLockfilesV0(store.blueprintsLockfiles),
+		Snapshots:  newSnapshotsV0(store.snapshots),
 	}
 }
 
 var imageTypeCompatMapping = map[string]string{
-	"vhd":               "Azure",
-	"ami":               "AWS",
-	"liveiso":           "LiveISO",
-	"openstack":         "OpenStack",
-	"qcow2":             "qcow2",
-	"vmdk":              "VMWare",
-	"ext4-filesystem":   "Raw-filesystem",
-	"partitioned-disk":  "Partitioned-disk",
-	"tar":               "Tar",
-	"fedora-iot-commit": "fedora-iot-commit",
-	"rhel-edge-commit":  "rhel-edge-commit",
-	"test_type":         "test_type",         // used only in json_test.go
-	"test_type_invalid": "test_type_invalid", // used only in json_test.go
+	"vhd":                  "Azure",
+	"ami":                  "AWS",
+	"liveiso":              "LiveISO",
+	"openstack":            "OpenStack",
+	"qcow2":                "qcow2",
+	"vmdk":                 "VMWare",
+	"ext4-filesystem":      "Raw-filesystem",
+	"partitioned-disk":     "Partitioned-disk",
+	"tar":                  "Tar",
+	"fedora-iot-commit":    "fedora-iot-commit",
+	"rhel-edge-commit":     "rhel-edge-commit",
+	"fedora-iot-installer": "fedora-iot-installer",
+	"rhel-edge-installer":  "rhel-edge-installer",
+	"image-installer":      "image-installer",
+	"container":            "container",
+	"gce":                  "gce",
+	"test_type":            "test_type",         // used only in json_test.go
+	"test_type_invalid":    "test_type_invalid", // used only in json_test.go
 }
 
 func imageTypeToCompatString(imgType distro.ImageType) string {
@@ -109,7 +109,7 @@ func TestMarshalEmpty(t *testing.T) {
 	}
 	store1 := FixtureEmpty()
 	storeV0 := store1.toStoreV0()
-	store2 := newStoreFromV0(*storeV0, arch, nil)
+	store2 := newStoreFromV0(*storeV0, arch, nil, nil)
 	if !reflect.DeepEqual(store1, store2) {
 		t.Errorf("marshal/unmarshal roundtrip not a noop for empty store: %v != %v", store1, store2)
 	}
@@ -123,7 +123,7 @@ func TestMarshalFinished(t *testing.T) {
 	}
 	store1 := FixtureFinished()
 	storeV0 := store1.toStoreV0()
-	store2 := newStoreFromV0(*storeV0, arch, nil)
+	store2 := newStoreFromV0(*storeV0, arch, nil, nil)
 	if !reflect.DeepEqual(store1, store2) {
 		t.Errorf("marshal/unmarshal roundtrip not a noop for base store: %v != %v", store1, store2)
 	}
@@ -153,6 +153,8 @@ func TestStore_toStoreV0(t *testing.T) {
 				Sources:    make(sourcesV0),
 				Changes:    make(changesV0),
 				Commits:    make(commitsV0),
+				Lockfiles:  make(lockfilesV0),
+				Snapshots:  make(snapshotsV0),
 			},
 		},
 	}
@@ -174,6 +176,9 @@ func TestStore_toStoreV0(t *testing.T) {
 }
 
 func Test_newStoreFromV0(t *testing.T) {
+	empty, err := New(nil, &test_distro.TestArch{}, nil, nil)
+	require.NoError(t, err)
+
 	type args struct {
 		storeStruct storeV0
 		arch        distro.Arch
@@ -189,12 +194,12 @@ func Test_newStoreFromV0(t *testing.T) {
 				storeStruct: storeV0{},
 				arch:        &test_distro.TestArch{},
 			},
-			want: New(nil, &test_distro.TestArch{}, nil),
+			want: empty,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := newStoreFromV0(tt.args.storeStruct, tt.args.arch, nil); !reflect.DeepEqual(got, tt.want) {
+			if got := newStoreFromV0(tt.args.storeStruct, tt.args.arch, nil, nil); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("newStoreFromV0() = %v, want %v", got, tt.want)
 			}
 		})
@@ -290,7 +295,7 @@ func Test_upgrade(t *testing.T) {
 		assert.NoErrorf(err, "Could not parse test-store '%s': %v", fileName, err)
 		arch, err := fedora32.New().GetArch("x86_64")
 		assert.NoError(err)
-		store := newStoreFromV0(storeStruct, arch, nil)
+		store := newStoreFromV0(storeStruct, arch, nil, nil)
 		assert.Equal(1, len(store.blueprints))
 		assert.Equal(1, len(store.blueprintsChanges))
 		assert.Equal(1, len(store.blueprintsCommits))
@@ -989,30 +994,32 @@ func Test_newComposeV0(t *testing.T) {
 			name: "qcow2 compose",
 			compose: Compose{
 				Blueprint: &bp,
-				ImageBuild: ImageBuild{
-					ID:        0,
-					ImageType: &test_distro.TestImageType{},
-					Manifest:  []byte("JSON MANIFEST GOES HERE"),
-					Targets: []*target.Target{
-						{
-							Uuid:      uuid.MustParse("f53b49c0-d321-447e-8ab8-6e827891e3f0"),
-							ImageName: "",
-							Name:      "org.osbuild.local",
-							Created:   MustParseTime("2020-08-12T09:21:44.427717205-07:00"),
-							Status:    common.IBWaiting,
-							Options: target.LocalTargetOptions{
-								ComposeId:    uuid.MustParse("6b512b52-1e9d-4dac-869c-108fd4860a3e"),
-								ImageBuildId: 0,
-								Filename:     "disk.qcow2",
+				ImageBuilds: []ImageBuild{
+					{
+						ID:        0,
+						ImageType: &test_distro.TestImageType{},
+						Manifest:  []byte("JSON MANIFEST GOES HERE"),
+						Targets: []*target.Target{
+							{
+								Uuid:      uuid.MustParse("f53b49c0-d321-447e-8ab8-6e827891e3f0"),
+								ImageName: "",
+								Name:      "org.osbuild.local",
+								Created:   MustParseTime("2020-08-12T09:21:44.427717205-07:00"),
+								Status:    common.IBWaiting,
+								Options: target.LocalTargetOptions{
+									ComposeId:    uuid.MustParse("6b512b52-1e9d-4dac-869c-108fd4860a3e"),
+									ImageBuildId: 0,
+									Filename:     "disk.qcow2",
+								},
 							},
 						},
+						JobCreated:  MustParseTime("2020-08-12T09:21:50.07040195-07:00"),
+						JobStarted:  MustParseTime("0001-01-01T00:00:00Z"),
+						JobFinished: MustParseTime("0001-01-01T00:00:00Z"),
+						Size:        2147483648,
+						JobID:       uuid.MustParse("22445cd3-7fa5-4dca-b7f8-4f9857b3e3a0"),
+						QueueStatus: common.IBFinished,
 					},
-					JobCreated:  MustParseTime("2020-08-12T09:21:50.07040195-07:00"),
-					JobStarted:  MustParseTime("0001-01-01T00:00:00Z"),
-					JobFinished: MustParseTime("0001-01-01T00:00:00Z"),
-					Size:        2147483648,
-					JobID:       uuid.MustParse("22445cd3-7fa5-4dca-b7f8-4f9857b3e3a0"),
-					QueueStatus: common.IBFinished,
 				},
 			},
 			want: composeV0{
@@ -1021,6 +1028,8 @@ func Test_newComposeV0(t *testing.T) {
 					{
 						ID:        0,
 						ImageType: "test_type",
+						Distro:    "test-distro",
+						Arch:      "test_arch",
 						Manifest:  []byte("JSON MANIFEST GOES HERE"),
 						Targets: []*target.Target{
 							{
@@ -1115,37 +1124,39 @@ func Test_newComposeFromV0(t *testing.T) {
 			},
 			want: Compose{
 				Blueprint: &bp,
-				ImageBuild: ImageBuild{
-					ID:        0,
-					ImageType: &test_distro.TestImageType{},
-					Manifest:  []byte("JSON MANIFEST GOES HERE"),
-					Targets: []*target.Target{
-						{
-							Uuid:      uuid.MustParse("f53b49c0-d321-447e-8ab8-6e827891e3f0"),
-							ImageName: "",
-							Name:      "org.osbuild.local",
-							Created:   MustParseTime("2020-08-12T09:21:44.427717205-07:00"),
-							Status:    common.IBWaiting,
-							Options: target.LocalTargetOptions{
-								ComposeId:    uuid.MustParse("6b512b52-1e9d-4dac-869c-108fd4860a3e"),
-								ImageBuildId: 0,
-								Filename:     "disk.qcow2",
+				ImageBuilds: []ImageBuild{
+					{
+						ID:        0,
+						ImageType: &test_distro.TestImageType{},
+						Manifest:  []byte("JSON MANIFEST GOES HERE"),
+						Targets: []*target.Target{
+							{
+								Uuid:      uuid.MustParse("f53b49c0-d321-447e-8ab8-6e827891e3f0"),
+								ImageName: "",
+								Name:      "org.osbuild.local",
+								Created:   MustParseTime("2020-08-12T09:21:44.427717205-07:00"),
+								Status:    common.IBWaiting,
+								Options: target.LocalTargetOptions{
+									ComposeId:    uuid.MustParse("6b512b52-1e9d-4dac-869c-108fd4860a3e"),
+									ImageBuildId: 0,
+									Filename:     "disk.qcow2",
+								},
 							},
 						},
+						JobCreated:  MustParseTime("2020-08-12T09:21:50.07040195-07:00"),
+						JobStarted:  MustParseTime("0001-01-01T00:00:00Z"),
+						JobFinished: MustParseTime("0001-01-01T00:00:00Z"),
+						Size:        2147483648,
+						JobID:       uuid.MustParse("22445cd3-7fa5-4dca-b7f8-4f9857b3e3a0"),
+						QueueStatus: common.IBFinished,
 					},
-					JobCreated:  MustParseTime("2020-08-12T09:21:50.07040195-07:00"),
-					JobStarted:  MustParseTime("0001-01-01T00:00:00Z"),
-					JobFinished: MustParseTime("0001-01-01T00:00:00Z"),
-					Size:        2147483648,
-					JobID:       uuid.MustParse("22445cd3-7fa5-4dca-b7f8-4f9857b3e3a0"),
-					QueueStatus: common.IBFinished,
 				},
 			},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := newComposeFromV0(tt.compose, tt.arch)
+			got, err := newComposeFromV0(tt.compose, tt.arch, nil)
 			if err != nil {
 				if !tt.errOk {
 					t.Errorf("newComposeFromV0() error = %v", err)
@@ -1176,58 +1187,62 @@ func Test_newComposesV0(t *testing.T) {
 			composes: map[uuid.UUID]Compose{
 				uuid.MustParse("f53b49c0-d321-447e-8ab8-6e827891e3f0"): {
 					Blueprint: &bp,
-					ImageBuild: ImageBuild{
-						ID:        0,
-						ImageType: &test_distro.TestImageType{},
-						Manifest:  []byte("JSON MANIFEST GOES HERE"),
-						Targets: []*target.Target{
-							{
-								Uuid:      uuid.MustParse("f53b49c0-d321-447e-8ab8-6e827891e3f0"),
-								ImageName: "",
-								Name:      "org.osbuild.local",
-								Created:   MustParseTime("2020-08-12T09:21:44.427717205-07:00"),
-								Status:    common.IBWaiting,
-								Options: target.LocalTargetOptions{
-									ComposeId:    uuid.MustParse("6b512b52-1e9d-4dac-869c-108fd4860a3e"),
-									ImageBuildId: 0,
-									Filename:     "disk.qcow2",
+					ImageBuilds: []ImageBuild{
+						{
+							ID:        0,
+							ImageType: &test_distro.TestImageType{},
+							Manifest:  []byte("JSON MANIFEST GOES HERE"),
+							Targets: []*target.Target{
+								{
+									Uuid:      uuid.MustParse("f53b49c0-d321-447e-8ab8-6e827891e3f0"),
+									ImageName: "",
+									Name:      "org.osbuild.local",
+									Created:   MustParseTime("2020-08-12T09:21:44.427717205-07:00"),
+									Status:    common.IBWaiting,
+									Options: target.LocalTargetOptions{
+										ComposeId:    uuid.MustParse("6b512b52-1e9d-4dac-869c-108fd4860a3e"),
+										ImageBuildId: 0,
+										Filename:     "disk.qcow2",
+									},
 								},
 							},
+							JobCreated:  MustParseTime("2020-08-12T09:21:50.07040195-07:00"),
+							JobStarted:  MustParseTime("0001-01-01T00:00:00Z"),
+							JobFinished: MustParseTime("0001-01-01T00:00:00Z"),
+							Size:        2147483648,
+							JobID:       uuid.MustParse("22445cd3-7fa5-4dca-b7f8-4f9857b3e3a0"),
+							QueueStatus: common.IBFinished,
 						},
-						JobCreated:  MustParseTime("2020-08-12T09:21:50.07040195-07:00"),
-						JobStarted:  MustParseTime("0001-01-01T00:00:00Z"),
-						JobFinished: MustParseTime("0001-01-01T00:00:00Z"),
-						Size:        2147483648,
-						JobID:       uuid.MustParse("22445cd3-7fa5-4dca-b7f8-4f9857b3e3a0"),
-						QueueStatus: common.IBFinished,
 					},
 				},
 				uuid.MustParse("14c454d0-26f3-4a56-8ceb-a5673aaba686"): {
 					Blueprint: &bp,
-					ImageBuild: ImageBuild{
-						ID:        0,
-						ImageType: &test_distro.TestImageType{},
-						Manifest:  []byte("JSON MANIFEST GOES HERE"),
-						Targets: []*target.Target{
-							{
-								Uuid:      uuid.MustParse("14c454d0-26f3-4a56-8ceb-a5673aaba686"),
-								ImageName: "",
-								Name:      "org.osbuild.local",
-								Created:   MustParseTime("2020-08-12T09:21:44.427717205-07:00"),
-								Status:    common.IBWaiting,
-								Options: target.LocalTargetOptions{
-									ComposeId:    uuid.MustParse("14c454d0-26f3-4a56-8ceb-a5673aaba686"),
-									ImageBuildId: 0,
-									Filename:     "disk.qcow2",
+					ImageBuilds: []ImageBuild{
+						{
+							ID:        0,
+							ImageType: &test_distro.TestImageType{},
+							Manifest:  []byte("JSON MANIFEST GOES HERE"),
+							Targets: []*target.Target{
+								{
+									Uuid:      uuid.MustParse("14c454d0-26f3-4a56-8ceb-a5673aaba686"),
+									ImageName: "",
+									Name:      "org.osbuild.local",
+									Created:   MustParseTime("2020-08-12T09:21:44.427717205-07:00"),
+									Status:    common.IBWaiting,
+									Options: target.LocalTargetOptions{
+										ComposeId:    uuid.MustParse("14c454d0-26f3-4a56-8ceb-a5673aaba686"),
+										ImageBuildId: 0,
+										Filename:     "disk.qcow2",
+									},
 								},
 							},
+							JobCreated:  MustParseTime("2020-08-12T09:21:50.07040195-07:00"),
+							JobStarted:  MustParseTime("0001-01-01T00:00:00Z"),
+							JobFinished: MustParseTime("0001-01-01T00:00:00Z"),
+							Size:        2147483648,
+							JobID:       uuid.MustParse("6ac04049-341a-4297-b50b-5424bec9f193"),
+							QueueStatus: common.IBFinished,
 						},
-						JobCreated:  MustParseTime("2020-08-12T09:21:50.07040195-07:00"),
-						JobStarted:  MustParseTime("0001-01-01T00:00:00Z"),
-						JobFinished: MustParseTime("0001-01-01T00:00:00Z"),
-						Size:        2147483648,
-						JobID:       uuid.MustParse("6ac04049-341a-4297-b50b-5424bec9f193"),
-						QueueStatus: common.IBFinished,
 					},
 				},
 			},
@@ -1238,6 +1253,8 @@ func Test_newComposesV0(t *testing.T) {
 						imageBuildV0{
 							ID:        0,
 							ImageType: "test_type",
+							Distro:    "test-distro",
+							Arch:      "test_arch",
 							Manifest:  []byte("JSON MANIFEST GOES HERE"),
 							Targets: []*target.Target{
 								{
@@ -1268,6 +1285,8 @@ func Test_newComposesV0(t *testing.T) {
 						imageBuildV0{
 							ID:        0,
 							ImageType: "test_type",
+							Distro:    "test-distro",
+							Arch:      "test_arch",
 							Manifest:  []byte("JSON MANIFEST GOES HERE"),
 							Targets: []*target.Target{
 								{
@@ -1393,58 +1412,62 @@ func Test_newComposesFromV0(t *testing.T) {
 			want: map[uuid.UUID]Compose{
 				uuid.MustParse("f53b49c0-d321-447e-8ab8-6e827891e3f0"): {
 					Blueprint: &bp,
-					ImageBuild: ImageBuild{
-						ID:        0,
-						ImageType: &test_distro.TestImageType{},
-						Manifest:  []byte("JSON MANIFEST GOES HERE"),
-						Targets: []*target.Target{
-							{
-								Uuid:      uuid.MustParse("f53b49c0-d321-447e-8ab8-6e827891e3f0"),
-								ImageName: "",
-								Name:      "org.osbuild.local",
-								Created:   MustParseTime("2020-08-12T09:21:44.427717205-07:00"),
-								Status:    common.IBWaiting,
-								Options: target.LocalTargetOptions{
-									ComposeId:    uuid.MustParse("6b512b52-1e9d-4dac-869c-108fd4860a3e"),
-									ImageBuildId: 0,
-									Filename:     "disk.qcow2",
+					ImageBuilds: []ImageBuild{
+						{
+							ID:        0,
+							ImageType: &test_distro.TestImageType{},
+							Manifest:  []byte("JSON MANIFEST GOES HERE"),
+							Targets: []*target.Target{
+								{
+									Uuid:      uuid.MustParse("f53b49c0-d321-447e-8ab8-6e827891e3f0"),
+									ImageName: "",
+									Name:      "org.osbuild.local",
+									Created:   MustParseTime("2020-08-12T09:21:44.427717205-07:00"),
+									Status:    common.IBWaiting,
+									Options: target.LocalTargetOptions{
+										ComposeId:    uuid.MustParse("6b512b52-1e9d-4dac-869c-108fd4860a3e"),
+										ImageBuildId: 0,
+										Filename:     "disk.qcow2",
+									},
 								},
 							},
+							JobCreated:  MustParseTime("2020-08-12T09:21:50.07040195-07:00"),
+							JobStarted:  MustParseTime("0001-01-01T00:00:00Z"),
+							JobFinished: MustParseTime("0001-01-01T00:00:00Z"),
+							Size:        2147483648,
+							JobID:       uuid.MustParse("22445cd3-7fa5-4dca-b7f8-4f9857b3e3a0"),
+							QueueStatus: common.IBFinished,
 						},
-						JobCreated:  MustParseTime("2020-08-12T09:21:50.07040195-07:00"),
-						JobStarted:  MustParseTime("0001-01-01T00:00:00Z"),
-						JobFinished: MustParseTime("0001-01-01T00:00:00Z"),
-						Size:        2147483648,
-						JobID:       uuid.MustParse("22445cd3-7fa5-4dca-b7f8-4f9857b3e3a0"),
-						QueueStatus: common.IBFinished,
 					},
 				},
 				uuid.MustParse("14c454d0-26f3-4a56-8ceb-a5673aaba686"): {
 					Blueprint: &bp,
-					ImageBuild: ImageBuild{
-						ID:        0,
-						ImageType: &test_distro.TestImageType{},
-						Manifest:  []byte("JSON MANIFEST GOES HERE"),
-						Targets: []*target.Target{
-							{
-								Uuid:      uuid.MustParse("14c454d0-26f3-4a56-8ceb-a5673aaba686"),
-								ImageName: "",
-								Name:      "org.osbuild.local",
-								Created:   MustParseTime("2020-08-12T09:21:44.427717205-07:00"),
-								Status:    common.IBWaiting,
-								Options: target.LocalTargetOptions{
-									ComposeId:    uuid.MustParse("14c454d0-26f3-4a56-8ceb-a5673aaba686"),
-									ImageBuildId: 0,
-									Filename:     "disk.qcow2",
+					ImageBuilds: []ImageBuild{
+						{
+							ID:        0,
+							ImageType: &test_distro.TestImageType{},
+							Manifest:  []byte("JSON MANIFEST GOES HERE"),
+							Targets: []*target.Target{
+								{
+									Uuid:      uuid.MustParse("14c454d0-26f3-4a56-8ceb-a5673aaba686"),
+									ImageName: "",
+									Name:      "org.osbuild.local",
+									Created:   MustParseTime("2020-08-12T09:21:44.427717205-07:00"),
+									Status:    common.IBWaiting,
+									Options: target.LocalTargetOptions{
+										ComposeId:    uuid.MustParse("14c454d0-26f3-4a56-8ceb-a5673aaba686"),
+										ImageBuildId: 0,
+										Filename:     "disk.qcow2",
+									},
 								},
 							},
+							JobCreated:  MustParseTime("2020-08-12T09:21:50.07040195-07:00"),
+							JobStarted:  MustParseTime("0001-01-01T00:00:00Z"),
+							JobFinished: MustParseTime("0001-01-01T00:00:00Z"),
+							Size:        2147483648,
+							JobID:       uuid.MustParse("6ac04049-341a-4297-b50b-5424bec9f193"),
+							QueueStatus: common.IBFinished,
 						},
-						JobCreated:  MustParseTime("2020-08-12T09:21:50.07040195-07:00"),
-						JobStarted:  MustParseTime("0001-01-01T00:00:00Z"),
-						JobFinished: MustParseTime("0001-01-01T00:00:00Z"),
-						Size:        2147483648,
-						JobID:       uuid.MustParse("6ac04049-341a-4297-b50b-5424bec9f193"),
-						QueueStatus: common.IBFinished,
 					},
 				},
 			},
@@ -1452,7 +1475,7 @@ func Test_newComposesFromV0(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := newComposesFromV0(tt.composes, tt.arch, nil); !reflect.DeepEqual(got, tt.want) {
+			if got := newComposesFromV0(tt.composes, tt.arch, nil, nil); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("newComposesFromV0() = %#v, want %#v", got, tt.want)
 			}
 		})
@@ -1532,7 +1555,7 @@ func Test_newImageBuildFromV0(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := newImageBuildFromV0(tt.ib, tt.arch)
+			got, err := newImageBuildFromV0(tt.ib, tt.arch, nil)
 			if err != nil {
 				if !tt.errOk {
 					t.Errorf("newImageBuildFromV0() error = %v", err)
@@ -1543,3 +1566,29 @@ func Test_newImageBuildFromV0(t *testing.T) {
 		})
 	}
 }
+
+func Test_newImageBuildFromV0Distro(t *testing.T) {
+	arch, err := test_distro.New().GetArch("test_arch")
+	require.NoError(t, err)
+	distros, err := distro.NewRegistry(test_distro.New(), fedora32.New())
+	require.NoError(t, err)
+
+	ib := imageBuildV0{
+		ImageType: "qcow2",
+		Distro:    "fedora-32",
+		Arch:      "aarch64",
+		Manifest:  []byte("JSON MANIFEST GOES HERE"),
+	}
+	got, err := newImageBuildFromV0(ib, arch, distros)
+	require.NoError(t, err)
+	assert.Equal(t, "qcow2", got.ImageType.Name())
+	assert.Equal(t, "aarch64", got.ImageType.Arch().Name())
+	assert.Equal(t, "fedora-32", got.ImageType.Arch().Distro().Name())
+
+	// image builds of unknown distributions are dropped
+	ib.Distro = "fedora-33"
+	_, err = newImageBuildFromV0(ib, arch, distros)
+	assert.EqualError(t, err, "unknown distribution: fedora-33")
+	_, err = newImageBuildFromV0(ib, arch, nil)
+	assert.EqualError(t, err, "unknown distribution: fedora-33")
+}
@@ -0,0 +1,69 @@
+package store
+
+import (
+	"github.com/osbuild/osbuild-composer/internal/blueprint"
+	"github.com/osbuild/osbuild-composer/internal/rpmmd"
+)
+
+// A Lockfile pins the exact package set of a blueprint commit, so that a
+// compose can be rebuilt later without depsolving again.
+type Lockfile struct {
+	Commit    string              `json:"commit"`
+	Timestamp string              `json:"timestamp"`
+	Blueprint blueprint.Blueprint `json:"blueprint"`
+	Images    []LockedImage       `json:"images"`
+}
+
+// A LockedImage is the depsolved package set for one image type of a
+// blueprint. Package specs carry their checksums. Distro is empty for images
+// which were locked before blueprints could target other distributions than
+// the host's.
+type LockedImage struct {
+	Distro        string              `json:"distro,omitempty"`
+	Arch          string              `json:"arch"`
+	ImageType     string              `json:"image_type"`
+	Packages      []rpmmd.PackageSpec `json:"packages"`
+	BuildPackages []rpmmd.PackageSpec `json:"build_packages"`
+}
+
+// Image returns the locked package set for the given distribution, arch and
+// image type, or nil if there is none
+func (l *Lockfile) Image(distroName, arch, imageType string) *LockedImage {
+	for i := range l.Images {
+		image := &l.Images[i]
+		if image.Distro == distroName && image.Arch == arch && image.ImageType == imageType {
+			return image
+		}
+	}
+	return nil
+}
+
+// SetImage adds the locked package set of an image, replacing the previous
+// one of the same distribution, arch and image type
+func (l *Lockfile) SetImage(image LockedImage) {
+	if old := l.Image(image.Distro, image.Arch, image.ImageType); old != nil {
+		*old = image
+		return
+	}
+	l.Images = append(l.Images, image)
+}
+
+// DeepCopy returns a deep copy of the lockfile
+func (l *Lockfile) DeepCopy() Lockfile {
+	images := make([]LockedImage, len(l.Images))
+	for i, image := range l.Images {
+		images[i] = LockedImage{
+			Distro:        image.Distro,
+			Arch:          image.Arch,
+			ImageType:     image.ImageType,
+			Packages:      append([]rpmmd.PackageSpec{}, image.Packages...),
+			BuildPackages: append([]rpmmd.PackageSpec{}, image.BuildPackages...),
+		}
+	}
+	return Lockfile{
+		Commit:    l.Commit,
+		Timestamp: l.Timestamp,
+		Blueprint: l.Blueprint.DeepCopy(),
+		Images:    images,
+	}
+}
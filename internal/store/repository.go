@@ -0,0 +1,146 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/osbuild/osbuild-composer/internal/blueprint"
+)
+
+// A BlueprintRepository keeps the committed blueprints of a store under
+// version control. When a store has one, the commits of blueprint changes are
+// the ones the repository creates, and tags are created in the repository as
+// well.
+type BlueprintRepository interface {
+	// Commit saves bp in a new commit and returns its id
+	Commit(bp blueprint.Blueprint, message string) (string, error)
+
+	// Delete removes a blueprint in a new commit. Deleting a blueprint the
+	// repository doesn't have is not an error.
+	Delete(name, message string) error
+
+	// Tag tags a commit of a blueprint with its revision
+	Tag(name, commit string, revision int) error
+
+	// Fetch fetches the upstream repository and returns the commit it is
+	// at and the changes since the last merged commit, oldest first. The
+	// commit is empty if there is nothing new.
+	Fetch() (string, []BlueprintRepositoryChange, error)
+
+	// Merge merges an upstream commit returned by Fetch into the
+	// repository, so that it is not returned by Fetch again
+	Merge(upstream string) error
+}
+
+// A BlueprintRepositoryChange is a change to a blueprint which was pulled
+// from the upstream repository of a BlueprintRepository. Deleted changes
+// carry the commit and its message, but no blueprint.
+type BlueprintRepositoryChange struct {
+	Name    string
+	Change  blueprint.Change
+	Deleted bool
+}
+
+// SetBlueprintRepository makes the store commit blueprints to `repo`. It must
+// be called before the store is used.
+func (s *Store) SetBlueprintRepository(repo BlueprintRepository) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.blueprintRepo = repo
+}
+
+// commitBlueprint returns the commit of a new blueprint change. It is a real
+// commit in the blueprint repository if the store has one, or a random hash
+// otherwise.
+func (s *Store) commitBlueprint(bp blueprint.Blueprint, message string) (string, error) {
+	if s.blueprintRepo == nil {
+		return randomSHA1String()
+	}
+
+	commit, err := s.blueprintRepo.Commit(bp, message)
+	if err != nil {
+		return "", fmt.Errorf("cannot commit blueprint %s: %v", bp.Name, err)
+	}
+	return commit, nil
+}
+
+// PullBlueprints pulls blueprint changes from the upstream repository of the
+// store's blueprint repository and applies them to the store. The upstream
+// changes are only merged into the repository once the store is saved, so
+// that they are pulled again if that fails. Changes to blueprints which are
+// not valid are skipped and reported in the returned error after all others
+// have been applied.
+func (s *Store) PullBlueprints() error {
+	s.pullMu.Lock()
+	defer s.pullMu.Unlock()
+
+	s.mu.RLock()
+	repo := s.blueprintRepo
+	s.mu.RUnlock()
+	if repo == nil {
+		return nil
+	}
+
+	// fetching can take long, don't block the store meanwhile
+	upstream, changes, err := repo.Fetch()
+	if err != nil {
+		return fmt.Errorf("cannot pull blueprints: %v", err)
+	}
+	if upstream == "" {
+		return nil
+	}
+
+	var invalid []string
+	err = s.change(func() error {
+		for _, c := range changes {
+			name := c.Name
+			if c.Deleted {
+				s.touch(kindBlueprints, name)
+				s.touch(kindLockfiles, name)
+				delete(s.blueprints, name)
+				delete(s.blueprintsLockfiles, name)
+				continue
+			}
+
+			bp := c.Change.Blueprint
+			if bp.Name != name {
+				invalid = append(invalid, fmt.Sprintf("%s: not a blueprint of that name", name))
+				continue
+			}
+			err := bp.Initialize()
+			if err != nil {
+				invalid = append(invalid, fmt.Sprintf("%s: %v", name, err))
+				continue
+			}
+			c.Change.Blueprint = bp
+
+			s.touch(kindChanges, name)
+			s.touch(kindCommits, name)
+			s.touch(kindBlueprints, name)
+			if s.blueprintsChanges[name] == nil {
+				s.blueprintsChanges[name] = make(map[string]blueprint.Change)
+			}
+			if _, exists := s.blueprintsChanges[name][c.Change.Commit]; !exists {
+				s.blueprintsCommits[name] = append(s.blueprintsCommits[name], c.Change.Commit)
+			}
+			s.blueprintsChanges[name][c.Change.Commit] = c.Change
+			s.blueprints[name] = bp
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = repo.Merge(upstream)
+	if err != nil {
+		return fmt.Errorf("cannot merge pulled blueprints: %v", err)
+	}
+
+	if len(invalid) > 0 {
+		return fmt.Errorf("invalid blueprints were not pulled: %s", strings.Join(invalid, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/osbuild-composer/internal/blueprint"
+	"github.com/osbuild/osbuild-composer/internal/distro/test_distro"
+)
+
+// fakeBlueprintRepository counts commits and records tags and deletions
+type fakeBlueprintRepository struct {
+	commits []string
+	tags    map[string]string
+	deleted []string
+	pull    []BlueprintRepositoryChange
+	merged  []string
+	err     error
+}
+
+func (r *fakeBlueprintRepository) Commit(bp blueprint.Blueprint, message string) (string, error) {
+	if r.err != nil {
+		return "", r.err
+	}
+	commit := fmt.Sprintf("commit-%d", len(r.commits)+1)
+	r.commits = append(r.commits, commit)
+	return commit, nil
+}
+
+func (r *fakeBlueprintRepository) Delete(name, message string) error {
+	r.deleted = append(r.deleted, name)
+	return nil
+}
+
+func (r *fakeBlueprintRepository) Tag(name, commit string, revision int) error {
+	r.tags[fmt.Sprintf("%s/r%d", name, revision)] = commit
+	return nil
+}
+
+// Fetch returns the changes in pull until they are merged
+func (r *fakeBlueprintRepository) Fetch() (string, []BlueprintRepositoryChange, error) {
+	if len(r.pull) == 0 {
+		return "", nil, nil
+	}
+	return r.pull[len(r.pull)-1].Change.Commit, r.pull, nil
+}
+
+func (r *fakeBlueprintRepository) Merge(upstream string) error {
+	r.merged = append(r.merged, upstream)
+	r.pull = nil
+	return nil
+}
+
+func TestBlueprintRepository(t *testing.T) {
+	s := newArchiveTestStore(t)
+	repo := &fakeBlueprintRepository{tags: make(map[string]string)}
+	s.SetBlueprintRepository(repo)
+
+	bp := blueprint.Blueprint{Name: "test", Version: "0.0.1"}
+	require.NoError(t, s.PushBlueprint(bp, "first commit"))
+	require.NoError(t, s.TagBlueprint("test"))
+	require.NoError(t, s.PushBlueprint(bp, "second commit"))
+	require.NoError(t, s.TagBlueprint("test"))
+
+	changes := s.GetBlueprintChanges("test")
+	require.Len(t, changes, 2)
+	require.Equal(t, "commit-1", changes[0].Commit)
+	require.Equal(t, "commit-2", changes[1].Commit)
+	require.Equal(t, 2, *changes[1].Revision)
+	require.Equal(t, map[string]string{"test/r1": "commit-1", "test/r2": "commit-2"}, repo.tags)
+
+	// a failed commit does not change the store
+	repo.err = errors.New("disk full")
+	err := s.PushBlueprint(bp, "third commit")
+	require.EqualError(t, err, "cannot commit blueprint test: disk full")
+	require.Len(t, s.GetBlueprintChanges("test"), 2)
+	repo.err = nil
+
+	require.NoError(t, s.DeleteBlueprint("test"))
+	require.Equal(t, []string{"test"}, repo.deleted)
+}
+
+func TestPullBlueprints(t *testing.T) {
+	s := newArchiveTestStore(t)
+	repo := &fakeBlueprintRepository{tags: make(map[string]string)}
+	s.SetBlueprintRepository(repo)
+	require.NoError(t, s.PushBlueprint(blueprint.Blueprint{Name: "removed"}, "first commit"))
+
+	repo.pull = []BlueprintRepositoryChange{
+		{
+			Name:   "pulled",
+			Change: blueprint.Change{Commit: "upstream-1", Message: "Add pulled", Blueprint: blueprint.Blueprint{Name: "pulled", Version: "0.0.1"}},
+		},
+		{
+			Name:   "pulled",
+			Change: blueprint.Change{Commit: "upstream-2", Message: "Update pulled", Blueprint: blueprint.Blueprint{Name: "pulled", Version: "0.0.2"}},
+		},
+		{
+			Name:   "invalid",
+			Change: blueprint.Change{Commit: "upstream-3", Blueprint: blueprint.Blueprint{Name: "other"}},
+		},
+		{
+			Name:    "removed",
+			Change:  blueprint.Change{Commit: "upstream-4"},
+			Deleted: true,
+		},
+	}
+	err := s.PullBlueprints()
+	require.EqualError(t, err, "invalid blueprints were not pulled: invalid: not a blueprint of that name")
+
+	changes := s.GetBlueprintChanges("pulled")
+	require.Len(t, changes, 2)
+	require.Equal(t, "upstream-1", changes[0].Commit)
+	require.Equal(t, "Update pulled", changes[1].Message)
+	require.Equal(t, "0.0.2", s.GetBlueprintCommitted("pulled").Version)
+	// pulled changes are not committed again
+	require.Len(t, repo.commits, 1)
+
+	require.Nil(t, s.GetBlueprintCommitted("invalid"))
+	require.Nil(t, s.GetBlueprintCommitted("removed"))
+	require.Empty(t, repo.deleted)
+
+	require.Equal(t, []string{"upstream-4"}, repo.merged)
+
+	// nothing new to pull
+	require.NoError(t, s.PullBlueprints())
+	require.Equal(t, []string{"upstream-4"}, repo.merged)
+}
+
+func TestPullBlueprintsBackendError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store-pull-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	arch, err := test_distro.New().GetArch("test_arch")
+	require.NoError(t, err)
+	s, err := NewWithBackend(&failingBackend{NewJSONBackend(dir), ""}, arch, nil, nil)
+	require.NoError(t, err)
+	repo := &fakeBlueprintRepository{tags: make(map[string]string)}
+	s.SetBlueprintRepository(repo)
+
+	repo.pull = []BlueprintRepositoryChange{
+		{
+			Name:   "pulled",
+			Change: blueprint.Change{Commit: "upstream-1", Blueprint: blueprint.Blueprint{Name: "pulled", Version: "0.0.1"}},
+		},
+	}
+	err = s.PullBlueprints()
+	require.Error(t, err)
+
+	// the changes are pulled again next time
+	require.Empty(t, repo.merged)
+	require.Len(t, repo.pull, 1)
+}
+
+func TestPushBlueprintBumpsChangeVersion(t *testing.T) {
+	s := newArchiveTestStore(t)
+	bp := blueprint.Blueprint{Name: "test", Version: "0.0.1"}
+	require.NoError(t, s.PushBlueprint(bp, "first commit"))
+	require.NoError(t, s.PushBlueprint(bp, "second commit"))
+
+	changes := s.GetBlueprintChanges("test")
+	require.Len(t, changes, 2)
+	require.Equal(t, "0.0.2", changes[1].Blueprint.Version)
+}
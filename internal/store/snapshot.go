@@ -0,0 +1,114 @@
+package store
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/osbuild/osbuild-composer/internal/distro"
+	"github.com/osbuild/osbuild-composer/internal/rpmmd"
+)
+
+// A Snapshot records the state of the repositories a compose was built from,
+// so that later composes can be built from the same state.
+type Snapshot struct {
+	// ID is the ID of the compose which recorded the snapshot
+	ID      uuid.UUID `json:"id"`
+	Created time.Time `json:"created"`
+	// Date is set if the repositories were taken from their snapshot
+	// mirrors as of that date (YYYY-MM-DD)
+	Date  string         `json:"date,omitempty"`
+	Repos []RepoSnapshot `json:"repos"`
+}
+
+// A RepoSnapshot is the location of a repository and the checksum of its
+// repomd.xml at the time the snapshot was taken. Distro and Arch are the
+// distribution and architecture the repository was used for; they are empty
+// for snapshots which were taken before composes could target others than
+// the host's.
+//
+// Repositories with a snapshot mirror are pinned to the mirror of the day
+// the snapshot was taken, which is recorded in PinnedDate. Their content
+// cannot change anymore. All other repositories are recorded with their
+// live URLs, so that only their checksum tells whether they changed since.
+type RepoSnapshot struct {
+	Name       string `json:"name"`
+	Distro     string `json:"distro,omitempty"`
+	Arch       string `json:"arch,omitempty"`
+	BaseURL    string `json:"baseurl,omitempty"`
+	Metalink   string `json:"metalink,omitempty"`
+	MirrorList string `json:"mirrorlist,omitempty"`
+	Checksum   string `json:"checksum"`
+	PinnedDate string `json:"pinned_date,omitempty"`
+}
+
+// NewSnapshot returns an empty snapshot for the compose with the given ID.
+// Add the repositories of each distribution and architecture with AddRepos.
+func NewSnapshot(id uuid.UUID, date string) Snapshot {
+	return Snapshot{
+		ID:      id,
+		Created: time.Now(),
+		Date:    date,
+		Repos:   []RepoSnapshot{},
+	}
+}
+
+// AddRepos records the repositories used for a distribution and arch and
+// the checksums of their metadata, keyed by repository name.
+// Repositories with a snapshot mirror are pinned to the mirror of the
+// snapshot's date or, if it has none, of the day it was created.
+func (s *Snapshot) AddRepos(distroName, arch string, repos []rpmmd.RepoConfig, checksums map[string]string) {
+	day := s.Created.UTC()
+	if date, err := time.Parse("2006-01-02", s.Date); err == nil {
+		day = date
+	}
+
+	for _, repo := range repos {
+		pinnedDate := ""
+		if pinned, err := repo.Snapshot(day); err == nil {
+			repo = pinned
+			pinnedDate = day.Format("2006-01-02")
+		}
+		s.Repos = append(s.Repos, RepoSnapshot{
+			Name:       repo.Name,
+			Distro:     distroName,
+			Arch:       arch,
+			BaseURL:    repo.BaseURL,
+			Metalink:   repo.Metalink,
+			MirrorList: repo.MirrorList,
+			Checksum:   checksums[repo.Name],
+			PinnedDate: pinnedDate,
+		})
+	}
+}
+
+// ArchRepos returns the repositories which were recorded for a distribution
+// and arch. Repositories without a distribution or architecture were
+// recorded for those of the host.
+func (s *Snapshot) ArchRepos(distroName, arch string, host distro.Arch) []RepoSnapshot {
+	var repos []RepoSnapshot
+	for _, repo := range s.Repos {
+		repoDistro := repo.Distro
+		if repoDistro == "" {
+			repoDistro = host.Distro().Name()
+		}
+		repoArch := repo.Arch
+		if repoArch == "" {
+			repoArch = host.Name()
+		}
+		if repoDistro == distroName && repoArch == arch {
+			repos = append(repos, repo)
+		}
+	}
+	return repos
+}
+
+// DeepCopy returns a deep copy of the snapshot
+func (s *Snapshot) DeepCopy() Snapshot {
+	return Snapshot{
+		ID:      s.ID,
+		Created: s.Created,
+		Date:    s.Date,
+		Repos:   append([]RepoSnapshot{}, s.Repos...),
+	}
+}
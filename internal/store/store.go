@@ -6,15 +6,17 @@ import (
 	"crypto/rand"
 	"crypto/sha1"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
+	"path"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/osbuild/osbuild-composer/internal/distro"
-	"github.com/osbuild/osbuild-composer/internal/jsondb"
 
 	"github.com/osbuild/osbuild-composer/internal/blueprint"
 	"github.com/osbuild/osbuild-composer/internal/common"
@@ -24,11 +26,13 @@ import (
 	"github.com/google/uuid"
 )
 
-// StoreDBName is the name under which to save the store to the underlying jsondb
+// StoreDBName is the name of the jsondb document the store was saved to
+// before it had backends. It is migrated on start.
 const StoreDBName = "state"
 
-// A Store contains all the persistent state of osbuild-composer, and is serialized
-// on every change, and deserialized on start.
+// A Store contains all the persistent state of osbuild-composer. The parts of
+// it that are touched by a change are written to its backend, and all of it
+// is read on start.
 type Store struct {
 	blueprints        map[string]blueprint.Blueprint
 	workspace         map[string]blueprint.Blueprint
@@ -36,10 +40,28 @@ type Store struct {
 	sources           map[string]SourceConfig
 	blueprintsChanges map[string]map[string]blueprint.Change
 	blueprintsCommits map[string][]string
+	// lockfiles by blueprint name and commit
+	blueprintsLockfiles map[string]map[string]Lockfile
+	snapshots           map[uuid.UUID]Snapshot
+	// keeps the committed blueprints under version control, if set
+	blueprintRepo BlueprintRepository
 
 	mu       sync.RWMutex // protects all fields
+	pullMu   sync.Mutex   // serializes PullBlueprints
 	stateDir *string
-	db       *jsondb.JSONDatabase
+	backend  Backend
+	// documents touched by the current change
+	touched []documentRef
+
+	// needed to read the composes from the backend again
+	arch    distro.Arch
+	distros *distro.Registry
+	log     *log.Logger
+}
+
+type documentRef struct {
+	kind string
+	key  string
 }
 
 type SourceConfig struct {
@@ -49,6 +71,8 @@ type SourceConfig struct {
 	CheckGPG bool   `json:"check_gpg" toml:"check_gpg"`
 	CheckSSL bool   `json:"check_ssl" toml:"check_ssl"`
 	System   bool   `json:"system" toml:"system"`
+	// URL of dated snapshots of the source, see rpmmd.RepoConfig
+	SnapshotURL string `json:"snapshot_url,omitempty" toml:"snapshot_url,omitempty"`
 }
 
 type NotFoundError struct {
@@ -67,24 +91,42 @@ func (e *NoLocalTargetError) Error() string {
 	return e.message
 }
 
-func New(stateDir *string, arch distro.Arch, log *log.Logger) *Store {
-	var storeStruct storeV0
-	var db *jsondb.JSONDatabase
-
-	if stateDir != nil {
-		db = jsondb.New(*stateDir, 0600)
-		_, err := db.Read(StoreDBName, &storeStruct)
-		if err != nil && log != nil {
-			log.Fatalf("cannot read state: %v", err)
-		}
+// New loads the store from stateDir, or returns an empty one if it is nil.
+// Image builds are resolved for the host architecture arch, or, if they were
+// built for another one, through distros. distros may be nil if composes can
+// only be built for the host's distribution.
+func New(stateDir *string, arch distro.Arch, distros *distro.Registry, log *log.Logger) (*Store, error) {
+	if stateDir == nil {
+		return newStoreFromV0(storeV0{}, arch, distros, log), nil
 	}
 
-	store := newStoreFromV0(storeStruct, arch, log)
+	backend := NewJSONBackend(path.Join(*stateDir, "store"))
+	err := migrateStoreV0(*stateDir, backend)
+	if err != nil {
+		return nil, fmt.Errorf("cannot migrate state: %v", err)
+	}
 
+	store, err := NewWithBackend(backend, arch, distros, log)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read state: %v", err)
+	}
 	store.stateDir = stateDir
-	store.db = db
 
-	return store
+	return store, nil
+}
+
+// NewWithBackend loads the store from backend, which all changes are
+// written to
+func NewWithBackend(backend Backend, arch distro.Arch, distros *distro.Registry, log *log.Logger) (*Store, error) {
+	storeStruct, err := readStoreV0(backend)
+	if err != nil {
+		return nil, err
+	}
+
+	store := newStoreFromV0(*storeStruct, arch, distros, log)
+	store.backend = backend
+
+	return store, nil
 }
 
 func randomSHA1String() (string, error) {
@@ -103,20 +145,161 @@ func randomSHA1String() (string, error) {
 	return hex.EncodeToString(hash.Sum(nil)), nil
 }
 
+// change calls f with the store locked for writing and writes the documents
+// it touched to the backend. If they cannot all be written, the change is
+// undone, both in the backend and in the store. The error of f takes
+// precedence over errors of the backend.
 func (s *Store) change(f func() error) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	s.touched = nil
 	result := f()
 
-	if s.stateDir != nil {
-		err := s.db.Write(StoreDBName, s.toStoreV0())
+	var err error
+	if s.backend != nil {
+		err = s.persistTouched()
+	}
+	s.touched = nil
+
+	if result != nil {
+		return result
+	}
+	return err
+}
+
+// persistTouched writes the documents touched by the current change to the
+// backend. If one of them cannot be written, the ones written before it are
+// restored and the store is read from the backend again.
+func (s *Store) persistTouched() error {
+	// the documents as they were in the backend before the change, nil
+	// for the ones which did not exist
+	previous := make(map[documentRef]json.RawMessage)
+	var written []documentRef
+
+	for _, ref := range s.touched {
+		if _, seen := previous[ref]; seen {
+			continue
+		}
+
+		var document json.RawMessage
+		exists, err := s.backend.Read(ref.kind, ref.key, &document)
+		if err == nil {
+			if !exists {
+				document = nil
+			}
+			previous[ref] = document
+			err = s.persist(ref)
+		}
 		if err != nil {
-			panic(err)
+			err = fmt.Errorf("cannot write %s/%s: %v", ref.kind, ref.key, err)
+			undoErr := s.undo(written, previous)
+			if undoErr != nil {
+				return fmt.Errorf("%v (undoing the change failed as well: %v)", err, undoErr)
+			}
+			return err
 		}
+		written = append(written, ref)
 	}
 
-	return result
+	return nil
+}
+
+// undo restores the previous versions of the documents in written and reads
+// the store from the backend again, to drop the change from memory as well
+func (s *Store) undo(written []documentRef, previous map[documentRef]json.RawMessage) error {
+	for _, ref := range written {
+		var err error
+		if document := previous[ref]; document != nil {
+			err = s.backend.Write(ref.kind, ref.key, document)
+		} else {
+			err = s.backend.Delete(ref.kind, ref.key)
+		}
+		if err != nil {
+			return fmt.Errorf("cannot restore %s/%s: %v", ref.kind, ref.key, err)
+		}
+	}
+
+	storeStruct, err := readStoreV0(s.backend)
+	if err != nil {
+		return err
+	}
+	reloaded := newStoreFromV0(*storeStruct, s.arch, s.distros, s.log)
+	s.blueprints = reloaded.blueprints
+	s.workspace = reloaded.workspace
+	s.composes = reloaded.composes
+	s.sources = reloaded.sources
+	s.blueprintsChanges = reloaded.blueprintsChanges
+	s.blueprintsCommits = reloaded.blueprintsCommits
+	s.blueprintsLockfiles = reloaded.blueprintsLockfiles
+	s.snapshots = reloaded.snapshots
+
+	return nil
+}
+
+// touch marks a document as changed. It must only be called from the
+// function passed to change().
+func (s *Store) touch(kind, key string) {
+	s.touched = append(s.touched, documentRef{kind, key})
+}
+
+// persist writes a document to the backend, or deletes it if it does not
+// exist anymore
+func (s *Store) persist(ref documentRef) error {
+	document, exists := s.document(ref.kind, ref.key)
+	if !exists {
+		return s.backend.Delete(ref.kind, ref.key)
+	}
+	return s.backend.Write(ref.kind, ref.key, document)
+}
+
+// document returns the current state of a document, in the format of the
+// corresponding section of storeV0
+func (s *Store) document(kind, key string) (interface{}, bool) {
+	switch kind {
+	case kindBlueprints:
+		bp, exists := s.blueprints[key]
+		return bp, exists
+	case kindWorkspace:
+		bp, exists := s.workspace[key]
+		return bp, exists
+	case kindComposes:
+		id, err := uuid.Parse(key)
+		if err != nil {
+			return nil, false
+		}
+		compose, exists := s.composes[id]
+		if !exists {
+			return nil, false
+		}
+		return newComposeV0(compose), true
+	case kindSources:
+		source, exists := s.sources[key]
+		return sourceV0(source), exists
+	case kindChanges:
+		changes, exists := s.blueprintsChanges[key]
+		if !exists {
+			return nil, false
+		}
+		return newChangesV0(map[string]map[string]blueprint.Change{key: changes})[key], true
+	case kindCommits:
+		commits, exists := s.blueprintsCommits[key]
+		return commits, exists
+	case kindLockfiles:
+		lockfiles, exists := s.blueprintsLockfiles[key]
+		if !exists {
+			return nil, false
+		}
+		return newLockfilesV0(map[string]map[string]Lockfile{key: lockfiles})[key], true
+	case kindSnapshots:
+		id, err := uuid.Parse(key)
+		if err != nil {
+			return nil, false
+		}
+		snapshot, exists := s.snapshots[id]
+		return snapshot, exists
+	}
+	panic("unknown kind of document: " + kind)
 }
 
 func (s *Store) ListBlueprints() []string {
@@ -132,6 +315,8 @@ func (s *Store) ListBlueprints() []string {
 	return names
 }
 
+// GetBlueprint returns the workspace version of a blueprint, or the
+// committed one if it isn't in the workspace. Its includes are not resolved.
 func (s *Store) GetBlueprint(name string) (*blueprint.Blueprint, bool) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -148,6 +333,8 @@ func (s *Store) GetBlueprint(name string) (*blueprint.Blueprint, bool) {
 	return &bp, inWorkspace
 }
 
+// GetBlueprintCommitted returns the committed version of a blueprint. Its
+// includes are not resolved.
 func (s *Store) GetBlueprintCommitted(name string) *blueprint.Blueprint {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -192,13 +379,24 @@ func (s *Store) GetBlueprintChanges(name string) []blueprint.Change {
 
 func (s *Store) PushBlueprint(bp blueprint.Blueprint, commitMsg string) error {
 	return s.change(func() error {
-		commit, err := randomSHA1String()
+		// Make sure the blueprint has default values and that the version is valid
+		err := bp.Initialize()
 		if err != nil {
 			return err
 		}
 
-		// Make sure the blueprint has default values and that the version is valid
-		err = bp.Initialize()
+		_, err = s.resolveBlueprint(bp)
+		if err != nil {
+			return err
+		}
+
+		if old, ok := s.blueprints[bp.Name]; ok {
+			if bp.Version == "" || bp.Version == old.Version {
+				bp.BumpVersion(old.Version)
+			}
+		}
+
+		commit, err := s.commitBlueprint(bp, commitMsg)
 		if err != nil {
 			return err
 		}
@@ -211,6 +409,11 @@ func (s *Store) PushBlueprint(bp blueprint.Blueprint, commitMsg string) error {
 			Blueprint: bp,
 		}
 
+		s.touch(kindWorkspace, bp.Name)
+		s.touch(kindChanges, bp.Name)
+		s.touch(kindCommits, bp.Name)
+		s.touch(kindBlueprints, bp.Name)
+
 		delete(s.workspace, bp.Name)
 		if s.blueprintsChanges[bp.Name] == nil {
 			s.blueprintsChanges[bp.Name] = make(map[string]blueprint.Change)
@@ -218,12 +421,6 @@ func (s *Store) PushBlueprint(bp blueprint.Blueprint, commitMsg string) error {
 		s.blueprintsChanges[bp.Name][commit] = change
 		// Keep track of the order of the commits
 		s.blueprintsCommits[bp.Name] = append(s.blueprintsCommits[bp.Name], commit)
-
-		if old, ok := s.blueprints[bp.Name]; ok {
-			if bp.Version == "" || bp.Version == old.Version {
-				bp.BumpVersion(old.Version)
-			}
-		}
 		s.blueprints[bp.Name] = bp
 		return nil
 	})
@@ -237,6 +434,12 @@ func (s *Store) PushBlueprintToWorkspace(bp blueprint.Blueprint) error {
 			return err
 		}
 
+		_, err = s.resolveBlueprint(bp)
+		if err != nil {
+			return err
+		}
+
+		s.touch(kindWorkspace, bp.Name)
 		s.workspace[bp.Name] = bp
 		return nil
 	})
@@ -247,11 +450,24 @@ func (s *Store) PushBlueprintToWorkspace(bp blueprint.Blueprint) error {
 // The workspace copy is deleted unconditionally, it will not return an error if it does not exist.
 func (s *Store) DeleteBlueprint(name string) error {
 	return s.change(func() error {
+		if dependants := s.getBlueprintDependants(name); len(dependants) > 0 {
+			return fmt.Errorf("Blueprint %s is included by: %s", name, strings.Join(dependants, ", "))
+		}
+		s.touch(kindWorkspace, name)
 		delete(s.workspace, name)
 		if _, ok := s.blueprints[name]; !ok {
 			return fmt.Errorf("Unknown blueprint: %s", name)
 		}
+		if s.blueprintRepo != nil {
+			err := s.blueprintRepo.Delete(name, "Recipe "+name+" deleted.")
+			if err != nil {
+				return fmt.Errorf("cannot delete blueprint %s: %v", name, err)
+			}
+		}
+		s.touch(kindBlueprints, name)
+		s.touch(kindLockfiles, name)
 		delete(s.blueprints, name)
+		delete(s.blueprintsLockfiles, name)
 		return nil
 	})
 }
@@ -263,6 +479,7 @@ func (s *Store) DeleteBlueprintFromWorkspace(name string) error {
 		if _, ok := s.workspace[name]; !ok {
 			return fmt.Errorf("Unknown blueprint: %s", name)
 		}
+		s.touch(kindWorkspace, name)
 		delete(s.workspace, name)
 		return nil
 	})
@@ -301,12 +518,135 @@ func (s *Store) TagBlueprint(name string) error {
 
 		// Bump the revision (if there was none it will start at 1)
 		revision++
+		if s.blueprintRepo != nil {
+			err := s.blueprintRepo.Tag(name, latest, revision)
+			if err != nil {
+				return fmt.Errorf("cannot tag blueprint %s: %v", name, err)
+			}
+		}
+		change = s.blueprintsChanges[name][latest]
 		change.Revision = &revision
+		s.touch(kindChanges, name)
 		s.blueprintsChanges[name][latest] = change
 		return nil
 	})
 }
 
+// LockBlueprint stores the package set of an image built from the most
+// recent commit of a blueprint in the lockfile of that commit. The package
+// sets of other images in the lockfile are kept.
+func (s *Store) LockBlueprint(name string, image LockedImage) (*Lockfile, error) {
+	var lockfile Lockfile
+	err := s.change(func() error {
+		bp, ok := s.blueprints[name]
+		if !ok {
+			return &NotFoundError{"Unknown blueprint"}
+		}
+		commits := s.blueprintsCommits[name]
+		if len(commits) == 0 {
+			return errors.New("No commits for blueprint")
+		}
+		commit := commits[len(commits)-1]
+
+		s.touch(kindLockfiles, name)
+		if s.blueprintsLockfiles[name] == nil {
+			s.blueprintsLockfiles[name] = make(map[string]Lockfile)
+		}
+		lockfile = s.blueprintsLockfiles[name][commit]
+		lockfile.Commit = commit
+		lockfile.Timestamp = time.Now().Format("2006-01-02T15:04:05Z")
+		bp = s.flattenBlueprint(bp)
+		lockfile.Blueprint = bp.DeepCopy()
+		lockfile.SetImage(image)
+		s.blueprintsLockfiles[name][commit] = lockfile
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	lockfile = lockfile.DeepCopy()
+	return &lockfile, nil
+}
+
+// GetBlueprintLockfile returns the lockfile of a blueprint commit. If commit
+// is empty, the lockfile of the most recent locked commit is returned. It
+// returns nil if there is no such lockfile.
+func (s *Store) GetBlueprintLockfile(name string, commit string) *Lockfile {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	lockfiles := s.blueprintsLockfiles[name]
+	if commit == "" {
+		commits := s.blueprintsCommits[name]
+		for i := len(commits) - 1; i >= 0; i-- {
+			if _, ok := lockfiles[commits[i]]; ok {
+				commit = commits[i]
+				break
+			}
+		}
+	}
+
+	lockfile, ok := lockfiles[commit]
+	if !ok {
+		return nil
+	}
+	lockfile = lockfile.DeepCopy()
+	return &lockfile
+}
+
+// PushSnapshot stores the repository snapshot of a compose
+func (s *Store) PushSnapshot(snapshot Snapshot) error {
+	return s.change(func() error {
+		s.touch(kindSnapshots, snapshot.ID.String())
+		s.snapshots[snapshot.ID] = snapshot.DeepCopy()
+		return nil
+	})
+}
+
+// DeleteSnapshot deletes the repository snapshot recorded by a compose
+func (s *Store) DeleteSnapshot(id uuid.UUID) error {
+	return s.change(func() error {
+		if _, exists := s.snapshots[id]; !exists {
+			return &NotFoundError{}
+		}
+		s.touch(kindSnapshots, id.String())
+		delete(s.snapshots, id)
+		return nil
+	})
+}
+
+// GetSnapshot returns the repository snapshot recorded by a compose
+func (s *Store) GetSnapshot(id uuid.UUID) (*Snapshot, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	snapshot, exists := s.snapshots[id]
+	if !exists {
+		return nil, false
+	}
+	snapshot = snapshot.DeepCopy()
+	return &snapshot, true
+}
+
+// ListSnapshots returns all repository snapshots, oldest first
+func (s *Store) ListSnapshots() []Snapshot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	snapshots := make([]Snapshot, 0, len(s.snapshots))
+	for _, snapshot := range s.snapshots {
+		snapshots = append(snapshots, snapshot.DeepCopy())
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		if snapshots[i].Created.Equal(snapshots[j].Created) {
+			return snapshots[i].ID.String() < snapshots[j].ID.String()
+		}
+		return snapshots[i].Created.Before(snapshots[j].Created)
+	})
+	return snapshots
+}
+
 func (s *Store) GetCompose(id uuid.UUID) (Compose, bool) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -331,41 +671,43 @@ func (s *Store) GetAllComposes() map[uuid.UUID]Compose {
 	return composes
 }
 
-func (s *Store) PushCompose(composeID uuid.UUID, manifest distro.Manifest, imageType distro.ImageType, bp *blueprint.Blueprint, size uint64, targets []*target.Target, jobId uuid.UUID) error {
+// PushCompose stores a compose of one or more image builds of the same
+// blueprint, and the values of the blueprint's variables, which are nil for
+// blueprints without variables. The image builds are numbered in the given
+// order.
+func (s *Store) PushCompose(composeID uuid.UUID, bp *blueprint.Blueprint, variables map[string]string, imageBuilds []ImageBuild) error {
 	if _, exists := s.GetCompose(composeID); exists {
 		panic("a compose with this id already exists")
 	}
 
-	if targets == nil {
-		targets = []*target.Target{}
+	now := time.Now()
+	builds := make([]ImageBuild, len(imageBuilds))
+	for i, ib := range imageBuilds {
+		builds[i] = ib.DeepCopy()
+		builds[i].ID = i
+		if builds[i].Targets == nil {
+			builds[i].Targets = []*target.Target{}
+		}
+		if builds[i].JobCreated.IsZero() {
+			builds[i].JobCreated = now
+		}
 	}
 
-	// FIXME: handle or comment this possible error
-	_ = s.change(func() error {
+	return s.change(func() error {
+		s.touch(kindComposes, composeID.String())
 		s.composes[composeID] = Compose{
-			Blueprint: bp,
-			ImageBuild: ImageBuild{
-				Manifest:   manifest,
-				ImageType:  imageType,
-				Targets:    targets,
-				JobCreated: time.Now(),
-				Size:       size,
-				JobID:      jobId,
-			},
+			Blueprint:   bp,
+			ImageBuilds: builds,
+			Variables:   variables,
 		}
 		return nil
 	})
-	return nil
 }
 
 // PushTestCompose is used for testing
 // Set testSuccess to create a fake successful compose, otherwise it will create a failed compose
 // It does not actually run a compose job
 func (s *Store) PushTestCompose(composeID uuid.UUID, manifest distro.Manifest, imageType distro.ImageType, bp *blueprint.Blueprint, size uint64, targets []*target.Target, testSuccess bool) error {
-	if targets == nil {
-		targets = []*target.Target{}
-	}
-
 	var status common.ImageBuildState
 	if testSuccess {
 		status = common.IBFinished
@@ -373,24 +715,16 @@ func (s *Store) PushTestCompose(composeID uuid.UUID, manifest distro.Manifest, i
 		status = common.IBFailed
 	}
 
-	// FIXME: handle or comment this possible error
-	_ = s.change(func() error {
-		s.composes[composeID] = Compose{
-			Blueprint: bp,
-			ImageBuild: ImageBuild{
-				QueueStatus: status,
-				Manifest:    manifest,
-				ImageType:   imageType,
-				Targets:     targets,
-				JobCreated:  time.Now(),
-				JobStarted:  time.Now(),
-				Size:        size,
-			},
-		}
-		return nil
+	return s.PushCompose(composeID, bp, nil, []ImageBuild{
+		{
+			QueueStatus: status,
+			Manifest:    manifest,
+			ImageType:   imageType,
+			Targets:     targets,
+			JobStarted:  time.Now(),
+			Size:        size,
+		},
 	})
-
-	return nil
 }
 
 // DeleteCompose deletes the compose from the state file and also removes all files on disk that are
@@ -401,6 +735,7 @@ func (s *Store) DeleteCompose(id uuid.UUID) error {
 			return &NotFoundError{}
 		}
 
+		s.touch(kindComposes, id.String())
 		delete(s.composes, id)
 
 		return nil
@@ -408,20 +743,20 @@ func (s *Store) DeleteCompose(id uuid.UUID) error {
 }
 
 // PushSource stores a SourceConfig in store.Sources
-func (s *Store) PushSource(key string, source SourceConfig) {
-	// FIXME: handle or comment this possible error
-	_ = s.change(func() error {
+func (s *Store) PushSource(key string, source SourceConfig) error {
+	return s.change(func() error {
+		s.touch(kindSources, key)
 		s.sources[key] = source
 		return nil
 	})
 }
 
 // DeleteSourceByName removes a SourceConfig from store.Sources using the .Name field
-func (s *Store) DeleteSourceByName(name string) {
-	// FIXME: handle or comment this possible error
-	_ = s.change(func() error {
+func (s *Store) DeleteSourceByName(name string) error {
+	return s.change(func() error {
 		for key := range s.sources {
 			if s.sources[key].Name == name {
+				s.touch(kindSources, key)
 				delete(s.sources, key)
 				return nil
 			}
@@ -431,9 +766,9 @@ func (s *Store) DeleteSourceByName(name string) {
 }
 
 // DeleteSourceByID removes a SourceConfig from store.Sources using the ID
-func (s *Store) DeleteSourceByID(key string) {
-	// FIXME: handle or comment this possible error
-	_ = s.change(func() error {
+func (s *Store) DeleteSourceByID(key string) error {
+	return s.change(func() error {
+		s.touch(kindSources, key)
 		delete(s.sources, key)
 		return nil
 	})
@@ -512,6 +847,8 @@ func NewSourceConfig(repo rpmmd.RepoConfig, system bool) SourceConfig {
 		CheckGPG: repo.CheckGPG,
 		CheckSSL: !repo.IgnoreSSL,
 		System:   system,
+
+		SnapshotURL: repo.SnapshotURL,
 	}
 
 	if repo.BaseURL != "" {
@@ -534,6 +871,7 @@ func (s *SourceConfig) RepoConfig(name string) rpmmd.RepoConfig {
 	repo.Name = name
 	repo.IgnoreSSL = !s.CheckSSL
 	repo.CheckGPG = s.CheckGPG
+	repo.SnapshotURL = s.SnapshotURL
 
 	if s.Type == "yum-baseurl" {
 		repo.BaseURL = s.URL
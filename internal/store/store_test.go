@@ -56,8 +56,8 @@ func (suite *storeTest) SetupSuite() {
 		Name: "testSourceConfig",
 	}
 	suite.myCompose = Compose{
-		Blueprint:  &suite.myBP,
-		ImageBuild: suite.myImageBuild,
+		Blueprint:   &suite.myBP,
+		ImageBuilds: []ImageBuild{suite.myImageBuild},
 	}
 	suite.myImageBuild = ImageBuild{
 		ID: 123,
@@ -102,7 +102,8 @@ func (suite *storeTest) SetupTest() {
 	arch, err := distro.GetArch("test_arch")
 	suite.NoError(err)
 	suite.dir = tmpDir
-	suite.myStore = New(&suite.dir, arch, nil)
+	suite.myStore, err = New(&suite.dir, arch, nil, nil)
+	suite.NoError(err)
 }
 
 //teardown after each test
@@ -226,6 +227,130 @@ func (suite *storeTest) TestTagBlueprint() {
 	suite.EqualError(suite.myStore.TagBlueprint("testBP"), "No commits for blueprint")
 }
 
+func (suite *storeTest) TestLockBlueprint() {
+	image := LockedImage{
+		Distro:        "test-distro",
+		Arch:          "test_arch",
+		ImageType:     "test_type",
+		Packages:      []rpmmd.PackageSpec{{Name: "test1", Version: "1.0", Release: "1", Arch: "noarch", Checksum: "sha256:abc"}},
+		BuildPackages: []rpmmd.PackageSpec{{Name: "dnf", Version: "4.2", Release: "1", Arch: "noarch", Checksum: "sha256:def"}},
+	}
+
+	//Try to lock a non existing BP
+	_, err := suite.myStore.LockBlueprint("testBP", image)
+	suite.EqualError(err, "Unknown blueprint")
+
+	suite.NoError(suite.myStore.PushBlueprint(suite.myBP, "testing commit"))
+	commit := suite.myStore.blueprintsCommits["testBP"][0]
+	lockfile, err := suite.myStore.LockBlueprint("testBP", image)
+	suite.NoError(err)
+	suite.Equal(commit, lockfile.Commit)
+	suite.Equal([]LockedImage{image}, lockfile.Images)
+	suite.Equal(lockfile, suite.myStore.GetBlueprintLockfile("testBP", commit))
+
+	//Locking the same image type again replaces the package set
+	image.Packages[0].Version = "1.1"
+	lockfile, err = suite.myStore.LockBlueprint("testBP", image)
+	suite.NoError(err)
+	suite.Equal([]LockedImage{image}, lockfile.Images)
+
+	//Other distributions are locked separately
+	other := image
+	other.Distro = "fedora-33"
+	lockfile, err = suite.myStore.LockBlueprint("testBP", other)
+	suite.NoError(err)
+	suite.Equal([]LockedImage{image, other}, lockfile.Images)
+	suite.Equal(&other, lockfile.Image("fedora-33", "test_arch", "test_type"))
+	suite.Nil(lockfile.Image("", "test_arch", "test_type"))
+
+	//New commits are not locked, but the last locked commit is still found
+	suite.NoError(suite.myStore.PushBlueprint(suite.myBP, "second commit"))
+	suite.Nil(suite.myStore.GetBlueprintLockfile("testBP", suite.myStore.blueprintsCommits["testBP"][1]))
+	suite.Equal(commit, suite.myStore.GetBlueprintLockfile("testBP", "").Commit)
+
+	//Lockfiles are persisted
+	distro := test_distro.New()
+	arch, err := distro.GetArch("test_arch")
+	suite.NoError(err)
+	reloaded, err := New(&suite.dir, arch, nil, nil)
+	suite.NoError(err)
+	suite.Equal(lockfile, reloaded.GetBlueprintLockfile("testBP", commit))
+
+	//Lockfiles are removed together with the blueprint
+	suite.NoError(suite.myStore.DeleteBlueprint("testBP"))
+	suite.Nil(suite.myStore.GetBlueprintLockfile("testBP", ""))
+}
+
+func (suite *storeTest) TestPushSnapshot() {
+	repos := []rpmmd.RepoConfig{
+		{Name: "base", BaseURL: "https://example.com/base"},
+		{Name: "updates", Metalink: "https://example.com/metalink"},
+	}
+	checksums := map[string]string{"base": "sha256:abc", "updates": "sha256:def"}
+	first := NewSnapshot(uuid.New(), "")
+	first.AddRepos("test-distro", "test_arch", repos, checksums)
+	second := NewSnapshot(uuid.New(), "2020-10-01")
+	second.AddRepos("test-distro", "test_arch", repos[:1], checksums)
+	second.AddRepos("fedora-33", "aarch64", repos[:1], checksums)
+	second.Created = first.Created.Add(time.Second)
+
+	suite.NoError(suite.myStore.PushSnapshot(second))
+	suite.NoError(suite.myStore.PushSnapshot(first))
+	suite.Equal([]RepoSnapshot{
+		{Name: "base", Distro: "test-distro", Arch: "test_arch", BaseURL: "https://example.com/base", Checksum: "sha256:abc"},
+		{Name: "updates", Distro: "test-distro", Arch: "test_arch", Metalink: "https://example.com/metalink", Checksum: "sha256:def"},
+	}, first.Repos)
+	suite.Equal([]RepoSnapshot{
+		{Name: "base", Distro: "fedora-33", Arch: "aarch64", BaseURL: "https://example.com/base", Checksum: "sha256:abc"},
+	}, second.ArchRepos("fedora-33", "aarch64", suite.myArch))
+	suite.Empty(second.ArchRepos("fedora-33", "s390x", suite.myArch))
+
+	//Repositories recorded without distro and arch belong to the host
+	legacy := Snapshot{Repos: []RepoSnapshot{{Name: "base", Checksum: "sha256:abc"}}}
+	suite.Len(legacy.ArchRepos("test-distro", "test_arch", suite.myArch), 1)
+	suite.Empty(legacy.ArchRepos("fedora-33", "test_arch", suite.myArch))
+
+	snapshot, exists := suite.myStore.GetSnapshot(second.ID)
+	suite.True(exists)
+	suite.Equal(&second, snapshot)
+	_, exists = suite.myStore.GetSnapshot(uuid.New())
+	suite.False(exists)
+
+	snapshots := suite.myStore.ListSnapshots()
+	suite.Len(snapshots, 2)
+	suite.Equal(first.ID, snapshots[0].ID)
+	suite.Equal(second.ID, snapshots[1].ID)
+
+	suite.NoError(suite.myStore.DeleteSnapshot(first.ID))
+	_, exists = suite.myStore.GetSnapshot(first.ID)
+	suite.False(exists)
+	suite.Error(suite.myStore.DeleteSnapshot(first.ID))
+}
+
+func (suite *storeTest) TestPushSnapshotPinned() {
+	repos := []rpmmd.RepoConfig{
+		{Name: "base", BaseURL: "https://example.com/base", SnapshotURL: "https://snapshots.example.com/{date}/base/"},
+		{Name: "updates", Metalink: "https://example.com/metalink"},
+	}
+	checksums := map[string]string{"base": "sha256:abc", "updates": "sha256:def"}
+
+	// repositories with a snapshot mirror are pinned to the day the
+	// snapshot was taken, unless it was taken as of another date
+	snapshot := NewSnapshot(uuid.New(), "")
+	snapshot.Created = time.Date(2020, 11, 2, 23, 0, 0, 0, time.UTC)
+	snapshot.AddRepos("test-distro", "test_arch", repos, checksums)
+	dated := NewSnapshot(uuid.New(), "2020-10-01")
+	dated.AddRepos("test-distro", "test_arch", repos[:1], checksums)
+
+	suite.Equal([]RepoSnapshot{
+		{Name: "base", Distro: "test-distro", Arch: "test_arch", BaseURL: "https://snapshots.example.com/2020-11-02/base/", Checksum: "sha256:abc", PinnedDate: "2020-11-02"},
+		{Name: "updates", Distro: "test-distro", Arch: "test_arch", Metalink: "https://example.com/metalink", Checksum: "sha256:def"},
+	}, snapshot.Repos)
+	suite.Equal([]RepoSnapshot{
+		{Name: "base", Distro: "test-distro", Arch: "test_arch", BaseURL: "https://snapshots.example.com/2020-10-01/base/", Checksum: "sha256:abc", PinnedDate: "2020-10-01"},
+	}, dated.Repos)
+}
+
 func (suite *storeTest) TestDeleteBlueprint() {
 	suite.myStore.blueprints["testBP"] = suite.myBP
 	suite.NoError(suite.myStore.DeleteBlueprint("testBP"))
@@ -244,24 +369,49 @@ func (suite *storeTest) TestDeleteBlueprintFromWorkspace() {
 
 func (suite *storeTest) TestPushCompose() {
 	testID := uuid.New()
-	err := suite.myStore.PushCompose(testID, suite.myManifest, suite.myImageType, &suite.myBP, 123, nil, uuid.New())
+	err := suite.myStore.PushCompose(testID, &suite.myBP, nil, []ImageBuild{
+		{ImageType: suite.myImageType, Manifest: suite.myManifest, Size: 123, JobID: uuid.New()},
+	})
 	suite.NoError(err)
 	suite.Panics(func() {
-		err = suite.myStore.PushCompose(testID, suite.myManifest, suite.myImageType, &suite.myBP, 123, []*target.Target{suite.myTarget}, uuid.New())
+		err = suite.myStore.PushCompose(testID, &suite.myBP, nil, []ImageBuild{
+			{ImageType: suite.myImageType, Manifest: suite.myManifest, Size: 123, Targets: []*target.Target{suite.myTarget}, JobID: uuid.New()},
+		})
 	})
 	suite.NoError(err)
 	testID = uuid.New()
 }
 
+func (suite *storeTest) TestPushComposeImageBuilds() {
+	testID := uuid.New()
+	variables := map[string]string{"hostname": "web-1"}
+	err := suite.myStore.PushCompose(testID, &suite.myBP, variables, []ImageBuild{
+		{ImageType: suite.myImageType, Manifest: suite.myManifest, JobID: uuid.New()},
+		{ImageType: suite.myImageType, Manifest: suite.myManifest, JobID: uuid.New()},
+	})
+	suite.NoError(err)
+	compose, exists := suite.myStore.GetCompose(testID)
+	suite.True(exists)
+	suite.Equal(variables, compose.Variables)
+	suite.Len(compose.ImageBuilds, 2)
+	for i, ib := range compose.ImageBuilds {
+		suite.Equal(i, ib.ID)
+		suite.NotNil(ib.Targets)
+		suite.False(ib.JobCreated.IsZero())
+	}
+	suite.Equal(&compose.ImageBuilds[1], compose.ImageBuild(1))
+	suite.Nil(compose.ImageBuild(2))
+}
+
 func (suite *storeTest) TestPushTestCompose() {
 	ID := uuid.New()
 	err := suite.myStore.PushTestCompose(ID, suite.myManifest, suite.myImageType, &suite.myBP, 123, nil, true)
 	suite.NoError(err)
-	suite.Equal(common.ImageBuildState(2), suite.myStore.composes[ID].ImageBuild.QueueStatus)
+	suite.Equal(common.ImageBuildState(2), suite.myStore.composes[ID].ImageBuilds[0].QueueStatus)
 	ID = uuid.New()
 	err = suite.myStore.PushTestCompose(ID, suite.myManifest, suite.myImageType, &suite.myBP, 123, []*target.Target{suite.myTarget}, false)
 	suite.NoError(err)
-	suite.Equal(common.ImageBuildState(3), suite.myStore.composes[ID].ImageBuild.QueueStatus)
+	suite.Equal(common.ImageBuildState(3), suite.myStore.composes[ID].ImageBuilds[0].QueueStatus)
 
 }
 
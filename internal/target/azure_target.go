@@ -5,6 +5,18 @@ type AzureTargetOptions struct {
 	StorageAccount   string `json:"storageAccount"`
 	StorageAccessKey string `json:"storageAccessKey"`
 	Container        string `json:"container"`
+
+	// A managed image is created from the uploaded VHD if ResourceGroup
+	// is set. It is published to a Shared Image Gallery if Gallery is set.
+	TenantID            string `json:"tenantID,omitempty"`
+	ClientID            string `json:"clientID,omitempty"`
+	ClientSecret        string `json:"clientSecret,omitempty"`
+	SubscriptionID      string `json:"subscriptionID,omitempty"`
+	ResourceGroup       string `json:"resourceGroup,omitempty"`
+	Location            string `json:"location,omitempty"`
+	Gallery             string `json:"gallery,omitempty"`
+	GalleryImage        string `json:"galleryImage,omitempty"`
+	GalleryImageVersion string `json:"galleryImageVersion,omitempty"`
 }
 
 func (AzureTargetOptions) isTargetOptions() {}
@@ -0,0 +1,12 @@
+package target
+
+type AzureTargetResultOptions struct {
+	ImageID               string `json:"image_id"`
+	GalleryImageVersionID string `json:"gallery_image_version_id,omitempty"`
+}
+
+func (AzureTargetResultOptions) isTargetResultOptions() {}
+
+func NewAzureTargetResult(options *AzureTargetResultOptions) *TargetResult {
+	return newTargetResult("org.osbuild.azure", options)
+}
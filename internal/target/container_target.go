@@ -0,0 +1,17 @@
+package target
+
+type ContainerTargetOptions struct {
+	Filename   string   `json:"filename"`
+	URL        string   `json:"url"`
+	Repository string   `json:"repository"`
+	Tags       []string `json:"tags,omitempty"`
+	Username   string   `json:"username,omitempty"`
+	Password   string   `json:"password,omitempty"`
+	TLSVerify  *bool    `json:"tls_verify,omitempty"`
+}
+
+func (ContainerTargetOptions) isTargetOptions() {}
+
+func NewContainerTarget(options *ContainerTargetOptions) *Target {
+	return newTarget("org.osbuild.container", options)
+}
@@ -0,0 +1,11 @@
+package target
+
+type ContainerTargetResultOptions struct {
+	Digest string `json:"digest"`
+}
+
+func (ContainerTargetResultOptions) isTargetResultOptions() {}
+
+func NewContainerTargetResult(options *ContainerTargetResultOptions) *TargetResult {
+	return newTargetResult("org.osbuild.container", options)
+}
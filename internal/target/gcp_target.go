@@ -0,0 +1,16 @@
+package target
+
+type GCPTargetOptions struct {
+	Filename    string `json:"filename"`
+	Region      string `json:"region,omitempty"`
+	Project     string `json:"project,omitempty"`
+	Bucket      string `json:"bucket"`
+	Object      string `json:"object"`
+	Credentials []byte `json:"credentials,omitempty"`
+}
+
+func (GCPTargetOptions) isTargetOptions() {}
+
+func NewGCPTarget(options *GCPTargetOptions) *Target {
+	return newTarget("org.osbuild.gcp", options)
+}
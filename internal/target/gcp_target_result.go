@@ -0,0 +1,12 @@
+package target
+
+type GCPTargetResultOptions struct {
+	ImageName string `json:"image_name"`
+	ProjectID string `json:"project_id"`
+}
+
+func (GCPTargetResultOptions) isTargetResultOptions() {}
+
+func NewGCPTargetResult(options *GCPTargetResultOptions) *TargetResult {
+	return newTargetResult("org.osbuild.gcp", options)
+}
@@ -0,0 +1,38 @@
+package target
+
+import (
+	"fmt"
+	"path"
+)
+
+type OpenStackTargetOptions struct {
+	Filename    string            `json:"filename"`
+	DiskFormat  string            `json:"disk_format"`
+	AuthURL     string            `json:"auth_url"`
+	Username    string            `json:"username"`
+	Password    string            `json:"password"`
+	DomainName  string            `json:"domain_name,omitempty"`
+	ProjectName string            `json:"project_name,omitempty"`
+	ProjectID   string            `json:"project_id,omitempty"`
+	Region      string            `json:"region,omitempty"`
+	Visibility  string            `json:"visibility,omitempty"`
+	Properties  map[string]string `json:"properties,omitempty"`
+}
+
+func (OpenStackTargetOptions) isTargetOptions() {}
+
+func NewOpenStackTarget(options *OpenStackTargetOptions) *Target {
+	return newTarget("org.osbuild.openstack", options)
+}
+
+// OpenStackDiskFormat returns the disk format the image service knows the
+// image file `filename` by. It returns an error for files which are not disk
+// images.
+func OpenStackDiskFormat(filename string) (string, error) {
+	switch ext := path.Ext(filename); ext {
+	case ".qcow2", ".raw", ".vmdk", ".vhd", ".iso":
+		return ext[1:], nil
+	default:
+		return "", fmt.Errorf("%s is not a disk image which can be uploaded to OpenStack", filename)
+	}
+}
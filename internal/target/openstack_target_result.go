@@ -0,0 +1,11 @@
+package target
+
+type OpenStackTargetResultOptions struct {
+	ImageID string `json:"image_id"`
+}
+
+func (OpenStackTargetResultOptions) isTargetResultOptions() {}
+
+func NewOpenStackTargetResult(options *OpenStackTargetResultOptions) *TargetResult {
+	return newTargetResult("org.osbuild.openstack", options)
+}
@@ -72,6 +72,14 @@ func UnmarshalTargetOptions(targetName string, rawOptions json.RawMessage) (Targ
 		options = new(LocalTargetOptions)
 	case "org.osbuild.koji":
 		options = new(KojiTargetOptions)
+	case "org.osbuild.container":
+		options = new(ContainerTargetOptions)
+	case "org.osbuild.gcp":
+		options = new(GCPTargetOptions)
+	case "org.osbuild.vmware":
+		options = new(VMwareTargetOptions)
+	case "org.osbuild.openstack":
+		options = new(OpenStackTargetOptions)
 	default:
 		return nil, errors.New("unexpected target name")
 	}
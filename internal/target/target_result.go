@@ -0,0 +1,66 @@
+package target
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// TargetResult carries what a worker learned while uploading to a target,
+// for example the identifier the image got at its destination.
+type TargetResult struct {
+	Name    string              `json:"name"`
+	Options TargetResultOptions `json:"options"`
+}
+
+func newTargetResult(name string, options TargetResultOptions) *TargetResult {
+	return &TargetResult{
+		Name:    name,
+		Options: options,
+	}
+}
+
+type TargetResultOptions interface {
+	isTargetResultOptions()
+}
+
+type rawTargetResult struct {
+	Name    string          `json:"name"`
+	Options json.RawMessage `json:"options"`
+}
+
+func (targetResult *TargetResult) UnmarshalJSON(data []byte) error {
+	var rawTR rawTargetResult
+	err := json.Unmarshal(data, &rawTR)
+	if err != nil {
+		return err
+	}
+	options, err := UnmarshalTargetResultOptions(rawTR.Name, rawTR.Options)
+	if err != nil {
+		return err
+	}
+
+	targetResult.Name = rawTR.Name
+	targetResult.Options = options
+	return nil
+}
+
+func UnmarshalTargetResultOptions(trName string, rawOptions json.RawMessage) (TargetResultOptions, error) {
+	var options TargetResultOptions
+	switch trName {
+	case "org.osbuild.azure":
+		options = new(AzureTargetResultOptions)
+	case "org.osbuild.container":
+		options = new(ContainerTargetResultOptions)
+	case "org.osbuild.gcp":
+		options = new(GCPTargetResultOptions)
+	case "org.osbuild.openstack":
+		options = new(OpenStackTargetResultOptions)
+	case "org.osbuild.vmware":
+		options = new(VMwareTargetResultOptions)
+	default:
+		return nil, errors.New("unexpected target result name")
+	}
+	err := json.Unmarshal(rawOptions, options)
+
+	return options, err
+}
@@ -0,0 +1,23 @@
+package target
+
+type VMwareTargetOptions struct {
+	Filename   string `json:"filename"`
+	Host       string `json:"host"`
+	Username   string `json:"username"`
+	Password   string `json:"password"`
+	Datacenter string `json:"datacenter,omitempty"`
+	Cluster    string `json:"cluster,omitempty"`
+	Datastore  string `json:"datastore,omitempty"`
+	Folder     string `json:"folder,omitempty"`
+	TLSVerify  *bool  `json:"tls_verify,omitempty"`
+	// The virtual hardware of the template, vSphere's defaults if unset
+	CPUs            int    `json:"cpus,omitempty"`
+	MemoryMB        int    `json:"memory_mb,omitempty"`
+	HardwareVersion string `json:"hardware_version,omitempty"`
+}
+
+func (VMwareTargetOptions) isTargetOptions() {}
+
+func NewVMwareTarget(options *VMwareTargetOptions) *Target {
+	return newTarget("org.osbuild.vmware", options)
+}
@@ -0,0 +1,12 @@
+package target
+
+type VMwareTargetResultOptions struct {
+	TemplateName string `json:"template_name"`
+	TemplateID   string `json:"template_id"`
+}
+
+func (VMwareTargetResultOptions) isTargetResultOptions() {}
+
+func NewVMwareTargetResult(options *VMwareTargetResultOptions) *TargetResult {
+	return newTargetResult("org.osbuild.vmware", options)
+}
@@ -0,0 +1,214 @@
+package azure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/Azure/go-autorest/autorest/azure/auth"
+)
+
+// ClientCredentials authenticate a service principal against Azure Resource
+// Manager, which is needed to create images, unlike uploading blobs.
+type ClientCredentials struct {
+	TenantID       string
+	ClientID       string
+	ClientSecret   string
+	SubscriptionID string
+}
+
+// GalleryImage identifies an image definition in a Shared Image Gallery.
+type GalleryImage struct {
+	Gallery string
+	Image   string
+	Version string
+}
+
+// ImageTimeout is how long creating an image and publishing it to a gallery
+// may take
+const ImageTimeout = time.Hour
+
+// computeAPIVersion is the version of the Microsoft.Compute API of Azure
+// Resource Manager used to create images
+const computeAPIVersion = "2019-12-01"
+
+// Compute creates images in Azure from uploaded VHDs.
+type Compute struct {
+	client         autorest.Client
+	baseURI        string
+	subscriptionID string
+}
+
+// NewCompute creates a client for the public Azure cloud.
+func NewCompute(credentials ClientCredentials) (*Compute, error) {
+	config := auth.NewClientCredentialsConfig(credentials.ClientID, credentials.ClientSecret, credentials.TenantID)
+	authorizer, err := config.Authorizer()
+	if err != nil {
+		return nil, fmt.Errorf("cannot create the authorizer: %v", err)
+	}
+
+	return NewComputeWithBaseURI(azure.PublicCloud.ResourceManagerEndpoint, credentials.SubscriptionID, authorizer), nil
+}
+
+// NewComputeWithBaseURI creates a client like NewCompute, which sends
+// requests to baseURI instead of the public Azure Resource Manager.
+func NewComputeWithBaseURI(baseURI, subscriptionID string, authorizer autorest.Authorizer) *Compute {
+	client := autorest.NewClientWithUserAgent("osbuild-composer")
+	client.Authorizer = authorizer
+	return &Compute{
+		client:         client,
+		baseURI:        baseURI,
+		subscriptionID: subscriptionID,
+	}
+}
+
+// BlobURL returns the URL of the blob UploadImage stores imageName in.
+func BlobURL(storageAccount, container, imageName string) string {
+	return fmt.Sprintf("https://%s.blob.core.windows.net/%s/%s", storageAccount, container, vhdName(imageName))
+}
+
+// Azure cannot create an image from a storage blob without .vhd extension
+func vhdName(imageName string) string {
+	if !strings.HasSuffix(imageName, ".vhd") {
+		return imageName + ".vhd"
+	}
+	return imageName
+}
+
+type imageOSDisk struct {
+	OSType  string `json:"osType"`
+	OSState string `json:"osState"`
+	BlobURI string `json:"blobUri"`
+}
+
+type imageProperties struct {
+	StorageProfile struct {
+		OSDisk imageOSDisk `json:"osDisk"`
+	} `json:"storageProfile"`
+}
+
+type galleryImageVersionProperties struct {
+	StorageProfile struct {
+		Source struct {
+			ID string `json:"id"`
+		} `json:"source"`
+	} `json:"storageProfile"`
+	PublishingProfile struct {
+		TargetRegions []targetRegion `json:"targetRegions"`
+	} `json:"publishingProfile"`
+}
+
+type targetRegion struct {
+	Name string `json:"name"`
+}
+
+// resource is a resource of Azure Resource Manager, as it is sent to create
+// it. Only its ID is read from responses.
+type resource struct {
+	ID         string      `json:"id,omitempty"`
+	Location   string      `json:"location"`
+	Properties interface{} `json:"properties"`
+}
+
+// CreateImage creates a generalized Linux managed image called name from
+// the VHD at blobURL and returns its resource ID.
+func (c *Compute) CreateImage(ctx context.Context, resourceGroup, location, name, blobURL string) (string, error) {
+	var properties imageProperties
+	properties.StorageProfile.OSDisk = imageOSDisk{
+		OSType:  "Linux",
+		OSState: "Generalized",
+		BlobURI: blobURL,
+	}
+
+	id, err := c.createOrUpdate(ctx, "/subscriptions/{subscriptionId}/resourceGroups/{resourceGroupName}/providers/Microsoft.Compute/images/{imageName}", map[string]interface{}{
+		"resourceGroupName": resourceGroup,
+		"imageName":         name,
+	}, resource{Location: location, Properties: properties})
+	if err != nil {
+		return "", fmt.Errorf("creating the image failed: %v", err)
+	}
+	return id, nil
+}
+
+// CreateGalleryImageVersion publishes the managed image imageID as a new
+// version of the gallery image in location and returns its resource ID. The
+// gallery and image definition must exist already.
+func (c *Compute) CreateGalleryImageVersion(ctx context.Context, resourceGroup, location, imageID string, gallery GalleryImage) (string, error) {
+	var properties galleryImageVersionProperties
+	properties.StorageProfile.Source.ID = imageID
+	properties.PublishingProfile.TargetRegions = []targetRegion{{Name: location}}
+
+	id, err := c.createOrUpdate(ctx, "/subscriptions/{subscriptionId}/resourceGroups/{resourceGroupName}/providers/Microsoft.Compute/galleries/{galleryName}/images/{galleryImageName}/versions/{galleryImageVersionName}", map[string]interface{}{
+		"resourceGroupName":       resourceGroup,
+		"galleryName":             gallery.Gallery,
+		"galleryImageName":        gallery.Image,
+		"galleryImageVersionName": gallery.Version,
+	}, resource{Location: location, Properties: properties})
+	if err != nil {
+		return "", fmt.Errorf("creating the gallery image version failed: %v", err)
+	}
+	return id, nil
+}
+
+// createOrUpdate puts r at the path of the Microsoft.Compute API given by
+// pathTemplate and pathParameters, waits until Azure has finished creating
+// it, and returns its resource ID.
+func (c *Compute) createOrUpdate(ctx context.Context, pathTemplate string, pathParameters map[string]interface{}, r resource) (string, error) {
+	parameters := map[string]interface{}{
+		"subscriptionId": autorest.Encode("path", c.subscriptionID),
+	}
+	for key, value := range pathParameters {
+		parameters[key] = autorest.Encode("path", value)
+	}
+
+	req, err := autorest.CreatePreparer(
+		autorest.AsContentType("application/json; charset=utf-8"),
+		autorest.AsPut(),
+		autorest.WithBaseURL(c.baseURI),
+		autorest.WithPathParameters(pathTemplate, parameters),
+		autorest.WithJSON(r),
+		autorest.WithQueryParameters(map[string]interface{}{
+			"api-version": computeAPIVersion,
+		}),
+	).Prepare((&http.Request{}).WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := c.client.Send(req, azure.DoRetryWithRegistration(c.client))
+	if err != nil {
+		return "", err
+	}
+	future, err := azure.NewFutureFromResponse(resp)
+	if err != nil {
+		return "", err
+	}
+	err = future.WaitForCompletionRef(ctx, c.client)
+	if err != nil {
+		return "", fmt.Errorf("waiting for the operation failed: %v", err)
+	}
+
+	resp, err = future.GetResult(c.client)
+	if err != nil {
+		return "", err
+	}
+	var created resource
+	err = autorest.Respond(
+		resp,
+		azure.WithErrorUnlessStatusCode(http.StatusOK, http.StatusCreated),
+		autorest.ByUnmarshallingJSON(&created),
+		autorest.ByClosing())
+	if err != nil {
+		return "", err
+	}
+
+	if created.ID == "" {
+		return "", errors.New("the response has no resource ID")
+	}
+	return created.ID, nil
+}
@@ -0,0 +1,115 @@
+package azure_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/osbuild-composer/internal/upload/azure"
+)
+
+// fakeResourceManager accepts PUT requests for any resource and finishes
+// them immediately
+type fakeResourceManager struct {
+	mu        sync.Mutex
+	resources map[string]map[string]interface{}
+}
+
+func (f *fakeResourceManager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.Method != http.MethodPut && r.Method != http.MethodGet {
+		http.Error(w, "unexpected method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if r.Method == http.MethodPut {
+		var resource map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&resource); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		resource["id"] = r.URL.Path
+		properties, _ := resource["properties"].(map[string]interface{})
+		if properties == nil {
+			properties = make(map[string]interface{})
+			resource["properties"] = properties
+		}
+		properties["provisioningState"] = "Succeeded"
+		f.resources[r.URL.Path] = resource
+	}
+
+	resource, ok := f.resources[r.URL.Path]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resource)
+}
+
+func newFakeResourceManager() (*fakeResourceManager, *httptest.Server, *azure.Compute) {
+	f := &fakeResourceManager{
+		resources: make(map[string]map[string]interface{}),
+	}
+	server := httptest.NewServer(f)
+	return f, server, azure.NewComputeWithBaseURI(server.URL, "subscription", autorest.NullAuthorizer{})
+}
+
+func TestCreateImage(t *testing.T) {
+	f, server, c := newFakeResourceManager()
+	defer server.Close()
+
+	blobURL := azure.BlobURL("account", "images", "my-image")
+	require.Equal(t, "https://account.blob.core.windows.net/images/my-image.vhd", blobURL)
+
+	id, err := c.CreateImage(context.Background(), "group", "westeurope", "my-image", blobURL)
+	require.NoError(t, err)
+	require.Equal(t, "/subscriptions/subscription/resourceGroups/group/providers/Microsoft.Compute/images/my-image", id)
+
+	image := f.resources[id]
+	require.Equal(t, "westeurope", image["location"])
+	osDisk := image["properties"].(map[string]interface{})["storageProfile"].(map[string]interface{})["osDisk"].(map[string]interface{})
+	require.Equal(t, blobURL, osDisk["blobUri"])
+	require.Equal(t, "Linux", osDisk["osType"])
+	require.Equal(t, "Generalized", osDisk["osState"])
+}
+
+func TestCreateGalleryImageVersion(t *testing.T) {
+	f, server, c := newFakeResourceManager()
+	defer server.Close()
+
+	imageID := "/subscriptions/subscription/resourceGroups/group/providers/Microsoft.Compute/images/my-image"
+	id, err := c.CreateGalleryImageVersion(context.Background(), "group", "westeurope", imageID, azure.GalleryImage{
+		Gallery: "gallery",
+		Image:   "rhel",
+		Version: "1.0.0",
+	})
+	require.NoError(t, err)
+	require.True(t, strings.HasSuffix(id, "/galleries/gallery/images/rhel/versions/1.0.0"), id)
+
+	version := f.resources[id]
+	source := version["properties"].(map[string]interface{})["storageProfile"].(map[string]interface{})["source"].(map[string]interface{})
+	require.Equal(t, imageID, source["id"])
+}
+
+func TestCreateImageFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":{"code":"InvalidParameter","message":"blob not found"}}`))
+	}))
+	defer server.Close()
+
+	c := azure.NewComputeWithBaseURI(server.URL, "subscription", autorest.NullAuthorizer{})
+	_, err := c.CreateImage(context.Background(), "group", "westeurope", "my-image", "https://account.blob.core.windows.net/images/my-image.vhd")
+	require.Error(t, err)
+}
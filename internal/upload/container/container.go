@@ -0,0 +1,523 @@
+// Package container pushes OCI archives to container registries speaking
+// the Docker Registry HTTP API V2.
+//
+// Only the parts of the protocol needed for a push are implemented: blob
+// existence checks, monolithic blob uploads, manifest uploads and the basic
+// and bearer token authentication schemes.
+package container
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+)
+
+const (
+	MediaTypeImageIndex    = "application/vnd.oci.image.index.v1+json"
+	MediaTypeImageManifest = "application/vnd.oci.image.manifest.v1+json"
+)
+
+// Credentials to log into a registry with.
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// Client pushes images to a single repository of a registry.
+type Client struct {
+	registry    *url.URL
+	repository  string
+	credentials *Credentials
+	client      *http.Client
+	token       string
+}
+
+type descriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+}
+
+type index struct {
+	Manifests []descriptor `json:"manifests"`
+}
+
+type manifest struct {
+	MediaType string       `json:"mediaType,omitempty"`
+	Config    descriptor   `json:"config"`
+	Layers    []descriptor `json:"layers"`
+}
+
+// NewClient returns a client for the repository at the registry. The
+// registry is either a bare host name, which is contacted over https, or a
+// URL with an http or https scheme. When tlsVerify is false, the
+// certificate of the registry is not verified. Credentials may be nil for
+// registries which allow anonymous pushes.
+func NewClient(registry, repository string, credentials *Credentials, tlsVerify bool) (*Client, error) {
+	if !strings.Contains(registry, "://") {
+		registry = "https://" + registry
+	}
+	u, err := url.Parse(registry)
+	if err != nil {
+		return nil, fmt.Errorf("invalid registry url: %v", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported registry url scheme: %s", u.Scheme)
+	}
+	if repository == "" {
+		return nil, errors.New("repository must not be empty")
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if !tlsVerify {
+		/* #nosec G402 */
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	return &Client{
+		registry:    u,
+		repository:  repository,
+		credentials: credentials,
+		client:      &http.Client{Transport: transport},
+	}, nil
+}
+
+// CredentialsFromAuthFile looks up the credentials for registry in an auth
+// file in the format used by podman, skopeo and docker:
+//
+//	{"auths": {"registry.example.com": {"auth": "<base64 of user:password>"}}}
+//
+// It returns nil if the file has no entry for the registry.
+func CredentialsFromAuthFile(filename, registry string) (*Credentials, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read auth file: %v", err)
+	}
+
+	var authFile struct {
+		Auths map[string]struct {
+			Auth string `json:"auth"`
+		} `json:"auths"`
+	}
+	err = json.Unmarshal(data, &authFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse auth file: %v", err)
+	}
+
+	host := registry
+	if u, err := url.Parse(registry); err == nil && u.Host != "" {
+		host = u.Host
+	}
+
+	for key, entry := range authFile.Auths {
+		k := strings.TrimPrefix(strings.TrimPrefix(key, "https://"), "http://")
+		k = strings.TrimSuffix(k, "/")
+		if k != host {
+			continue
+		}
+
+		decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+		if err != nil {
+			return nil, fmt.Errorf("invalid auth entry for %s: %v", host, err)
+		}
+		parts := strings.SplitN(string(decoded), ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid auth entry for %s", host)
+		}
+		return &Credentials{Username: parts[0], Password: parts[1]}, nil
+	}
+
+	return nil, nil
+}
+
+// PushArchive uploads the image in the OCI archive at filename to the
+// repository and tags it with each of tags. It returns the digest of the
+// pushed manifest.
+func (c *Client) PushArchive(filename string, tags []string) (string, error) {
+	if len(tags) == 0 {
+		return "", errors.New("at least one tag is required")
+	}
+
+	var idx index
+	err := readArchiveJSON(filename, "index.json", &idx)
+	if err != nil {
+		return "", err
+	}
+	if len(idx.Manifests) != 1 {
+		return "", fmt.Errorf("expected exactly one manifest in the archive, found %d", len(idx.Manifests))
+	}
+	desc := idx.Manifests[0]
+
+	rawManifest, err := readArchiveBlob(filename, desc.Digest)
+	if err != nil {
+		return "", err
+	}
+	var m manifest
+	err = json.Unmarshal(rawManifest, &m)
+	if err != nil {
+		return "", fmt.Errorf("cannot parse manifest: %v", err)
+	}
+
+	for _, blob := range append([]descriptor{m.Config}, m.Layers...) {
+		err = c.pushBlob(filename, blob)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	mediaType := desc.MediaType
+	if mediaType == "" {
+		mediaType = MediaTypeImageManifest
+	}
+	for _, tag := range tags {
+		err = c.pushManifest(tag, mediaType, rawManifest)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return desc.Digest, nil
+}
+
+func (c *Client) pushBlob(filename string, blob descriptor) error {
+	blobURL := c.url("blobs", blob.Digest)
+	resp, err := c.do(func() (*http.Request, error) {
+		return http.NewRequest(http.MethodHead, blobURL, nil)
+	})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	uploadURL := c.url("blobs", "uploads") + "/"
+	resp, err = c.do(func() (*http.Request, error) {
+		return http.NewRequest(http.MethodPost, uploadURL, nil)
+	})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("cannot start upload of blob %s: %s", blob.Digest, resp.Status)
+	}
+
+	location, err := resp.Location()
+	if err != nil {
+		return fmt.Errorf("registry did not return an upload location: %v", err)
+	}
+	query := location.Query()
+	query.Set("digest", blob.Digest)
+	location.RawQuery = query.Encode()
+
+	resp, err = c.do(func() (*http.Request, error) {
+		body, err := openArchiveBlob(filename, blob.Digest)
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequest(http.MethodPut, location.String(), body)
+		if err != nil {
+			body.Close()
+			return nil, err
+		}
+		req.ContentLength = blob.Size
+		req.Header.Set("Content-Type", "application/octet-stream")
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("cannot upload blob %s: %s", blob.Digest, resp.Status)
+	}
+
+	return nil
+}
+
+func (c *Client) pushManifest(tag, mediaType string, rawManifest []byte) error {
+	manifestURL := c.url("manifests", tag)
+	resp, err := c.do(func() (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodPut, manifestURL, bytes.NewReader(rawManifest))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", mediaType)
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("cannot upload manifest for tag %s: %s", tag, resp.Status)
+	}
+
+	return nil
+}
+
+// url returns the API endpoint of kind ("blobs", "manifests") named
+// reference in the repository of the client.
+func (c *Client) url(kind, reference string) string {
+	u := *c.registry
+	u.Path = path.Join(u.Path, "v2", c.repository, kind, reference)
+	return u.String()
+}
+
+// do sends the request created by newRequest. If the registry asks for
+// authentication, it authenticates and sends a fresh request created by
+// newRequest once more.
+func (c *Client) do(newRequest func() (*http.Request, error)) (*http.Response, error) {
+	req, err := newRequest()
+	if err != nil {
+		return nil, err
+	}
+	c.authorize(req)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	challenge := resp.Header.Get("WWW-Authenticate")
+	err = c.authenticate(challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err = newRequest()
+	if err != nil {
+		return nil, err
+	}
+	c.authorize(req)
+
+	resp, err = c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		resp.Body.Close()
+		return nil, errors.New("registry rejected the credentials")
+	}
+
+	return resp, nil
+}
+
+func (c *Client) authorize(req *http.Request) {
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	} else if c.credentials != nil {
+		req.SetBasicAuth(c.credentials.Username, c.credentials.Password)
+	}
+}
+
+// authenticate answers an authentication challenge from the registry. Basic
+// challenges are answered by sending the credentials with each request,
+// bearer challenges by fetching a token from the realm named in the
+// challenge.
+func (c *Client) authenticate(challenge string) error {
+	scheme, params := parseChallenge(challenge)
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if c.credentials == nil {
+			return errors.New("registry requires credentials")
+		}
+		return nil
+	case "bearer":
+	default:
+		return fmt.Errorf("unsupported authentication scheme: %q", scheme)
+	}
+
+	realm, err := url.Parse(params["realm"])
+	if err != nil || realm.Host == "" {
+		return fmt.Errorf("invalid authentication realm: %q", params["realm"])
+	}
+	query := realm.Query()
+	if service, ok := params["service"]; ok {
+		query.Set("service", service)
+	}
+	if scope, ok := params["scope"]; ok {
+		query.Set("scope", scope)
+	}
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return err
+	}
+	if c.credentials != nil {
+		req.SetBasicAuth(c.credentials.Username, c.credentials.Password)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("cannot get token from %s: %s", realm.Host, resp.Status)
+	}
+
+	var tokenResponse struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&tokenResponse)
+	if err != nil {
+		return fmt.Errorf("cannot parse token response: %v", err)
+	}
+
+	c.token = tokenResponse.Token
+	if c.token == "" {
+		c.token = tokenResponse.AccessToken
+	}
+	if c.token == "" {
+		return errors.New("token response does not contain a token")
+	}
+
+	return nil
+}
+
+// parseChallenge splits a WWW-Authenticate header of the form
+// `Bearer realm="...",service="...",scope="..."` into its scheme and
+// parameters.
+func parseChallenge(challenge string) (string, map[string]string) {
+	params := make(map[string]string)
+
+	parts := strings.SplitN(strings.TrimSpace(challenge), " ", 2)
+	if len(parts) < 2 {
+		return parts[0], params
+	}
+
+	rest := parts[1]
+	for rest != "" {
+		eq := strings.Index(rest, "=")
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(rest[:eq]))
+		rest = strings.TrimSpace(rest[eq+1:])
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else if comma := strings.Index(rest, ","); comma >= 0 {
+			value, rest = rest[:comma], rest[comma:]
+		} else {
+			value, rest = rest, ""
+		}
+		params[key] = value
+
+		rest = strings.TrimPrefix(strings.TrimSpace(rest), ",")
+	}
+
+	return parts[0], params
+}
+
+// archiveFile is an entry of an OCI archive, which closes the archive when
+// it is closed.
+type archiveFile struct {
+	io.Reader
+	file *os.File
+}
+
+func (f *archiveFile) Close() error {
+	return f.file.Close()
+}
+
+// openArchiveFile returns a reader for the file at name in the tar archive
+// at filename.
+func openArchiveFile(filename, name string) (*archiveFile, int64, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, 0, fmt.Errorf("cannot open archive: %v", err)
+	}
+
+	tr := tar.NewReader(f)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			f.Close()
+			return nil, 0, fmt.Errorf("cannot read archive: %v", err)
+		}
+		if path.Clean(header.Name) == name {
+			return &archiveFile{Reader: tr, file: f}, header.Size, nil
+		}
+	}
+
+	f.Close()
+	return nil, 0, fmt.Errorf("archive does not contain %s", name)
+}
+
+func openArchiveBlob(filename, digest string) (*archiveFile, error) {
+	parts := strings.SplitN(digest, ":", 2)
+	if len(parts) != 2 || parts[0] != "sha256" {
+		return nil, fmt.Errorf("unsupported digest: %s", digest)
+	}
+
+	f, _, err := openArchiveFile(filename, path.Join("blobs", parts[0], parts[1]))
+	return f, err
+}
+
+func readArchiveBlob(filename, digest string) ([]byte, error) {
+	f, err := openArchiveBlob(filename, digest)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read blob %s: %v", digest, err)
+	}
+	if sum := fmt.Sprintf("sha256:%x", sha256.Sum256(data)); sum != digest {
+		return nil, fmt.Errorf("blob %s has digest %s", digest, sum)
+	}
+
+	return data, nil
+}
+
+func readArchiveJSON(filename, name string, v interface{}) error {
+	f, size, err := openArchiveFile(filename, name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(f, size))
+	if err != nil {
+		return fmt.Errorf("cannot read %s: %v", name, err)
+	}
+	err = json.Unmarshal(data, v)
+	if err != nil {
+		return fmt.Errorf("cannot parse %s: %v", name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,315 @@
+package container_test
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/osbuild-composer/internal/upload/container"
+)
+
+func digestOf(data []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+}
+
+// writeArchive writes a minimal OCI archive with one layer to dir and
+// returns its path and the digest of its manifest.
+func writeArchive(t *testing.T, dir string) (string, string) {
+	config := []byte(`{"architecture":"amd64","os":"linux"}`)
+	layer := []byte("not really a tarball")
+	manifest, err := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"config": map[string]interface{}{
+			"mediaType": "application/vnd.oci.image.config.v1+json",
+			"digest":    digestOf(config),
+			"size":      len(config),
+		},
+		"layers": []interface{}{
+			map[string]interface{}{
+				"mediaType": "application/vnd.oci.image.layer.v1.tar",
+				"digest":    digestOf(layer),
+				"size":      len(layer),
+			},
+		},
+	})
+	require.NoError(t, err)
+	index, err := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"manifests": []interface{}{
+			map[string]interface{}{
+				"mediaType": container.MediaTypeImageManifest,
+				"digest":    digestOf(manifest),
+				"size":      len(manifest),
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	filename := filepath.Join(dir, "container.tar")
+	f, err := os.Create(filename)
+	require.NoError(t, err)
+	defer f.Close()
+
+	tw := tar.NewWriter(f)
+	files := []struct {
+		name string
+		data []byte
+	}{
+		{"oci-layout", []byte(`{"imageLayoutVersion":"1.0.0"}`)},
+		{"index.json", index},
+		{"blobs/sha256/" + digestOf(config)[7:], config},
+		{"blobs/sha256/" + digestOf(layer)[7:], layer},
+		{"blobs/sha256/" + digestOf(manifest)[7:], manifest},
+	}
+	for _, file := range files {
+		err = tw.WriteHeader(&tar.Header{Name: file.name, Mode: 0644, Size: int64(len(file.data))})
+		require.NoError(t, err)
+		_, err = tw.Write(file.data)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+
+	return filename, digestOf(manifest)
+}
+
+// fakeRegistry implements the parts of the registry API used for pushing.
+type fakeRegistry struct {
+	mu         sync.Mutex
+	repository string
+	blobs      map[string][]byte
+	manifests  map[string][]byte
+	authorized func(r *http.Request) bool
+	challenge  string
+}
+
+func newFakeRegistry(repository string) *fakeRegistry {
+	return &fakeRegistry{
+		repository: repository,
+		blobs:      make(map[string][]byte),
+		manifests:  make(map[string][]byte),
+	}
+}
+
+func (reg *fakeRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	if reg.authorized != nil && !reg.authorized(r) {
+		w.Header().Set("WWW-Authenticate", reg.challenge)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	prefix := "/v2/" + reg.repository + "/"
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	p := strings.TrimPrefix(r.URL.Path, prefix)
+
+	switch {
+	case r.Method == http.MethodPost && p == "blobs/uploads/":
+		w.Header().Set("Location", "/upload/1?state=abc")
+		w.WriteHeader(http.StatusAccepted)
+	case r.Method == http.MethodHead && strings.HasPrefix(p, "blobs/"):
+		if _, ok := reg.blobs[strings.TrimPrefix(p, "blobs/")]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	case r.Method == http.MethodPut && strings.HasPrefix(p, "manifests/"):
+		data, _ := ioutil.ReadAll(r.Body)
+		if r.Header.Get("Content-Type") != container.MediaTypeImageManifest {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		reg.manifests[strings.TrimPrefix(p, "manifests/")] = data
+		w.Header().Set("Docker-Content-Digest", digestOf(data))
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (reg *fakeRegistry) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/v2/", reg)
+	mux.HandleFunc("/upload/1", func(w http.ResponseWriter, r *http.Request) {
+		reg.mu.Lock()
+		defer reg.mu.Unlock()
+
+		if reg.authorized != nil && !reg.authorized(r) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodPut || r.URL.Query().Get("state") != "abc" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		data, _ := ioutil.ReadAll(r.Body)
+		digest := r.URL.Query().Get("digest")
+		if digest != digestOf(data) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		reg.blobs[digest] = data
+		w.WriteHeader(http.StatusCreated)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if !ok || username != "user" || password != "pass" || r.URL.Query().Get("scope") != "repository:osbuild/test:push,pull" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"token":"secret-token"}`))
+	})
+	return mux
+}
+
+func TestPushArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "osbuild-container-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	archive, manifestDigest := writeArchive(t, dir)
+
+	reg := newFakeRegistry("osbuild/test")
+	server := httptest.NewServer(reg.handler())
+	defer server.Close()
+
+	client, err := container.NewClient(server.URL, "osbuild/test", nil, true)
+	require.NoError(t, err)
+
+	digest, err := client.PushArchive(archive, []string{"latest", "1.0"})
+	require.NoError(t, err)
+	require.Equal(t, manifestDigest, digest)
+
+	require.Len(t, reg.blobs, 2)
+	require.Contains(t, reg.manifests, "latest")
+	require.Contains(t, reg.manifests, "1.0")
+	require.Equal(t, manifestDigest, digestOf(reg.manifests["latest"]))
+
+	// pushing again skips blobs the registry already has
+	reg.blobs["sha256:unused"] = nil
+	_, err = client.PushArchive(archive, []string{"latest"})
+	require.NoError(t, err)
+	require.Len(t, reg.blobs, 3)
+
+	_, err = client.PushArchive(archive, nil)
+	require.Error(t, err)
+}
+
+func TestPushArchiveBasicAuth(t *testing.T) {
+	dir, err := ioutil.TempDir("", "osbuild-container-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	archive, _ := writeArchive(t, dir)
+
+	reg := newFakeRegistry("osbuild/test")
+	reg.challenge = `Basic realm="registry"`
+	reg.authorized = func(r *http.Request) bool {
+		username, password, ok := r.BasicAuth()
+		return ok && username == "user" && password == "pass"
+	}
+	server := httptest.NewServer(reg.handler())
+	defer server.Close()
+
+	client, err := container.NewClient(server.URL, "osbuild/test", nil, true)
+	require.NoError(t, err)
+	_, err = client.PushArchive(archive, []string{"latest"})
+	require.Error(t, err)
+
+	client, err = container.NewClient(server.URL, "osbuild/test", &container.Credentials{Username: "user", Password: "wrong"}, true)
+	require.NoError(t, err)
+	_, err = client.PushArchive(archive, []string{"latest"})
+	require.Error(t, err)
+
+	client, err = container.NewClient(server.URL, "osbuild/test", &container.Credentials{Username: "user", Password: "pass"}, true)
+	require.NoError(t, err)
+	_, err = client.PushArchive(archive, []string{"latest"})
+	require.NoError(t, err)
+	require.Contains(t, reg.manifests, "latest")
+}
+
+func TestPushArchiveBearerAuth(t *testing.T) {
+	dir, err := ioutil.TempDir("", "osbuild-container-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	archive, _ := writeArchive(t, dir)
+
+	reg := newFakeRegistry("osbuild/test")
+	server := httptest.NewServer(reg.handler())
+	defer server.Close()
+
+	reg.challenge = fmt.Sprintf(`Bearer realm="%s/token",service="registry",scope="repository:osbuild/test:push,pull"`, server.URL)
+	reg.authorized = func(r *http.Request) bool {
+		return r.Header.Get("Authorization") == "Bearer secret-token"
+	}
+
+	client, err := container.NewClient(server.URL, "osbuild/test", &container.Credentials{Username: "user", Password: "pass"}, true)
+	require.NoError(t, err)
+	_, err = client.PushArchive(archive, []string{"latest"})
+	require.NoError(t, err)
+	require.Contains(t, reg.manifests, "latest")
+}
+
+func TestPushArchiveTLSVerify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "osbuild-container-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	archive, _ := writeArchive(t, dir)
+
+	reg := newFakeRegistry("osbuild/test")
+	server := httptest.NewTLSServer(reg.handler())
+	defer server.Close()
+
+	// the test server's certificate is self-signed
+	client, err := container.NewClient(server.URL, "osbuild/test", nil, true)
+	require.NoError(t, err)
+	_, err = client.PushArchive(archive, []string{"latest"})
+	require.Error(t, err)
+
+	client, err = container.NewClient(server.URL, "osbuild/test", nil, false)
+	require.NoError(t, err)
+	_, err = client.PushArchive(archive, []string{"latest"})
+	require.NoError(t, err)
+}
+
+func TestCredentialsFromAuthFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "osbuild-container-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	authFile := filepath.Join(dir, "auth.json")
+	auth := base64.StdEncoding.EncodeToString([]byte("user:pa:ss"))
+	err = ioutil.WriteFile(authFile, []byte(`{"auths":{"https://registry.example.com/":{"auth":"`+auth+`"},"other.example.com":{"auth":"!"}}}`), 0600)
+	require.NoError(t, err)
+
+	credentials, err := container.CredentialsFromAuthFile(authFile, "registry.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, &container.Credentials{Username: "user", Password: "pa:ss"}, credentials)
+
+	credentials, err = container.CredentialsFromAuthFile(authFile, "https://registry.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, &container.Credentials{Username: "user", Password: "pa:ss"}, credentials)
+
+	credentials, err = container.CredentialsFromAuthFile(authFile, "unknown.example.com")
+	require.NoError(t, err)
+	assert.Nil(t, credentials)
+
+	_, err = container.CredentialsFromAuthFile(authFile, "other.example.com")
+	assert.Error(t, err)
+
+	_, err = container.CredentialsFromAuthFile(filepath.Join(dir, "missing.json"), "registry.example.com")
+	assert.Error(t, err)
+}
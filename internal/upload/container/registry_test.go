@@ -0,0 +1,48 @@
+//+build container_test
+
+package container_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/osbuild-composer/internal/upload/container"
+)
+
+// TestRegistryPush pushes to the registry started by
+// tools/run-registry-container.sh.
+func TestRegistryPush(t *testing.T) {
+	registry := "http://localhost:5000"
+
+	dir, err := ioutil.TempDir("", "osbuild-container-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	archive, manifestDigest := writeArchive(t, dir)
+
+	client, err := container.NewClient(registry, "osbuild/test", &container.Credentials{Username: "osbuild", Password: "wrong"}, true)
+	require.NoError(t, err)
+	_, err = client.PushArchive(archive, []string{"latest"})
+	require.Error(t, err)
+
+	client, err = container.NewClient(registry, "osbuild/test", &container.Credentials{Username: "osbuild", Password: "osbuildpass"}, true)
+	require.NoError(t, err)
+	digest, err := client.PushArchive(archive, []string{"latest", "1.0"})
+	require.NoError(t, err)
+	require.Equal(t, manifestDigest, digest)
+
+	for _, tag := range []string{"latest", "1.0"} {
+		req, err := http.NewRequest(http.MethodHead, registry+"/v2/osbuild/test/manifests/"+tag, nil)
+		require.NoError(t, err)
+		req.SetBasicAuth("osbuild", "osbuildpass")
+		req.Header.Set("Accept", container.MediaTypeImageManifest)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, manifestDigest, resp.Header.Get("Docker-Content-Digest"))
+	}
+}
@@ -0,0 +1,471 @@
+// Package gcp uploads images to Google Cloud Storage and imports them into
+// Google Compute Engine, using the JSON REST APIs of both services.
+package gcp
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultStorageEndpoint = "https://storage.googleapis.com"
+	DefaultComputeEndpoint = "https://compute.googleapis.com"
+	DefaultTokenURI        = "https://oauth2.googleapis.com/token"
+
+	cloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
+)
+
+// ImportTimeout is how long uploading an image and importing it into
+// Compute Engine may take
+const ImportTimeout = time.Hour
+
+// requestTimeout bounds each request other than uploads, whose duration
+// depends on the size of the image
+const requestTimeout = 5 * time.Minute
+
+// maxPollInterval is the longest time Import waits between two polls of
+// the import operation
+const maxPollInterval = 30 * time.Second
+
+// Credentials is the subset of a service account key file needed to
+// authenticate as the service account.
+type Credentials struct {
+	ProjectID   string `json:"project_id"`
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+// Endpoints of the services. Empty values are replaced with the defaults.
+type Endpoints struct {
+	Storage string
+	Compute string
+}
+
+type GCP struct {
+	credentials *Credentials
+	privateKey  *rsa.PrivateKey
+	endpoints   Endpoints
+	client      *http.Client
+
+	token        string
+	tokenExpires time.Time
+}
+
+// New creates a client authenticating with the service account key in
+// credentials, which is the content of a JSON key file.
+func New(credentials []byte) (*GCP, error) {
+	if len(credentials) == 0 {
+		return nil, errors.New("no GCP credentials given")
+	}
+	return NewWithEndpoints(credentials, Endpoints{})
+}
+
+// NewWithEndpoints creates a client like New, which sends requests to the
+// given endpoints instead of the Google ones. Without credentials, requests
+// are sent unauthenticated, which is only useful for emulators of the
+// services.
+func NewWithEndpoints(credentials []byte, endpoints Endpoints) (*GCP, error) {
+	if endpoints.Storage == "" {
+		endpoints.Storage = DefaultStorageEndpoint
+	}
+	if endpoints.Compute == "" {
+		endpoints.Compute = DefaultComputeEndpoint
+	}
+	endpoints.Storage = strings.TrimSuffix(endpoints.Storage, "/")
+	endpoints.Compute = strings.TrimSuffix(endpoints.Compute, "/")
+
+	g := &GCP{
+		endpoints: endpoints,
+		client:    &http.Client{},
+	}
+
+	if len(credentials) == 0 {
+		return g, nil
+	}
+
+	var creds Credentials
+	err := json.Unmarshal(credentials, &creds)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse credentials: %v", err)
+	}
+	if creds.ClientEmail == "" || creds.PrivateKey == "" {
+		return nil, errors.New("credentials must contain client_email and private_key")
+	}
+	if creds.TokenURI == "" {
+		creds.TokenURI = DefaultTokenURI
+	}
+
+	privateKey, err := parsePrivateKey(creds.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	g.credentials = &creds
+	g.privateKey = privateKey
+	return g, nil
+}
+
+// ProjectID returns the project of the service account, or an empty string
+// if the client has no credentials.
+func (g *GCP) ProjectID() string {
+	if g.credentials == nil {
+		return ""
+	}
+	return g.credentials.ProjectID
+}
+
+func parsePrivateKey(data string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, errors.New("private key is not PEM encoded")
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		pkcs1Key, pkcs1Err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if pkcs1Err != nil {
+			return nil, fmt.Errorf("cannot parse private key: %v", err)
+		}
+		return pkcs1Key, nil
+	}
+
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key is not an RSA key")
+	}
+	return rsaKey, nil
+}
+
+// WriteImageArchive stores the raw disk image at diskPath as disk.raw in a
+// gzip-compressed tarball at archivePath, which is the format Compute Engine
+// imports images from.
+func WriteImageArchive(diskPath, archivePath string) error {
+	disk, err := os.Open(diskPath)
+	if err != nil {
+		return fmt.Errorf("cannot open image: %v", err)
+	}
+	defer disk.Close()
+
+	info, err := disk.Stat()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(archivePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+
+	err = tw.WriteHeader(&tar.Header{
+		Name:    "disk.raw",
+		Mode:    0644,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		Format:  tar.FormatGNU,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, disk)
+	if err != nil {
+		return fmt.Errorf("cannot write image archive: %v", err)
+	}
+
+	err = tw.Close()
+	if err != nil {
+		return err
+	}
+	err = gz.Close()
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// Upload uploads the file at filename to the object in the bucket. It gives
+// up when ctx is done.
+func (g *GCP) Upload(ctx context.Context, filename, bucket, object string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("cannot open image: %v", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	query := url.Values{}
+	query.Set("uploadType", "media")
+	query.Set("name", object)
+	u := fmt.Sprintf("%s/upload/storage/v1/b/%s/o?%s", g.endpoints.Storage, url.PathEscape(bucket), query.Encode())
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, f)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = info.Size()
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	return g.do(req, nil)
+}
+
+// DeleteObject deletes the object in the bucket.
+func (g *GCP) DeleteObject(ctx context.Context, bucket, object string) error {
+	u := fmt.Sprintf("%s/storage/v1/b/%s/o/%s", g.endpoints.Storage, url.PathEscape(bucket), url.PathEscape(object))
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, u, nil)
+	if err != nil {
+		return err
+	}
+
+	return g.doWithTimeout(req, nil)
+}
+
+type operation struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Error  *struct {
+		Errors []struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	} `json:"error,omitempty"`
+}
+
+func (op *operation) err() error {
+	if op.Error == nil || len(op.Error.Errors) == 0 {
+		return nil
+	}
+	var messages []string
+	for _, e := range op.Error.Errors {
+		messages = append(messages, fmt.Sprintf("%s: %s", e.Code, e.Message))
+	}
+	return errors.New(strings.Join(messages, "; "))
+}
+
+// Import creates the Compute Engine image imageName in project from the
+// object in the bucket, which must be a gzip-compressed tarball containing
+// disk.raw. If region is set, the image is stored in that region. Import
+// waits for the image to be created, or gives up when ctx is done.
+func (g *GCP) Import(ctx context.Context, bucket, object, project, imageName, region string) error {
+	// Compute Engine reads the disk from Cloud Storage itself, so the
+	// source is always a Google storage URL, even with other endpoints.
+	image := map[string]interface{}{
+		"name": imageName,
+		"rawDisk": map[string]string{
+			"source": fmt.Sprintf("%s/%s/%s", DefaultStorageEndpoint, bucket, object),
+		},
+	}
+	if region != "" {
+		image["storageLocations"] = []string{region}
+	}
+	body, err := json.Marshal(image)
+	if err != nil {
+		return err
+	}
+
+	projectURL := fmt.Sprintf("%s/compute/v1/projects/%s", g.endpoints.Compute, url.PathEscape(project))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, projectURL+"/global/images", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	var op operation
+	err = g.doWithTimeout(req, &op)
+	if err != nil {
+		return err
+	}
+
+	// The wait method returns when the operation is done or after about
+	// two minutes, whichever comes first. It may return earlier, so back
+	// off between the calls.
+	interval := time.Second
+	for op.Status != "DONE" {
+		if op.Name == "" {
+			return errors.New("import operation has no name")
+		}
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, projectURL+"/global/operations/"+url.PathEscape(op.Name)+"/wait", nil)
+		if err != nil {
+			return err
+		}
+		err = g.doWithTimeout(req, &op)
+		if err != nil {
+			return err
+		}
+		if op.Status == "DONE" {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("importing image %s: %v", imageName, ctx.Err())
+		case <-time.After(interval):
+		}
+		interval *= 2
+		if interval > maxPollInterval {
+			interval = maxPollInterval
+		}
+	}
+
+	err = op.err()
+	if err != nil {
+		return fmt.Errorf("importing image %s failed: %v", imageName, err)
+	}
+
+	return nil
+}
+
+// doWithTimeout sends req like do, but gives up after requestTimeout.
+func (g *GCP) doWithTimeout(req *http.Request, v interface{}) error {
+	ctx, cancel := context.WithTimeout(req.Context(), requestTimeout)
+	defer cancel()
+	return g.do(req.WithContext(ctx), v)
+}
+
+// do sends req with an access token and decodes the JSON response into v,
+// if v is not nil. The token is requested with the context of req.
+func (g *GCP) do(req *http.Request, v interface{}) error {
+	if g.credentials != nil {
+		token, err := g.accessToken(req.Context())
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var errorResponse struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		if json.Unmarshal(body, &errorResponse) == nil && errorResponse.Error.Message != "" {
+			return fmt.Errorf("%s %s: %s: %s", req.Method, req.URL.Path, resp.Status, errorResponse.Error.Message)
+		}
+		return fmt.Errorf("%s %s: %s", req.Method, req.URL.Path, resp.Status)
+	}
+
+	if v == nil {
+		return nil
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(v)
+	if err != nil {
+		return fmt.Errorf("cannot parse response of %s %s: %v", req.Method, req.URL.Path, err)
+	}
+	return nil
+}
+
+// accessToken returns an access token for the service account, exchanging
+// a signed JWT for a new one when the last one expired.
+func (g *GCP) accessToken(ctx context.Context) (string, error) {
+	now := time.Now()
+	if g.token != "" && now.Before(g.tokenExpires) {
+		return g.token, nil
+	}
+
+	assertion, err := g.signedJWT(now)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+	form.Set("assertion", assertion)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.credentials.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("cannot get access token: %s", resp.Status)
+	}
+
+	var tokenResponse struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&tokenResponse)
+	if err != nil {
+		return "", fmt.Errorf("cannot parse token response: %v", err)
+	}
+	if tokenResponse.AccessToken == "" {
+		return "", errors.New("token response does not contain a token")
+	}
+
+	g.token = tokenResponse.AccessToken
+	// renew the token a minute before it expires
+	g.tokenExpires = now.Add(time.Duration(tokenResponse.ExpiresIn)*time.Second - time.Minute)
+	return g.token, nil
+}
+
+// signedJWT returns the JWT which is exchanged for an access token, as
+// described in https://developers.google.com/identity/protocols/oauth2/service-account
+func (g *GCP) signedJWT(now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{
+		"alg": "RS256",
+		"typ": "JWT",
+	})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		"iss":   g.credentials.ClientEmail,
+		"scope": cloudPlatformScope,
+		"aud":   g.credentials.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	sum := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, g.privateKey, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", fmt.Errorf("cannot sign token request: %v", err)
+	}
+
+	return unsigned + "." + enc.EncodeToString(signature), nil
+}
@@ -0,0 +1,292 @@
+package gcp_test
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/osbuild-composer/internal/upload/gcp"
+)
+
+// fakeGoogle implements the token endpoint and the parts of the Cloud
+// Storage and Compute Engine APIs used by the gcp package.
+type fakeGoogle struct {
+	mu        sync.Mutex
+	publicKey *rsa.PublicKey
+	objects   map[string][]byte
+	images    map[string]map[string]interface{}
+	waits     int
+	tokens    int
+	failWith  string
+	running   bool
+}
+
+func (f *fakeGoogle) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.URL.Path == "/token" {
+		f.serveToken(w, r)
+		return
+	}
+
+	if f.publicKey != nil && r.Header.Get("Authorization") != "Bearer access-token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"error":{"message":"invalid credentials"}}`))
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/upload/storage/v1/b/bucket/o":
+		if r.URL.Query().Get("uploadType") != "media" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		data, _ := ioutil.ReadAll(r.Body)
+		f.objects[r.URL.Query().Get("name")] = data
+		_, _ = w.Write([]byte(`{"name":"` + r.URL.Query().Get("name") + `"}`))
+	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/storage/v1/b/bucket/o/"):
+		name := strings.TrimPrefix(r.URL.Path, "/storage/v1/b/bucket/o/")
+		if _, ok := f.objects[name]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(f.objects, name)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPost && r.URL.Path == "/compute/v1/projects/project/global/images":
+		var image map[string]interface{}
+		err := json.NewDecoder(r.Body).Decode(&image)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.images[image["name"].(string)] = image
+		_, _ = w.Write([]byte(`{"name":"operation-1","status":"RUNNING"}`))
+	case r.Method == http.MethodPost && r.URL.Path == "/compute/v1/projects/project/global/operations/operation-1/wait":
+		f.waits += 1
+		if f.waits < 2 || f.running {
+			_, _ = w.Write([]byte(`{"name":"operation-1","status":"RUNNING"}`))
+		} else if f.failWith != "" {
+			_, _ = w.Write([]byte(`{"name":"operation-1","status":"DONE","error":{"errors":[{"code":"INVALID","message":"` + f.failWith + `"}]}}`))
+		} else {
+			_, _ = w.Write([]byte(`{"name":"operation-1","status":"DONE"}`))
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (f *fakeGoogle) serveToken(w http.ResponseWriter, r *http.Request) {
+	if r.FormValue("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	parts := strings.Split(r.FormValue("assertion"), ".")
+	if len(parts) != 3 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	sum := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if rsa.VerifyPKCS1v15(f.publicKey, crypto.SHA256, sum[:], signature) != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	claimsJSON, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	var claims map[string]interface{}
+	if json.Unmarshal(claimsJSON, &claims) != nil || claims["iss"] != "composer@project.iam.gserviceaccount.com" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	f.tokens += 1
+	_, _ = w.Write([]byte(`{"access_token":"access-token","expires_in":3600,"token_type":"Bearer"}`))
+}
+
+func newFakeGoogle(t *testing.T) (*fakeGoogle, *httptest.Server, []byte) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+
+	fake := &fakeGoogle{
+		publicKey: &key.PublicKey,
+		objects:   make(map[string][]byte),
+		images:    make(map[string]map[string]interface{}),
+	}
+	server := httptest.NewServer(fake)
+
+	privateKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	credentials, err := json.Marshal(map[string]string{
+		"type":         "service_account",
+		"project_id":   "project",
+		"client_email": "composer@project.iam.gserviceaccount.com",
+		"private_key":  string(privateKey),
+		"token_uri":    server.URL + "/token",
+	})
+	require.NoError(t, err)
+
+	return fake, server, credentials
+}
+
+func TestUploadAndImport(t *testing.T) {
+	fake, server, credentials := newFakeGoogle(t)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "osbuild-gcp-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "image.tar.gz")
+	require.NoError(t, ioutil.WriteFile(filename, []byte("image"), 0600))
+
+	g, err := gcp.NewWithEndpoints(credentials, gcp.Endpoints{Storage: server.URL, Compute: server.URL})
+	require.NoError(t, err)
+	require.Equal(t, "project", g.ProjectID())
+
+	err = g.Upload(context.Background(), filename, "bucket", "image.tar.gz")
+	require.NoError(t, err)
+	require.Equal(t, []byte("image"), fake.objects["image.tar.gz"])
+
+	err = g.Import(context.Background(), "bucket", "image.tar.gz", "project", "my-image", "europe-west3")
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"name": "my-image",
+		"rawDisk": map[string]interface{}{
+			"source": "https://storage.googleapis.com/bucket/image.tar.gz",
+		},
+		"storageLocations": []interface{}{"europe-west3"},
+	}, fake.images["my-image"])
+	require.Equal(t, 2, fake.waits)
+
+	err = g.DeleteObject(context.Background(), "bucket", "image.tar.gz")
+	require.NoError(t, err)
+	require.Empty(t, fake.objects)
+
+	err = g.DeleteObject(context.Background(), "bucket", "image.tar.gz")
+	require.Error(t, err)
+
+	// the access token is reused until it expires
+	require.Equal(t, 1, fake.tokens)
+}
+
+func TestImportFailure(t *testing.T) {
+	fake, server, credentials := newFakeGoogle(t)
+	defer server.Close()
+	fake.failWith = "not a valid image"
+
+	g, err := gcp.NewWithEndpoints(credentials, gcp.Endpoints{Storage: server.URL, Compute: server.URL})
+	require.NoError(t, err)
+
+	err = g.Import(context.Background(), "bucket", "image.tar.gz", "project", "my-image", "")
+	require.EqualError(t, err, "importing image my-image failed: INVALID: not a valid image")
+}
+
+func TestImportTimeout(t *testing.T) {
+	fake, server, credentials := newFakeGoogle(t)
+	defer server.Close()
+	fake.running = true
+
+	g, err := gcp.NewWithEndpoints(credentials, gcp.Endpoints{Storage: server.URL, Compute: server.URL})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	err = g.Import(ctx, "bucket", "image.tar.gz", "project", "my-image", "")
+	require.EqualError(t, err, "importing image my-image: context deadline exceeded")
+
+	// the wait method is polled with a growing interval: right away, and
+	// after one second
+	require.Equal(t, 2, fake.waits)
+}
+
+func TestUnauthenticated(t *testing.T) {
+	fake, server, _ := newFakeGoogle(t)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "osbuild-gcp-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "image.tar.gz")
+	require.NoError(t, ioutil.WriteFile(filename, []byte("image"), 0600))
+
+	g, err := gcp.NewWithEndpoints(nil, gcp.Endpoints{Storage: server.URL, Compute: server.URL})
+	require.NoError(t, err)
+
+	err = g.Upload(context.Background(), filename, "bucket", "image.tar.gz")
+	require.EqualError(t, err, "POST /upload/storage/v1/b/bucket/o: 401 Unauthorized: invalid credentials")
+
+	// emulators of the storage API don't require authentication
+	fake.publicKey = nil
+	err = g.Upload(context.Background(), filename, "bucket", "image.tar.gz")
+	require.NoError(t, err)
+}
+
+func TestInvalidCredentials(t *testing.T) {
+	_, err := gcp.New([]byte(`{`))
+	require.Error(t, err)
+
+	_, err = gcp.New([]byte(`{"client_email":"composer@project.iam.gserviceaccount.com"}`))
+	require.Error(t, err)
+
+	_, err = gcp.New([]byte(`{"client_email":"composer@project.iam.gserviceaccount.com","private_key":"not a key"}`))
+	require.Error(t, err)
+}
+
+func TestNoCredentials(t *testing.T) {
+	_, err := gcp.New(nil)
+	require.EqualError(t, err, "no GCP credentials given")
+}
+
+func TestWriteImageArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "osbuild-gcp-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	diskPath := filepath.Join(dir, "image.raw")
+	require.NoError(t, ioutil.WriteFile(diskPath, []byte("raw disk"), 0600))
+	archivePath := filepath.Join(dir, "image.tar.gz")
+
+	err = gcp.WriteImageArchive(diskPath, archivePath)
+	require.NoError(t, err)
+
+	f, err := os.Open(archivePath)
+	require.NoError(t, err)
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	tr := tar.NewReader(gz)
+
+	header, err := tr.Next()
+	require.NoError(t, err)
+	require.Equal(t, "disk.raw", header.Name)
+	data, err := ioutil.ReadAll(tr)
+	require.NoError(t, err)
+	require.Equal(t, "raw disk", string(data))
+
+	_, err = tr.Next()
+	require.Equal(t, io.EOF, err)
+}
@@ -0,0 +1,131 @@
+// Package openstack uploads images to the Glance image service of an
+// OpenStack cloud.
+package openstack
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack"
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/imagedata"
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
+)
+
+// WaitTimeout is how long to wait for an uploaded image to become active,
+// in seconds.
+const WaitTimeout = 600
+
+// AuthOptions describe how to authenticate against the identity service
+// (Keystone) and which region the image service is taken from.
+type AuthOptions struct {
+	AuthURL     string
+	Username    string
+	Password    string
+	DomainName  string
+	ProjectName string
+	ProjectID   string
+	Region      string
+}
+
+// ImageOptions describe the image created in Glance.
+type ImageOptions struct {
+	Name       string
+	DiskFormat string
+	Visibility string
+	Properties map[string]string
+}
+
+type OpenStack struct {
+	client *gophercloud.ServiceClient
+}
+
+// New authenticates and looks up the image service in the catalog.
+func New(options AuthOptions) (*OpenStack, error) {
+	provider, err := openstack.AuthenticatedClient(gophercloud.AuthOptions{
+		IdentityEndpoint: options.AuthURL,
+		Username:         options.Username,
+		Password:         options.Password,
+		DomainName:       options.DomainName,
+		TenantName:       options.ProjectName,
+		TenantID:         options.ProjectID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot authenticate to OpenStack: %v", err)
+	}
+
+	client, err := openstack.NewImageServiceV2(provider, gophercloud.EndpointOpts{
+		Region: options.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot find the image service: %v", err)
+	}
+
+	return &OpenStack{client}, nil
+}
+
+// UploadImage creates an image, uploads the file at imagePath as its data
+// and waits until it becomes active. It returns the ID of the image. If any
+// of the steps fails, the image is deleted again.
+func (o *OpenStack) UploadImage(imagePath string, options ImageOptions) (string, error) {
+	f, err := os.Open(imagePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if options.DiskFormat == "" {
+		return "", errors.New("no disk format given")
+	}
+
+	createOpts := images.CreateOpts{
+		Name:            options.Name,
+		DiskFormat:      options.DiskFormat,
+		ContainerFormat: "bare",
+		Properties:      options.Properties,
+	}
+	if options.Visibility != "" {
+		visibility := images.ImageVisibility(options.Visibility)
+		createOpts.Visibility = &visibility
+	}
+
+	image, err := images.Create(o.client, createOpts).Extract()
+	if err != nil {
+		return "", fmt.Errorf("creating the image failed: %v", err)
+	}
+
+	err = o.upload(image.ID, f)
+	if err != nil {
+		deleteErr := images.Delete(o.client, image.ID).ExtractErr()
+		if deleteErr != nil {
+			return "", fmt.Errorf("%v (deleting the image failed as well: %v)", err, deleteErr)
+		}
+		return "", err
+	}
+
+	return image.ID, nil
+}
+
+func (o *OpenStack) upload(imageID string, f *os.File) error {
+	err := imagedata.Upload(o.client, imageID, f).ExtractErr()
+	if err != nil {
+		return fmt.Errorf("uploading the image data failed: %v", err)
+	}
+
+	err = gophercloud.WaitFor(WaitTimeout, func() (bool, error) {
+		image, err := images.Get(o.client, imageID).Extract()
+		if err != nil {
+			return false, err
+		}
+		if image.Status == images.ImageStatusKilled || image.Status == images.ImageStatusDeleted {
+			return false, fmt.Errorf("the image is %s", image.Status)
+		}
+		return image.Status == images.ImageStatusActive, nil
+	})
+	if err != nil {
+		return fmt.Errorf("waiting for the image to become active failed: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,240 @@
+package openstack_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/osbuild-composer/internal/upload/openstack"
+)
+
+// fakeOpenStack implements the parts of the Keystone v3 and Glance v2 APIs
+// used by the openstack package.
+type fakeOpenStack struct {
+	mu     sync.Mutex
+	url    string
+	images map[string]map[string]interface{}
+	data   map[string][]byte
+
+	// status an image gets after its data is uploaded
+	uploadedStatus string
+}
+
+func (f *fakeOpenStack) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.URL.Path == "/identity/v3/auth/tokens" && r.Method == http.MethodPost {
+		f.serveToken(w, r)
+		return
+	}
+
+	if r.Header.Get("X-Auth-Token") != "token" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/image/v2/images":
+		var image map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&image); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		id := fmt.Sprintf("image-%d", len(f.images)+1)
+		image["id"] = id
+		image["status"] = "queued"
+		f.images[id] = image
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(image)
+
+	case strings.HasPrefix(r.URL.Path, "/image/v2/images/"):
+		id := strings.TrimPrefix(r.URL.Path, "/image/v2/images/")
+		upload := strings.HasSuffix(id, "/file")
+		id = strings.TrimSuffix(id, "/file")
+		image, ok := f.images[id]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		switch {
+		case upload && r.Method == http.MethodPut:
+			data, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			f.data[id] = data
+			image["status"] = f.uploadedStatus
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(image)
+		case r.Method == http.MethodDelete:
+			delete(f.images, id)
+			delete(f.data, id)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "unexpected method", http.StatusMethodNotAllowed)
+		}
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeOpenStack) serveToken(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Auth struct {
+			Identity struct {
+				Password struct {
+					User struct {
+						Name     string `json:"name"`
+						Password string `json:"password"`
+					} `json:"user"`
+				} `json:"password"`
+			} `json:"identity"`
+		} `json:"auth"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	user := req.Auth.Identity.Password.User
+	if user.Name != "admin" || user.Password != "secret" {
+		http.Error(w, `{"error":{"code":401}}`, http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("X-Subject-Token", "token")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"token": map[string]interface{}{
+			"expires_at": "2099-01-01T00:00:00.000000Z",
+			"catalog": []interface{}{
+				map[string]interface{}{
+					"type": "image",
+					"name": "glance",
+					"endpoints": []interface{}{
+						map[string]interface{}{
+							"interface": "public",
+							"region":    "RegionOne",
+							"region_id": "RegionOne",
+							"url":       f.url + "/image/",
+						},
+					},
+				},
+			},
+		},
+	})
+}
+
+func newFakeOpenStack() (*fakeOpenStack, *httptest.Server, openstack.AuthOptions) {
+	f := &fakeOpenStack{
+		images:         make(map[string]map[string]interface{}),
+		data:           make(map[string][]byte),
+		uploadedStatus: "active",
+	}
+	server := httptest.NewServer(f)
+	f.url = server.URL
+
+	return f, server, openstack.AuthOptions{
+		AuthURL:     server.URL + "/identity/v3/",
+		Username:    "admin",
+		Password:    "secret",
+		DomainName:  "Default",
+		ProjectName: "images",
+		Region:      "RegionOne",
+	}
+}
+
+func writeImage(t *testing.T, dir string) string {
+	imagePath := filepath.Join(dir, "disk.qcow2")
+	err := ioutil.WriteFile(imagePath, []byte("qcow2 image"), 0600)
+	require.NoError(t, err)
+	return imagePath
+}
+
+func TestUploadImage(t *testing.T) {
+	f, server, authOptions := newFakeOpenStack()
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "openstack-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	o, err := openstack.New(authOptions)
+	require.NoError(t, err)
+
+	id, err := o.UploadImage(writeImage(t, dir), openstack.ImageOptions{
+		Name:       "my-image",
+		DiskFormat: "qcow2",
+		Visibility: "shared",
+		Properties: map[string]string{"os_distro": "rhel"},
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, []byte("qcow2 image"), f.data[id])
+	image := f.images[id]
+	require.Equal(t, "my-image", image["name"])
+	require.Equal(t, "qcow2", image["disk_format"])
+	require.Equal(t, "bare", image["container_format"])
+	require.Equal(t, "shared", image["visibility"])
+	require.Equal(t, "rhel", image["os_distro"])
+}
+
+func TestUploadImageKilled(t *testing.T) {
+	f, server, authOptions := newFakeOpenStack()
+	defer server.Close()
+	f.uploadedStatus = "killed"
+
+	dir, err := ioutil.TempDir("", "openstack-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	o, err := openstack.New(authOptions)
+	require.NoError(t, err)
+
+	_, err = o.UploadImage(writeImage(t, dir), openstack.ImageOptions{Name: "my-image", DiskFormat: "qcow2"})
+	require.Error(t, err)
+
+	// the broken image is cleaned up
+	require.Empty(t, f.images)
+}
+
+func TestUploadImageWithoutDiskFormat(t *testing.T) {
+	f, server, authOptions := newFakeOpenStack()
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "openstack-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	o, err := openstack.New(authOptions)
+	require.NoError(t, err)
+
+	_, err = o.UploadImage(writeImage(t, dir), openstack.ImageOptions{Name: "my-image"})
+	require.EqualError(t, err, "no disk format given")
+	require.Empty(t, f.images)
+}
+
+func TestWrongPassword(t *testing.T) {
+	_, server, authOptions := newFakeOpenStack()
+	defer server.Close()
+	authOptions.Password = "wrong"
+
+	_, err := openstack.New(authOptions)
+	require.Error(t, err)
+}
@@ -1,11 +1,62 @@
 package vmware
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
 	"os"
 	"os/exec"
 	"strings"
+	"text/template"
+	"time"
+
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/nfc"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/ovf"
+	"github.com/vmware/govmomi/session"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/govmomi/vim25/types"
 )
 
+// ImportTimeout is how long UploadImage may take to import an image
+const ImportTimeout = time.Hour
+
+// Options describe where in vSphere images are imported to.
+type Options struct {
+	Host       string
+	Username   string
+	Password   string
+	Datacenter string
+	Cluster    string
+	Datastore  string
+	Folder     string
+	TLSVerify  bool
+	Hardware   Hardware
+}
+
+// Hardware describes the virtual machine of imported templates. Fields
+// which are not set default to 2 virtual CPUs, 2048 MiB of memory and the
+// hardware version of vSphere 6.5 (vmx-13).
+type Hardware struct {
+	CPUs     int
+	MemoryMB int
+	Version  string
+}
+
+// A Template is a template created by ImportTemplate.
+type Template struct {
+	Name string
+	// The managed object ID of the template, e.g. "vm-42"
+	ID string
+}
+
 func OpenAsStreamOptimizedVmdk(imagePath string) (*os.File, error) {
 	newPath := strings.TrimSuffix(imagePath, ".vmdk") + "-stream.vmdk"
 	cmd := exec.Command(
@@ -21,3 +72,299 @@ func OpenAsStreamOptimizedVmdk(imagePath string) (*os.File, error) {
 	}
 	return f, err
 }
+
+// UploadImage converts the VMDK at imagePath to a stream-optimized one and
+// imports it as the template name, giving up after ImportTimeout.
+func UploadImage(options Options, imagePath, name string) (*Template, error) {
+	f, err := OpenAsStreamOptimizedVmdk(imagePath)
+	if err != nil {
+		return nil, fmt.Errorf("converting to a stream optimized vmdk failed: %v", err)
+	}
+	streamPath := f.Name()
+	f.Close()
+	defer os.Remove(streamPath)
+
+	ctx, cancel := context.WithTimeout(context.Background(), ImportTimeout)
+	defer cancel()
+
+	return ImportTemplate(ctx, options, streamPath, name)
+}
+
+// ImportTemplate imports the stream-optimized VMDK at streamPath as the disk
+// of a new virtual machine called name and marks it as a template.
+func ImportTemplate(ctx context.Context, options Options, streamPath, name string) (*Template, error) {
+	u, err := soap.ParseURL(options.Host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid vSphere host: %v", err)
+	}
+	u.User = url.UserPassword(options.Username, options.Password)
+
+	client, err := vim25.NewClient(ctx, soap.NewClient(u, !options.TLSVerify))
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to vSphere: %v", err)
+	}
+
+	sessionManager := session.NewManager(client)
+	err = sessionManager.Login(ctx, u.User)
+	if err != nil {
+		return nil, fmt.Errorf("cannot log into vSphere: %v", err)
+	}
+	defer func() {
+		_ = sessionManager.Logout(ctx)
+	}()
+
+	return importTemplate(ctx, &govmomiClient{client}, options, streamPath, name)
+}
+
+// vSphere is the part of the vSphere API templates are imported with
+type vSphere interface {
+	// importVM creates a virtual machine as described by the OVF
+	// descriptor in the location of options, uploads the content of its
+	// only disk, and returns its managed object ID
+	importVM(ctx context.Context, options Options, descriptor, name string, disk io.Reader, size int64) (string, error)
+
+	markAsTemplate(ctx context.Context, id string) error
+}
+
+func importTemplate(ctx context.Context, c vSphere, options Options, streamPath, name string) (*Template, error) {
+	disk, err := readDiskInfo(streamPath)
+	if err != nil {
+		return nil, err
+	}
+	disk.Name = name
+	disk.Hardware = options.Hardware
+	if disk.Hardware.CPUs == 0 {
+		disk.Hardware.CPUs = 2
+	}
+	if disk.Hardware.MemoryMB == 0 {
+		disk.Hardware.MemoryMB = 2048
+	}
+	if disk.Hardware.Version == "" {
+		disk.Hardware.Version = "vmx-13"
+	}
+
+	var descriptor bytes.Buffer
+	err = ovfTemplate.Execute(&descriptor, disk)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(streamPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	id, err := c.importVM(ctx, options, descriptor.String(), name, f, disk.Size)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.markAsTemplate(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("marking the virtual machine as template failed: %v", err)
+	}
+
+	return &Template{
+		Name: name,
+		ID:   id,
+	}, nil
+}
+
+// govmomiClient implements vSphere with a logged in govmomi client
+type govmomiClient struct {
+	client *vim25.Client
+}
+
+func (c *govmomiClient) importVM(ctx context.Context, options Options, descriptor, name string, disk io.Reader, size int64) (string, error) {
+	finder := find.NewFinder(c.client, true)
+	datacenter, err := finder.DatacenterOrDefault(ctx, options.Datacenter)
+	if err != nil {
+		return "", err
+	}
+	finder.SetDatacenter(datacenter)
+
+	datastore, err := finder.DatastoreOrDefault(ctx, options.Datastore)
+	if err != nil {
+		return "", err
+	}
+
+	var pool *object.ResourcePool
+	if options.Cluster != "" {
+		pool, err = finder.ResourcePool(ctx, options.Cluster+"/Resources")
+	} else {
+		pool, err = finder.DefaultResourcePool(ctx)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	folder, err := finder.FolderOrDefault(ctx, options.Folder)
+	if err != nil {
+		return "", err
+	}
+
+	spec, err := ovf.NewManager(c.client).CreateImportSpec(ctx, descriptor, pool, datastore, types.OvfCreateImportSpecParams{
+		DiskProvisioning: string(types.VirtualDiskTypeThin),
+		EntityName:       name,
+	})
+	if err != nil {
+		return "", err
+	}
+	if spec.Error != nil {
+		return "", errors.New(spec.Error[0].LocalizedMessage)
+	}
+
+	lease, err := pool.ImportVApp(ctx, spec.ImportSpec, folder, nil)
+	if err != nil {
+		return "", err
+	}
+
+	info, err := lease.Wait(ctx, spec.FileItem)
+	if err != nil {
+		return "", err
+	}
+
+	err = uploadDisk(ctx, lease, info, disk, size)
+	if err != nil {
+		_ = lease.Abort(ctx, nil)
+		return "", fmt.Errorf("uploading the vmdk failed: %v", err)
+	}
+
+	err = lease.Complete(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return info.Entity.Value, nil
+}
+
+func (c *govmomiClient) markAsTemplate(ctx context.Context, id string) error {
+	vm := object.NewVirtualMachine(c.client, types.ManagedObjectReference{
+		Type:  "VirtualMachine",
+		Value: id,
+	})
+	return vm.MarkAsTemplate(ctx)
+}
+
+func uploadDisk(ctx context.Context, lease *nfc.Lease, info *nfc.LeaseInfo, disk io.Reader, size int64) error {
+	updater := lease.StartUpdater(ctx, info)
+	defer updater.Done()
+
+	// the descriptor only contains a single disk
+	return lease.Upload(ctx, info.Items[0], disk, soap.Upload{ContentLength: size})
+}
+
+type diskInfo struct {
+	Name     string
+	Size     int64
+	Capacity uint64
+	Hardware Hardware
+}
+
+// readDiskInfo checks that the VMDK at path is stream-optimized and returns
+// the sizes needed for the OVF descriptor.
+func readDiskInfo(path string) (*diskInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var header struct {
+		MagicNumber uint32
+		Version     uint32
+		Flags       uint32
+		Capacity    uint64
+	}
+	err = binary.Read(f, binary.LittleEndian, &header)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the vmdk header: %v", err)
+	}
+
+	// SPARSE_MAGICNUMBER and SPARSEFLAG_COMPRESSED
+	if header.MagicNumber != 0x564d444b || header.Flags&(1<<16) == 0 {
+		return nil, errors.New("the vmdk is not stream optimized")
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	return &diskInfo{
+		Size:     fi.Size(),
+		Capacity: header.Capacity * 512,
+	}, nil
+}
+
+// ovfTemplate describes a virtual machine with a single stream-optimized
+// disk attached to a paravirtual SCSI controller.
+var ovfTemplate = template.Must(template.New("ovf").Funcs(template.FuncMap{
+	"xml": func(s string) (string, error) {
+		var b bytes.Buffer
+		err := xml.EscapeText(&b, []byte(s))
+		return b.String(), err
+	},
+}).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<Envelope xmlns="http://schemas.dmtf.org/ovf/envelope/1"
+          xmlns:ovf="http://schemas.dmtf.org/ovf/envelope/1"
+          xmlns:rasd="http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_ResourceAllocationSettingData"
+          xmlns:vmw="http://www.vmware.com/schema/ovf"
+          xmlns:vssd="http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_VirtualSystemSettingData">
+  <References>
+    <File ovf:href="disk.vmdk" ovf:id="file1" ovf:size="{{ .Size }}"/>
+  </References>
+  <DiskSection>
+    <Info>Virtual disk information</Info>
+    <Disk ovf:capacity="{{ .Capacity }}" ovf:capacityAllocationUnits="byte" ovf:diskId="vmdisk1" ovf:fileRef="file1" ovf:format="http://www.vmware.com/interfaces/specifications/vmdk.html#streamOptimized"/>
+  </DiskSection>
+  <VirtualSystem ovf:id="{{ xml .Name }}">
+    <Info>A virtual machine</Info>
+    <Name>{{ xml .Name }}</Name>
+    <OperatingSystemSection ovf:id="101" vmw:osType="otherLinux64Guest">
+      <Info>The kind of installed guest operating system</Info>
+    </OperatingSystemSection>
+    <VirtualHardwareSection>
+      <Info>Virtual hardware requirements</Info>
+      <System>
+        <vssd:ElementName>Virtual Hardware Family</vssd:ElementName>
+        <vssd:InstanceID>0</vssd:InstanceID>
+        <vssd:VirtualSystemIdentifier>{{ xml .Name }}</vssd:VirtualSystemIdentifier>
+        <vssd:VirtualSystemType>{{ xml .Hardware.Version }}</vssd:VirtualSystemType>
+      </System>
+      <Item>
+        <rasd:AllocationUnits>hertz * 10^6</rasd:AllocationUnits>
+        <rasd:Description>Number of Virtual CPUs</rasd:Description>
+        <rasd:ElementName>{{ .Hardware.CPUs }} virtual CPU(s)</rasd:ElementName>
+        <rasd:InstanceID>1</rasd:InstanceID>
+        <rasd:ResourceType>3</rasd:ResourceType>
+        <rasd:VirtualQuantity>{{ .Hardware.CPUs }}</rasd:VirtualQuantity>
+      </Item>
+      <Item>
+        <rasd:AllocationUnits>byte * 2^20</rasd:AllocationUnits>
+        <rasd:Description>Memory Size</rasd:Description>
+        <rasd:ElementName>{{ .Hardware.MemoryMB }}MB of memory</rasd:ElementName>
+        <rasd:InstanceID>2</rasd:InstanceID>
+        <rasd:ResourceType>4</rasd:ResourceType>
+        <rasd:VirtualQuantity>{{ .Hardware.MemoryMB }}</rasd:VirtualQuantity>
+      </Item>
+      <Item>
+        <rasd:Address>0</rasd:Address>
+        <rasd:Description>SCSI Controller</rasd:Description>
+        <rasd:ElementName>SCSI Controller 0</rasd:ElementName>
+        <rasd:InstanceID>3</rasd:InstanceID>
+        <rasd:ResourceSubType>VirtualSCSI</rasd:ResourceSubType>
+        <rasd:ResourceType>6</rasd:ResourceType>
+      </Item>
+      <Item>
+        <rasd:AddressOnParent>0</rasd:AddressOnParent>
+        <rasd:ElementName>Hard Disk 1</rasd:ElementName>
+        <rasd:HostResource>ovf:/disk/vmdisk1</rasd:HostResource>
+        <rasd:InstanceID>4</rasd:InstanceID>
+        <rasd:Parent>3</rasd:Parent>
+        <rasd:ResourceType>17</rasd:ResourceType>
+      </Item>
+    </VirtualHardwareSection>
+  </VirtualSystem>
+</Envelope>`))
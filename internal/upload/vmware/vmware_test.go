@@ -0,0 +1,148 @@
+package vmware
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeVSphere records the virtual machines imported into it
+type fakeVSphere struct {
+	descriptor string
+	disk       []byte
+	templates  []string
+
+	importErr error
+}
+
+func (f *fakeVSphere) importVM(ctx context.Context, options Options, descriptor, name string, disk io.Reader, size int64) (string, error) {
+	if f.importErr != nil {
+		return "", f.importErr
+	}
+
+	data, err := ioutil.ReadAll(disk)
+	if err != nil {
+		return "", err
+	}
+	if int64(len(data)) != size {
+		return "", errors.New("wrong disk size")
+	}
+
+	f.descriptor = descriptor
+	f.disk = data
+	return "vm-42", nil
+}
+
+func (f *fakeVSphere) markAsTemplate(ctx context.Context, id string) error {
+	f.templates = append(f.templates, id)
+	return nil
+}
+
+// writeStreamOptimizedVmdk writes just enough of a stream-optimized sparse
+// extent header for the import to accept the file.
+func writeStreamOptimizedVmdk(t *testing.T, dir string) string {
+	header := struct {
+		MagicNumber uint32
+		Version     uint32
+		Flags       uint32
+		Capacity    uint64
+	}{
+		MagicNumber: 0x564d444b,
+		Version:     3,
+		Flags:       1 << 16,
+		Capacity:    2048,
+	}
+
+	streamPath := filepath.Join(dir, "disk.vmdk")
+	f, err := os.Create(streamPath)
+	require.NoError(t, err)
+	defer f.Close()
+
+	err = binary.Write(f, binary.LittleEndian, header)
+	require.NoError(t, err)
+	_, err = f.Write(make([]byte, 512))
+	require.NoError(t, err)
+
+	return streamPath
+}
+
+func TestImportTemplate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vmware-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	streamPath := writeStreamOptimizedVmdk(t, dir)
+
+	f := &fakeVSphere{}
+	template, err := importTemplate(context.Background(), f, Options{}, streamPath, "my-template")
+	require.NoError(t, err)
+	require.Equal(t, &Template{Name: "my-template", ID: "vm-42"}, template)
+	require.Equal(t, []string{"vm-42"}, f.templates)
+
+	content, err := ioutil.ReadFile(streamPath)
+	require.NoError(t, err)
+	require.Equal(t, content, f.disk)
+
+	require.Contains(t, f.descriptor, `<Name>my-template</Name>`)
+	require.Contains(t, f.descriptor, `ovf:size="532"`)
+	require.Contains(t, f.descriptor, `ovf:capacity="1048576"`)
+	require.Contains(t, f.descriptor, `<vssd:VirtualSystemType>vmx-13</vssd:VirtualSystemType>`)
+	require.Contains(t, f.descriptor, `<rasd:VirtualQuantity>2</rasd:VirtualQuantity>`)
+	require.Contains(t, f.descriptor, `<rasd:VirtualQuantity>2048</rasd:VirtualQuantity>`)
+}
+
+func TestImportTemplateHardware(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vmware-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	streamPath := writeStreamOptimizedVmdk(t, dir)
+
+	f := &fakeVSphere{}
+	options := Options{
+		Hardware: Hardware{
+			CPUs:     8,
+			MemoryMB: 16384,
+			Version:  "vmx-15",
+		},
+	}
+	_, err = importTemplate(context.Background(), f, options, streamPath, "web & db")
+	require.NoError(t, err)
+
+	require.Contains(t, f.descriptor, `<Name>web &amp; db</Name>`)
+	require.Contains(t, f.descriptor, `<vssd:VirtualSystemType>vmx-15</vssd:VirtualSystemType>`)
+	require.Contains(t, f.descriptor, `<rasd:VirtualQuantity>8</rasd:VirtualQuantity>`)
+	require.Contains(t, f.descriptor, `<rasd:VirtualQuantity>16384</rasd:VirtualQuantity>`)
+}
+
+func TestImportTemplateFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vmware-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	streamPath := writeStreamOptimizedVmdk(t, dir)
+
+	f := &fakeVSphere{importErr: errors.New("datastore full")}
+	_, err = importTemplate(context.Background(), f, Options{}, streamPath, "my-template")
+	require.EqualError(t, err, "datastore full")
+	require.Empty(t, f.templates)
+}
+
+func TestImportTemplateNotStreamOptimized(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vmware-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	streamPath := filepath.Join(dir, "disk.vmdk")
+	err = ioutil.WriteFile(streamPath, []byte("this is not a vmdk at all"), 0600)
+	require.NoError(t, err)
+
+	f := &fakeVSphere{}
+	_, err = importTemplate(context.Background(), f, Options{}, streamPath, "my-template")
+	require.Error(t, err)
+	require.Empty(t, f.templates)
+}
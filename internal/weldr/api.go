@@ -17,6 +17,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/BurntSushi/toml"
@@ -27,7 +28,9 @@ import (
 	"github.com/osbuild/osbuild-composer/internal/common"
 	"github.com/osbuild/osbuild-composer/internal/distro"
 	"github.com/osbuild/osbuild-composer/internal/jobqueue"
+	"github.com/osbuild/osbuild-composer/internal/jsondb"
 	"github.com/osbuild/osbuild-composer/internal/osbuild"
+	"github.com/osbuild/osbuild-composer/internal/ostree"
 	"github.com/osbuild/osbuild-composer/internal/rpmmd"
 	"github.com/osbuild/osbuild-composer/internal/store"
 	"github.com/osbuild/osbuild-composer/internal/target"
@@ -38,15 +41,28 @@ type API struct {
 	store   *store.Store
 	workers *worker.Server
 
-	rpmmd  rpmmd.RPMMD
-	arch   distro.Arch
-	distro distro.Distro
-	repos  []rpmmd.RepoConfig
+	rpmmd   rpmmd.RPMMD
+	arch    distro.Arch
+	distro  distro.Distro
+	distros *distro.Registry
+	repos   []rpmmd.RepoConfig
+	// the repositories of each distribution, by architecture
+	distroRepos map[string]map[string][]rpmmd.RepoConfig
 
 	logger *log.Logger
 	router *httprouter.Router
 
 	compatOutputDir string
+
+	// The commits of composes are pulled into ostreeRepo, if it is set.
+	// ostreePulled are the jobs whose commits were pulled already (true)
+	// or failed to be pulled (false), which are saved in ostreeDB.
+	ostreeRepo   OSTreeRepository
+	ostreeURL    string
+	ostreeDB     *jsondb.JSONDatabase
+	ostreePulled map[uuid.UUID]bool
+	ostreeMu     sync.Mutex
+	ostreePullMu sync.Mutex
 }
 
 // systemRepoIDs returns a list of the system repos
@@ -60,14 +76,20 @@ func (api *API) systemRepoNames() (names []string) {
 
 var ValidBlueprintName = regexp.MustCompile(`^[a-zA-Z0-9._-]+$`)
 
-func New(rpmmd rpmmd.RPMMD, arch distro.Arch, distro distro.Distro, repos []rpmmd.RepoConfig, logger *log.Logger, store *store.Store, workers *worker.Server, compatOutputDir string) *API {
+// New creates a weldr API for the host architecture `arch` (and its
+// distribution). The repositories are keyed by distribution name and
+// architecture; images can be composed for every distribution in `distros`
+// and architecture which has repositories.
+func New(rpmmd rpmmd.RPMMD, arch distro.Arch, distros *distro.Registry, repos map[string]map[string][]rpmmd.RepoConfig, logger *log.Logger, store *store.Store, workers *worker.Server, compatOutputDir string) *API {
 	api := &API{
 		store:           store,
 		workers:         workers,
 		rpmmd:           rpmmd,
 		arch:            arch,
-		distro:          distro,
-		repos:           repos,
+		distro:          arch.Distro(),
+		distros:         distros,
+		repos:           repos[arch.Distro().Name()][arch.Name()],
+		distroRepos:     repos,
 		logger:          logger,
 		compatOutputDir: compatOutputDir,
 	}
@@ -84,6 +106,9 @@ func New(rpmmd rpmmd.RPMMD, arch distro.Arch, distro distro.Distro, repos []rpmm
 	api.router.GET("/api/v:version/projects/source/info/:sources", api.sourceInfoHandler)
 	api.router.POST("/api/v:version/projects/source/new", api.sourceNewHandler)
 	api.router.DELETE("/api/v:version/projects/source/delete/*source", api.sourceDeleteHandler)
+	api.router.GET("/api/v:version/projects/source/snapshots", api.sourceSnapshotsHandler)
+
+	api.router.GET("/api/v:version/distros/list", api.distrosListHandler)
 
 	api.router.GET("/api/v:version/projects/depsolve", api.projectsDepsolveHandler)
 	api.router.GET("/api/v:version/projects/depsolve/*projects", api.projectsDepsolveHandler)
@@ -109,6 +134,10 @@ func New(rpmmd rpmmd.RPMMD, arch distro.Arch, distro distro.Distro, repos []rpmm
 	api.router.POST("/api/v:version/blueprints/workspace", api.blueprintsWorkspaceHandler)
 	api.router.POST("/api/v:version/blueprints/undo/:blueprint/:commit", api.blueprintUndoHandler)
 	api.router.POST("/api/v:version/blueprints/tag/:blueprint", api.blueprintsTagHandler)
+	api.router.GET("/api/v:version/blueprints/lock/:blueprint", api.blueprintsLockfileHandler)
+	api.router.POST("/api/v:version/blueprints/lock/:blueprint", api.blueprintsLockHandler)
+	api.router.GET("/api/v:version/blueprints/export/*blueprints", api.blueprintsExportHandler)
+	api.router.POST("/api/v:version/blueprints/import", api.blueprintsImportHandler)
 	api.router.DELETE("/api/v:version/blueprints/delete/:blueprint", api.blueprintDeleteHandler)
 	api.router.DELETE("/api/v:version/blueprints/workspace/:blueprint", api.blueprintDeleteWorkspaceHandler)
 
@@ -138,6 +167,8 @@ func New(rpmmd rpmmd.RPMMD, arch distro.Arch, distro distro.Distro, repos []rpmm
 	api.router.POST("/api/v:version/upload/providers/save", api.providersSaveHandler)
 	api.router.DELETE("/api/v:version/upload/providers/delete/:provider/:profile", api.providersDeleteHandler)
 
+	api.router.GET("/api/v:version/ostree/commits/*ref", api.ostreeCommitsHandler)
+
 	return api
 }
 
@@ -167,20 +198,77 @@ type composeStatus struct {
 	Started  time.Time
 	Finished time.Time
 	Result   *osbuild.Result
+
+	// What the worker reported about uploading to the targets
+	TargetResults []*target.TargetResult
+
+	// The status of each image build of the compose, in order
+	ImageBuilds []*composeStatus
 }
 
-// Returns the state of the image in `compose` and the times the job was
-// queued, started, and finished. Assumes that there's only one image in the
-// compose.
+// Returns the state of the images in `compose` and the times the jobs were
+// queued, started, and finished. A compose is running until all of its
+// image builds are done and has failed if any of them failed.
 func (api *API) getComposeStatus(compose store.Compose) *composeStatus {
-	jobId := compose.ImageBuild.JobID
+	var builds []*composeStatus
+	for _, ib := range compose.ImageBuilds {
+		builds = append(builds, api.getImageBuildStatus(ib))
+	}
+
+	if len(builds) == 1 {
+		status := *builds[0]
+		status.ImageBuilds = builds
+		return &status
+	}
+
+	status := &composeStatus{
+		State:       common.CFinished,
+		ImageBuilds: builds,
+	}
+	waiting := true
+	for _, build := range builds {
+		switch build.State {
+		case common.CWaiting, common.CRunning:
+			status.State = common.CRunning
+		case common.CFailed:
+			if status.State != common.CRunning {
+				status.State = common.CFailed
+			}
+		}
+		if build.State != common.CWaiting {
+			waiting = false
+		}
+		if status.Queued.IsZero() || build.Queued.Before(status.Queued) {
+			status.Queued = build.Queued
+		}
+		if !build.Started.IsZero() && (status.Started.IsZero() || build.Started.Before(status.Started)) {
+			status.Started = build.Started
+		}
+		if build.Finished.After(status.Finished) {
+			status.Finished = build.Finished
+		}
+	}
+	if waiting {
+		status.State = common.CWaiting
+	}
+	if status.State == common.CWaiting || status.State == common.CRunning {
+		status.Finished = time.Time{}
+	}
+
+	return status
+}
+
+// Returns the state of a single image build and the times its job was
+// queued, started, and finished.
+func (api *API) getImageBuildStatus(ib store.ImageBuild) *composeStatus {
+	jobId := ib.JobID
 
 	// backwards compatibility: composes that were around before splitting
 	// the job queue from the store still contain their valid status and
 	// times. Return those here as a fallback.
 	if jobId == uuid.Nil {
 		var state common.ComposeState
-		switch compose.ImageBuild.QueueStatus {
+		switch ib.QueueStatus {
 		case common.IBWaiting:
 			state = common.CWaiting
 		case common.IBRunning:
@@ -192,9 +280,9 @@ func (api *API) getComposeStatus(compose store.Compose) *composeStatus {
 		}
 		return &composeStatus{
 			State:    state,
-			Queued:   compose.ImageBuild.JobCreated,
-			Started:  compose.ImageBuild.JobStarted,
-			Finished: compose.ImageBuild.JobFinished,
+			Queued:   ib.JobCreated,
+			Started:  ib.JobStarted,
+			Finished: ib.JobFinished,
 			Result:   &osbuild.Result{},
 		}
 	}
@@ -202,27 +290,28 @@ func (api *API) getComposeStatus(compose store.Compose) *composeStatus {
 	// is it ok to ignore this error?
 	jobStatus, _ := api.workers.JobStatus(jobId)
 	return &composeStatus{
-		State:    jobStatus.State,
-		Queued:   jobStatus.Queued,
-		Started:  jobStatus.Started,
-		Finished: jobStatus.Finished,
-		Result:   jobStatus.Result.OSBuildOutput,
+		State:         jobStatus.State,
+		Queued:        jobStatus.Queued,
+		Started:       jobStatus.Started,
+		Finished:      jobStatus.Finished,
+		Result:        jobStatus.Result.OSBuildOutput,
+		TargetResults: jobStatus.Result.TargetResults,
 	}
 }
 
-// Opens the image file for `compose`. This asks the worker server for the
-// artifact first, and then falls back to looking in
+// Opens the image file of the image build `ib` of a compose. This asks the
+// worker server for the artifact first, and then falls back to looking in
 // `{outputs}/{composeId}/{imageBuildId}` for backwards compatibility.
-func (api *API) openImageFile(composeId uuid.UUID, compose store.Compose) (io.Reader, int64, error) {
-	name := compose.ImageBuild.ImageType.Filename()
+func (api *API) openImageFile(composeId uuid.UUID, ib store.ImageBuild) (io.Reader, int64, error) {
+	name := ib.ImageType.Filename()
 
-	reader, size, err := api.workers.JobArtifact(compose.ImageBuild.JobID, name)
+	reader, size, err := api.workers.JobArtifact(ib.JobID, name)
 	if err != nil {
 		if api.compatOutputDir == "" || err != jobqueue.ErrNotExist {
 			return nil, 0, err
 		}
 
-		p := path.Join(api.compatOutputDir, composeId.String(), "0", name)
+		p := path.Join(api.compatOutputDir, composeId.String(), strconv.Itoa(ib.ID), name)
 		f, err := os.Open(p)
 		if err != nil {
 			return nil, 0, err
@@ -240,6 +329,33 @@ func (api *API) openImageFile(composeId uuid.UUID, compose store.Compose) (io.Re
 	return reader, size, nil
 }
 
+// imageBuildFromQuery returns the image build of `compose` which is selected
+// by the "build" query parameter, or the first one if it is not given. It
+// writes the UnknownBuild error to the writer and returns nil if there is no
+// such image build.
+func imageBuildFromQuery(writer http.ResponseWriter, request *http.Request, compose *store.Compose, uuidString string) *store.ImageBuild {
+	id := 0
+	if build := request.URL.Query().Get("build"); build != "" {
+		var err error
+		id, err = strconv.Atoi(build)
+		if err != nil {
+			id = -1
+		}
+	}
+
+	ib := compose.ImageBuild(id)
+	if ib == nil {
+		errors := responseError{
+			ID:  "UnknownBuild",
+			Msg: fmt.Sprintf("Compose %s has no image build %s", uuidString, request.URL.Query().Get("build")),
+		}
+		statusResponseError(writer, http.StatusBadRequest, errors)
+		return nil
+	}
+
+	return ib
+}
+
 func verifyRequestVersion(writer http.ResponseWriter, params httprouter.Params, minVersion uint) bool {
 	versionString := params.ByName("version")
 
@@ -293,9 +409,48 @@ func statusResponseOK(writer http.ResponseWriter) {
 }
 
 type responseError struct {
-	Code int    `json:"code,omitempty"`
-	ID   string `json:"id"`
-	Msg  string `json:"msg"`
+	Code     int                 `json:"code,omitempty"`
+	ID       string              `json:"id"`
+	Msg      string              `json:"msg"`
+	Problems []DepsolveProblemV0 `json:"problems,omitempty"`
+}
+
+// depsolveProblems maps the structured problems of a failed depsolve back to
+// the entries of bp they originate from
+func depsolveProblems(bp *blueprint.Blueprint, err error) []DepsolveProblemV0 {
+	var problems []DepsolveProblemV0
+	for _, p := range rpmmd.DepsolveProblems(err) {
+		problems = append(problems, DepsolveProblemV0{
+			DepsolveProblem: p,
+			Entry:           blueprintEntryForSpec(bp, p.Spec),
+		})
+	}
+	return problems
+}
+
+func blueprintEntryForSpec(bp *blueprint.Blueprint, spec string) *BlueprintEntryV0 {
+	if spec == "" {
+		return nil
+	}
+	for _, pkg := range bp.Packages {
+		if pkg.ToNameVersion() == spec || pkg.Name == spec {
+			return &BlueprintEntryV0{Type: "package", Name: pkg.Name}
+		}
+	}
+	for _, module := range bp.Modules {
+		if stream := module.ModuleStream(); stream != nil && stream.Spec() == spec {
+			return &BlueprintEntryV0{Type: "module", Name: module.Name}
+		}
+		if module.ToNameVersion() == spec || module.Name == spec {
+			return &BlueprintEntryV0{Type: "module", Name: module.Name}
+		}
+	}
+	for _, group := range bp.Groups {
+		if "@"+group.Name == spec {
+			return &BlueprintEntryV0{Type: "group", Name: group.Name}
+		}
+	}
+	return nil
 }
 
 // verifyStringsWithRegex checks a slive of strings against a regex of allowed characters
@@ -613,7 +768,15 @@ func (api *API) sourceNewHandler(writer http.ResponseWriter, request *http.Reque
 		return
 	}
 
-	api.store.PushSource(source.GetKey(), source.SourceConfig())
+	err = api.store.PushSource(source.GetKey(), source.SourceConfig())
+	if err != nil {
+		errors := responseError{
+			ID:  "ProjectsError",
+			Msg: err.Error(),
+		}
+		statusResponseError(writer, http.StatusInternalServerError, errors)
+		return
+	}
 
 	statusResponseOK(writer)
 }
@@ -648,10 +811,19 @@ func (api *API) sourceDeleteHandler(writer http.ResponseWriter, request *http.Re
 	}
 
 	// Only delete the first name, which will have a / at the start because of the /*source route
+	var err error
 	if isRequestVersionAtLeast(params, 1) {
-		api.store.DeleteSourceByID(name[0][1:])
+		err = api.store.DeleteSourceByID(name[0][1:])
 	} else {
-		api.store.DeleteSourceByName(name[0][1:])
+		err = api.store.DeleteSourceByName(name[0][1:])
+	}
+	if err != nil {
+		errors := responseError{
+			ID:  "ProjectsError",
+			Msg: err.Error(),
+		}
+		statusResponseError(writer, http.StatusInternalServerError, errors)
+		return
 	}
 
 	statusResponseOK(writer)
@@ -923,7 +1095,7 @@ func (api *API) projectsDepsolveHandler(writer http.ResponseWriter, request *htt
 	projects = projects[1:]
 	names := strings.Split(projects, ",")
 
-	packages, _, err := api.rpmmd.Depsolve(names, nil, api.repos, api.distro.ModulePlatformID(), api.arch.Name())
+	packages, _, err := api.rpmmd.Depsolve(names, nil, nil, api.repos, api.distro.ModulePlatformID(), api.arch.Name())
 
 	if err != nil {
 		errors := responseError{
@@ -976,6 +1148,9 @@ func (api *API) blueprintsListHandler(writer http.ResponseWriter, request *http.
 	common.PanicOnError(err)
 }
 
+// blueprintsInfoHandler returns blueprints as they were saved, so that they
+// can be edited and pushed again. With flatten=true, the blueprints they
+// include are merged into them.
 func (api *API) blueprintsInfoHandler(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
 	if !verifyRequestVersion(writer, params, 0) {
 		return
@@ -1019,6 +1194,19 @@ func (api *API) blueprintsInfoHandler(writer http.ResponseWriter, request *http.
 		return
 	}
 
+	flatten := false
+	if value := query.Get("flatten"); value != "" {
+		flatten, err = strconv.ParseBool(value)
+		if err != nil {
+			errors := responseError{
+				ID:  "InvalidChars",
+				Msg: fmt.Sprintf("invalid flatten parameter: %s", value),
+			}
+			statusResponseError(writer, http.StatusBadRequest, errors)
+			return
+		}
+	}
+
 	blueprints := []blueprint.Blueprint{}
 	changes := []change{}
 	blueprintErrors := []responseError{}
@@ -1032,6 +1220,17 @@ func (api *API) blueprintsInfoHandler(writer http.ResponseWriter, request *http.
 			})
 			continue
 		}
+		if flatten {
+			resolved, err := api.store.ResolveBlueprint(*blueprint)
+			if err != nil {
+				blueprintErrors = append(blueprintErrors, responseError{
+					ID:  "BlueprintsError",
+					Msg: fmt.Sprintf("%s: %s", name, err.Error()),
+				})
+				continue
+			}
+			blueprint = &resolved
+		}
 		blueprints = append(blueprints, *blueprint)
 		changes = append(changes, change{changed, blueprint.Name})
 	}
@@ -1118,13 +1317,24 @@ func (api *API) blueprintsDepsolveHandler(writer http.ResponseWriter, request *h
 			continue
 		}
 
-		dependencies, _, err := api.depsolveBlueprint(blueprint, nil)
-
+		resolved, err := api.store.ResolveBlueprint(*blueprint)
 		if err != nil {
 			blueprintsErrors = append(blueprintsErrors, responseError{
 				ID:  "BlueprintsError",
 				Msg: fmt.Sprintf("%s: %s", name, err.Error()),
 			})
+			continue
+		}
+		blueprint = &resolved
+
+		dependencies, _, err := api.depsolveBlueprint(blueprint, nil)
+
+		if err != nil {
+			blueprintsErrors = append(blueprintsErrors, responseError{
+				ID:       "BlueprintsError",
+				Msg:      fmt.Sprintf("%s: %s", name, err.Error()),
+				Problems: depsolveProblems(blueprint, err),
+			})
 			dependencies = []rpmmd.PackageSpec{}
 		}
 
@@ -1205,8 +1415,17 @@ func (api *API) blueprintsFreezeHandler(writer http.ResponseWriter, request *htt
 			errors = append(errors, rerr)
 			break
 		}
-		// Make a copy of the blueprint since we will be replacing the version globs
-		blueprint := bp.DeepCopy()
+		// Resolving the includes makes a copy of the blueprint, whose
+		// version globs can be replaced
+		blueprint, err := api.store.ResolveBlueprint(*bp)
+		if err != nil {
+			rerr := responseError{
+				ID:  "BlueprintsError",
+				Msg: fmt.Sprintf("%s: %s", name, err.Error()),
+			}
+			errors = append(errors, rerr)
+			break
+		}
 		dependencies, _, err := api.depsolveBlueprint(&blueprint, nil)
 		if err != nil {
 			rerr := responseError{
@@ -1281,13 +1500,11 @@ func (api *API) blueprintsDiffHandler(writer http.ResponseWriter, request *http.
 		return
 	}
 
-	type pack struct {
-		Package blueprint.Package `json:"Package"`
-	}
-
+	// Whether an entry was added, removed, or changed follows from which
+	// of `new` and `old` are null, as in lorax-composer
 	type diff struct {
-		New *pack `json:"new"`
-		Old *pack `json:"old"`
+		New map[string]interface{} `json:"new"`
+		Old map[string]interface{} `json:"old"`
 	}
 
 	type reply struct {
@@ -1318,7 +1535,19 @@ func (api *API) blueprintsDiffHandler(writer http.ResponseWriter, request *http.
 		statusResponseError(writer, http.StatusNotFound, errors)
 		return
 	}
-	if fromCommit != "NEWEST" {
+
+	// Fetch old and new blueprint details from store and return error if not found
+	if api.store.GetBlueprintCommitted(name) == nil {
+		errors := responseError{
+			ID:  "UnknownBlueprint",
+			Msg: fmt.Sprintf("Unknown blueprint name: %s", name),
+		}
+		statusResponseError(writer, http.StatusNotFound, errors)
+		return
+	}
+
+	oldBlueprint := api.getBlueprintAtCommit(name, fromCommit)
+	if oldBlueprint == nil {
 		errors := responseError{
 			ID:  "UnknownCommit",
 			Msg: fmt.Sprintf("ggit-error: revspec '%s' not found (-3)", fromCommit),
@@ -1326,7 +1555,8 @@ func (api *API) blueprintsDiffHandler(writer http.ResponseWriter, request *http.
 		statusResponseError(writer, http.StatusBadRequest, errors)
 		return
 	}
-	if toCommit != "WORKSPACE" {
+	newBlueprint := api.getBlueprintAtCommit(name, toCommit)
+	if newBlueprint == nil {
 		errors := responseError{
 			ID:  "UnknownCommit",
 			Msg: fmt.Sprintf("ggit-error: revspec '%s' not found (-3)", toCommit),
@@ -1335,48 +1565,47 @@ func (api *API) blueprintsDiffHandler(writer http.ResponseWriter, request *http.
 		return
 	}
 
-	// Fetch old and new blueprint details from store and return error if not found
-	oldBlueprint := api.store.GetBlueprintCommitted(name)
-	newBlueprint, _ := api.store.GetBlueprint(name)
-	if oldBlueprint == nil || newBlueprint == nil {
-		errors := responseError{
-			ID:  "UnknownBlueprint",
-			Msg: fmt.Sprintf("Unknown blueprint name: %s", name),
+	diffs := []diff{}
+	for _, entry := range blueprint.Diff(oldBlueprint, newBlueprint) {
+		// The store bumps the version with every commit, so that it
+		// would show up in almost every diff without saying anything
+		// about the contents
+		if entry.Section == "Version" {
+			continue
 		}
-		statusResponseError(writer, http.StatusNotFound, errors)
-		return
+		var d diff
+		if entry.Old != nil {
+			d.Old = map[string]interface{}{entry.Section: entry.Old}
+		}
+		if entry.New != nil {
+			d.New = map[string]interface{}{entry.Section: entry.New}
+		}
+		diffs = append(diffs, d)
 	}
 
-	newSlice := newBlueprint.Packages
-	oldMap := make(map[string]blueprint.Package)
-	diffs := []diff{}
-
-	for _, oldPackage := range oldBlueprint.Packages {
-		oldMap[oldPackage.Name] = oldPackage
-	}
+	err := json.NewEncoder(writer).Encode(reply{diffs})
+	common.PanicOnError(err)
+}
 
-	// For each package in new blueprint check if the old one contains it
-	for _, newPackage := range newSlice {
-		oldPackage, found := oldMap[newPackage.Name]
-		// If found remove from old packages map but otherwise create a diff with the added package
-		if found {
-			delete(oldMap, oldPackage.Name)
-			// Create a diff if the versions changed
-			if oldPackage.Version != newPackage.Version {
-				diffs = append(diffs, diff{Old: &pack{oldPackage}, New: &pack{newPackage}})
-			}
-		} else {
-			diffs = append(diffs, diff{Old: nil, New: &pack{newPackage}})
-		}
+// getBlueprintAtCommit returns the blueprint `name` as it was at `commit`,
+// which is either the id of one of its changes, "NEWEST" for the committed
+// blueprint, or "WORKSPACE" for the workspace (which is the committed
+// blueprint if the workspace is empty). It returns nil if there is no such
+// commit.
+func (api *API) getBlueprintAtCommit(name, commit string) *blueprint.Blueprint {
+	switch commit {
+	case "NEWEST":
+		return api.store.GetBlueprintCommitted(name)
+	case "WORKSPACE":
+		bp, _ := api.store.GetBlueprint(name)
+		return bp
 	}
 
-	// All packages remaining in the old packages map have been removed in the new blueprint so create a diff
-	for _, oldPackage := range oldMap {
-		diffs = append(diffs, diff{Old: &pack{oldPackage}, New: nil})
+	change, err := api.store.GetBlueprintChange(name, commit)
+	if err != nil {
+		return nil
 	}
-
-	err := json.NewEncoder(writer).Encode(reply{diffs})
-	common.PanicOnError(err)
+	return &change.Blueprint
 }
 
 func (api *API) blueprintsChangesHandler(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
@@ -1384,10 +1613,16 @@ func (api *API) blueprintsChangesHandler(writer http.ResponseWriter, request *ht
 		return
 	}
 
+	// Changes of included blueprints carry the name of that blueprint
+	type blueprintChange struct {
+		blueprint.Change
+		Blueprint string `json:"blueprint,omitempty"`
+	}
+
 	type change struct {
-		Changes []blueprint.Change `json:"changes"`
-		Name    string             `json:"name"`
-		Total   int                `json:"total"`
+		Changes []blueprintChange `json:"changes"`
+		Name    string            `json:"name"`
+		Total   int               `json:"total"`
 	}
 
 	type reply struct {
@@ -1428,13 +1663,28 @@ func (api *API) blueprintsChangesHandler(writer http.ResponseWriter, request *ht
 	allChanges := []change{}
 	errors := []responseError{}
 	for _, name := range names {
-		bpChanges := api.store.GetBlueprintChanges(name)
+		bpChanges := []blueprintChange{}
+		for _, c := range api.store.GetBlueprintChanges(name) {
+			bpChanges = append(bpChanges, blueprintChange{Change: c})
+		}
+		if len(bpChanges) > 0 {
+			// Changes to included blueprints are changes to this one, too
+			for _, include := range api.store.GetBlueprintIncludes(name) {
+				for _, c := range api.store.GetBlueprintChanges(include) {
+					bpChanges = append(bpChanges, blueprintChange{c, include})
+				}
+			}
+			sort.SliceStable(bpChanges, func(i, j int) bool {
+				return bpChanges[i].Timestamp < bpChanges[j].Timestamp
+			})
+		}
+
 		// Reverse the changes, newest first
-		reversed := make([]blueprint.Change, 0, len(bpChanges))
+		reversed := make([]blueprintChange, 0, len(bpChanges))
 		for i := len(bpChanges) - 1; i >= 0; i-- {
 			reversed = append(reversed, bpChanges[i])
 		}
-		if bpChanges != nil {
+		if len(bpChanges) > 0 {
 			change := change{
 				Changes: reversed,
 				Name:    name,
@@ -1506,6 +1756,11 @@ func (api *API) blueprintsNewHandler(writer http.ResponseWriter, request *http.R
 		return
 	}
 
+	if _, distroErr := api.composeDistro(blueprint.Distro); distroErr != nil {
+		statusResponseError(writer, http.StatusBadRequest, *distroErr)
+		return
+	}
+
 	commitMsg := "Recipe " + blueprint.Name + ", version " + blueprint.Version + " saved."
 	err = api.store.PushBlueprint(blueprint, commitMsg)
 	if err != nil {
@@ -1567,6 +1822,11 @@ func (api *API) blueprintsWorkspaceHandler(writer http.ResponseWriter, request *
 		return
 	}
 
+	if _, distroErr := api.composeDistro(blueprint.Distro); distroErr != nil {
+		statusResponseError(writer, http.StatusBadRequest, *distroErr)
+		return
+	}
+
 	err = api.store.PushBlueprintToWorkspace(blueprint)
 	if err != nil {
 		errors := responseError{
@@ -1684,90 +1944,62 @@ func (api *API) blueprintsTagHandler(writer http.ResponseWriter, request *http.R
 	statusResponseOK(writer)
 }
 
-// Schedule new compose by first translating the appropriate blueprint into a pipeline and then
-// pushing it into the channel for waiting builds.
-func (api *API) composeHandler(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
-	if !verifyRequestVersion(writer, params, 0) {
+// blueprintsLockHandler depsolves the most recent commit of a blueprint for
+// the image type given by the "type" query parameter (and the architecture
+// given by "arch", or the host's) and stores the result in the lockfile of
+// that commit. The image is built from the distribution of the blueprint.
+func (api *API) blueprintsLockHandler(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	if !verifyRequestVersion(writer, params, 1) {
 		return
 	}
 
-	type OSTreeRequest struct {
-		Ref    string `json:"ref"`
-		Parent string `json:"parent"`
-	}
-
-	// https://weldr.io/lorax/pylorax.api.html#pylorax.api.v0.v0_compose_start
-	type ComposeRequest struct {
-		BlueprintName string         `json:"blueprint_name"`
-		ComposeType   string         `json:"compose_type"`
-		Size          uint64         `json:"size"`
-		OSTree        OSTreeRequest  `json:"ostree"`
-		Branch        string         `json:"branch"`
-		Upload        *uploadRequest `json:"upload"`
-	}
-	type ComposeReply struct {
-		BuildID uuid.UUID `json:"build_id"`
-		Status  bool      `json:"status"`
-	}
-
-	contentType := request.Header["Content-Type"]
-	if len(contentType) != 1 || contentType[0] != "application/json" {
-		errors := responseError{
-			ID:  "MissingPost",
-			Msg: "blueprint must be json",
-		}
-		statusResponseError(writer, http.StatusBadRequest, errors)
+	name := params.ByName("blueprint")
+	if !verifyStringsWithRegex(writer, []string{name}, ValidBlueprintName) {
 		return
 	}
 
-	var cr ComposeRequest
-	err := json.NewDecoder(request.Body).Decode(&cr)
-	if err != nil {
+	bp := api.store.GetBlueprintCommitted(name)
+	if bp == nil {
 		errors := responseError{
-			Code: http.StatusNotFound,
-			ID:   "HTTPError",
-			Msg:  "Not Found",
+			ID:  "UnknownBlueprint",
+			Msg: fmt.Sprintf("%s: blueprint not found", name),
 		}
-		statusResponseError(writer, http.StatusNotFound, errors)
+		statusResponseError(writer, http.StatusBadRequest, errors)
 		return
 	}
-
-	imageType, err := api.arch.GetImageType(cr.ComposeType)
+	resolved, err := api.store.ResolveBlueprint(*bp)
 	if err != nil {
 		errors := responseError{
-			ID:  "UnknownComposeType",
-			Msg: fmt.Sprintf("Unknown compose type for architecture: %s", cr.ComposeType),
+			ID:  "BlueprintsError",
+			Msg: err.Error(),
 		}
 		statusResponseError(writer, http.StatusBadRequest, errors)
 		return
 	}
+	bp = &resolved
 
-	if !verifyStringsWithRegex(writer, []string{cr.BlueprintName}, ValidBlueprintName) {
+	d, distroErr := api.composeDistro(bp.Distro)
+	if distroErr != nil {
+		statusResponseError(writer, http.StatusBadRequest, *distroErr)
 		return
 	}
 
-	composeID := uuid.New()
-
-	var targets []*target.Target
-	if isRequestVersionAtLeast(params, 1) && cr.Upload != nil {
-		t := uploadRequestToTarget(*cr.Upload, imageType)
-		targets = append(targets, t)
+	archName := request.URL.Query().Get("arch")
+	if archName == "" {
+		archName = api.arch.Name()
+	}
+	arch, archErr := api.composeArch(d, archName)
+	if archErr != nil {
+		statusResponseError(writer, http.StatusBadRequest, *archErr)
+		return
 	}
 
-	targets = append(targets, target.NewLocalTarget(
-		&target.LocalTargetOptions{
-			ComposeId:       composeID,
-			ImageBuildId:    0,
-			Filename:        imageType.Filename(),
-			StreamOptimized: imageType.Name() == "vmdk", // TODO: move conversion to osbuild
-		},
-	))
-
-	bp := api.store.GetBlueprintCommitted(cr.BlueprintName)
-	if bp == nil {
+	composeType := request.URL.Query().Get("type")
+	imageType, err := arch.GetImageType(composeType)
+	if err != nil {
 		errors := responseError{
-			ID:  "UnknownBlueprint",
-			Msg: fmt.Sprintf("Unknown blueprint name: %s", cr.BlueprintName),
+			ID:  "UnknownComposeType",
+			Msg: fmt.Sprintf("Unknown compose type for architecture: %s", composeType),
 		}
 		statusResponseError(writer, http.StatusBadRequest, errors)
 		return
@@ -1776,98 +2008,695 @@ func (api *API) composeHandler(writer http.ResponseWriter, request *http.Request
 	packages, buildPackages, err := api.depsolveBlueprint(bp, imageType)
 	if err != nil {
 		errors := responseError{
-			ID:  "DepsolveError",
-			Msg: err.Error(),
+			ID:       "DepsolveError",
+			Msg:      err.Error(),
+			Problems: depsolveProblems(bp, err),
 		}
 		statusResponseError(writer, http.StatusInternalServerError, errors)
 		return
 	}
 
-	// Check for test parameter
-	q, err := url.ParseQuery(request.URL.RawQuery)
+	lockfile, err := api.store.LockBlueprint(name, store.LockedImage{
+		Distro:        d.Name(),
+		Arch:          arch.Name(),
+		ImageType:     imageType.Name(),
+		Packages:      packages,
+		BuildPackages: buildPackages,
+	})
 	if err != nil {
 		errors := responseError{
-			ID:  "InvalidChars",
-			Msg: fmt.Sprintf("invalid query string: %v", err),
+			ID:  "BlueprintsError",
+			Msg: err.Error(),
 		}
 		statusResponseError(writer, http.StatusBadRequest, errors)
 		return
 	}
 
-	size := imageType.Size(cr.Size)
-	manifest, err := imageType.Manifest(bp.Customizations,
-		distro.ImageOptions{
-			Size: size,
-			OSTree: distro.OSTreeImageOptions{
-				Ref:    cr.OSTree.Ref,
-				Parent: cr.OSTree.Parent,
-			},
-		},
-		api.allRepositories(),
-		packages,
-		buildPackages)
-	if err != nil {
-		errors := responseError{
-			ID:  "ManifestCreationFailed",
-			Msg: fmt.Sprintf("failed to create osbuild manifest: %v", err),
-		}
-		statusResponseError(writer, http.StatusBadRequest, errors)
+	err = json.NewEncoder(writer).Encode(BlueprintsLockfileV1{Lockfile: *lockfile})
+	common.PanicOnError(err)
+}
+
+// blueprintsLockfileHandler returns the lockfile of the blueprint commit
+// given by the "commit" query parameter, or of the most recently locked one
+func (api *API) blueprintsLockfileHandler(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	if !verifyRequestVersion(writer, params, 1) {
 		return
 	}
 
-	testMode := q.Get("test")
-	if testMode == "1" {
-		// Create a failed compose
-		err = api.store.PushTestCompose(composeID, manifest, imageType, bp, size, targets, false)
-	} else if testMode == "2" {
-		// Create a successful compose
-		err = api.store.PushTestCompose(composeID, manifest, imageType, bp, size, targets, true)
-	} else {
-		var jobId uuid.UUID
-
-		jobId, err = api.workers.Enqueue(api.arch.Name(), manifest, targets)
-		if err == nil {
-			err = api.store.PushCompose(composeID, manifest, imageType, bp, size, targets, jobId)
-		}
+	name := params.ByName("blueprint")
+	if !verifyStringsWithRegex(writer, []string{name}, ValidBlueprintName) {
+		return
 	}
 
-	// TODO: we should probably do some kind of blueprint validation in future
-	// for now, let's just 500 and bail out
-	if err != nil {
-		log.Println("error when pushing new compose: ", err.Error())
+	commit := request.URL.Query().Get("commit")
+	lockfile := api.store.GetBlueprintLockfile(name, commit)
+	if lockfile == nil {
 		errors := responseError{
-			ID:  "ComposePushErrored",
-			Msg: err.Error(),
+			ID:  "BlueprintNotLocked",
+			Msg: fmt.Sprintf("%s: blueprint has no lockfile", name),
 		}
-		statusResponseError(writer, http.StatusInternalServerError, errors)
+		statusResponseError(writer, http.StatusNotFound, errors)
 		return
 	}
 
-	err = json.NewEncoder(writer).Encode(ComposeReply{
-		BuildID: composeID,
-		Status:  true,
-	})
+	err := json.NewEncoder(writer).Encode(BlueprintsLockfileV1{Lockfile: *lockfile})
 	common.PanicOnError(err)
 }
 
-func (api *API) composeDeleteHandler(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
-	if !verifyRequestVersion(writer, params, 0) {
+// blueprintsExportHandler returns a tarball with the committed and workspace
+// versions and all changes of the given blueprints, or of all blueprints if
+// none are given
+func (api *API) blueprintsExportHandler(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	if !verifyRequestVersion(writer, params, 1) {
 		return
 	}
 
-	type composeDeleteStatus struct {
-		UUID   uuid.UUID `json:"uuid"`
-		Status bool      `json:"status"`
-	}
+	var histories []store.BlueprintHistory
+	if params.ByName("blueprints") == "/" {
+		histories = api.store.ExportBlueprints()
+	} else {
+		names := strings.Split(params.ByName("blueprints")[1:], ",")
+		if !verifyStringsWithRegex(writer, names, ValidBlueprintName) {
+			return
+		}
 
-	type composeDeleteError struct {
-		ID  string `json:"id"`
-		Msg string `json:"msg"`
+		for _, name := range names {
+			history, exists := api.store.ExportBlueprint(name)
+			if !exists {
+				errors := responseError{
+					ID:  "UnknownBlueprint",
+					Msg: fmt.Sprintf("%s: ", name),
+				}
+				statusResponseError(writer, http.StatusBadRequest, errors)
+				return
+			}
+			histories = append(histories, *history)
+		}
 	}
 
-	uuidsParam := params.ByName("uuids")
+	writer.Header().Set("Content-Disposition", "attachment; filename=blueprints.tar")
+	writer.Header().Set("Content-Type", "application/x-tar")
+	err := store.WriteBlueprintArchive(writer, histories)
+	common.PanicOnError(err)
+}
 
-	results := []composeDeleteStatus{}
+// blueprintsImportHandler replays the blueprints of a tarball written by
+// blueprintsExportHandler into the store
+func (api *API) blueprintsImportHandler(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	if !verifyRequestVersion(writer, params, 1) {
+		return
+	}
+
+	contentType := request.Header["Content-Type"]
+	if len(contentType) == 0 || contentType[0] != "application/x-tar" {
+		errors := responseError{
+			ID:  "BlueprintsError",
+			Msg: "blueprints must be imported from a tarball (application/x-tar)",
+		}
+		statusResponseError(writer, http.StatusBadRequest, errors)
+		return
+	}
+
+	histories, err := store.ReadBlueprintArchive(request.Body)
+	if err != nil {
+		errors := responseError{
+			ID:  "BlueprintsError",
+			Msg: err.Error(),
+		}
+		statusResponseError(writer, http.StatusBadRequest, errors)
+		return
+	}
+
+	names := []string{}
+	for _, history := range histories {
+		names = append(names, history.Name)
+	}
+	if !verifyStringsWithRegex(writer, names, ValidBlueprintName) {
+		return
+	}
+
+	err = api.store.ImportBlueprints(histories)
+	if err != nil {
+		errors := responseError{
+			ID:  "BlueprintsError",
+			Msg: err.Error(),
+		}
+		statusResponseError(writer, http.StatusBadRequest, errors)
+		return
+	}
+
+	err = json.NewEncoder(writer).Encode(BlueprintsImportV1{Blueprints: names})
+	common.PanicOnError(err)
+}
+
+// lockedPackages returns the blueprint and package sets locked for the given
+// image type. It fails if any of the locked packages is not available in the
+// repositories anymore, or if its checksum differs from the locked one. The
+// package specs keep the locked checksums, so that osbuild verifies the
+// downloaded packages against them.
+func (api *API) lockedPackages(name, commit string, imageType distro.ImageType, repos []rpmmd.RepoConfig) (*blueprint.Blueprint, []rpmmd.PackageSpec, []rpmmd.PackageSpec, map[string]string, *responseError) {
+	lockfile := api.store.GetBlueprintLockfile(name, commit)
+	if lockfile == nil {
+		return nil, nil, nil, nil, &responseError{
+			ID:  "BlueprintNotLocked",
+			Msg: fmt.Sprintf("%s: blueprint has no lockfile", name),
+		}
+	}
+
+	d := imageType.Arch().Distro()
+	arch := imageType.Arch().Name()
+	image := lockfile.Image(d.Name(), arch, imageType.Name())
+	if image == nil && d.Name() == api.distro.Name() {
+		// images locked before lockfiles recorded their distribution
+		image = lockfile.Image("", arch, imageType.Name())
+	}
+	if image == nil {
+		return nil, nil, nil, nil, &responseError{
+			ID:  "BlueprintNotLocked",
+			Msg: fmt.Sprintf("%s: blueprint commit %s is not locked for %s on %s", name, lockfile.Commit, imageType.Name(), arch),
+		}
+	}
+
+	available, checksums, err := api.rpmmd.FetchMetadata(repos, d.ModulePlatformID(), arch)
+	if err != nil {
+		return nil, nil, nil, nil, &responseError{
+			ID:  "LockfileError",
+			Msg: fmt.Sprintf("cannot verify locked packages: %v", err),
+		}
+	}
+
+	// the checksum of each available package by its NEVRA
+	nevras := make(map[string]string)
+	for _, pkg := range available {
+		nevras[nevra(pkg.Name, pkg.Epoch, pkg.Version, pkg.Release, pkg.Arch)] = pkg.Checksum
+	}
+
+	var missing, changed []string
+	checked := make(map[string]bool)
+	for _, packages := range [][]rpmmd.PackageSpec{image.Packages, image.BuildPackages} {
+		for _, pkg := range packages {
+			n := nevra(pkg.Name, pkg.Epoch, pkg.Version, pkg.Release, pkg.Arch)
+			// build packages are often also part of the image
+			if checked[n] {
+				continue
+			}
+			checked[n] = true
+
+			checksum, ok := nevras[n]
+			if !ok {
+				missing = append(missing, n)
+			} else if pkg.Checksum != "" && pkg.Checksum != checksum {
+				// the package was rebuilt without bumping its release
+				changed = append(changed, n)
+			}
+		}
+	}
+	if len(missing) > 0 {
+		return nil, nil, nil, nil, &responseError{
+			ID:  "LockedPackagesMissing",
+			Msg: fmt.Sprintf("locked packages are not available in the repositories anymore: %s", strings.Join(missing, ", ")),
+		}
+	}
+	if len(changed) > 0 {
+		return nil, nil, nil, nil, &responseError{
+			ID:  "LockedPackagesChanged",
+			Msg: fmt.Sprintf("the checksums of locked packages have changed in the repositories: %s", strings.Join(changed, ", ")),
+		}
+	}
+
+	return &lockfile.Blueprint, image.Packages, image.BuildPackages, checksums, nil
+}
+
+func nevra(name string, epoch uint, version, release, arch string) string {
+	if epoch == 0 {
+		return fmt.Sprintf("%s-%s-%s.%s", name, version, release, arch)
+	}
+	return fmt.Sprintf("%s-%d:%s-%s.%s", name, epoch, version, release, arch)
+}
+
+// Schedule new compose by first translating the appropriate blueprint into a pipeline and then
+// pushing it into the channel for waiting builds.
+func (api *API) composeHandler(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	if !verifyRequestVersion(writer, params, 0) {
+		return
+	}
+
+	type OSTreeRequest struct {
+		Ref    string `json:"ref"`
+		Parent string `json:"parent"`
+		// The repository the parent is pulled from to generate a static
+		// delta, or installers install the commit of Ref from. Composer's
+		// OSTree repository by default.
+		URL         string `json:"url,omitempty"`
+		StaticDelta bool   `json:"static_delta,omitempty"`
+	}
+
+	// The image live installers install, such as the tar image of a compose
+	type InstallerRequest struct {
+		URL string `json:"url"`
+	}
+
+	// https://weldr.io/lorax/pylorax.api.html#pylorax.api.v0.v0_compose_start
+	type ComposeRequest struct {
+		BlueprintName string `json:"blueprint_name"`
+		ComposeType   string `json:"compose_type"`
+		// Build several compose types (and architectures) of the blueprint
+		// in one compose, with an image build for each combination
+		ComposeTypes []string         `json:"compose_types,omitempty"`
+		Arches       []string         `json:"arches,omitempty"`
+		Size         uint64           `json:"size"`
+		OSTree       OSTreeRequest    `json:"ostree"`
+		Installer    InstallerRequest `json:"installer"`
+		Branch       string           `json:"branch"`
+		Upload       *uploadRequest   `json:"upload"`
+		// Build the package set of a blueprint lockfile instead of depsolving
+		Locked bool   `json:"locked,omitempty"`
+		Commit string `json:"commit,omitempty"`
+		// Build from the repositories as recorded by an earlier compose, or
+		// as of a date (YYYY-MM-DD)
+		Snapshot     string `json:"snapshot,omitempty"`
+		SnapshotDate string `json:"snapshot_date,omitempty"`
+		// Build from another distribution than the one of the blueprint
+		// (or the host's)
+		Distro string `json:"distro,omitempty"`
+		// Values of the blueprint's variables
+		Variables map[string]string `json:"variables,omitempty"`
+	}
+	type ComposeReply struct {
+		BuildID uuid.UUID `json:"build_id"`
+		Status  bool      `json:"status"`
+	}
+
+	contentType := request.Header["Content-Type"]
+	if len(contentType) != 1 || contentType[0] != "application/json" {
+		errors := responseError{
+			ID:  "MissingPost",
+			Msg: "blueprint must be json",
+		}
+		statusResponseError(writer, http.StatusBadRequest, errors)
+		return
+	}
+
+	var cr ComposeRequest
+	err := json.NewDecoder(request.Body).Decode(&cr)
+	if err != nil {
+		errors := responseError{
+			Code: http.StatusNotFound,
+			ID:   "HTTPError",
+			Msg:  "Not Found",
+		}
+		statusResponseError(writer, http.StatusNotFound, errors)
+		return
+	}
+
+	composeTypes := cr.ComposeTypes
+	if len(composeTypes) == 0 {
+		composeTypes = []string{cr.ComposeType}
+	} else if cr.ComposeType != "" {
+		errors := responseError{
+			ID:  "UnknownComposeType",
+			Msg: "only one of 'compose_type' and 'compose_types' may be given",
+		}
+		statusResponseError(writer, http.StatusBadRequest, errors)
+		return
+	}
+	seenComposeTypes := make(map[string]bool)
+	for _, composeType := range composeTypes {
+		if seenComposeTypes[composeType] {
+			errors := responseError{
+				ID:  "UnknownComposeType",
+				Msg: fmt.Sprintf("compose type %s is given more than once", composeType),
+			}
+			statusResponseError(writer, http.StatusBadRequest, errors)
+			return
+		}
+		seenComposeTypes[composeType] = true
+	}
+
+	bp := api.store.GetBlueprintCommitted(cr.BlueprintName)
+	if bp != nil {
+		resolved, err := api.store.ResolveBlueprint(*bp)
+		if err != nil {
+			errors := responseError{
+				ID:  "BlueprintsError",
+				Msg: err.Error(),
+			}
+			statusResponseError(writer, http.StatusBadRequest, errors)
+			return
+		}
+		bp = &resolved
+	}
+
+	distroName := cr.Distro
+	if distroName == "" && bp != nil {
+		distroName = bp.Distro
+	}
+	d, distroErr := api.composeDistro(distroName)
+	if distroErr != nil {
+		statusResponseError(writer, http.StatusBadRequest, *distroErr)
+		return
+	}
+
+	arches := cr.Arches
+	if len(arches) == 0 {
+		arches = []string{api.arch.Name()}
+	}
+
+	// every combination of architecture and compose type is a separate
+	// image build of the compose
+	var imageTypes []distro.ImageType
+	for _, archName := range arches {
+		arch, archErr := api.composeArch(d, archName)
+		if archErr != nil {
+			statusResponseError(writer, http.StatusBadRequest, *archErr)
+			return
+		}
+		for _, composeType := range composeTypes {
+			imageType, err := arch.GetImageType(composeType)
+			if err != nil {
+				errors := responseError{
+					ID:  "UnknownComposeType",
+					Msg: fmt.Sprintf("Unknown compose type for architecture: %s", composeType),
+				}
+				statusResponseError(writer, http.StatusBadRequest, errors)
+				return
+			}
+			imageTypes = append(imageTypes, imageType)
+		}
+	}
+
+	if cr.OSTree.StaticDelta {
+		for _, imageType := range imageTypes {
+			if imageType.Filename() != "commit.tar" {
+				errors := responseError{
+					ID:  "InvalidOSTreeRequest",
+					Msg: fmt.Sprintf("Static deltas can only be generated for OSTree commits, not %s", imageType.Name()),
+				}
+				statusResponseError(writer, http.StatusBadRequest, errors)
+				return
+			}
+		}
+	}
+
+	if cr.Upload != nil {
+		switch settings := cr.Upload.Settings.(type) {
+		case *openstackUploadSettings:
+			for _, imageType := range imageTypes {
+				if _, err := target.OpenStackDiskFormat(imageType.Filename()); err != nil {
+					errors := responseError{
+						ID:  "InvalidUploadRequest",
+						Msg: fmt.Sprintf("Images of type %s cannot be uploaded to OpenStack", imageType.Name()),
+					}
+					statusResponseError(writer, http.StatusBadRequest, errors)
+					return
+				}
+			}
+		case *azureUploadSettings:
+			if err := settings.validate(); err != nil {
+				errors := responseError{
+					ID:  "InvalidUploadRequest",
+					Msg: fmt.Sprintf("Invalid Azure upload settings: %v", err),
+				}
+				statusResponseError(writer, http.StatusBadRequest, errors)
+				return
+			}
+		}
+	}
+
+	if !verifyStringsWithRegex(writer, []string{cr.BlueprintName}, ValidBlueprintName) {
+		return
+	}
+
+	composeID := uuid.New()
+
+	if bp == nil {
+		errors := responseError{
+			ID:  "UnknownBlueprint",
+			Msg: fmt.Sprintf("Unknown blueprint name: %s", cr.BlueprintName),
+		}
+		statusResponseError(writer, http.StatusBadRequest, errors)
+		return
+	}
+
+	variables, err := bp.VariableValues(cr.Variables)
+	if err != nil {
+		errors := responseError{
+			ID:  "InvalidVariables",
+			Msg: err.Error(),
+		}
+		statusResponseError(writer, http.StatusBadRequest, errors)
+		return
+	}
+
+	// each architecture is built from its own repositories
+	archRepos := make(map[string][]rpmmd.RepoConfig)
+	var snapshot *store.Snapshot
+	for _, archName := range arches {
+		repos, archSnapshot, snapshotErr := api.composeRepositories(d, archName, cr.Snapshot, cr.SnapshotDate)
+		if snapshotErr != nil {
+			statusResponseError(writer, http.StatusBadRequest, *snapshotErr)
+			return
+		}
+		archRepos[archName] = repos
+		snapshot = archSnapshot
+	}
+
+	// Check for test parameter
+	q, err := url.ParseQuery(request.URL.RawQuery)
+	if err != nil {
+		errors := responseError{
+			ID:  "InvalidChars",
+			Msg: fmt.Sprintf("invalid query string: %v", err),
+		}
+		statusResponseError(writer, http.StatusBadRequest, errors)
+		return
+	}
+
+	var imageBuilds []store.ImageBuild
+	var staticDeltas []*worker.OSTreeStaticDelta
+	archChecksums := make(map[string]map[string]string)
+	for i, imageType := range imageTypes {
+		arch := imageType.Arch().Name()
+		repos := archRepos[arch]
+
+		var targets []*target.Target
+		if isRequestVersionAtLeast(params, 1) && cr.Upload != nil {
+			t := uploadRequestToTarget(*cr.Upload, imageType)
+			targets = append(targets, t)
+		}
+
+		targets = append(targets, target.NewLocalTarget(
+			&target.LocalTargetOptions{
+				ComposeId:       composeID,
+				ImageBuildId:    i,
+				Filename:        imageType.Filename(),
+				StreamOptimized: imageType.Name() == "vmdk", // TODO: move conversion to osbuild
+			},
+		))
+
+		buildBlueprint := bp
+		var packages, buildPackages []rpmmd.PackageSpec
+		var checksums map[string]string
+		if cr.Locked {
+			var lockErr *responseError
+			buildBlueprint, packages, buildPackages, checksums, lockErr = api.lockedPackages(cr.BlueprintName, cr.Commit, imageType, repos)
+			if lockErr != nil {
+				statusResponseError(writer, http.StatusBadRequest, *lockErr)
+				return
+			}
+		} else {
+			packages, buildPackages, checksums, err = api.depsolveBlueprintInRepos(bp, imageType, repos)
+			if err != nil {
+				errors := responseError{
+					ID:       "DepsolveError",
+					Msg:      err.Error(),
+					Problems: depsolveProblems(bp, err),
+				}
+				statusResponseError(writer, http.StatusInternalServerError, errors)
+				return
+			}
+			checksums = checksumsByRepoName(repos, checksums)
+		}
+
+		if snapshot != nil {
+			if snapshotErr := verifySnapshot(snapshot, d.Name(), arch, api.arch, checksums); snapshotErr != nil {
+				statusResponseError(writer, http.StatusBadRequest, *snapshotErr)
+				return
+			}
+		}
+		archChecksums[arch] = checksums
+
+		substituted, err := buildBlueprint.SubstituteVariables(variables)
+		if err != nil {
+			errors := responseError{
+				ID:  "InvalidVariables",
+				Msg: err.Error(),
+			}
+			statusResponseError(writer, http.StatusBadRequest, errors)
+			return
+		}
+
+		// New commits of a ref build on its latest commit by default
+		parent := cr.OSTree.Parent
+		if parent == "" && cr.OSTree.Ref != "" && imageType.Filename() == "commit.tar" {
+			parent, err = api.ostreeParent(cr.OSTree.Ref)
+			if err != nil {
+				errors := responseError{
+					ID:  "OSTreeError",
+					Msg: err.Error(),
+				}
+				statusResponseError(writer, http.StatusInternalServerError, errors)
+				return
+			}
+		}
+
+		// Installers install commits of composer's repository by default
+		url := cr.OSTree.URL
+		if url == "" && imageType.Filename() == "installer.iso" {
+			url, err = api.ostreeInstallerURL()
+			if err != nil {
+				errors := responseError{
+					ID:  "OSTreeError",
+					Msg: err.Error(),
+				}
+				statusResponseError(writer, http.StatusInternalServerError, errors)
+				return
+			}
+		}
+
+		var staticDelta *worker.OSTreeStaticDelta
+		if cr.OSTree.StaticDelta {
+			var deltaErr *responseError
+			staticDelta, deltaErr = api.ostreeStaticDelta(imageType, parent, cr.OSTree.URL)
+			if deltaErr != nil {
+				statusResponseError(writer, http.StatusBadRequest, *deltaErr)
+				return
+			}
+		}
+
+		size := imageType.Size(cr.Size)
+		manifest, err := imageType.Manifest(substituted.Customizations,
+			distro.ImageOptions{
+				Size: size,
+				OSTree: distro.OSTreeImageOptions{
+					Ref:    cr.OSTree.Ref,
+					Parent: parent,
+					URL:    url,
+				},
+				Installer: distro.InstallerImageOptions{
+					URL: cr.Installer.URL,
+				},
+				Modules: buildBlueprint.GetModuleStreams(),
+			},
+			repos,
+			packages,
+			buildPackages)
+		if err != nil {
+			errors := responseError{
+				ID:  "ManifestCreationFailed",
+				Msg: fmt.Sprintf("failed to create osbuild manifest: %v", err),
+			}
+			statusResponseError(writer, http.StatusBadRequest, errors)
+			return
+		}
+
+		bp = buildBlueprint
+		imageBuilds = append(imageBuilds, store.ImageBuild{
+			ImageType: imageType,
+			Manifest:  manifest,
+			Targets:   targets,
+			Size:      size,
+		})
+		staticDeltas = append(staticDeltas, staticDelta)
+	}
+
+	testMode := q.Get("test")
+	if testMode == "1" || testMode == "2" {
+		// Create a failed (1) or successful (2) compose
+		status := common.IBFailed
+		if testMode == "2" {
+			status = common.IBFinished
+		}
+		for i := range imageBuilds {
+			imageBuilds[i].QueueStatus = status
+			imageBuilds[i].JobStarted = time.Now()
+		}
+	} else {
+		for i, ib := range imageBuilds {
+			imageBuilds[i].JobID, err = api.workers.EnqueueOSBuild(ib.ImageType.Arch().Name(), &worker.OSBuildJob{
+				Manifest:          ib.Manifest,
+				Targets:           ib.Targets,
+				OSTreeStaticDelta: staticDeltas[i],
+			})
+			if err != nil {
+				break
+			}
+		}
+	}
+
+	if err == nil {
+		err = api.store.PushCompose(composeID, bp, variables, imageBuilds)
+	}
+
+	if err != nil {
+		// The compose doesn't exist, so don't leave the jobs which were
+		// already enqueued for it behind
+		for _, ib := range imageBuilds {
+			if ib.JobID != uuid.Nil {
+				_ = api.deleteJob(ib.JobID)
+			}
+		}
+	}
+
+	if err == nil {
+		newSnapshot := store.NewSnapshot(composeID, cr.SnapshotDate)
+		for _, archName := range arches {
+			// record each architecture once
+			if checksums, ok := archChecksums[archName]; ok {
+				newSnapshot.AddRepos(d.Name(), archName, archRepos[archName], checksums)
+				delete(archChecksums, archName)
+			}
+		}
+		err = api.store.PushSnapshot(newSnapshot)
+	}
+
+	// TODO: we should probably do some kind of blueprint validation in future
+	// for now, let's just 500 and bail out
+	if err != nil {
+		log.Println("error when pushing new compose: ", err.Error())
+		errors := responseError{
+			ID:  "ComposePushErrored",
+			Msg: err.Error(),
+		}
+		statusResponseError(writer, http.StatusInternalServerError, errors)
+		return
+	}
+
+	err = json.NewEncoder(writer).Encode(ComposeReply{
+		BuildID: composeID,
+		Status:  true,
+	})
+	common.PanicOnError(err)
+}
+
+func (api *API) composeDeleteHandler(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	if !verifyRequestVersion(writer, params, 0) {
+		return
+	}
+
+	type composeDeleteStatus struct {
+		UUID   uuid.UUID `json:"uuid"`
+		Status bool      `json:"status"`
+	}
+
+	type composeDeleteError struct {
+		ID  string `json:"id"`
+		Msg string `json:"msg"`
+	}
+
+	uuidsParam := params.ByName("uuids")
+
+	results := []composeDeleteStatus{}
 	errors := []composeDeleteError{}
 	uuidStrings := strings.Split(uuidsParam, ",")
 	for _, uuidString := range uuidStrings {
@@ -1898,7 +2727,7 @@ func (api *API) composeDeleteHandler(writer http.ResponseWriter, request *http.R
 			continue
 		}
 
-		err = api.store.DeleteCompose(id)
+		err = api.deleteCompose(id, compose)
 		if err != nil {
 			errors = append(errors, composeDeleteError{
 				"ComposeError",
@@ -1907,15 +2736,6 @@ func (api *API) composeDeleteHandler(writer http.ResponseWriter, request *http.R
 			continue
 		}
 
-		// Delete artifacts from the worker server or — if that doesn't
-		// have this job — the compat output dir. Ignore errors,
-		// because there's no point of reporting them to the client
-		// after the compose itself has already been deleted.
-		err = api.workers.DeleteArtifacts(compose.ImageBuild.JobID)
-		if err == jobqueue.ErrNotExist && api.compatOutputDir != "" {
-			_ = os.RemoveAll(path.Join(api.compatOutputDir, id.String()))
-		}
-
 		results = append(results, composeDeleteStatus{id, true})
 	}
 
@@ -1928,6 +2748,42 @@ func (api *API) composeDeleteHandler(writer http.ResponseWriter, request *http.R
 	common.PanicOnError(err)
 }
 
+// Deletes a compose from the store, together with the jobs of its image
+// builds and their artifacts. Jobs which are still running are canceled.
+func (api *API) deleteCompose(id uuid.UUID, compose store.Compose) error {
+	err := api.store.DeleteCompose(id)
+	if err != nil {
+		return err
+	}
+
+	// Delete jobs and artifacts from the worker server or — if that
+	// doesn't have this job — the compat output dir. Ignore errors,
+	// because there's no point of reporting them to the client after the
+	// compose itself has already been deleted.
+	for _, ib := range compose.ImageBuilds {
+		err = api.deleteJob(ib.JobID)
+		if err == jobqueue.ErrNotExist && api.compatOutputDir != "" {
+			_ = os.RemoveAll(path.Join(api.compatOutputDir, id.String()))
+		}
+	}
+
+	return nil
+}
+
+// deleteJob deletes the job id and its artifacts from the worker server. A
+// job which hasn't finished yet is canceled first, so that no jobs and
+// artifacts are left behind for a compose which doesn't exist (anymore).
+func (api *API) deleteJob(id uuid.UUID) error {
+	err := api.workers.DeleteJob(id)
+	if err == jobqueue.ErrNotFinished {
+		err = api.workers.Cancel(id)
+		if err == nil {
+			err = api.workers.DeleteJob(id)
+		}
+	}
+	return err
+}
+
 func (api *API) composeCancelHandler(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
 	if !verifyRequestVersion(writer, params, 0) {
 		return
@@ -1964,14 +2820,20 @@ func (api *API) composeCancelHandler(writer http.ResponseWriter, request *http.R
 		return
 	}
 
-	err = api.workers.Cancel(compose.ImageBuild.JobID)
-	if err != nil {
-		errors := responseError{
-			ID:  "InternalServerError",
-			Msg: fmt.Sprintf("Internal server error: %v", err),
+	for i, ib := range compose.ImageBuilds {
+		// only cancel the image builds which are not done yet
+		if len(compose.ImageBuilds) > 1 && composeStatus.ImageBuilds[i].State != common.CWaiting && composeStatus.ImageBuilds[i].State != common.CRunning {
+			continue
+		}
+		err = api.workers.Cancel(ib.JobID)
+		if err != nil {
+			errors := responseError{
+				ID:  "InternalServerError",
+				Msg: fmt.Sprintf("Internal server error: %v", err),
+			}
+			statusResponseError(writer, http.StatusBadRequest, errors)
+			return
 		}
-		statusResponseError(writer, http.StatusBadRequest, errors)
-		return
 	}
 
 	reply := CancelComposeStatusV0{id, true}
@@ -1991,7 +2853,24 @@ func (api *API) composeTypesHandler(writer http.ResponseWriter, request *http.Re
 		Types []composeType `json:"types"`
 	}
 
-	for _, format := range api.arch.ListImageTypes() {
+	query := request.URL.Query()
+	d, distroErr := api.composeDistro(query.Get("distro"))
+	if distroErr != nil {
+		statusResponseError(writer, http.StatusBadRequest, *distroErr)
+		return
+	}
+
+	archName := query.Get("arch")
+	if archName == "" {
+		archName = api.arch.Name()
+	}
+	arch, archErr := api.composeArch(d, archName)
+	if archErr != nil {
+		statusResponseError(writer, http.StatusBadRequest, *archErr)
+		return
+	}
+
+	for _, format := range arch.ListImageTypes() {
 		reply.Types = append(reply.Types, composeType{format, true})
 	}
 
@@ -2089,7 +2968,7 @@ func (api *API) composeStatusHandler(writer http.ResponseWriter, request *http.R
 			continue
 		} else if filterStatus != "" && composeStatus.State.ToString() != filterStatus {
 			continue
-		} else if filterImageType != "" && compose.ImageBuild.ImageType.Name() != filterImageType {
+		} else if filterImageType != "" && !composeHasImageType(compose, filterImageType) {
 			continue
 		}
 		filteredUUIDs = append(filteredUUIDs, id)
@@ -2150,23 +3029,29 @@ func (api *API) composeInfoHandler(writer http.ResponseWriter, request *http.Req
 		QueueStatus string               `json:"queue_status"`
 		ImageSize   uint64               `json:"image_size"`
 		Uploads     []uploadResponse     `json:"uploads,omitempty"`
+		ImageBuilds []*ImageBuildEntry   `json:"image_builds,omitempty"`
+		Variables   map[string]string    `json:"variables,omitempty"`
 	}
 
 	reply.ID = id
 	reply.Blueprint = compose.Blueprint
+	reply.Variables = compose.Variables
 	reply.Deps = Dependencies{
 		Packages: make([]map[string]interface{}, 0),
 	}
 	// Weldr API assumes only one image build per compose, that's why only the
-	// 1st build is considered
+	// 1st build is considered. Composes of several image builds list all of
+	// them in addition.
 	composeStatus := api.getComposeStatus(compose)
-	reply.ComposeType = compose.ImageBuild.ImageType.Name()
+	reply.ComposeType = compose.ImageBuilds[0].ImageType.Name()
 	reply.QueueStatus = composeStatus.State.ToString()
-	reply.ImageSize = compose.ImageBuild.Size
+	reply.ImageSize = compose.ImageBuilds[0].Size
 
-	if isRequestVersionAtLeast(params, 1) {
-		reply.Uploads = targetsToUploadResponses(compose.ImageBuild.Targets, composeStatus.State)
+	includeUploads := isRequestVersionAtLeast(params, 1)
+	if includeUploads {
+		reply.Uploads = composeUploadResponses(compose, composeStatus)
 	}
+	reply.ImageBuilds = imageBuildsToImageBuildEntries(compose, composeStatus, includeUploads)
 
 	err = json.NewEncoder(writer).Encode(reply)
 	common.PanicOnError(err)
@@ -2198,7 +3083,12 @@ func (api *API) composeImageHandler(writer http.ResponseWriter, request *http.Re
 		return
 	}
 
-	composeStatus := api.getComposeStatus(compose)
+	ib := imageBuildFromQuery(writer, request, &compose, uuidString)
+	if ib == nil {
+		return
+	}
+
+	composeStatus := api.getImageBuildStatus(*ib)
 	if composeStatus.State != common.CFinished {
 		errors := responseError{
 			ID:  "BuildInWrongState",
@@ -2208,10 +3098,10 @@ func (api *API) composeImageHandler(writer http.ResponseWriter, request *http.Re
 		return
 	}
 
-	imageName := compose.ImageBuild.ImageType.Filename()
-	imageMime := compose.ImageBuild.ImageType.MIMEType()
+	imageName := ib.ImageType.Filename()
+	imageMime := ib.ImageType.MIMEType()
 
-	reader, fileSize, err := api.openImageFile(uuid, compose)
+	reader, fileSize, err := api.openImageFile(uuid, *ib)
 	if err != nil {
 		errors := responseError{
 			ID:  "InternalServerError",
@@ -2256,7 +3146,12 @@ func (api *API) composeMetadataHandler(writer http.ResponseWriter, request *http
 		return
 	}
 
-	composeStatus := api.getComposeStatus(compose)
+	ib := imageBuildFromQuery(writer, request, &compose, uuidString)
+	if ib == nil {
+		return
+	}
+
+	composeStatus := api.getImageBuildStatus(*ib)
 	if composeStatus.State != common.CFinished && composeStatus.State != common.CFailed {
 		errors := responseError{
 			ID:  "BuildInWrongState",
@@ -2266,7 +3161,7 @@ func (api *API) composeMetadataHandler(writer http.ResponseWriter, request *http
 		return
 	}
 
-	metadata, err := json.Marshal(&compose.ImageBuild.Manifest)
+	metadata, err := json.Marshal(&ib.Manifest)
 	common.PanicOnError(err)
 
 	writer.Header().Set("Content-Disposition", "attachment; filename="+uuid.String()+"-metadata.tar")
@@ -2286,6 +3181,23 @@ func (api *API) composeMetadataHandler(writer http.ResponseWriter, request *http
 	_, err = tw.Write(metadata)
 	common.PanicOnError(err)
 
+	if len(compose.Variables) > 0 {
+		variables, err := json.Marshal(compose.Variables)
+		common.PanicOnError(err)
+
+		hdr := &tar.Header{
+			Name:    uuid.String() + "-variables.json",
+			Mode:    0600,
+			Size:    int64(len(variables)),
+			ModTime: time.Now().Truncate(time.Second),
+		}
+		err = tw.WriteHeader(hdr)
+		common.PanicOnError(err)
+
+		_, err = tw.Write(variables)
+		common.PanicOnError(err)
+	}
+
 	err = tw.Close()
 	common.PanicOnError(err)
 }
@@ -2317,7 +3229,12 @@ func (api *API) composeResultsHandler(writer http.ResponseWriter, request *http.
 		return
 	}
 
-	composeStatus := api.getComposeStatus(compose)
+	ib := imageBuildFromQuery(writer, request, &compose, uuidString)
+	if ib == nil {
+		return
+	}
+
+	composeStatus := api.getImageBuildStatus(*ib)
 	if composeStatus.State != common.CFinished && composeStatus.State != common.CFailed {
 		errors := responseError{
 			ID:  "BuildInWrongState",
@@ -2327,7 +3244,7 @@ func (api *API) composeResultsHandler(writer http.ResponseWriter, request *http.
 		return
 	}
 
-	metadata, err := json.Marshal(&compose.ImageBuild.Manifest)
+	metadata, err := json.Marshal(&ib.Manifest)
 	common.PanicOnError(err)
 
 	writer.Header().Set("Content-Disposition", "attachment; filename="+uuid.String()+".tar")
@@ -2364,10 +3281,25 @@ func (api *API) composeResultsHandler(writer http.ResponseWriter, request *http.
 		common.PanicOnError(err)
 	}
 
-	reader, fileSize, err := api.openImageFile(uuid, compose)
+	reader, fileSize, err := api.openImageFile(uuid, *ib)
 	if err == nil {
 		hdr = &tar.Header{
-			Name:    uuid.String() + "-" + compose.ImageBuild.ImageType.Filename(),
+			Name:    uuid.String() + "-" + ib.ImageType.Filename(),
+			Mode:    0644,
+			Size:    int64(fileSize),
+			ModTime: time.Now().Truncate(time.Second),
+		}
+		err = tw.WriteHeader(hdr)
+		common.PanicOnError(err)
+		_, err = io.Copy(tw, reader)
+		common.PanicOnError(err)
+	}
+
+	// The static delta of an OSTree commit, if one was generated
+	reader, fileSize, err = api.workers.JobArtifact(ib.JobID, ostree.StaticDeltaFilename)
+	if err == nil {
+		hdr = &tar.Header{
+			Name:    uuid.String() + "-" + ostree.StaticDeltaFilename,
 			Mode:    0644,
 			Size:    int64(fileSize),
 			ModTime: time.Now().Truncate(time.Second),
@@ -2408,7 +3340,12 @@ func (api *API) composeLogsHandler(writer http.ResponseWriter, request *http.Req
 		return
 	}
 
-	composeStatus := api.getComposeStatus(compose)
+	ib := imageBuildFromQuery(writer, request, &compose, uuidString)
+	if ib == nil {
+		return
+	}
+
+	composeStatus := api.getImageBuildStatus(*ib)
 	if composeStatus.State != common.CFinished && composeStatus.State != common.CFailed {
 		errors := responseError{
 			ID:  "BuildInWrongState",
@@ -2472,7 +3409,12 @@ func (api *API) composeLogHandler(writer http.ResponseWriter, request *http.Requ
 		return
 	}
 
-	composeStatus := api.getComposeStatus(compose)
+	ib := imageBuildFromQuery(writer, request, &compose, uuidString)
+	if ib == nil {
+		return
+	}
+
+	composeStatus := api.getImageBuildStatus(*ib)
 	if composeStatus.State == common.CWaiting {
 		errors := responseError{
 			ID:  "BuildInWrongState",
@@ -2544,39 +3486,269 @@ func (api *API) fetchPackageList() (rpmmd.PackageList, error) {
 
 // Returns all configured repositories (base + sources) as rpmmd.RepoConfig
 func (api *API) allRepositories() []rpmmd.RepoConfig {
-	repos := append([]rpmmd.RepoConfig{}, api.repos...)
+	return api.archRepositories(api.distro, api.arch.Name())
+}
+
+// Returns the configured repositories of a distribution and architecture and
+// all sources. Sources are not specific to either.
+func (api *API) archRepositories(d distro.Distro, arch string) []rpmmd.RepoConfig {
+	repos := append([]rpmmd.RepoConfig{}, api.distroRepos[d.Name()][arch]...)
 	for id, source := range api.store.GetAllSourcesByID() {
 		repos = append(repos, source.RepoConfig(id))
 	}
 	return repos
 }
 
+// depsolveBlueprint depsolves a blueprint against the repositories of the
+// image type, or if it is nil, of the distribution of the blueprint and the
+// host architecture
 func (api *API) depsolveBlueprint(bp *blueprint.Blueprint, imageType distro.ImageType) ([]rpmmd.PackageSpec, []rpmmd.PackageSpec, error) {
-	repos := api.allRepositories()
+	d, arch, err := api.depsolveTarget(bp, imageType)
+	if err != nil {
+		return nil, nil, err
+	}
+	packages, buildPackages, _, err := api.depsolveBlueprintInRepos(bp, imageType, api.archRepositories(d, arch))
+	return packages, buildPackages, err
+}
+
+// depsolveTarget returns the distribution and architecture a blueprint is
+// depsolved for
+func (api *API) depsolveTarget(bp *blueprint.Blueprint, imageType distro.ImageType) (distro.Distro, string, error) {
+	if imageType != nil {
+		return imageType.Arch().Distro(), imageType.Arch().Name(), nil
+	}
+	d, distroErr := api.composeDistro(bp.Distro)
+	if distroErr != nil {
+		return nil, "", errors_package.New(distroErr.Msg)
+	}
+	return d, api.arch.Name(), nil
+}
 
+// depsolveBlueprintInRepos depsolves a blueprint against the given
+// repositories and also returns the checksums of their metadata, keyed by
+// the index of the repository as returned by rpmmd.Depsolve
+func (api *API) depsolveBlueprintInRepos(bp *blueprint.Blueprint, imageType distro.ImageType, repos []rpmmd.RepoConfig) ([]rpmmd.PackageSpec, []rpmmd.PackageSpec, map[string]string, error) {
 	specs := bp.GetPackages()
-	excludeSpecs := []string{}
+	excludeSpecs := bp.GetExcludes()
 	if imageType != nil {
 		// When the output type is known, include the base packages in the depsolve
 		// transaction.
 		specs, excludeSpecs = imageType.Packages(*bp)
 	}
 
-	packages, _, err := api.rpmmd.Depsolve(specs, excludeSpecs, repos, api.distro.ModulePlatformID(), api.arch.Name())
+	d, arch, err := api.depsolveTarget(bp, imageType)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
+	}
+
+	packages, checksums, err := api.rpmmd.Depsolve(specs, excludeSpecs, bp.GetPackageSelectors(), repos, d.ModulePlatformID(), arch)
+	if err != nil {
+		return nil, nil, nil, err
 	}
 
 	buildPackages := []rpmmd.PackageSpec{}
 	if imageType != nil {
 		buildSpecs := imageType.BuildPackages()
-		buildPackages, _, err = api.rpmmd.Depsolve(buildSpecs, nil, repos, api.distro.ModulePlatformID(), api.arch.Name())
+		buildPackages, _, err = api.rpmmd.Depsolve(buildSpecs, nil, nil, repos, d.ModulePlatformID(), arch)
 		if err != nil {
-			return nil, nil, err
+			return nil, nil, nil, err
 		}
 	}
 
-	return packages, buildPackages, err
+	return packages, buildPackages, checksums, err
+}
+
+// composeDistro returns the distribution named in a compose request or
+// blueprint, or the host's if name is empty. Images can be built for every
+// other distribution which has repositories configured.
+func (api *API) composeDistro(name string) (distro.Distro, *responseError) {
+	if name == "" || name == api.distro.Name() {
+		return api.distro, nil
+	}
+	d := api.distros.GetDistro(name)
+	if d == nil {
+		return nil, &responseError{
+			ID:  "UnknownDistro",
+			Msg: fmt.Sprintf("Unknown distribution: %s", name),
+		}
+	}
+	if len(api.distroRepos[d.Name()]) == 0 {
+		return nil, &responseError{
+			ID:  "UnsupportedDistro",
+			Msg: fmt.Sprintf("No repositories configured for %s", name),
+		}
+	}
+	return d, nil
+}
+
+// composeArch returns the architecture of distribution d named in a compose
+// request. Images can be built for the host architecture and every other
+// architecture which has repositories configured. Their jobs are picked up
+// by workers of that architecture.
+func (api *API) composeArch(d distro.Distro, name string) (distro.Arch, *responseError) {
+	arch, err := d.GetArch(name)
+	if err != nil {
+		return nil, &responseError{
+			ID:  "UnknownArch",
+			Msg: fmt.Sprintf("Unknown architecture: %s", name),
+		}
+	}
+	isHost := d.Name() == api.distro.Name() && arch.Name() == api.arch.Name()
+	if !isHost && len(api.distroRepos[d.Name()][arch.Name()]) == 0 {
+		return nil, &responseError{
+			ID:  "UnsupportedArch",
+			Msg: fmt.Sprintf("No repositories configured for %s", name),
+		}
+	}
+	return arch, nil
+}
+
+// composeRepositories returns the repositories a compose for distribution d
+// and arch is built from: the configured ones, their state as of
+// snapshotDate, or as recorded by the snapshot with the ID snapshotID. The
+// snapshot is returned so that the caller can verify that the repositories
+// did not change since.
+func (api *API) composeRepositories(d distro.Distro, arch, snapshotID, snapshotDate string) ([]rpmmd.RepoConfig, *store.Snapshot, *responseError) {
+	repos := api.archRepositories(d, arch)
+
+	if snapshotID != "" && snapshotDate != "" {
+		return nil, nil, &responseError{
+			ID:  "InvalidSnapshot",
+			Msg: "only one of 'snapshot' and 'snapshot_date' may be given",
+		}
+	}
+
+	if snapshotDate != "" {
+		date, err := time.Parse("2006-01-02", snapshotDate)
+		if err != nil {
+			return nil, nil, &responseError{
+				ID:  "InvalidSnapshot",
+				Msg: fmt.Sprintf("invalid snapshot date, must be YYYY-MM-DD: %s", snapshotDate),
+			}
+		}
+		for i := range repos {
+			repos[i], err = repos[i].Snapshot(date)
+			if err != nil {
+				return nil, nil, &responseError{
+					ID:  "InvalidSnapshot",
+					Msg: err.Error(),
+				}
+			}
+		}
+		return repos, nil, nil
+	}
+
+	if snapshotID != "" {
+		id, err := uuid.Parse(snapshotID)
+		if err != nil {
+			return nil, nil, &responseError{
+				ID:  "UnknownSnapshot",
+				Msg: fmt.Sprintf("%s is not a valid snapshot id", snapshotID),
+			}
+		}
+		snapshot, exists := api.store.GetSnapshot(id)
+		if !exists {
+			return nil, nil, &responseError{
+				ID:  "UnknownSnapshot",
+				Msg: fmt.Sprintf("Unknown snapshot: %s", snapshotID),
+			}
+		}
+
+		repoSnapshots := snapshot.ArchRepos(d.Name(), arch, api.arch)
+		if len(repoSnapshots) == 0 {
+			return nil, nil, &responseError{
+				ID:  "InvalidSnapshot",
+				Msg: fmt.Sprintf("snapshot %s has no repositories for %s on %s", snapshotID, d.Name(), arch),
+			}
+		}
+
+		configured := make(map[string]rpmmd.RepoConfig)
+		for _, repo := range repos {
+			configured[repo.Name] = repo
+		}
+		repos = make([]rpmmd.RepoConfig, 0, len(repoSnapshots))
+		for _, repoSnapshot := range repoSnapshots {
+			repo, ok := configured[repoSnapshot.Name]
+			if !ok {
+				return nil, nil, &responseError{
+					ID:  "InvalidSnapshot",
+					Msg: fmt.Sprintf("repository %s of snapshot %s is not configured anymore", repoSnapshot.Name, snapshotID),
+				}
+			}
+			repo.BaseURL = repoSnapshot.BaseURL
+			repo.Metalink = repoSnapshot.Metalink
+			repo.MirrorList = repoSnapshot.MirrorList
+			repos = append(repos, repo)
+		}
+		return repos, snapshot, nil
+	}
+
+	return repos, nil, nil
+}
+
+// checksumsByRepoName keys the metadata checksums returned by rpmmd.Depsolve,
+// which are keyed by the index of the repository, by the repository's name
+func checksumsByRepoName(repos []rpmmd.RepoConfig, checksums map[string]string) map[string]string {
+	byName := make(map[string]string)
+	for i, repo := range repos {
+		if checksum, ok := checksums[strconv.Itoa(i)]; ok {
+			byName[repo.Name] = checksum
+		}
+	}
+	return byName
+}
+
+// verifySnapshot checks that the metadata of the repositories which are not
+// pinned to a snapshot mirror still matches the checksums recorded in the
+// snapshot for a distribution and arch
+func verifySnapshot(snapshot *store.Snapshot, distroName, arch string, host distro.Arch, checksums map[string]string) *responseError {
+	var changed []string
+	for _, repo := range snapshot.ArchRepos(distroName, arch, host) {
+		if repo.PinnedDate != "" {
+			continue
+		}
+		if checksum, ok := checksums[repo.Name]; ok && checksum != repo.Checksum {
+			changed = append(changed, repo.Name)
+		}
+	}
+	if len(changed) > 0 {
+		return &responseError{
+			ID:  "SnapshotMismatch",
+			Msg: fmt.Sprintf("repositories changed since snapshot %s: %s", snapshot.ID, strings.Join(changed, ", ")),
+		}
+	}
+	return nil
+}
+
+// distrosListHandler lists the distributions images can be composed for:
+// the host's and all others which have repositories configured
+func (api *API) distrosListHandler(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	if !verifyRequestVersion(writer, params, 1) {
+		return
+	}
+
+	distros := []string{}
+	for _, name := range api.distros.List() {
+		if _, distroErr := api.composeDistro(name); distroErr == nil {
+			distros = append(distros, name)
+		}
+	}
+
+	err := json.NewEncoder(writer).Encode(DistrosListV1{
+		Distros: distros,
+	})
+	common.PanicOnError(err)
+}
+
+func (api *API) sourceSnapshotsHandler(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	if !verifyRequestVersion(writer, params, 1) {
+		return
+	}
+
+	err := json.NewEncoder(writer).Encode(SourceSnapshotsV1{
+		Snapshots: api.store.ListSnapshots(),
+	})
+	common.PanicOnError(err)
 }
 
 func (api *API) uploadsScheduleHandler(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
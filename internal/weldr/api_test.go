@@ -3,11 +3,15 @@ package weldr
 import (
 	"archive/tar"
 	"bytes"
+	"context"
+	"encoding/json"
 	"io"
+	"io/ioutil"
 	"math/rand"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path"
 	"strconv"
 	"testing"
 	"time"
@@ -15,29 +19,42 @@ import (
 	"github.com/osbuild/osbuild-composer/internal/blueprint"
 	"github.com/osbuild/osbuild-composer/internal/common"
 	"github.com/osbuild/osbuild-composer/internal/distro"
+	"github.com/osbuild/osbuild-composer/internal/distro/fedora32"
+	"github.com/osbuild/osbuild-composer/internal/distro/fedora33"
 	test_distro "github.com/osbuild/osbuild-composer/internal/distro/fedoratest"
+	"github.com/osbuild/osbuild-composer/internal/jobqueue"
+	"github.com/osbuild/osbuild-composer/internal/jobqueue/testjobqueue"
 	rpmmd_mock "github.com/osbuild/osbuild-composer/internal/mocks/rpmmd"
+	"github.com/osbuild/osbuild-composer/internal/osbuild"
 	"github.com/osbuild/osbuild-composer/internal/rpmmd"
 	"github.com/osbuild/osbuild-composer/internal/store"
 	"github.com/osbuild/osbuild-composer/internal/target"
 	"github.com/osbuild/osbuild-composer/internal/test"
+	"github.com/osbuild/osbuild-composer/internal/worker"
 
 	"github.com/BurntSushi/toml"
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/require"
 )
 
 func createWeldrAPI(fixtureGenerator rpmmd_mock.FixtureGenerator) (*API, *store.Store) {
 	fixture := fixtureGenerator()
 	rpm := rpmmd_mock.NewRPMMDMock(fixture)
-	repos := []rpmmd.RepoConfig{{Name: "test-id", BaseURL: "http://example.com/test/os/x86_64", CheckGPG: true}}
 	d := test_distro.New()
+	repos := map[string]map[string][]rpmmd.RepoConfig{
+		d.Name(): {"x86_64": {{Name: "test-id", BaseURL: "http://example.com/test/os/x86_64", CheckGPG: true}}},
+	}
 	arch, err := d.GetArch("x86_64")
 	if err != nil {
 		panic(err)
 	}
+	distros, err := distro.NewRegistry(d)
+	if err != nil {
+		panic(err)
+	}
 
-	return New(rpm, arch, d, repos, nil, fixture.Store, fixture.Workers, ""), fixture.Store
+	return New(rpm, arch, distros, repos, nil, fixture.Store, fixture.Workers, ""), fixture.Store
 }
 
 func TestBasic(t *testing.T) {
@@ -77,6 +94,7 @@ func TestBlueprintsNew(t *testing.T) {
 	}{
 		{"POST", "/api/v0/blueprints/new", `{"name":"test","description":"Test","packages":[],"version":""}`, http.StatusOK, `{"status":true}`},
 		{"POST", "/api/v0/blueprints/new", `{"name":"test","description":"Test","packages":[{"name":"httpd","version":"2.4.*"}],"version":"0.0.0"}`, http.StatusOK, `{"status":true}`},
+		{"POST", "/api/v0/blueprints/new", `{"name":"test","description":"Test","distro":"fedora-33","packages":[],"version":""}`, http.StatusBadRequest, `{"status":false,"errors":[{"id":"UnknownDistro","msg":"Unknown distribution: fedora-33"}]}`},
 		{"POST", "/api/v0/blueprints/new", `{"name":"test","description":"Test","packages:}`, http.StatusBadRequest, `{"status":false,"errors":[{"id":"BlueprintsError","msg":"400 Bad Request: The browser (or proxy) sent a request that this server could not understand: unexpected EOF"}]}`},
 		{"POST", "/api/v0/blueprints/new", `{"name":"","description":"Test","packages":[{"name":"httpd","version":"2.4.*"}],"version":"0.0.0"}`, http.StatusBadRequest, `{"status":false,"errors":[{"id":"InvalidChars","msg":"Invalid characters in API path"}]}`},
 		{"POST", "/api/v0/blueprints/new", ``, http.StatusBadRequest, `{"status":false,"errors":[{"id":"BlueprintsError","msg":"Missing blueprint"}]}`},
@@ -241,6 +259,79 @@ func TestBlueprintsInfo(t *testing.T) {
 	}
 }
 
+func TestBlueprintsInfoFlattenNested(t *testing.T) {
+	api, _ := createWeldrAPI(rpmmd_mock.BaseFixture)
+	test.SendHTTP(api, true, "POST", "/api/v0/blueprints/new", `{"name":"base","description":"Base","packages":[{"name":"httpd","version":"2.4.*"}],"customizations":{"hostname":"base-host"},"version":"0.0.1"}`)
+	test.SendHTTP(api, true, "POST", "/api/v0/blueprints/new", `{"name":"monitoring","description":"Monitoring","include":["base"],"packages":[{"name":"collectd","version":"*"}],"version":"0.0.1"}`)
+	test.SendHTTP(api, true, "POST", "/api/v0/blueprints/new", `{"name":"test","description":"Test","include":["monitoring"],"packages":[{"name":"tmux","version":"*"}],"customizations":{"hostname":"test-host"},"version":"0.0.1"}`)
+
+	// the includes of included blueprints are merged as well
+	test.TestRoute(t, api, true, "GET", "/api/v0/blueprints/info/test?flatten=true", ``, http.StatusOK, `{"blueprints":[{"name":"test","description":"Test","version":"0.0.1","include":["monitoring"],"modules":[],"packages":[{"name":"httpd","version":"2.4.*"},{"name":"collectd","version":"*"},{"name":"tmux","version":"*"}],"groups":[],"customizations":{"hostname":"test-host"}}],
+		"changes":[{"name":"test","changed":false}], "errors":[]}`)
+
+	// changes to an included blueprint are picked up
+	test.SendHTTP(api, true, "POST", "/api/v0/blueprints/new", `{"name":"base","description":"Base","packages":[{"name":"nginx","version":"*"}],"version":"0.0.2"}`)
+	resp := test.SendHTTP(api, true, "GET", "/api/v0/blueprints/info/test?flatten=true&format=toml", ``)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var flattened blueprint.Blueprint
+	_, err := toml.DecodeReader(resp.Body, &flattened)
+	require.NoError(t, err)
+	require.Equal(t, []blueprint.Package{{Name: "nginx", Version: "*"}, {Name: "collectd", Version: "*"}, {Name: "tmux", Version: "*"}}, flattened.Packages)
+}
+
+func TestBlueprintsInclude(t *testing.T) {
+	api, _ := createWeldrAPI(rpmmd_mock.BaseFixture)
+	test.SendHTTP(api, true, "POST", "/api/v0/blueprints/new", `{"name":"base","description":"Base","packages":[{"name":"httpd","version":"2.4.*"}],"customizations":{"hostname":"base-host"},"version":"0.0.1"}`)
+	test.SendHTTP(api, true, "POST", "/api/v0/blueprints/new", `{"name":"test","description":"Test","include":["base"],"packages":[{"name":"tmux","version":"*"}],"version":"0.0.1"}`)
+
+	// blueprints are shown as they were saved, but depsolved with their includes
+	test.TestRoute(t, api, true, "GET", "/api/v0/blueprints/info/test", ``, http.StatusOK, `{"blueprints":[{"name":"test","description":"Test","version":"0.0.1","include":["base"],"modules":[],"packages":[{"name":"tmux","version":"*"}],"groups":[]}],
+		"changes":[{"name":"test","changed":false}], "errors":[]}`)
+	test.TestRoute(t, api, true, "GET", "/api/v0/blueprints/info/test?flatten=true", ``, http.StatusOK, `{"blueprints":[{"name":"test","description":"Test","version":"0.0.1","include":["base"],"modules":[],"packages":[{"name":"httpd","version":"2.4.*"},{"name":"tmux","version":"*"}],"groups":[],"customizations":{"hostname":"base-host"}}],
+		"changes":[{"name":"test","changed":false}], "errors":[]}`)
+	test.TestRoute(t, api, true, "GET", "/api/v0/blueprints/info/test?flatten=maybe", ``, http.StatusBadRequest, `{"status":false,"errors":[{"id":"InvalidChars","msg":"invalid flatten parameter: maybe"}]}`)
+	resp := test.SendHTTP(api, true, "GET", "/api/v0/blueprints/depsolve/test", ``)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var depsolved struct {
+		Blueprints []struct {
+			Blueprint blueprint.Blueprint `json:"blueprint"`
+		} `json:"blueprints"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&depsolved))
+	require.Len(t, depsolved.Blueprints, 1)
+	require.Equal(t, []blueprint.Package{{Name: "httpd", Version: "2.4.*"}, {Name: "tmux", Version: "*"}}, depsolved.Blueprints[0].Blueprint.Packages)
+	require.Equal(t, "base-host", *depsolved.Blueprints[0].Blueprint.Customizations.Hostname)
+
+	test.SendHTTP(api, true, "POST", "/api/v0/blueprints/new", `{"name":"base","description":"Base","packages":[{"name":"httpd","version":"2.4.*"}],"version":"0.0.2"}`)
+	// changes of the same second are in no particular order
+	resp = test.SendHTTP(api, true, "GET", "/api/v0/blueprints/changes/test", ``)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var reply struct {
+		Blueprints []struct {
+			Changes []struct {
+				Message   string `json:"message"`
+				Blueprint string `json:"blueprint"`
+			} `json:"changes"`
+			Total int `json:"total"`
+		} `json:"blueprints"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&reply))
+	require.Len(t, reply.Blueprints, 1)
+	require.Equal(t, 3, reply.Blueprints[0].Total)
+	changes := make(map[string]string)
+	for _, c := range reply.Blueprints[0].Changes {
+		changes[c.Message] = c.Blueprint
+	}
+	require.Equal(t, map[string]string{
+		"Recipe base, version 0.0.1 saved.": "base",
+		"Recipe base, version 0.0.2 saved.": "base",
+		"Recipe test, version 0.0.1 saved.": "",
+	}, changes)
+
+	test.TestRoute(t, api, true, "POST", "/api/v0/blueprints/new", `{"name":"base","description":"Base","include":["test"],"version":"0.0.3"}`, http.StatusBadRequest, `{"status":false,"errors":[{"id":"BlueprintsError","msg":"blueprint include cycle: base -> test -> base"}]}`)
+	test.TestRoute(t, api, true, "DELETE", "/api/v0/blueprints/delete/base", ``, http.StatusBadRequest, `{"status":false,"errors":[{"id":"BlueprintsError","msg":"Blueprint base is included by: test"}]}`)
+}
+
 func TestBlueprintsInfoToml(t *testing.T) {
 	api, _ := createWeldrAPI(rpmmd_mock.BaseFixture)
 	test.SendHTTP(api, true, "POST", "/api/v0/blueprints/new", `{"name":"test1","description":"Test","packages":[{"name":"httpd","version":"2.4.*"}],"version":"0.0.0"}`)
@@ -261,7 +352,7 @@ func TestBlueprintsInfoToml(t *testing.T) {
 		Description: "Test",
 		Version:     "0.0.0",
 		Packages: []blueprint.Package{
-			{"httpd", "2.4.*"},
+			{Name: "httpd", Version: "2.4.*"},
 		},
 		Groups:  []blueprint.Group{},
 		Modules: []blueprint.Package{},
@@ -389,6 +480,9 @@ func TestBlueprintsDiff(t *testing.T) {
 		ExpectedJSON   string
 	}{
 		{"GET", "/api/v0/blueprints/diff/test/NEWEST/WORKSPACE", ``, http.StatusOK, `{"diff":[{"new":{"Package":{"name":"systemd","version":"123"}},"old":null},{"new":null,"old":{"Package":{"name":"httpd","version":"2.4.*"}}}]}`},
+		{"GET", "/api/v0/blueprints/diff/test/NEWEST/NEWEST", ``, http.StatusOK, `{"diff":[]}`},
+		{"GET", "/api/v0/blueprints/diff/test/NEWEST/unknown", ``, http.StatusBadRequest, `{"status":false,"errors":[{"id":"UnknownCommit","msg":"ggit-error: revspec 'unknown' not found (-3)"}]}`},
+		{"GET", "/api/v0/blueprints/diff/unknown/NEWEST/WORKSPACE", ``, http.StatusNotFound, `{"status":false,"errors":[{"id":"UnknownBlueprint","msg":"Unknown blueprint name: unknown"}]}`},
 	}
 
 	for _, c := range cases {
@@ -400,6 +494,19 @@ func TestBlueprintsDiff(t *testing.T) {
 	}
 }
 
+func TestBlueprintsDiffCustomizations(t *testing.T) {
+	api, sf := createWeldrAPI(rpmmd_mock.BaseFixture)
+	test.SendHTTP(api, true, "POST", "/api/v0/blueprints/new", `{"name":"test","description":"Test","version":"0.0.1","customizations":{"hostname":"first"}}`)
+	first := sf.GetBlueprintChanges("test")[0].Commit
+	test.SendHTTP(api, true, "POST", "/api/v0/blueprints/new", `{"name":"test","description":"Test","version":"0.0.2","customizations":{"hostname":"second","sshkey":[{"user":"root","key":"ssh-rsa"}]}}`)
+	second := sf.GetBlueprintChanges("test")[1].Commit
+
+	test.TestRoute(t, api, true, "GET", "/api/v0/blueprints/diff/test/"+first+"/"+second, ``, http.StatusOK, `{"diff":[`+
+		`{"old":{"Customizations.hostname":"first"},"new":{"Customizations.hostname":"second"}},`+
+		`{"old":null,"new":{"Customizations.sshkey":{"user":"root","key":"ssh-rsa"}}}]}`)
+	test.TestRoute(t, api, true, "GET", "/api/v0/blueprints/diff/test/"+second+"/WORKSPACE", ``, http.StatusOK, `{"diff":[]}`)
+}
+
 func TestBlueprintsDelete(t *testing.T) {
 	var cases = []struct {
 		Method         string
@@ -444,6 +551,7 @@ func TestBlueprintsDepsolve(t *testing.T) {
 		{rpmmd_mock.BaseFixture, http.StatusOK, `{"blueprints":[{"blueprint":{"name":"test","description":"Test","version":"0.0.1","packages":[{"name":"dep-package1","version":"*"}],"groups":[],"modules":[{"name":"dep-package3","version":"*"}]},"dependencies":[{"name":"dep-package3","epoch":7,"version":"3.0.3","release":"1.fc30","arch":"x86_64"},{"name":"dep-package1","epoch":0,"version":"1.33","release":"2.fc30","arch":"x86_64"},{"name":"dep-package2","epoch":0,"version":"2.9","release":"1.fc30","arch":"x86_64"}]}],"errors":[]}`},
 		{rpmmd_mock.NonExistingPackage, http.StatusOK, `{"blueprints":[{"blueprint":{"name":"test","description":"Test","version":"0.0.1","packages":[{"name":"dep-package1","version":"*"}],"groups":[],"modules":[{"name":"dep-package3","version":"*"}]},"dependencies":[]}],"errors":[{"id":"BlueprintsError","msg":"test: DNF error occured: MarkingErrors: Error occurred when marking packages for installation: Problems in request:\nmissing packages: fash"}]}`},
 		{rpmmd_mock.BadDepsolve, http.StatusOK, `{"blueprints":[{"blueprint":{"name":"test","description":"Test","version":"0.0.1","packages":[{"name":"dep-package1","version":"*"}],"groups":[],"modules":[{"name":"dep-package3","version":"*"}]},"dependencies":[]}],"errors":[{"id":"BlueprintsError","msg":"test: DNF error occured: DepsolveError: There was a problem depsolving ['go2rpm']: \n Problem: conflicting requests\n  - nothing provides askalono-cli needed by go2rpm-1-4.fc31.noarch"}]}`},
+		{rpmmd_mock.DepsolveProblems, http.StatusOK, `{"blueprints":[{"blueprint":{"name":"test","description":"Test","version":"0.0.1","packages":[{"name":"dep-package1","version":"*"}],"groups":[],"modules":[{"name":"dep-package3","version":"*"}]},"dependencies":[]}],"errors":[{"id":"BlueprintsError","msg":"test: DNF error occured: DepsolveError: There was a problem depsolving ['dep-package1', 'dep-package3']: \n Problem: conflicting requests\n  - nothing provides libdep.so.2 needed by dep-package1-1.33-2.fc30.x86_64","problems":[{"kind":"missing-requirement","message":"nothing provides libdep.so.2 needed by dep-package1-1.33-2.fc30.x86_64","spec":"dep-package1","package":"dep-package1-1.33-2.fc30.x86_64","requirement":"libdep.so.2","blueprint_entry":{"type":"package","name":"dep-package1"}},{"kind":"conflict","message":"package dep-package3-7:3.0.3-1.fc30.x86_64 conflicts with dep-package2 provided by dep-package2-2.9-1.fc30.x86_64","spec":"dep-package3","package":"dep-package3-7:3.0.3-1.fc30.x86_64","conflicts":["dep-package2-2.9-1.fc30.x86_64"],"blueprint_entry":{"type":"module","name":"dep-package3"}},{"kind":"other","message":"conflicting requests"}]}]}`},
 	}
 
 	for _, c := range cases {
@@ -454,6 +562,176 @@ func TestBlueprintsDepsolve(t *testing.T) {
 	}
 }
 
+func TestBlueprintsLock(t *testing.T) {
+	api, sf := createWeldrAPI(rpmmd_mock.LockableFixture)
+	test.SendHTTP(api, false, "POST", "/api/v0/blueprints/new", `{"name":"test-lock","description":"Test","packages":[{"name":"dep-package1","version":"*"}],"version":"0.0.0"}`)
+
+	test.TestRoute(t, api, false, "GET", "/api/v1/blueprints/lock/test-lock", ``, http.StatusNotFound, `{"status":false,"errors":[{"id":"BlueprintNotLocked","msg":"test-lock: blueprint has no lockfile"}]}`)
+	test.TestRoute(t, api, false, "POST", "/api/v1/blueprints/lock/test-lock?type=foo", ``, http.StatusBadRequest, `{"status":false,"errors":[{"id":"UnknownComposeType","msg":"Unknown compose type for architecture: foo"}]}`)
+	test.TestRoute(t, api, false, "POST", "/api/v1/blueprints/lock/unknown?type=qcow2", ``, http.StatusBadRequest, `{"status":false,"errors":[{"id":"UnknownBlueprint","msg":"unknown: blueprint not found"}]}`)
+	test.TestRoute(t, api, false, "POST", "/api/v0/compose", `{"blueprint_name":"test-lock","compose_type":"qcow2","locked":true}`, http.StatusBadRequest, `{"status":false,"errors":[{"id":"BlueprintNotLocked","msg":"test-lock: blueprint has no lockfile"}]}`)
+
+	lockedPackages := `[{"name":"dep-package3","epoch":7,"version":"3.0.3","release":"1.fc30","arch":"x86_64"},{"name":"dep-package1","epoch":0,"version":"1.33","release":"2.fc30","arch":"x86_64"},{"name":"dep-package2","epoch":0,"version":"2.9","release":"1.fc30","arch":"x86_64"}]`
+	test.TestRoute(t, api, false, "POST", "/api/v1/blueprints/lock/test-lock?type=qcow2", ``, http.StatusOK, `{"lockfile":{"blueprint":{"name":"test-lock","description":"Test","version":"0.0.0","packages":[{"name":"dep-package1","version":"*"}],"groups":[],"modules":[]},"images":[{"distro":"fedora-30","arch":"x86_64","image_type":"qcow2","packages":`+lockedPackages+`,"build_packages":`+lockedPackages+`}]}}`, "commit", "timestamp")
+
+	lockfile := sf.GetBlueprintLockfile("test-lock", "")
+	require.NotNil(t, lockfile)
+	require.Equal(t, sf.GetBlueprintChanges("test-lock")[0].Commit, lockfile.Commit)
+
+	// The lockfile keeps the locked blueprint even if it changes afterwards
+	test.SendHTTP(api, false, "POST", "/api/v0/blueprints/new", `{"name":"test-lock","description":"Changed","packages":[],"version":"0.0.1"}`)
+	test.TestRoute(t, api, false, "GET", "/api/v1/blueprints/lock/test-lock", ``, http.StatusOK, `{"lockfile":{"blueprint":{"name":"test-lock","description":"Test","version":"0.0.0","packages":[{"name":"dep-package1","version":"*"}],"groups":[],"modules":[]},"images":[{"distro":"fedora-30","arch":"x86_64","image_type":"qcow2","packages":`+lockedPackages+`,"build_packages":`+lockedPackages+`}]}}`, "commit", "timestamp")
+	test.TestRoute(t, api, false, "GET", "/api/v1/blueprints/lock/test-lock?commit="+sf.GetBlueprintChanges("test-lock")[1].Commit, ``, http.StatusNotFound, `{"status":false,"errors":[{"id":"BlueprintNotLocked","msg":"test-lock: blueprint has no lockfile"}]}`)
+
+	test.TestRoute(t, api, false, "POST", "/api/v0/compose?test=2", `{"blueprint_name":"test-lock","compose_type":"qcow2","locked":true}`, http.StatusOK, `{"status":true}`, "build_id")
+
+	var composed bool
+	for _, c := range sf.GetAllComposes() {
+		if c.Blueprint.Name == "test-lock" {
+			require.Equal(t, "Test", c.Blueprint.Description)
+			composed = true
+		}
+	}
+	require.True(t, composed)
+}
+
+func TestBlueprintsLockMissingPackages(t *testing.T) {
+	// The depsolved packages of BaseFixture are not part of its package list
+	api, _ := createWeldrAPI(rpmmd_mock.BaseFixture)
+	test.SendHTTP(api, false, "POST", "/api/v0/blueprints/new", `{"name":"test-lock","description":"Test","packages":[{"name":"dep-package1","version":"*"}],"version":"0.0.0"}`)
+	test.TestRoute(t, api, false, "POST", "/api/v1/blueprints/lock/test-lock?type=qcow2", ``, http.StatusOK, `*`)
+	test.TestRoute(t, api, false, "POST", "/api/v0/compose?test=2", `{"blueprint_name":"test-lock","compose_type":"qcow2","locked":true}`, http.StatusBadRequest, `{"status":false,"errors":[{"id":"LockedPackagesMissing","msg":"locked packages are not available in the repositories anymore: dep-package3-7:3.0.3-1.fc30.x86_64, dep-package1-1.33-2.fc30.x86_64, dep-package2-2.9-1.fc30.x86_64"}]}`)
+}
+
+func TestBlueprintsLockChangedPackages(t *testing.T) {
+	api, _ := createWeldrAPI(rpmmd_mock.RebuiltPackagesFixture)
+	test.SendHTTP(api, false, "POST", "/api/v0/blueprints/new", `{"name":"test-lock","description":"Test","packages":[{"name":"dep-package1","version":"*"}],"version":"0.0.0"}`)
+	test.TestRoute(t, api, false, "POST", "/api/v1/blueprints/lock/test-lock?type=qcow2", ``, http.StatusOK, `*`)
+	test.TestRoute(t, api, false, "POST", "/api/v0/compose?test=2", `{"blueprint_name":"test-lock","compose_type":"qcow2","locked":true}`, http.StatusBadRequest, `{"status":false,"errors":[{"id":"LockedPackagesChanged","msg":"the checksums of locked packages have changed in the repositories: dep-package3-7:3.0.3-1.fc30.x86_64, dep-package1-1.33-2.fc30.x86_64, dep-package2-2.9-1.fc30.x86_64"}]}`)
+}
+
+func TestBlueprintsExportImport(t *testing.T) {
+	api, sf := createWeldrAPI(rpmmd_mock.BaseFixture)
+	test.SendHTTP(api, false, "POST", "/api/v0/blueprints/new", `{"name":"test-export","description":"Test","packages":[{"name":"tmux","version":"*"}],"version":"0.0.0"}`)
+	test.SendHTTP(api, false, "POST", "/api/v0/blueprints/tag/test-export", ``)
+	test.SendHTTP(api, false, "POST", "/api/v0/blueprints/new", `{"name":"test-export","description":"Test","packages":[],"version":"0.0.1"}`)
+	test.SendHTTP(api, false, "POST", "/api/v0/blueprints/workspace", `{"name":"test-export","description":"Workspace","packages":[],"version":"0.0.2"}`)
+
+	test.TestRoute(t, api, false, "GET", "/api/v0/blueprints/export/test-export", ``, http.StatusNotFound, `{"status":false,"errors":[{"code":404,"id":"HTTPError","msg":"Not Found"}]}`)
+	test.TestRoute(t, api, false, "GET", "/api/v1/blueprints/export/unknown", ``, http.StatusBadRequest, `{"status":false,"errors":[{"id":"UnknownBlueprint","msg":"unknown: "}]}`)
+	test.TestRoute(t, api, false, "GET", "/api/v1/blueprints/export/test-export,*", ``, http.StatusBadRequest, `{"status":false,"errors":[{"id":"InvalidChars","msg":"Invalid characters in API path"}]}`)
+
+	resp := test.SendHTTP(api, false, "GET", "/api/v1/blueprints/export/test-export", ``)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "application/x-tar", resp.Header.Get("Content-Type"))
+	archive, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	histories, err := store.ReadBlueprintArchive(bytes.NewReader(archive))
+	require.NoError(t, err)
+	require.Len(t, histories, 1)
+	require.Equal(t, "test-export", histories[0].Name)
+	require.Equal(t, "0.0.1", histories[0].Blueprint.Version)
+	require.Equal(t, "Workspace", histories[0].Workspace.Description)
+	require.Len(t, histories[0].Changes, 2)
+	require.Equal(t, 1, *histories[0].Changes[0].Revision)
+
+	// all blueprints
+	resp = test.SendHTTP(api, false, "GET", "/api/v1/blueprints/export/", ``)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	histories, err = store.ReadBlueprintArchive(resp.Body)
+	require.NoError(t, err)
+	require.Len(t, histories, 2)
+	require.Equal(t, "test", histories[0].Name)
+	require.Equal(t, "test-export", histories[1].Name)
+
+	// deleted blueprints keep their history
+	test.SendHTTP(api, false, "POST", "/api/v0/blueprints/new", `{"name":"test-deleted","description":"Test","packages":[],"version":"0.0.0"}`)
+	test.SendHTTP(api, false, "DELETE", "/api/v0/blueprints/delete/test-deleted", ``)
+	resp = test.SendHTTP(api, false, "GET", "/api/v1/blueprints/export/", ``)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	histories, err = store.ReadBlueprintArchive(resp.Body)
+	require.NoError(t, err)
+	require.Len(t, histories, 3)
+	require.Equal(t, "test-deleted", histories[1].Name)
+	require.Nil(t, histories[1].Blueprint)
+	require.Len(t, histories[1].Changes, 1)
+
+	importArchive := func(api *API, contentType string, body []byte) *http.Response {
+		req := httptest.NewRequest("POST", "/api/v1/blueprints/import", bytes.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		recorder := httptest.NewRecorder()
+		api.ServeHTTP(recorder, req)
+		return recorder.Result()
+	}
+
+	imported, importedStore := createWeldrAPI(rpmmd_mock.BaseFixture)
+	resp = importArchive(imported, "application/json", archive)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp = importArchive(imported, "application/x-tar", []byte("not a tarball"))
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// nothing is imported if one of the blueprints is invalid
+	var invalid bytes.Buffer
+	require.NoError(t, store.WriteBlueprintArchive(&invalid, []store.BlueprintHistory{
+		{Name: "imported-first", Blueprint: &blueprint.Blueprint{Name: "imported-first", Version: "0.0.1"}},
+		{Name: "invalid", Workspace: &blueprint.Blueprint{Name: "invalid", Version: "not-semver"}},
+	}))
+	resp = importArchive(imported, "application/x-tar", invalid.Bytes())
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	require.Nil(t, importedStore.GetBlueprintCommitted("imported-first"))
+
+	resp = importArchive(imported, "application/x-tar", archive)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var reply BlueprintsImportV1
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&reply))
+	require.Equal(t, []string{"test-export"}, reply.Blueprints)
+
+	require.Equal(t, sf.GetBlueprintChanges("test-export"), importedStore.GetBlueprintChanges("test-export"))
+	require.Equal(t, sf.GetBlueprintCommitted("test-export"), importedStore.GetBlueprintCommitted("test-export"))
+	workspace, changed := importedStore.GetBlueprint("test-export")
+	require.True(t, changed)
+	require.Equal(t, "Workspace", workspace.Description)
+}
+
+func TestComposeSnapshots(t *testing.T) {
+	api, sf := createWeldrAPI(rpmmd_mock.BaseFixture)
+	test.TestRoute(t, api, false, "GET", "/api/v1/projects/source/snapshots", ``, http.StatusOK, `{"snapshots":[]}`)
+
+	test.TestRoute(t, api, false, "POST", "/api/v0/compose?test=2", `{"blueprint_name":"test","compose_type":"qcow2"}`, http.StatusOK, `{"status":true}`, "build_id")
+	snapshots := sf.ListSnapshots()
+	require.Len(t, snapshots, 1)
+	test.TestRoute(t, api, false, "GET", "/api/v1/projects/source/snapshots", ``, http.StatusOK, `{"snapshots":[{"repos":[{"name":"test-id","baseurl":"http://example.com/test/os/x86_64","checksum":"sha256:f34848ca92665c342abd5816c9e3eda0e82180671195362bcd0080544a3bc2ac","distro":"fedora-30","arch":"x86_64"}]}]}`, "id", "created")
+
+	// the same snapshot again
+	test.TestRoute(t, api, false, "POST", "/api/v0/compose?test=2", `{"blueprint_name":"test","compose_type":"qcow2","snapshot":"`+snapshots[0].ID.String()+`"}`, http.StatusOK, `{"status":true}`, "build_id")
+	require.Len(t, sf.ListSnapshots(), 2)
+
+	// the repository changed since the snapshot was taken
+	changed := snapshots[0]
+	changed.ID = uuid.New()
+	changed.Repos[0].Checksum = "sha256:0000"
+	require.NoError(t, sf.PushSnapshot(changed))
+	test.TestRoute(t, api, false, "POST", "/api/v0/compose?test=2", `{"blueprint_name":"test","compose_type":"qcow2","snapshot":"`+changed.ID.String()+`"}`, http.StatusBadRequest, `{"status":false,"errors":[{"id":"SnapshotMismatch","msg":"repositories changed since snapshot `+changed.ID.String()+`: test-id"}]}`)
+
+	test.TestRoute(t, api, false, "POST", "/api/v0/compose?test=2", `{"blueprint_name":"test","compose_type":"qcow2","snapshot":"`+uuid.Nil.String()+`"}`, http.StatusBadRequest, `{"status":false,"errors":[{"id":"UnknownSnapshot","msg":"Unknown snapshot: 00000000-0000-0000-0000-000000000000"}]}`)
+	test.TestRoute(t, api, false, "POST", "/api/v0/compose?test=2", `{"blueprint_name":"test","compose_type":"qcow2","snapshot_date":"2020-13-01"}`, http.StatusBadRequest, `{"status":false,"errors":[{"id":"InvalidSnapshot","msg":"invalid snapshot date, must be YYYY-MM-DD: 2020-13-01"}]}`)
+	test.TestRoute(t, api, false, "POST", "/api/v0/compose?test=2", `{"blueprint_name":"test","compose_type":"qcow2","snapshot_date":"2020-10-01"}`, http.StatusBadRequest, `{"status":false,"errors":[{"id":"InvalidSnapshot","msg":"repository test-id does not support snapshots"}]}`)
+
+	// sources with a snapshot mirror can be composed as of a date
+	test.SendHTTP(api, false, "POST", "/api/v1/projects/source/new", `{"id":"snap","name":"Snapshotted","type":"yum-baseurl","url":"https://example.com/snap/","snapshot_url":"https://snapshots.example.com/{date}/snap/","check_gpg":false,"check_ssl":false}`)
+	test.TestRoute(t, api, false, "GET", "/api/v1/projects/source/info/snap", ``, http.StatusOK, `{"sources":{"snap":{"id":"snap","name":"Snapshotted","type":"yum-baseurl","url":"https://example.com/snap/","snapshot_url":"https://snapshots.example.com/{date}/snap/","check_gpg":false,"check_ssl":false,"system":false}},"errors":[]}`)
+
+	// repositories pinned to a snapshot mirror are not compared with the
+	// live repositories anymore
+	pinned := snapshots[0]
+	pinned.ID = uuid.New()
+	pinned.Repos[0].BaseURL = "https://snapshots.example.com/2020-10-01/test/"
+	pinned.Repos[0].Checksum = "sha256:0000"
+	pinned.Repos[0].PinnedDate = "2020-10-01"
+	require.NoError(t, sf.PushSnapshot(pinned))
+	test.TestRoute(t, api, false, "POST", "/api/v0/compose?test=2", `{"blueprint_name":"test","compose_type":"qcow2","snapshot":"`+pinned.ID.String()+`"}`, http.StatusOK, `{"status":true}`, "build_id")
+}
+
 func TestCompose(t *testing.T) {
 	arch, err := test_distro.New().GetArch("x86_64")
 	require.NoError(t, err)
@@ -470,16 +748,18 @@ func TestCompose(t *testing.T) {
 			Groups:         []blueprint.Group{},
 			Customizations: nil,
 		},
-		ImageBuild: store.ImageBuild{
-			QueueStatus: common.IBWaiting,
-			ImageType:   imgType,
-			Manifest:    manifest,
-			Targets: []*target.Target{
-				{
-					// skip Uuid and Created fields - they are ignored
-					Name: "org.osbuild.local",
-					Options: &target.LocalTargetOptions{
-						Filename: "test.img",
+		ImageBuilds: []store.ImageBuild{
+			{
+				QueueStatus: common.IBWaiting,
+				ImageType:   imgType,
+				Manifest:    manifest,
+				Targets: []*target.Target{
+					{
+						// skip Uuid and Created fields - they are ignored
+						Name: "org.osbuild.local",
+						Options: &target.LocalTargetOptions{
+							Filename: "test.img",
+						},
 					},
 				},
 			},
@@ -494,29 +774,31 @@ func TestCompose(t *testing.T) {
 			Groups:         []blueprint.Group{},
 			Customizations: nil,
 		},
-		ImageBuild: store.ImageBuild{
-			QueueStatus: common.IBWaiting,
-			ImageType:   imgType,
-			Manifest:    manifest,
-			Targets: []*target.Target{
-				{
-					Name:      "org.osbuild.aws",
-					Status:    common.IBWaiting,
-					ImageName: "test_upload",
-					Options: &target.AWSTargetOptions{
-						Filename:        "test.img",
-						Region:          "frankfurt",
-						AccessKeyID:     "accesskey",
-						SecretAccessKey: "secretkey",
-						Bucket:          "clay",
-						Key:             "imagekey",
+		ImageBuilds: []store.ImageBuild{
+			{
+				QueueStatus: common.IBWaiting,
+				ImageType:   imgType,
+				Manifest:    manifest,
+				Targets: []*target.Target{
+					{
+						Name:      "org.osbuild.aws",
+						Status:    common.IBWaiting,
+						ImageName: "test_upload",
+						Options: &target.AWSTargetOptions{
+							Filename:        "test.img",
+							Region:          "frankfurt",
+							AccessKeyID:     "accesskey",
+							SecretAccessKey: "secretkey",
+							Bucket:          "clay",
+							Key:             "imagekey",
+						},
 					},
-				},
-				{
-					// skip Uuid and Created fields - they are ignored
-					Name: "org.osbuild.local",
-					Options: &target.LocalTargetOptions{
-						Filename: "test.img",
+					{
+						// skip Uuid and Created fields - they are ignored
+						Name: "org.osbuild.local",
+						Options: &target.LocalTargetOptions{
+							Filename: "test.img",
+						},
 					},
 				},
 			},
@@ -557,14 +839,201 @@ func TestCompose(t *testing.T) {
 			break
 		}
 
-		require.NotNilf(t, composeStruct.ImageBuild.Manifest, "%s: the compose in the store did not contain a blueprint", c.Path)
+		require.NotNilf(t, composeStruct.ImageBuilds[0].Manifest, "%s: the compose in the store did not contain a blueprint", c.Path)
 
-		if diff := cmp.Diff(composeStruct, *c.ExpectedCompose, test.IgnoreDates(), test.IgnoreUuids(), test.Ignore("Targets.Options.Location"), test.CompareImageTypes()); diff != "" {
+		if diff := cmp.Diff(composeStruct, *c.ExpectedCompose, test.IgnoreDates(), test.IgnoreUuids(), test.Ignore("ImageBuilds.Targets.Options.Location"), test.CompareImageTypes()); diff != "" {
 			t.Errorf("%s: compose in store isn't the same as expected, diff:\n%s", c.Path, diff)
 		}
 	}
 }
 
+func TestComposeVariables(t *testing.T) {
+	api, s := createWeldrAPI(rpmmd_mock.NoComposesFixture)
+	defaultNTP := "ntp.example.com"
+	hostname := "${hostname}"
+	err := s.PushBlueprint(blueprint.Blueprint{
+		Name: "vars",
+		Variables: []blueprint.Variable{
+			{Name: "hostname"},
+			{Name: "ntp_server", Default: &defaultNTP},
+			{Name: "debug", Type: blueprint.VariableTypeBoolean, Default: &[]string{"false"}[0]},
+		},
+		Customizations: &blueprint.Customizations{
+			Hostname: &hostname,
+			Timezone: &blueprint.TimezoneCustomization{NTPServers: []string{"${ntp_server}"}},
+		},
+	}, "variables")
+	require.NoError(t, err)
+
+	test.TestRoute(t, api, false, "POST", "/api/v0/compose", `{"blueprint_name":"vars","compose_type":"qcow2"}`, http.StatusBadRequest, `{"status":false,"errors":[{"id":"InvalidVariables","msg":"variable 'hostname' requires a value"}]}`)
+	test.TestRoute(t, api, false, "POST", "/api/v0/compose", `{"blueprint_name":"vars","compose_type":"qcow2","variables":{"hostname":"web-1","debug":"maybe","other":"1"}}`, http.StatusBadRequest, `{"status":false,"errors":[{"id":"InvalidVariables","msg":"variable 'debug' must be a boolean, not 'maybe'; blueprint has no variable 'other'"}]}`)
+	require.Empty(t, s.GetAllComposes())
+
+	test.TestRoute(t, api, false, "POST", "/api/v0/compose?test=2", `{"blueprint_name":"vars","compose_type":"qcow2","variables":{"hostname":"web-1","debug":"true"}}`, http.StatusOK, `{"status":true}`, "build_id")
+	composes := s.GetAllComposes()
+	require.Len(t, composes, 1)
+	for id, compose := range composes {
+		expected := map[string]string{"hostname": "web-1", "ntp_server": "ntp.example.com", "debug": "true"}
+		require.Equal(t, expected, compose.Variables)
+		// the blueprint of the compose is the one with the references
+		require.Equal(t, "${hostname}", *compose.Blueprint.Customizations.Hostname)
+
+		resp := test.SendHTTP(api, false, "GET", "/api/v0/compose/info/"+id.String(), ``)
+		var info struct {
+			Variables map[string]string `json:"variables"`
+		}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&info))
+		require.Equal(t, expected, info.Variables)
+	}
+}
+
+func TestComposeImageBuilds(t *testing.T) {
+	artifactsDir, err := ioutil.TempDir("", "weldr-compose-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(artifactsDir)
+
+	api, _, s := createFedoraTestAPI(t, artifactsDir)
+
+	test.TestRoute(t, api, false, "POST", "/api/v0/compose?test=2", `{"blueprint_name":"test","compose_type":"qcow2","compose_types":["qcow2"]}`, http.StatusBadRequest, `{"status":false,"errors":[{"id":"UnknownComposeType","msg":"only one of 'compose_type' and 'compose_types' may be given"}]}`)
+	test.TestRoute(t, api, false, "POST", "/api/v0/compose?test=2", `{"blueprint_name":"test","compose_types":["qcow2","rpm"]}`, http.StatusBadRequest, `{"status":false,"errors":[{"id":"UnknownComposeType","msg":"Unknown compose type for architecture: rpm"}]}`)
+	test.TestRoute(t, api, false, "POST", "/api/v0/compose?test=2", `{"blueprint_name":"test","compose_types":["qcow2","qcow2"]}`, http.StatusBadRequest, `{"status":false,"errors":[{"id":"UnknownComposeType","msg":"compose type qcow2 is given more than once"}]}`)
+	test.TestRoute(t, api, false, "POST", "/api/v0/compose?test=2", `{"blueprint_name":"test","compose_types":["qcow2"],"arches":["s390x"]}`, http.StatusBadRequest, `{"status":false,"errors":[{"id":"UnknownArch","msg":"Unknown architecture: s390x"}]}`)
+	require.Empty(t, s.GetAllComposes())
+
+	test.TestRoute(t, api, false, "POST", "/api/v0/compose?test=2", `{"blueprint_name":"test","compose_types":["qcow2","vhd"],"arches":["x86_64"]}`, http.StatusOK, `{"status":true}`, "build_id")
+
+	composes := s.GetAllComposes()
+	require.Len(t, composes, 1)
+	var id uuid.UUID
+	var compose store.Compose
+	for composeID, c := range composes {
+		id = composeID
+		compose = c
+		break
+	}
+	require.Len(t, compose.ImageBuilds, 2)
+	for i, ib := range compose.ImageBuilds {
+		require.Equal(t, i, ib.ID)
+		require.Equal(t, i, ib.GetLocalTargetOptions().ImageBuildId)
+	}
+
+	resp := test.SendHTTP(api, false, "GET", "/api/v0/compose/status/"+id.String(), ``)
+	var status struct {
+		UUIDs []ComposeEntry `json:"uuids"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&status))
+	require.Len(t, status.UUIDs, 1)
+	require.Equal(t, common.IBFinished, status.UUIDs[0].QueueStatus)
+	require.Len(t, status.UUIDs[0].ImageBuilds, 2)
+	for i, entry := range status.UUIDs[0].ImageBuilds {
+		require.Equal(t, i, entry.ID)
+		require.Equal(t, []string{"qcow2", "vhd"}[i], entry.ComposeType)
+		require.Equal(t, "x86_64", entry.Arch)
+		require.Equal(t, common.IBFinished, entry.QueueStatus)
+	}
+
+	resp = test.SendHTTP(api, false, "GET", "/api/v0/compose/metadata/"+id.String()+"?build=1", ``)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "application/x-tar", resp.Header.Get("Content-Type"))
+	test.TestRoute(t, api, false, "GET", "/api/v0/compose/image/"+id.String()+"?build=2", ``, http.StatusBadRequest, `{"status":false,"errors":[{"id":"UnknownBuild","msg":"Compose `+id.String()+` has no image build 2"}]}`)
+	test.TestRoute(t, api, false, "GET", "/api/v0/compose/logs/"+id.String()+"?build=x", ``, http.StatusBadRequest, `{"status":false,"errors":[{"id":"UnknownBuild","msg":"Compose `+id.String()+` has no image build x"}]}`)
+}
+
+func TestComposeArches(t *testing.T) {
+	api, _ := createWeldrAPI(rpmmd_mock.NoComposesFixture)
+	test.TestRoute(t, api, false, "POST", "/api/v1/compose", `{"blueprint_name":"test","compose_type":"qcow2","arches":["aarch64"]}`, http.StatusBadRequest, `{"status":false,"errors":[{"id":"UnsupportedArch","msg":"No repositories configured for aarch64"}]}`)
+	test.TestRoute(t, api, false, "GET", "/api/v1/compose/types?arch=aarch64", ``, http.StatusBadRequest, `{"status":false,"errors":[{"id":"UnsupportedArch","msg":"No repositories configured for aarch64"}]}`)
+
+	fixture := rpmmd_mock.NoComposesFixture()
+	d := test_distro.New()
+	arch, err := d.GetArch("x86_64")
+	require.NoError(t, err)
+	distros, err := distro.NewRegistry(d)
+	require.NoError(t, err)
+	repos := map[string]map[string][]rpmmd.RepoConfig{
+		d.Name(): {
+			"x86_64":  {{Name: "test-id", BaseURL: "http://example.com/test/os/x86_64", CheckGPG: true}},
+			"aarch64": {{Name: "test-id", BaseURL: "http://example.com/test/os/aarch64", CheckGPG: true}},
+		},
+	}
+	api = New(rpmmd_mock.NewRPMMDMock(fixture), arch, distros, repos, nil, fixture.Store, fixture.Workers, "")
+
+	test.TestRoute(t, api, false, "GET", "/api/v1/compose/types?arch=aarch64", ``, http.StatusOK, `{"types":[{"name":"qcow2","enabled":true}]}`)
+	test.TestRoute(t, api, false, "POST", "/api/v1/compose", `{"blueprint_name":"test","compose_type":"qcow2","arches":["aarch64","x86_64"]}`, http.StatusOK, `{"status":true}`, "build_id")
+
+	composes := fixture.Store.GetAllComposes()
+	require.Len(t, composes, 1)
+	for _, compose := range composes {
+		require.Len(t, compose.ImageBuilds, 2)
+		require.Equal(t, "aarch64", compose.ImageBuilds[0].ImageType.Arch().Name())
+		require.Equal(t, "x86_64", compose.ImageBuilds[1].ImageType.Arch().Name())
+	}
+
+	// the job of each image build is only handed to workers of its arch
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, _, job, err := fixture.Workers.RequestOSBuildJob(ctx, "aarch64")
+	require.NoError(t, err)
+	require.Equal(t, 0, job.Targets[0].Options.(*target.LocalTargetOptions).ImageBuildId)
+	_, _, job, err = fixture.Workers.RequestOSBuildJob(ctx, "x86_64")
+	require.NoError(t, err)
+	require.Equal(t, 1, job.Targets[0].Options.(*target.LocalTargetOptions).ImageBuildId)
+
+	snapshots := fixture.Store.ListSnapshots()
+	require.Len(t, snapshots, 1)
+	require.Len(t, snapshots[0].ArchRepos(d.Name(), "aarch64", arch), 1)
+	require.Equal(t, "http://example.com/test/os/aarch64", snapshots[0].ArchRepos(d.Name(), "aarch64", arch)[0].BaseURL)
+	require.Len(t, snapshots[0].ArchRepos(d.Name(), "x86_64", arch), 1)
+}
+
+func TestComposeDistros(t *testing.T) {
+	api, _ := createWeldrAPI(rpmmd_mock.NoComposesFixture)
+	test.TestRoute(t, api, false, "GET", "/api/v1/distros/list", ``, http.StatusOK, `{"distros":["fedora-30"]}`)
+	test.TestRoute(t, api, false, "POST", "/api/v1/compose", `{"blueprint_name":"test","compose_type":"qcow2","distro":"fedora-33"}`, http.StatusBadRequest, `{"status":false,"errors":[{"id":"UnknownDistro","msg":"Unknown distribution: fedora-33"}]}`)
+
+	fixture := rpmmd_mock.NoComposesFixture()
+	d := test_distro.New()
+	arch, err := d.GetArch("x86_64")
+	require.NoError(t, err)
+	distros, err := distro.NewRegistry(d, fedora32.New(), fedora33.New())
+	require.NoError(t, err)
+	repos := map[string]map[string][]rpmmd.RepoConfig{
+		d.Name():    {"x86_64": {{Name: "test-id", BaseURL: "http://example.com/test/os/x86_64", CheckGPG: true}}},
+		"fedora-33": {"x86_64": {{Name: "test-id", BaseURL: "http://example.com/fedora/33/x86_64", CheckGPG: true}}},
+	}
+	api = New(rpmmd_mock.NewRPMMDMock(fixture), arch, distros, repos, nil, fixture.Store, fixture.Workers, "")
+
+	// fedora-32 has no repositories
+	test.TestRoute(t, api, false, "GET", "/api/v1/distros/list", ``, http.StatusOK, `{"distros":["fedora-30","fedora-33"]}`)
+	test.TestRoute(t, api, false, "POST", "/api/v1/compose", `{"blueprint_name":"test","compose_type":"qcow2","distro":"fedora-32"}`, http.StatusBadRequest, `{"status":false,"errors":[{"id":"UnsupportedDistro","msg":"No repositories configured for fedora-32"}]}`)
+	test.TestRoute(t, api, false, "POST", "/api/v1/compose", `{"blueprint_name":"test","compose_type":"qcow2","distro":"fedora-33","arches":["aarch64"]}`, http.StatusBadRequest, `{"status":false,"errors":[{"id":"UnsupportedArch","msg":"No repositories configured for aarch64"}]}`)
+	test.TestRoute(t, api, false, "GET", "/api/v1/compose/types?distro=fedora-32", ``, http.StatusBadRequest, `{"status":false,"errors":[{"id":"UnsupportedDistro","msg":"No repositories configured for fedora-32"}]}`)
+
+	test.TestRoute(t, api, false, "POST", "/api/v1/compose", `{"blueprint_name":"test","compose_type":"qcow2","distro":"fedora-33"}`, http.StatusOK, `{"status":true}`, "build_id")
+
+	// the distribution of the blueprint is used unless the compose
+	// request overrides it
+	test.TestRoute(t, api, true, "POST", "/api/v1/blueprints/new", `{"name":"test-distro","description":"Test","distro":"fedora-33","packages":[],"version":"0.0.1"}`, http.StatusOK, `{"status":true}`)
+	test.TestRoute(t, api, false, "POST", "/api/v1/compose", `{"blueprint_name":"test-distro","compose_type":"qcow2"}`, http.StatusOK, `{"status":true}`, "build_id")
+	test.TestRoute(t, api, false, "POST", "/api/v1/compose", `{"blueprint_name":"test-distro","compose_type":"qcow2","distro":"fedora-30"}`, http.StatusOK, `{"status":true}`, "build_id")
+
+	distroNames := map[string][]string{}
+	for _, compose := range fixture.Store.GetAllComposes() {
+		require.Len(t, compose.ImageBuilds, 1)
+		distroName := compose.ImageBuilds[0].ImageType.Arch().Distro().Name()
+		distroNames[compose.Blueprint.Name] = append(distroNames[compose.Blueprint.Name], distroName)
+	}
+	require.Equal(t, []string{"fedora-33"}, distroNames["test"])
+	require.ElementsMatch(t, []string{"fedora-33", "fedora-30"}, distroNames["test-distro"])
+
+	for _, snapshot := range fixture.Store.ListSnapshots() {
+		require.Len(t, snapshot.Repos, 1)
+		if snapshot.Repos[0].Distro == "fedora-33" {
+			require.Equal(t, "http://example.com/fedora/33/x86_64", snapshot.Repos[0].BaseURL)
+		}
+	}
+}
+
 func TestComposeDelete(t *testing.T) {
 	if len(os.Getenv("OSBUILD_COMPOSER_TEST_EXTERNAL")) > 0 {
 		t.Skip("This test is for internal testing only")
@@ -1036,3 +1505,511 @@ func TestModulesList(t *testing.T) {
 		test.TestRoute(t, api, true, "GET", c.Path, ``, c.ExpectedStatus, c.ExpectedJSON)
 	}
 }
+
+// pushRetentionTestCompose pushes a compose of blueprint `bpName` whose job
+// has finished with `size` bytes of artifacts
+func pushRetentionTestCompose(t *testing.T, api *API, artifactsDir, bpName string, success bool, size int) uuid.UUID {
+	t.Helper()
+	imageType, err := api.arch.GetImageType("qcow2")
+	require.NoError(t, err)
+	manifest, err := imageType.Manifest(nil, distro.ImageOptions{}, nil, nil, nil)
+	require.NoError(t, err)
+
+	jobID, err := api.workers.Enqueue(api.arch.Name(), manifest, nil)
+	require.NoError(t, err)
+	token, _, _, err := api.workers.RequestOSBuildJob(context.Background(), api.arch.Name())
+	require.NoError(t, err)
+	tmpDir := path.Join(artifactsDir, "tmp", token.String())
+	require.NoError(t, os.MkdirAll(tmpDir, 0700))
+	require.NoError(t, ioutil.WriteFile(path.Join(tmpDir, "disk.qcow2"), make([]byte, size), 0600))
+	err = api.workers.FinishJob(token, &worker.OSBuildJobResult{OSBuildOutput: &osbuild.Result{Success: success}})
+	require.NoError(t, err)
+
+	id := uuid.New()
+	err = api.store.PushCompose(id, &blueprint.Blueprint{Name: bpName}, nil, []store.ImageBuild{
+		{
+			ImageType: imageType,
+			Manifest:  manifest,
+			JobID:     jobID,
+		},
+	})
+	require.NoError(t, err)
+	return id
+}
+
+func TestCollectComposes(t *testing.T) {
+	type compose struct {
+		Blueprint string
+		Success   bool
+		Size      int
+	}
+
+	// composes are pushed oldest first
+	var cases = []struct {
+		Name     string
+		Composes []compose
+		Policy   RetentionPolicy
+		Age      time.Duration
+		Deleted  []int
+	}{
+		{
+			"empty policy",
+			[]compose{{"a", true, 10}, {"a", false, 10}},
+			RetentionPolicy{},
+			time.Hour,
+			nil,
+		},
+		{
+			"max age",
+			[]compose{{"a", true, 10}, {"b", false, 10}},
+			RetentionPolicy{MaxAge: time.Minute},
+			time.Hour,
+			[]int{0, 1},
+		},
+		{
+			"max age not reached",
+			[]compose{{"a", true, 10}, {"b", false, 10}},
+			RetentionPolicy{MaxAge: 2 * time.Hour},
+			time.Hour,
+			nil,
+		},
+		{
+			"max composes per blueprint",
+			[]compose{{"a", true, 10}, {"a", false, 10}, {"b", true, 10}, {"a", true, 10}},
+			RetentionPolicy{MaxComposesPerBlueprint: 2},
+			0,
+			[]int{0},
+		},
+		{
+			"keep last successful",
+			[]compose{{"a", true, 10}, {"a", false, 10}, {"a", false, 10}},
+			RetentionPolicy{MaxComposesPerBlueprint: 1, KeepLastSuccessful: 1},
+			0,
+			[]int{1},
+		},
+		{
+			"keep last successful with max age",
+			[]compose{{"a", true, 10}, {"a", true, 10}, {"b", false, 10}},
+			RetentionPolicy{MaxAge: time.Minute, KeepLastSuccessful: 1},
+			time.Hour,
+			[]int{0, 2},
+		},
+		{
+			"max disk usage",
+			[]compose{{"a", true, 10}, {"b", true, 20}, {"a", true, 30}},
+			RetentionPolicy{MaxDiskUsage: 35},
+			0,
+			[]int{0, 1},
+		},
+		{
+			"max disk usage after other limits",
+			[]compose{{"a", true, 10}, {"b", true, 20}, {"a", true, 30}, {"a", false, 5}},
+			RetentionPolicy{MaxDiskUsage: 35, MaxComposesPerBlueprint: 2, KeepLastSuccessful: 1},
+			0,
+			[]int{0, 3},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			artifactsDir, err := ioutil.TempDir("", "weldr-retention-test-")
+			require.NoError(t, err)
+			defer os.RemoveAll(artifactsDir)
+
+			api, s := createWeldrAPI(rpmmd_mock.BaseFixture)
+			api.workers = worker.NewServer(nil, testjobqueue.New(), artifactsDir)
+			for id := range s.GetAllComposes() {
+				require.NoError(t, s.DeleteCompose(id))
+			}
+
+			// a waiting compose is never deleted
+			waitingID := uuid.New()
+			imageType, err := api.arch.GetImageType("qcow2")
+			require.NoError(t, err)
+			err = s.PushCompose(waitingID, &blueprint.Blueprint{Name: "a"}, nil, []store.ImageBuild{
+				{
+					ImageType:   imageType,
+					QueueStatus: common.IBWaiting,
+					JobCreated:  time.Now(),
+				},
+			})
+			require.NoError(t, err)
+
+			var ids []uuid.UUID
+			for _, compose := range c.Composes {
+				ids = append(ids, pushRetentionTestCompose(t, api, artifactsDir, compose.Blueprint, compose.Success, compose.Size))
+				// jobs are ordered by their finish time
+				time.Sleep(time.Millisecond)
+			}
+
+			var expected []uuid.UUID
+			jobIDs := make(map[uuid.UUID]uuid.UUID)
+			for _, i := range c.Deleted {
+				expected = append(expected, ids[i])
+				compose, exists := s.GetCompose(ids[i])
+				require.True(t, exists)
+				jobIDs[ids[i]] = compose.ImageBuilds[0].JobID
+			}
+
+			deleted, err := api.CollectComposes(c.Policy, time.Now().Add(c.Age))
+			require.NoError(t, err)
+			require.ElementsMatch(t, expected, deleted)
+
+			_, exists := s.GetCompose(waitingID)
+			require.True(t, exists)
+			// jobs and artifacts of deleted composes are gone
+			for _, id := range deleted {
+				_, exists := s.GetCompose(id)
+				require.False(t, exists)
+				_, err = api.workers.JobStatus(jobIDs[id])
+				require.Equal(t, jobqueue.ErrNotExist, err)
+				_, err = os.Stat(path.Join(artifactsDir, jobIDs[id].String()))
+				require.True(t, os.IsNotExist(err))
+			}
+		})
+	}
+}
+
+func TestCollectComposesWithoutSize(t *testing.T) {
+	artifactsDir, err := ioutil.TempDir("", "weldr-retention-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(artifactsDir)
+
+	api, s := createWeldrAPI(rpmmd_mock.BaseFixture)
+	api.workers = worker.NewServer(nil, testjobqueue.New(), artifactsDir)
+	for id := range s.GetAllComposes() {
+		require.NoError(t, s.DeleteCompose(id))
+	}
+	id := pushRetentionTestCompose(t, api, artifactsDir, "a", true, 10)
+
+	// replace the artifacts with a file, so that their size can't be read
+	require.NoError(t, os.RemoveAll(artifactsDir))
+	require.NoError(t, ioutil.WriteFile(artifactsDir, nil, 0600))
+
+	deleted, err := api.CollectComposes(RetentionPolicy{MaxDiskUsage: 5}, time.Now())
+	require.NoError(t, err)
+	require.Empty(t, deleted)
+	_, exists := s.GetCompose(id)
+	require.True(t, exists)
+}
+
+func TestCollectSnapshots(t *testing.T) {
+	api, s := createWeldrAPI(rpmmd_mock.BaseFixture)
+
+	var ids []uuid.UUID
+	created := time.Now()
+	for i := 0; i < 3; i++ {
+		snapshot := store.NewSnapshot(uuid.New(), "")
+		snapshot.Created = created.Add(time.Duration(i) * time.Second)
+		require.NoError(t, s.PushSnapshot(snapshot))
+		ids = append(ids, snapshot.ID)
+	}
+
+	deleted, err := api.CollectSnapshots(RetentionPolicy{})
+	require.NoError(t, err)
+	require.Empty(t, deleted)
+
+	deleted, err = api.CollectSnapshots(RetentionPolicy{MaxSnapshots: 2})
+	require.NoError(t, err)
+	require.Equal(t, ids[:1], deleted)
+	snapshots := s.ListSnapshots()
+	require.Len(t, snapshots, 2)
+	require.Equal(t, ids[1], snapshots[0].ID)
+	require.Equal(t, ids[2], snapshots[1].ID)
+}
+
+func TestComposeDeleteRunningImageBuild(t *testing.T) {
+	artifactsDir, err := ioutil.TempDir("", "weldr-delete-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(artifactsDir)
+
+	api, s := createWeldrAPI(rpmmd_mock.BaseFixture)
+	api.workers = worker.NewServer(nil, testjobqueue.New(), artifactsDir)
+
+	imageType, err := api.arch.GetImageType("qcow2")
+	require.NoError(t, err)
+	manifest, err := imageType.Manifest(nil, distro.ImageOptions{}, nil, nil, nil)
+	require.NoError(t, err)
+
+	// the first image build failed, while the second one is still running
+	failedID, err := api.workers.Enqueue(api.arch.Name(), manifest, nil)
+	require.NoError(t, err)
+	token, _, _, err := api.workers.RequestOSBuildJob(context.Background(), api.arch.Name())
+	require.NoError(t, err)
+	err = api.workers.FinishJob(token, &worker.OSBuildJobResult{OSBuildOutput: &osbuild.Result{Success: false}})
+	require.NoError(t, err)
+
+	runningID, err := api.workers.Enqueue(api.arch.Name(), manifest, nil)
+	require.NoError(t, err)
+	token, _, _, err = api.workers.RequestOSBuildJob(context.Background(), api.arch.Name())
+	require.NoError(t, err)
+
+	id := uuid.New()
+	err = s.PushCompose(id, &blueprint.Blueprint{Name: "test"}, nil, []store.ImageBuild{
+		{ImageType: imageType, Manifest: manifest, JobID: failedID},
+		{ImageType: imageType, Manifest: manifest, JobID: runningID},
+	})
+	require.NoError(t, err)
+
+	compose, exists := s.GetCompose(id)
+	require.True(t, exists)
+	err = api.deleteCompose(id, compose)
+	require.NoError(t, err)
+	_, exists = s.GetCompose(id)
+	require.False(t, exists)
+
+	for _, jobID := range []uuid.UUID{failedID, runningID} {
+		_, err = api.workers.JobStatus(jobID)
+		require.Equal(t, jobqueue.ErrNotExist, err)
+	}
+
+	// the worker of the deleted job can't finish it anymore and its
+	// artifacts are removed
+	err = api.workers.FinishJob(token, &worker.OSBuildJobResult{OSBuildOutput: &osbuild.Result{Success: true}})
+	require.Error(t, err)
+	_, err = os.Stat(path.Join(artifactsDir, "tmp", token.String()))
+	require.True(t, os.IsNotExist(err))
+}
+
+// composeUploads returns the uploads of the compose with the given id in
+// JSON, without their uuid and creation time
+func composeUploads(t *testing.T, api *API, id uuid.UUID) string {
+	t.Helper()
+	resp := test.SendHTTP(api, false, "GET", "/api/v1/compose/status/"+id.String(), ``)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var reply struct {
+		UUIDs []struct {
+			Uploads []map[string]interface{} `json:"uploads"`
+		} `json:"uuids"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&reply))
+	require.Len(t, reply.UUIDs, 1)
+	for _, upload := range reply.UUIDs[0].Uploads {
+		delete(upload, "uuid")
+		delete(upload, "creation_time")
+	}
+	uploads, err := json.Marshal(reply.UUIDs[0].Uploads)
+	require.NoError(t, err)
+	return string(uploads)
+}
+
+// createFedoraTestAPI creates a weldr API for fedora-33, whose worker server
+// keeps artifacts in artifactsDir
+func createFedoraTestAPI(t *testing.T, artifactsDir string) (*API, distro.Arch, *store.Store) {
+	t.Helper()
+	fixture := rpmmd_mock.NoComposesFixture()
+	d := fedora33.New()
+	arch, err := d.GetArch("x86_64")
+	require.NoError(t, err)
+	distros, err := distro.NewRegistry(d)
+	require.NoError(t, err)
+	repos := map[string]map[string][]rpmmd.RepoConfig{
+		d.Name(): {"x86_64": {{Name: "test-id", BaseURL: "http://example.com/fedora/33/x86_64", CheckGPG: true}}},
+	}
+	workers := worker.NewServer(nil, testjobqueue.New(), artifactsDir)
+	return New(rpmmd_mock.NewRPMMDMock(fixture), arch, distros, repos, nil, fixture.Store, workers, ""), arch, fixture.Store
+}
+
+func TestComposeUpload(t *testing.T) {
+	if len(os.Getenv("OSBUILD_COMPOSER_TEST_EXTERNAL")) > 0 {
+		t.Skip("This test is for internal testing only")
+	}
+
+	tlsVerify := false
+	azureImageID := "/subscriptions/subscription/resourceGroups/group/providers/Microsoft.Compute/images/test-upload"
+	azureVersionID := "/subscriptions/subscription/resourceGroups/group/providers/Microsoft.Compute/galleries/gallery/images/fedora/versions/1.0.0"
+
+	var cases = []struct {
+		ComposeType string
+		Provider    string
+		Settings    string
+		Target      string
+		Options     target.TargetOptions
+		Result      *target.TargetResult
+		// the settings and result of the upload in the compose status,
+		// which must not contain any secrets
+		StatusSettings string
+		StatusResult   string
+	}{
+		{
+			"container",
+			"container",
+			`{"url":"registry.example.com","repository":"osbuild/test","tags":["latest","33"],"username":"user","password":"secret","tls_verify":false}`,
+			"org.osbuild.container",
+			&target.ContainerTargetOptions{
+				Filename:   "container.tar",
+				URL:        "registry.example.com",
+				Repository: "osbuild/test",
+				Tags:       []string{"latest", "33"},
+				Username:   "user",
+				Password:   "secret",
+				TLSVerify:  &tlsVerify,
+			},
+			target.NewContainerTargetResult(&target.ContainerTargetResultOptions{Digest: "sha256:abcdef"}),
+			`{"url":"registry.example.com","repository":"osbuild/test","tags":["latest","33"],"tls_verify":false}`,
+			`{"digest":"sha256:abcdef"}`,
+		},
+		{
+			"gce",
+			"gcp",
+			`{"region":"europe-west3","bucket":"images","credentials":"eyJwcm9qZWN0X2lkIjoicHJvamVjdCJ9"}`,
+			"org.osbuild.gcp",
+			&target.GCPTargetOptions{
+				Filename:    "disk.raw",
+				Region:      "europe-west3",
+				Bucket:      "images",
+				Object:      "test-upload.tar.gz",
+				Credentials: []byte(`{"project_id":"project"}`),
+			},
+			target.NewGCPTargetResult(&target.GCPTargetResultOptions{ImageName: "test-upload", ProjectID: "project"}),
+			`{"region":"europe-west3","bucket":"images","object":"test-upload.tar.gz"}`,
+			`{"image_name":"test-upload","project_id":"project"}`,
+		},
+		{
+			"vmdk",
+			"vmware",
+			`{"host":"vcenter.example.com","username":"admin","password":"secret","datacenter":"DC0","datastore":"ds0","cpus":4}`,
+			"org.osbuild.vmware",
+			&target.VMwareTargetOptions{
+				Filename:   "disk.vmdk",
+				Host:       "vcenter.example.com",
+				Username:   "admin",
+				Password:   "secret",
+				Datacenter: "DC0",
+				Datastore:  "ds0",
+				CPUs:       4,
+			},
+			target.NewVMwareTargetResult(&target.VMwareTargetResultOptions{TemplateName: "test-upload", TemplateID: "vm-42"}),
+			`{"host":"vcenter.example.com","datacenter":"DC0","datastore":"ds0","cpus":4}`,
+			`{"template_name":"test-upload","template_id":"vm-42"}`,
+		},
+		{
+			"openstack",
+			"openstack",
+			`{"auth_url":"https://keystone.example.com/v3","username":"admin","password":"secret","project_name":"images","visibility":"shared","properties":{"os_distro":"fedora"}}`,
+			"org.osbuild.openstack",
+			&target.OpenStackTargetOptions{
+				Filename:    "disk.qcow2",
+				DiskFormat:  "qcow2",
+				AuthURL:     "https://keystone.example.com/v3",
+				Username:    "admin",
+				Password:    "secret",
+				ProjectName: "images",
+				Visibility:  "shared",
+				Properties:  map[string]string{"os_distro": "fedora"},
+			},
+			target.NewOpenStackTargetResult(&target.OpenStackTargetResultOptions{ImageID: "c1a2b3"}),
+			`{"auth_url":"https://keystone.example.com/v3","project_name":"images","visibility":"shared","properties":{"os_distro":"fedora"}}`,
+			`{"image_id":"c1a2b3"}`,
+		},
+		{
+			"vhd",
+			"azure",
+			`{"storageAccount":"account","storageAccessKey":"key","container":"images","tenantID":"tenant","clientID":"client","clientSecret":"secret","subscriptionID":"subscription","resourceGroup":"group","location":"westeurope","gallery":"gallery","galleryImage":"fedora","galleryImageVersion":"1.0.0"}`,
+			"org.osbuild.azure",
+			&target.AzureTargetOptions{
+				Filename:            "disk.vhd",
+				StorageAccount:      "account",
+				StorageAccessKey:    "key",
+				Container:           "images",
+				TenantID:            "tenant",
+				ClientID:            "client",
+				ClientSecret:        "secret",
+				SubscriptionID:      "subscription",
+				ResourceGroup:       "group",
+				Location:            "westeurope",
+				Gallery:             "gallery",
+				GalleryImage:        "fedora",
+				GalleryImageVersion: "1.0.0",
+			},
+			target.NewAzureTargetResult(&target.AzureTargetResultOptions{ImageID: azureImageID, GalleryImageVersionID: azureVersionID}),
+			`{"container":"images","resourceGroup":"group","location":"westeurope","gallery":"gallery","galleryImage":"fedora","galleryImageVersion":"1.0.0"}`,
+			`{"image_id":"` + azureImageID + `","gallery_image_version_id":"` + azureVersionID + `"}`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Provider, func(t *testing.T) {
+			artifactsDir, err := ioutil.TempDir("", "weldr-upload-test-")
+			require.NoError(t, err)
+			defer os.RemoveAll(artifactsDir)
+
+			api, arch, _ := createFedoraTestAPI(t, artifactsDir)
+
+			body := `{"blueprint_name":"test","compose_type":"` + c.ComposeType + `","upload":{"image_name":"test-upload","provider":"` + c.Provider + `","settings":` + c.Settings + `}}`
+			resp := test.SendHTTP(api, false, "POST", "/api/v1/compose", body)
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			var composeReply struct {
+				BuildID uuid.UUID `json:"build_id"`
+			}
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&composeReply))
+
+			token, _, args, err := api.workers.RequestOSBuildJob(context.Background(), arch.Name())
+			require.NoError(t, err)
+			require.Equal(t, c.Target, args.Targets[0].Name)
+			require.Equal(t, "test-upload", args.Targets[0].ImageName)
+			require.Equal(t, c.Options, args.Targets[0].Options)
+
+			upload := `"provider_name":"` + c.Provider + `","image_name":"test-upload","settings":` + c.StatusSettings
+			require.JSONEq(t, `[{"status":"RUNNING",`+upload+`}]`, composeUploads(t, api, composeReply.BuildID))
+
+			err = api.workers.FinishJob(token, &worker.OSBuildJobResult{
+				OSBuildOutput: &osbuild.Result{Success: true},
+				TargetResults: []*target.TargetResult{c.Result},
+			})
+			require.NoError(t, err)
+
+			require.JSONEq(t, `[{"status":"FINISHED",`+upload+`,"result":`+c.StatusResult+`}]`, composeUploads(t, api, composeReply.BuildID))
+		})
+	}
+}
+
+func TestComposeOpenStackUploadDiskFormat(t *testing.T) {
+	if len(os.Getenv("OSBUILD_COMPOSER_TEST_EXTERNAL")) > 0 {
+		t.Skip("This test is for internal testing only")
+	}
+
+	artifactsDir, err := ioutil.TempDir("", "weldr-upload-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(artifactsDir)
+
+	api, arch, _ := createFedoraTestAPI(t, artifactsDir)
+
+	settings := `"settings":{"auth_url":"https://keystone.example.com/v3","username":"admin","password":"secret"}`
+	resp := test.SendHTTP(api, false, "POST", "/api/v1/compose", `{"blueprint_name":"test","compose_type":"vhd","upload":{"image_name":"test-upload","provider":"openstack",`+settings+`}}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	_, _, args, err := api.workers.RequestOSBuildJob(context.Background(), arch.Name())
+	require.NoError(t, err)
+	require.Equal(t, "vhd", args.Targets[0].Options.(*target.OpenStackTargetOptions).DiskFormat)
+
+	test.TestRoute(t, api, false, "POST", "/api/v1/compose", `{"blueprint_name":"test","compose_type":"container","upload":{"image_name":"test-upload","provider":"openstack",`+settings+`}}`, http.StatusBadRequest,
+		`{"status":false,"errors":[{"id":"InvalidUploadRequest","msg":"Images of type container cannot be uploaded to OpenStack"}]}`)
+}
+
+func TestComposeInvalidAzureUpload(t *testing.T) {
+	if len(os.Getenv("OSBUILD_COMPOSER_TEST_EXTERNAL")) > 0 {
+		t.Skip("This test is for internal testing only")
+	}
+
+	artifactsDir, err := ioutil.TempDir("", "weldr-upload-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(artifactsDir)
+
+	api, _, _ := createFedoraTestAPI(t, artifactsDir)
+
+	credentials := `"tenantID":"tenant","clientID":"client","clientSecret":"secret","subscriptionID":"subscription"`
+	var cases = []struct {
+		Settings string
+		Error    string
+	}{
+		{`{"container":"images","resourceGroup":"group",` + credentials + `}`, "a resource group requires a location"},
+		{`{"container":"images","resourceGroup":"group","location":"westeurope"}`, "a resource group requires the tenant ID, client ID, client secret and subscription ID"},
+		{`{"container":"images","gallery":"gallery","galleryImage":"rhel","galleryImageVersion":"1.0.0"}`, "a gallery requires a resource group"},
+		{`{"container":"images","resourceGroup":"group","location":"westeurope","gallery":"gallery",` + credentials + `}`, "a gallery requires the gallery image and its version"},
+	}
+
+	for _, c := range cases {
+		test.TestRoute(t, api, false, "POST", "/api/v1/compose", `{"blueprint_name":"test","compose_type":"vhd","upload":{"image_name":"test-upload","provider":"azure","settings":`+c.Settings+`}}`, http.StatusBadRequest,
+			`{"status":false,"errors":[{"id":"InvalidUploadRequest","msg":"Invalid Azure upload settings: `+c.Error+`"}]}`)
+	}
+}
@@ -20,6 +20,23 @@ type ComposeEntry struct {
 	JobStarted  float64                `json:"job_started,omitempty"`
 	JobFinished float64                `json:"job_finished,omitempty"`
 	Uploads     []uploadResponse       `json:"uploads,omitempty"`
+	// Only set for composes of more than one image build
+	ImageBuilds []*ImageBuildEntry `json:"image_builds,omitempty"`
+}
+
+// ImageBuildEntry is the status of a single image build of a compose. Its ID
+// selects the image build in the compose image, logs, and metadata routes
+// (`?build=<id>`).
+type ImageBuildEntry struct {
+	ID          int                    `json:"id"`
+	ComposeType string                 `json:"compose_type"`
+	Arch        string                 `json:"arch"`
+	ImageSize   uint64                 `json:"image_size"`
+	QueueStatus common.ImageBuildState `json:"queue_status"`
+	JobCreated  float64                `json:"job_created"`
+	JobStarted  float64                `json:"job_started,omitempty"`
+	JobFinished float64                `json:"job_finished,omitempty"`
+	Uploads     []uploadResponse       `json:"uploads,omitempty"`
 }
 
 func composeToComposeEntry(id uuid.UUID, compose store.Compose, status *composeStatus, includeUploads bool) *ComposeEntry {
@@ -28,39 +45,99 @@ func composeToComposeEntry(id uuid.UUID, compose store.Compose, status *composeS
 	composeEntry.ID = id
 	composeEntry.Blueprint = compose.Blueprint.Name
 	composeEntry.Version = compose.Blueprint.Version
-	composeEntry.ComposeType = compose.ImageBuild.ImageType.Name()
+	composeEntry.ComposeType = compose.ImageBuilds[0].ImageType.Name()
 
 	if includeUploads {
-		composeEntry.Uploads = targetsToUploadResponses(compose.ImageBuild.Targets, status.State)
+		composeEntry.Uploads = composeUploadResponses(compose, status)
+	}
+
+	composeEntry.QueueStatus, composeEntry.JobCreated, composeEntry.JobStarted, composeEntry.JobFinished = composeStatusTimes(status)
+	if status.State == common.CFinished {
+		composeEntry.ImageSize = compose.ImageBuilds[0].Size
 	}
 
+	composeEntry.ImageBuilds = imageBuildsToImageBuildEntries(compose, status, includeUploads)
+
+	return &composeEntry
+}
+
+// imageBuildsToImageBuildEntries returns an entry for each image build of a
+// compose, or nil if the compose only has one
+func imageBuildsToImageBuildEntries(compose store.Compose, status *composeStatus, includeUploads bool) []*ImageBuildEntry {
+	if len(compose.ImageBuilds) < 2 {
+		return nil
+	}
+
+	var entries []*ImageBuildEntry
+	for i, ib := range compose.ImageBuilds {
+		ibStatus := status.ImageBuilds[i]
+		entry := &ImageBuildEntry{
+			ID:          ib.ID,
+			ComposeType: ib.ImageType.Name(),
+			Arch:        ib.ImageType.Arch().Name(),
+		}
+		entry.QueueStatus, entry.JobCreated, entry.JobStarted, entry.JobFinished = composeStatusTimes(ibStatus)
+		if ibStatus.State == common.CFinished {
+			entry.ImageSize = ib.Size
+		}
+		if includeUploads {
+			entry.Uploads = targetsToUploadResponses(ib.Targets, ibStatus)
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+// composeUploadResponses returns the uploads of all image builds of a compose
+func composeUploadResponses(compose store.Compose, status *composeStatus) []uploadResponse {
+	var uploads []uploadResponse
+	for i, ib := range compose.ImageBuilds {
+		uploads = append(uploads, targetsToUploadResponses(ib.Targets, status.ImageBuilds[i])...)
+	}
+	return uploads
+}
+
+// composeStatusTimes converts a compose status into the queue status and
+// the job times (in seconds since the epoch) that weldr reports
+func composeStatusTimes(status *composeStatus) (queueStatus common.ImageBuildState, created, started, finished float64) {
 	switch status.State {
 	case common.CWaiting:
-		composeEntry.QueueStatus = common.IBWaiting
-		composeEntry.JobCreated = float64(status.Queued.UnixNano()) / 1000000000
+		queueStatus = common.IBWaiting
+		created = float64(status.Queued.UnixNano()) / 1000000000
 
 	case common.CRunning:
-		composeEntry.QueueStatus = common.IBRunning
-		composeEntry.JobCreated = float64(status.Queued.UnixNano()) / 1000000000
-		composeEntry.JobStarted = float64(status.Started.UnixNano()) / 1000000000
+		queueStatus = common.IBRunning
+		created = float64(status.Queued.UnixNano()) / 1000000000
+		started = float64(status.Started.UnixNano()) / 1000000000
 
 	case common.CFinished:
-		composeEntry.QueueStatus = common.IBFinished
-		composeEntry.ImageSize = compose.ImageBuild.Size
-		composeEntry.JobCreated = float64(status.Queued.UnixNano()) / 1000000000
-		composeEntry.JobStarted = float64(status.Started.UnixNano()) / 1000000000
-		composeEntry.JobFinished = float64(status.Finished.UnixNano()) / 1000000000
+		queueStatus = common.IBFinished
+		created = float64(status.Queued.UnixNano()) / 1000000000
+		started = float64(status.Started.UnixNano()) / 1000000000
+		finished = float64(status.Finished.UnixNano()) / 1000000000
 
 	case common.CFailed:
-		composeEntry.QueueStatus = common.IBFailed
-		composeEntry.JobCreated = float64(status.Queued.UnixNano()) / 1000000000
-		composeEntry.JobStarted = float64(status.Started.UnixNano()) / 1000000000
-		composeEntry.JobFinished = float64(status.Finished.UnixNano()) / 1000000000
+		queueStatus = common.IBFailed
+		created = float64(status.Queued.UnixNano()) / 1000000000
+		started = float64(status.Started.UnixNano()) / 1000000000
+		finished = float64(status.Finished.UnixNano()) / 1000000000
 	default:
 		panic("invalid compose state")
 	}
 
-	return &composeEntry
+	return
+}
+
+// composeHasImageType returns whether any image build of the compose is of
+// the given image type
+func composeHasImageType(compose store.Compose, imageType string) bool {
+	for _, ib := range compose.ImageBuilds {
+		if ib.ImageType.Name() == imageType {
+			return true
+		}
+	}
+	return false
 }
 
 func sortComposeEntries(entries []*ComposeEntry) {
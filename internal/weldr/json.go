@@ -32,9 +32,33 @@ type BlueprintsListV0 struct {
 
 // ResponseError holds the API response error details
 type ResponseError struct {
-	Code int    `json:"code,omitempty"`
-	ID   string `json:"id"`
-	Msg  string `json:"msg"`
+	Code     int                 `json:"code,omitempty"`
+	ID       string              `json:"id"`
+	Msg      string              `json:"msg"`
+	Problems []DepsolveProblemV0 `json:"problems,omitempty"`
+}
+
+// BlueprintEntryV0 identifies a package, module or group of a blueprint
+type BlueprintEntryV0 struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+}
+
+// DepsolveProblemV0 is a problem reported by a failed depsolve, together
+// with the blueprint entry that pulled in the offending package, if known
+type DepsolveProblemV0 struct {
+	rpmmd.DepsolveProblem
+	Entry *BlueprintEntryV0 `json:"blueprint_entry,omitempty"`
+}
+
+// BlueprintsLockfileV1 is the response to /blueprints/lock requests
+type BlueprintsLockfileV1 struct {
+	Lockfile store.Lockfile `json:"lockfile"`
+}
+
+// BlueprintsImportV1 is the response to /blueprints/import requests
+type BlueprintsImportV1 struct {
+	Blueprints []string `json:"blueprints"`
 }
 
 // BlueprintsInfoV0 is the response to /blueprints/info?format=json request
@@ -125,6 +149,7 @@ func NewSourceConfigV0(s store.SourceConfig) SourceConfigV0 {
 	sc.CheckGPG = s.CheckGPG
 	sc.CheckSSL = s.CheckSSL
 	sc.System = s.System
+	sc.SnapshotURL = s.SnapshotURL
 
 	return sc
 }
@@ -139,6 +164,8 @@ type SourceConfigV0 struct {
 	System   bool     `json:"system" toml:"system"`
 	Proxy    string   `json:"proxy,omitempty" toml:"proxy,omitempty"`
 	GPGUrls  []string `json:"gpgkey_urls,omitempty" toml:"gpgkey_urls,omitempty"`
+
+	SnapshotURL string `json:"snapshot_url,omitempty" toml:"snapshot_url,omitempty"`
 }
 
 // Key return the key, .Name in this case
@@ -164,6 +191,7 @@ func (s SourceConfigV0) SourceConfig() (ssc store.SourceConfig) {
 	ssc.URL = s.URL
 	ssc.CheckGPG = s.CheckGPG
 	ssc.CheckSSL = s.CheckSSL
+	ssc.SnapshotURL = s.SnapshotURL
 
 	return ssc
 }
@@ -186,6 +214,7 @@ func NewSourceConfigV1(id string, s store.SourceConfig) SourceConfigV1 {
 	sc.CheckGPG = s.CheckGPG
 	sc.CheckSSL = s.CheckSSL
 	sc.System = s.System
+	sc.SnapshotURL = s.SnapshotURL
 
 	return sc
 }
@@ -201,6 +230,8 @@ type SourceConfigV1 struct {
 	System   bool     `json:"system" toml:"system"`
 	Proxy    string   `json:"proxy,omitempty" toml:"proxy,omitempty"`
 	GPGUrls  []string `json:"gpgkey_urls,omitempty" toml:"gpgkey_urls,omitempty"`
+
+	SnapshotURL string `json:"snapshot_url,omitempty" toml:"snapshot_url,omitempty"`
 }
 
 // Key returns the key, .ID in this case
@@ -226,6 +257,7 @@ func (s SourceConfigV1) SourceConfig() (ssc store.SourceConfig) {
 	ssc.URL = s.URL
 	ssc.CheckGPG = s.CheckGPG
 	ssc.CheckSSL = s.CheckSSL
+	ssc.SnapshotURL = s.SnapshotURL
 
 	return ssc
 }
@@ -236,6 +268,16 @@ type SourceInfoResponseV1 struct {
 	Errors  []responseError           `json:"errors"`
 }
 
+// SourceSnapshotsV1 is the response to /projects/source/snapshots request
+type SourceSnapshotsV1 struct {
+	Snapshots []store.Snapshot `json:"snapshots"`
+}
+
+// DistrosListV1 is the response to /distros/list request
+type DistrosListV1 struct {
+	Distros []string `json:"distros"`
+}
+
 // ProjectsListV0 is the response to /projects/list request
 type ProjectsListV0 struct {
 	Total    uint                `json:"total"`
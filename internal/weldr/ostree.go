@@ -0,0 +1,301 @@
+package weldr
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/osbuild/osbuild-composer/internal/common"
+	"github.com/osbuild/osbuild-composer/internal/distro"
+	"github.com/osbuild/osbuild-composer/internal/jsondb"
+	"github.com/osbuild/osbuild-composer/internal/ostree"
+	"github.com/osbuild/osbuild-composer/internal/worker"
+)
+
+// An OSTreeRepository keeps the commits composes built. It is implemented by
+// ostree.Repository.
+type OSTreeRepository interface {
+	// PullCommitTar pulls the commit in a commit.tar into the repository
+	// and returns its ref and checksum
+	PullCommitTar(tarball io.Reader) (string, string, error)
+
+	// Head returns the latest commit of ref, or "" if there is none
+	Head(ref string) (string, error)
+
+	// Log returns the commits of ref, newest first
+	Log(ref string) ([]ostree.Commit, error)
+}
+
+// ostreePulledDocument is the name of the jsondb document the jobs whose
+// commits were pulled are saved to
+const ostreePulledDocument = "pulled"
+
+// SetOSTreeRepository makes the API pull the commits of finished composes
+// into `repo`, and default the parent of new commits to the head of their
+// ref in it. Workers pull parent commits from `url` to generate static
+// deltas. The jobs whose commits were pulled are saved in db, unless it is
+// nil.
+func (api *API) SetOSTreeRepository(repo OSTreeRepository, url string, db *jsondb.JSONDatabase) error {
+	pulled := make(map[uuid.UUID]bool)
+	if db != nil {
+		_, err := db.Read(ostreePulledDocument, &pulled)
+		if err != nil {
+			return err
+		}
+	}
+
+	api.ostreeMu.Lock()
+	defer api.ostreeMu.Unlock()
+
+	api.ostreeRepo = repo
+	api.ostreeURL = url
+	api.ostreeDB = db
+	api.ostreePulled = pulled
+	return nil
+}
+
+// PullOSTreeCommits pulls the commits of all successful image builds which
+// haven't been pulled yet into the OSTree repository, oldest first. Builds
+// whose commits cannot be pulled are logged and not tried again. It does
+// nothing if no repository is set.
+func (api *API) PullOSTreeCommits() error {
+	// only one caller pulls at a time, without blocking the users of
+	// ostreeMu while commits are extracted
+	api.ostreePullMu.Lock()
+	defer api.ostreePullMu.Unlock()
+
+	api.ostreeMu.Lock()
+	repo := api.ostreeRepo
+	pulled := make(map[uuid.UUID]bool, len(api.ostreePulled))
+	for id, ok := range api.ostreePulled {
+		pulled[id] = ok
+	}
+	api.ostreeMu.Unlock()
+
+	if repo == nil {
+		return nil
+	}
+
+	type commitBuild struct {
+		jobID    uuid.UUID
+		finished int64
+	}
+	var builds []commitBuild
+	for _, compose := range api.store.GetAllComposes() {
+		for _, ib := range compose.ImageBuilds {
+			if ib.JobID == uuid.Nil || ib.ImageType.Filename() != "commit.tar" {
+				continue
+			}
+			if _, ok := pulled[ib.JobID]; ok {
+				continue
+			}
+			status := api.getImageBuildStatus(ib)
+			if status.State != common.CFinished {
+				continue
+			}
+			builds = append(builds, commitBuild{ib.JobID, status.Finished.UnixNano()})
+		}
+	}
+
+	if len(builds) == 0 {
+		return nil
+	}
+
+	// later commits of a ref are usually children of earlier ones
+	sort.Slice(builds, func(i, j int) bool {
+		return builds[i].finished < builds[j].finished
+	})
+
+	for _, build := range builds {
+		err := pullOSTreeCommit(repo, api.workers, build.jobID)
+		if err != nil {
+			log.Printf("Cannot pull the OSTree commit of job %s: %v", build.jobID, err)
+		}
+		pulled[build.jobID] = err == nil
+	}
+
+	api.ostreeMu.Lock()
+	defer api.ostreeMu.Unlock()
+
+	if api.ostreeDB != nil {
+		err := api.ostreeDB.Write(ostreePulledDocument, pulled)
+		if err != nil {
+			return fmt.Errorf("cannot save the pulled OSTree commits: %v", err)
+		}
+	}
+	api.ostreePulled = pulled
+
+	return nil
+}
+
+// pullOSTreeCommit pulls the commit.tar of job jobID into repo
+func pullOSTreeCommit(repo OSTreeRepository, workers *worker.Server, jobID uuid.UUID) error {
+	reader, _, err := workers.JobArtifact(jobID, "commit.tar")
+	if err != nil {
+		return fmt.Errorf("cannot read commit: %v", err)
+	}
+	if closer, ok := reader.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	_, _, err = repo.PullCommitTar(reader)
+	return err
+}
+
+// ostreeParent returns the head of ref in the OSTree repository, after
+// pulling the commits of finished composes. It returns "" if no repository
+// is set or it doesn't have the ref.
+func (api *API) ostreeParent(ref string) (string, error) {
+	err := api.PullOSTreeCommits()
+	if err != nil {
+		return "", err
+	}
+
+	api.ostreeMu.Lock()
+	defer api.ostreeMu.Unlock()
+
+	if api.ostreeRepo == nil {
+		return "", nil
+	}
+	return api.ostreeRepo.Head(ref)
+}
+
+// ostreeInstallerURL returns the url of the OSTree repository, after
+// pulling the commits of finished composes, so that installers can install
+// their latest commits. It returns "" if no repository is set.
+func (api *API) ostreeInstallerURL() (string, error) {
+	err := api.PullOSTreeCommits()
+	if err != nil {
+		return "", err
+	}
+
+	api.ostreeMu.Lock()
+	defer api.ostreeMu.Unlock()
+
+	return api.ostreeURL, nil
+}
+
+// ostreeStaticDelta returns the static delta from `parent` a worker should
+// generate for a commit of imageType. The parent is pulled from url, or
+// from composer's OSTree repository if url is empty.
+func (api *API) ostreeStaticDelta(imageType distro.ImageType, parent, url string) (*worker.OSTreeStaticDelta, *responseError) {
+	if parent == "" {
+		return nil, &responseError{
+			ID:  "InvalidOSTreeRequest",
+			Msg: "Static deltas require a parent commit",
+		}
+	}
+
+	if url == "" {
+		api.ostreeMu.Lock()
+		url = api.ostreeURL
+		api.ostreeMu.Unlock()
+	}
+	if url == "" {
+		return nil, &responseError{
+			ID:  "InvalidOSTreeRequest",
+			Msg: "Static deltas require the url of a repository containing the parent commit",
+		}
+	}
+
+	return &worker.OSTreeStaticDelta{
+		Filename: imageType.Filename(),
+		From:     parent,
+		URL:      url,
+	}, nil
+}
+
+func (api *API) ostreeCommitsHandler(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	if !verifyRequestVersion(writer, params, 1) {
+		return
+	}
+
+	type commit struct {
+		Checksum  string    `json:"checksum"`
+		Parent    string    `json:"parent,omitempty"`
+		Timestamp time.Time `json:"timestamp"`
+		Version   string    `json:"version,omitempty"`
+		Subject   string    `json:"subject,omitempty"`
+	}
+
+	type reply struct {
+		Ref     string   `json:"ref"`
+		Commits []commit `json:"commits"`
+	}
+
+	ref := strings.TrimPrefix(params.ByName("ref"), "/")
+	if ref == "" {
+		errors := responseError{
+			ID:  "UnknownRef",
+			Msg: "Missing ref",
+		}
+		statusResponseError(writer, http.StatusBadRequest, errors)
+		return
+	}
+
+	err := api.PullOSTreeCommits()
+	if err != nil {
+		errors := responseError{
+			ID:  "OSTreeError",
+			Msg: err.Error(),
+		}
+		statusResponseError(writer, http.StatusInternalServerError, errors)
+		return
+	}
+
+	api.ostreeMu.Lock()
+	repo := api.ostreeRepo
+	api.ostreeMu.Unlock()
+
+	if repo == nil {
+		errors := responseError{
+			ID:  "OSTreeNotConfigured",
+			Msg: "No OSTree repository is configured",
+		}
+		statusResponseError(writer, http.StatusBadRequest, errors)
+		return
+	}
+
+	commits, err := repo.Log(ref)
+	if err != nil {
+		errors := responseError{
+			ID:  "OSTreeError",
+			Msg: err.Error(),
+		}
+		statusResponseError(writer, http.StatusInternalServerError, errors)
+		return
+	}
+	if len(commits) == 0 {
+		errors := responseError{
+			ID:  "UnknownRef",
+			Msg: fmt.Sprintf("Unknown ref: %s", ref),
+		}
+		statusResponseError(writer, http.StatusNotFound, errors)
+		return
+	}
+
+	r := reply{
+		Ref:     ref,
+		Commits: make([]commit, 0, len(commits)),
+	}
+	for _, c := range commits {
+		r.Commits = append(r.Commits, commit{
+			Checksum:  c.Checksum,
+			Parent:    c.Parent,
+			Timestamp: c.Timestamp,
+			Version:   c.Version,
+			Subject:   c.Subject,
+		})
+	}
+
+	err = json.NewEncoder(writer).Encode(r)
+	common.PanicOnError(err)
+}
@@ -0,0 +1,293 @@
+package weldr
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/osbuild-composer/internal/blueprint"
+	"github.com/osbuild/osbuild-composer/internal/distro"
+	"github.com/osbuild/osbuild-composer/internal/jsondb"
+	"github.com/osbuild/osbuild-composer/internal/osbuild"
+	"github.com/osbuild/osbuild-composer/internal/ostree"
+	"github.com/osbuild/osbuild-composer/internal/store"
+	"github.com/osbuild/osbuild-composer/internal/test"
+	"github.com/osbuild/osbuild-composer/internal/worker"
+)
+
+// fakeOSTreeRepository takes the content of a commit.tar as its checksum
+// and keeps the commits of the ref "fedora/33/x86_64/iot"
+type fakeOSTreeRepository struct {
+	commits []ostree.Commit
+	pulls   int
+}
+
+func (r *fakeOSTreeRepository) PullCommitTar(tarball io.Reader) (string, string, error) {
+	content, err := ioutil.ReadAll(tarball)
+	if err != nil {
+		return "", "", err
+	}
+	r.pulls += 1
+	if string(content) == "broken" {
+		return "", "", errors.New("broken commit")
+	}
+
+	commit := ostree.Commit{
+		Checksum:  string(content),
+		Timestamp: time.Date(2020, 6, 1, 12, r.pulls, 0, 0, time.UTC),
+		Subject:   "Commit " + string(content),
+	}
+	if len(r.commits) > 0 {
+		commit.Parent = r.commits[0].Checksum
+	}
+	r.commits = append([]ostree.Commit{commit}, r.commits...)
+	return "fedora/33/x86_64/iot", commit.Checksum, nil
+}
+
+func (r *fakeOSTreeRepository) Head(ref string) (string, error) {
+	if ref != "fedora/33/x86_64/iot" || len(r.commits) == 0 {
+		return "", nil
+	}
+	return r.commits[0].Checksum, nil
+}
+
+func (r *fakeOSTreeRepository) Log(ref string) ([]ostree.Commit, error) {
+	if ref != "fedora/33/x86_64/iot" {
+		return nil, nil
+	}
+	return r.commits, nil
+}
+
+// pushOSTreeTestCompose pushes a compose of a commit whose job has finished
+// with a commit.tar containing `checksum`
+func pushOSTreeTestCompose(t *testing.T, api *API, artifactsDir string, imageType distro.ImageType, checksum string) {
+	t.Helper()
+	manifest, err := imageType.Manifest(nil, distro.ImageOptions{}, nil, nil, nil)
+	require.NoError(t, err)
+
+	jobID, err := api.workers.Enqueue(imageType.Arch().Name(), manifest, nil)
+	require.NoError(t, err)
+	token, _, _, err := api.workers.RequestOSBuildJob(context.Background(), imageType.Arch().Name())
+	require.NoError(t, err)
+	tmpDir := path.Join(artifactsDir, "tmp", token.String())
+	require.NoError(t, os.MkdirAll(tmpDir, 0700))
+	require.NoError(t, ioutil.WriteFile(path.Join(tmpDir, "commit.tar"), []byte(checksum), 0600))
+	err = api.workers.FinishJob(token, &worker.OSBuildJobResult{OSBuildOutput: &osbuild.Result{Success: true}})
+	require.NoError(t, err)
+
+	err = api.store.PushCompose(uuid.New(), &blueprint.Blueprint{Name: "test"}, nil, []store.ImageBuild{
+		{
+			ImageType: imageType,
+			Manifest:  manifest,
+			JobID:     jobID,
+		},
+	})
+	require.NoError(t, err)
+}
+
+func TestOSTreeCommits(t *testing.T) {
+	artifactsDir, err := ioutil.TempDir("", "weldr-ostree-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(artifactsDir)
+
+	api, arch, s := createFedoraTestAPI(t, artifactsDir)
+
+	test.TestRoute(t, api, false, "GET", "/api/v1/ostree/commits/fedora/33/x86_64/iot", ``, http.StatusBadRequest, `{"status":false,"errors":[{"id":"OSTreeNotConfigured","msg":"No OSTree repository is configured"}]}`)
+	test.TestRoute(t, api, false, "GET", "/api/v0/ostree/commits/fedora/33/x86_64/iot", ``, http.StatusNotFound, `{"status":false,"errors":[{"code":404,"id":"HTTPError","msg":"Not Found"}]}`)
+
+	repo := &fakeOSTreeRepository{}
+	require.NoError(t, api.SetOSTreeRepository(repo, "", nil))
+
+	imageType, err := arch.GetImageType("fedora-iot-commit")
+	require.NoError(t, err)
+	pushOSTreeTestCompose(t, api, artifactsDir, imageType, "first")
+	pushOSTreeTestCompose(t, api, artifactsDir, imageType, "second")
+
+	// other image types are not pulled
+	qcow2, err := arch.GetImageType("qcow2")
+	require.NoError(t, err)
+	require.NoError(t, api.store.PushCompose(uuid.New(), &blueprint.Blueprint{Name: "test"}, nil, []store.ImageBuild{{ImageType: qcow2}}))
+
+	test.TestRoute(t, api, false, "GET", "/api/v1/ostree/commits/fedora/33/x86_64/iot", ``, http.StatusOK, `{
+		"ref": "fedora/33/x86_64/iot",
+		"commits": [
+			{"checksum": "second", "parent": "first", "timestamp": "2020-06-01T12:02:00Z", "subject": "Commit second"},
+			{"checksum": "first", "timestamp": "2020-06-01T12:01:00Z", "subject": "Commit first"}
+		]
+	}`)
+	test.TestRoute(t, api, false, "GET", "/api/v1/ostree/commits/fedora/33/x86_64/unknown", ``, http.StatusNotFound, `{"status":false,"errors":[{"id":"UnknownRef","msg":"Unknown ref: fedora/33/x86_64/unknown"}]}`)
+
+	// commits are pulled only once
+	require.NoError(t, api.PullOSTreeCommits())
+	require.Equal(t, 2, repo.pulls)
+
+	// new commits of the ref build on its head, unless a parent is given
+	test.TestRoute(t, api, false, "POST", "/api/v1/compose", `{"blueprint_name":"test","compose_type":"fedora-iot-commit","ostree":{"ref":"fedora/33/x86_64/iot"}}`, http.StatusOK, `{"status":true}`, "build_id")
+	test.TestRoute(t, api, false, "POST", "/api/v1/compose", `{"blueprint_name":"test","compose_type":"fedora-iot-commit","ostree":{"ref":"fedora/33/x86_64/iot","parent":"first"}}`, http.StatusOK, `{"status":true}`, "build_id")
+	test.TestRoute(t, api, false, "POST", "/api/v1/compose", `{"blueprint_name":"test","compose_type":"fedora-iot-commit","ostree":{"ref":"fedora/33/x86_64/other"}}`, http.StatusOK, `{"status":true}`, "build_id")
+
+	var commits []string
+	for _, compose := range s.GetAllComposes() {
+		manifest := string(compose.ImageBuilds[0].Manifest)
+		if i := strings.Index(manifest, `"ref":`); i >= 0 {
+			commits = append(commits, manifest[i:])
+		}
+	}
+	tail := `"tar":{"filename":"commit.tar"}}}}}`
+	require.ElementsMatch(t, []string{
+		// the composes pushed above
+		`"ref":"fedora/33/x86_64/iot",` + tail,
+		`"ref":"fedora/33/x86_64/iot",` + tail,
+		`"ref":"fedora/33/x86_64/iot","parent":"second",` + tail,
+		`"ref":"fedora/33/x86_64/iot","parent":"first",` + tail,
+		`"ref":"fedora/33/x86_64/other",` + tail,
+	}, commits)
+}
+
+func TestOSTreePullFailure(t *testing.T) {
+	artifactsDir, err := ioutil.TempDir("", "weldr-ostree-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(artifactsDir)
+
+	api, arch, _ := createFedoraTestAPI(t, artifactsDir)
+	require.NoError(t, os.Mkdir(path.Join(artifactsDir, "ostree"), 0700))
+	db := jsondb.New(path.Join(artifactsDir, "ostree"), 0600)
+	repo := &fakeOSTreeRepository{}
+	require.NoError(t, api.SetOSTreeRepository(repo, "", db))
+
+	imageType, err := arch.GetImageType("fedora-iot-commit")
+	require.NoError(t, err)
+	pushOSTreeTestCompose(t, api, artifactsDir, imageType, "first")
+	pushOSTreeTestCompose(t, api, artifactsDir, imageType, "broken")
+	pushOSTreeTestCompose(t, api, artifactsDir, imageType, "second")
+
+	// a broken commit doesn't keep the others from being pulled
+	require.NoError(t, api.PullOSTreeCommits())
+	require.Equal(t, 3, repo.pulls)
+	head, err := repo.Head("fedora/33/x86_64/iot")
+	require.NoError(t, err)
+	require.Equal(t, "second", head)
+
+	// neither the pulled nor the broken commits are pulled again, even
+	// after a restart
+	require.NoError(t, api.PullOSTreeCommits())
+	require.Equal(t, 3, repo.pulls)
+	require.NoError(t, api.SetOSTreeRepository(repo, "", db))
+	require.NoError(t, api.PullOSTreeCommits())
+	require.Equal(t, 3, repo.pulls)
+}
+
+func TestOSTreeStaticDelta(t *testing.T) {
+	if len(os.Getenv("OSBUILD_COMPOSER_TEST_EXTERNAL")) > 0 {
+		t.Skip("This test is for internal testing only")
+	}
+
+	artifactsDir, err := ioutil.TempDir("", "weldr-ostree-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(artifactsDir)
+
+	api, arch, _ := createFedoraTestAPI(t, artifactsDir)
+
+	test.TestRoute(t, api, false, "POST", "/api/v1/compose", `{"blueprint_name":"test","compose_type":"qcow2","ostree":{"static_delta":true}}`, http.StatusBadRequest, `{"status":false,"errors":[{"id":"InvalidOSTreeRequest","msg":"Static deltas can only be generated for OSTree commits, not qcow2"}]}`)
+	test.TestRoute(t, api, false, "POST", "/api/v1/compose", `{"blueprint_name":"test","compose_type":"fedora-iot-commit","ostree":{"static_delta":true}}`, http.StatusBadRequest, `{"status":false,"errors":[{"id":"InvalidOSTreeRequest","msg":"Static deltas require a parent commit"}]}`)
+	test.TestRoute(t, api, false, "POST", "/api/v1/compose", `{"blueprint_name":"test","compose_type":"fedora-iot-commit","ostree":{"parent":"first","static_delta":true}}`, http.StatusBadRequest, `{"status":false,"errors":[{"id":"InvalidOSTreeRequest","msg":"Static deltas require the url of a repository containing the parent commit"}]}`)
+
+	test.TestRoute(t, api, false, "POST", "/api/v1/compose", `{"blueprint_name":"test","compose_type":"fedora-iot-commit","ostree":{"parent":"first","url":"http://example.com/repo","static_delta":true}}`, http.StatusOK, `{"status":true}`, "build_id")
+	_, _, args, err := api.workers.RequestOSBuildJob(context.Background(), arch.Name())
+	require.NoError(t, err)
+	require.Equal(t, &worker.OSTreeStaticDelta{Filename: "commit.tar", From: "first", URL: "http://example.com/repo"}, args.OSTreeStaticDelta)
+
+	// the parent and the repository default to composer's
+	require.NoError(t, api.SetOSTreeRepository(&fakeOSTreeRepository{}, "file:///var/lib/osbuild-composer/ostree/repo", nil))
+	imageType, err := arch.GetImageType("fedora-iot-commit")
+	require.NoError(t, err)
+	pushOSTreeTestCompose(t, api, artifactsDir, imageType, "first")
+
+	response := test.SendHTTP(api, false, "POST", "/api/v1/compose", `{"blueprint_name":"test","compose_type":"fedora-iot-commit","ostree":{"ref":"fedora/33/x86_64/iot","static_delta":true}}`)
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	var reply struct {
+		BuildID uuid.UUID `json:"build_id"`
+	}
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&reply))
+
+	token, _, args, err := api.workers.RequestOSBuildJob(context.Background(), arch.Name())
+	require.NoError(t, err)
+	require.Equal(t, &worker.OSTreeStaticDelta{Filename: "commit.tar", From: "first", URL: "file:///var/lib/osbuild-composer/ostree/repo"}, args.OSTreeStaticDelta)
+
+	// the delta is part of the results
+	tmpDir := path.Join(artifactsDir, "tmp", token.String())
+	require.NoError(t, ioutil.WriteFile(path.Join(tmpDir, "commit.tar"), []byte("second"), 0600))
+	require.NoError(t, ioutil.WriteFile(path.Join(tmpDir, "commit.delta"), []byte("delta"), 0600))
+	require.NoError(t, api.workers.FinishJob(token, &worker.OSBuildJobResult{OSBuildOutput: &osbuild.Result{Success: true}}))
+
+	response = test.SendHTTP(api, false, "GET", "/api/v1/compose/results/"+reply.BuildID.String(), "")
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	files := make(map[string]string)
+	tr := tar.NewReader(response.Body)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		content, err := ioutil.ReadAll(tr)
+		require.NoError(t, err)
+		files[h.Name] = string(content)
+	}
+	require.Equal(t, "second", files[reply.BuildID.String()+"-commit.tar"])
+	require.Equal(t, "delta", files[reply.BuildID.String()+"-commit.delta"])
+}
+
+func TestOSTreeInstaller(t *testing.T) {
+	if len(os.Getenv("OSBUILD_COMPOSER_TEST_EXTERNAL")) > 0 {
+		t.Skip("This test is for internal testing only")
+	}
+
+	artifactsDir, err := ioutil.TempDir("", "weldr-ostree-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(artifactsDir)
+
+	api, arch, _ := createFedoraTestAPI(t, artifactsDir)
+
+	test.TestRoute(t, api, false, "POST", "/api/v1/compose", `{"blueprint_name":"test","compose_type":"fedora-iot-installer"}`, http.StatusBadRequest, `{"status":false,"errors":[{"id":"ManifestCreationFailed","msg":"failed to create osbuild manifest: fedora-iot-installer images require the url of the repository of the commit to install"}]}`)
+
+	pullStage := func() *osbuild.OSTreePullStageOptions {
+		_, _, args, err := api.workers.RequestOSBuildJob(context.Background(), arch.Name())
+		require.NoError(t, err)
+		var manifest osbuild.Manifest
+		require.NoError(t, json.Unmarshal(args.Manifest, &manifest))
+		for _, stage := range manifest.Pipeline.Stages {
+			if stage.Name == "org.osbuild.ostree.pull" {
+				return stage.Options.(*osbuild.OSTreePullStageOptions)
+			}
+		}
+		require.FailNow(t, "manifest has no ostree.pull stage")
+		return nil
+	}
+
+	test.TestRoute(t, api, false, "POST", "/api/v1/compose", `{"blueprint_name":"test","compose_type":"fedora-iot-installer","ostree":{"ref":"fedora/33/x86_64/stable","url":"http://example.com/repo"}}`, http.StatusOK, `{"status":true}`, "build_id")
+	require.Equal(t, &osbuild.OSTreePullStageOptions{Repo: "/ostree/repo", URL: "http://example.com/repo", Ref: "fedora/33/x86_64/stable"}, pullStage())
+
+	// installers install the latest commit in composer's repository by default
+	repo := &fakeOSTreeRepository{}
+	require.NoError(t, api.SetOSTreeRepository(repo, "file:///var/lib/osbuild-composer/ostree/repo", nil))
+	imageType, err := arch.GetImageType("fedora-iot-commit")
+	require.NoError(t, err)
+	pushOSTreeTestCompose(t, api, artifactsDir, imageType, "first")
+
+	test.TestRoute(t, api, false, "POST", "/api/v1/compose", `{"blueprint_name":"test","compose_type":"fedora-iot-installer"}`, http.StatusOK, `{"status":true}`, "build_id")
+	require.Equal(t, &osbuild.OSTreePullStageOptions{Repo: "/ostree/repo", URL: "file:///var/lib/osbuild-composer/ostree/repo", Ref: "fedora/33/x86_64/iot"}, pullStage())
+	require.Equal(t, 1, repo.pulls)
+}
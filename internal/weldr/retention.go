@@ -0,0 +1,166 @@
+package weldr
+
+import (
+	"log"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/osbuild/osbuild-composer/internal/common"
+	"github.com/osbuild/osbuild-composer/internal/store"
+)
+
+// A RetentionPolicy limits which composes are kept after they are done.
+// Composes which are still waiting or running are never deleted. A zero
+// value disables the respective limit.
+type RetentionPolicy struct {
+	// Composes which finished longer ago than this are deleted
+	MaxAge time.Duration
+
+	// Only the most recently finished composes of each blueprint are kept
+	MaxComposesPerBlueprint int
+
+	// The oldest composes are deleted until the artifacts of all composes
+	// take up at most this many bytes
+	MaxDiskUsage int64
+
+	// The most recent successful composes of each blueprint are kept,
+	// regardless of the other limits
+	KeepLastSuccessful int
+
+	// Only the most recently taken repository snapshots are kept
+	MaxSnapshots int
+}
+
+// IsEmpty returns true if the policy does not limit any composes or
+// snapshots
+func (p RetentionPolicy) IsEmpty() bool {
+	return p.MaxAge == 0 && p.MaxComposesPerBlueprint == 0 && p.MaxDiskUsage == 0 && p.MaxSnapshots == 0
+}
+
+type retainedCompose struct {
+	id         uuid.UUID
+	compose    store.Compose
+	successful bool
+	finished   time.Time
+	size       int64
+	keep       bool
+	remove     bool
+}
+
+// CollectComposes deletes all composes which are done and not retained by
+// `policy`, as if they had been deleted with the compose/delete route. It
+// returns the ids of the deleted composes.
+func (api *API) CollectComposes(policy RetentionPolicy, now time.Time) ([]uuid.UUID, error) {
+	var done []*retainedCompose
+	for id, compose := range api.store.GetAllComposes() {
+		status := api.getComposeStatus(compose)
+		if status.State != common.CFinished && status.State != common.CFailed {
+			continue
+		}
+
+		c := &retainedCompose{
+			id:         id,
+			compose:    compose,
+			successful: status.State == common.CFinished,
+			finished:   status.Finished,
+		}
+		var err error
+		for _, ib := range compose.ImageBuilds {
+			var size int64
+			size, err = api.workers.ArtifactsSize(ib.JobID)
+			if err != nil {
+				break
+			}
+			c.size += size
+		}
+		if err != nil {
+			// Keep the compose, rather than guessing how much
+			// space it takes up
+			log.Printf("cannot determine the size of compose %s: %v", id, err)
+			continue
+		}
+		done = append(done, c)
+	}
+
+	// newest first, so that the composes to keep come first for each blueprint
+	sort.Slice(done, func(i, j int) bool {
+		if done[i].finished.Equal(done[j].finished) {
+			return done[i].id.String() < done[j].id.String()
+		}
+		return done[i].finished.After(done[j].finished)
+	})
+
+	var usage int64
+	composes := make(map[string]int)
+	successful := make(map[string]int)
+	for _, c := range done {
+		name := c.compose.Blueprint.Name
+		if policy.KeepLastSuccessful > 0 && c.successful {
+			successful[name] += 1
+			c.keep = successful[name] <= policy.KeepLastSuccessful
+		}
+		composes[name] += 1
+
+		if !c.keep {
+			if policy.MaxAge > 0 && now.Sub(c.finished) > policy.MaxAge {
+				c.remove = true
+			}
+			if policy.MaxComposesPerBlueprint > 0 && composes[name] > policy.MaxComposesPerBlueprint {
+				c.remove = true
+			}
+		}
+		if !c.remove {
+			usage += c.size
+		}
+	}
+
+	// Delete the oldest of the remaining composes until they fit
+	if policy.MaxDiskUsage > 0 {
+		for i := len(done) - 1; i >= 0 && usage > policy.MaxDiskUsage; i-- {
+			c := done[i]
+			if c.keep || c.remove {
+				continue
+			}
+			c.remove = true
+			usage -= c.size
+		}
+	}
+
+	var deleted []uuid.UUID
+	for _, c := range done {
+		if !c.remove {
+			continue
+		}
+		err := api.deleteCompose(c.id, c.compose)
+		if err != nil {
+			return deleted, err
+		}
+		deleted = append(deleted, c.id)
+	}
+
+	return deleted, nil
+}
+
+// CollectSnapshots deletes the oldest repository snapshots until at most
+// policy.MaxSnapshots are left. It returns the ids of the deleted snapshots.
+func (api *API) CollectSnapshots(policy RetentionPolicy) ([]uuid.UUID, error) {
+	if policy.MaxSnapshots == 0 {
+		return nil, nil
+	}
+
+	// oldest first
+	snapshots := api.store.ListSnapshots()
+
+	var deleted []uuid.UUID
+	for i := 0; i < len(snapshots)-policy.MaxSnapshots; i++ {
+		err := api.store.DeleteSnapshot(snapshots[i].ID)
+		if err != nil {
+			return deleted, err
+		}
+		deleted = append(deleted, snapshots[i].ID)
+	}
+
+	return deleted, nil
+}
@@ -19,6 +19,7 @@ type uploadResponse struct {
 	ImageName    string                 `json:"image_name"`
 	CreationTime float64                `json:"creation_time"`
 	Settings     uploadSettings         `json:"settings"`
+	Result       uploadResult           `json:"result,omitempty"`
 }
 
 type uploadSettings interface {
@@ -39,10 +40,136 @@ type azureUploadSettings struct {
 	StorageAccount   string `json:"storageAccount,omitempty"`
 	StorageAccessKey string `json:"storageAccessKey,omitempty"`
 	Container        string `json:"container"`
+
+	// Optional, to create a managed image from the uploaded VHD
+	TenantID            string `json:"tenantID,omitempty"`
+	ClientID            string `json:"clientID,omitempty"`
+	ClientSecret        string `json:"clientSecret,omitempty"`
+	SubscriptionID      string `json:"subscriptionID,omitempty"`
+	ResourceGroup       string `json:"resourceGroup,omitempty"`
+	Location            string `json:"location,omitempty"`
+	Gallery             string `json:"gallery,omitempty"`
+	GalleryImage        string `json:"galleryImage,omitempty"`
+	GalleryImageVersion string `json:"galleryImageVersion,omitempty"`
 }
 
 func (azureUploadSettings) isUploadSettings() {}
 
+// validate checks that the settings needed to create a managed image, and to
+// publish it to a gallery, are given together.
+func (settings *azureUploadSettings) validate() error {
+	if settings.ResourceGroup == "" {
+		if settings.Gallery != "" {
+			return errors.New("a gallery requires a resource group")
+		}
+		return nil
+	}
+
+	if settings.Location == "" {
+		return errors.New("a resource group requires a location")
+	}
+	if settings.TenantID == "" || settings.ClientID == "" || settings.ClientSecret == "" || settings.SubscriptionID == "" {
+		return errors.New("a resource group requires the tenant ID, client ID, client secret and subscription ID")
+	}
+	if settings.Gallery != "" && (settings.GalleryImage == "" || settings.GalleryImageVersion == "") {
+		return errors.New("a gallery requires the gallery image and its version")
+	}
+	return nil
+}
+
+type containerUploadSettings struct {
+	URL        string   `json:"url"`
+	Repository string   `json:"repository"`
+	Tags       []string `json:"tags,omitempty"`
+	Username   string   `json:"username,omitempty"`
+	Password   string   `json:"password,omitempty"`
+	TLSVerify  *bool    `json:"tls_verify,omitempty"`
+}
+
+func (containerUploadSettings) isUploadSettings() {}
+
+type gcpUploadSettings struct {
+	Region  string `json:"region,omitempty"`
+	Project string `json:"project,omitempty"`
+	Bucket  string `json:"bucket"`
+	Object  string `json:"object,omitempty"`
+
+	// base64 encoded content of a service account key file
+	Credentials []byte `json:"credentials,omitempty"`
+}
+
+func (gcpUploadSettings) isUploadSettings() {}
+
+type vmwareUploadSettings struct {
+	Host       string `json:"host"`
+	Username   string `json:"username,omitempty"`
+	Password   string `json:"password,omitempty"`
+	Datacenter string `json:"datacenter,omitempty"`
+	Cluster    string `json:"cluster,omitempty"`
+	Datastore  string `json:"datastore,omitempty"`
+	Folder     string `json:"folder,omitempty"`
+	TLSVerify  *bool  `json:"tls_verify,omitempty"`
+	// The virtual hardware of the template
+	CPUs            int    `json:"cpus,omitempty"`
+	MemoryMB        int    `json:"memory_mb,omitempty"`
+	HardwareVersion string `json:"hardware_version,omitempty"`
+}
+
+func (vmwareUploadSettings) isUploadSettings() {}
+
+type openstackUploadSettings struct {
+	AuthURL     string            `json:"auth_url"`
+	Username    string            `json:"username,omitempty"`
+	Password    string            `json:"password,omitempty"`
+	DomainName  string            `json:"domain_name,omitempty"`
+	ProjectName string            `json:"project_name,omitempty"`
+	ProjectID   string            `json:"project_id,omitempty"`
+	Region      string            `json:"region,omitempty"`
+	Visibility  string            `json:"visibility,omitempty"`
+	Properties  map[string]string `json:"properties,omitempty"`
+}
+
+func (openstackUploadSettings) isUploadSettings() {}
+
+// uploadResult is what the worker reported back after uploading, for
+// example the identifier of the image at its destination.
+type uploadResult interface {
+	isUploadResult()
+}
+
+type azureUploadResult struct {
+	ImageID               string `json:"image_id"`
+	GalleryImageVersionID string `json:"gallery_image_version_id,omitempty"`
+}
+
+func (azureUploadResult) isUploadResult() {}
+
+type containerUploadResult struct {
+	Digest string `json:"digest"`
+}
+
+func (containerUploadResult) isUploadResult() {}
+
+type gcpUploadResult struct {
+	ImageName string `json:"image_name"`
+	ProjectID string `json:"project_id"`
+}
+
+func (gcpUploadResult) isUploadResult() {}
+
+type vmwareUploadResult struct {
+	TemplateName string `json:"template_name"`
+	TemplateID   string `json:"template_id"`
+}
+
+func (vmwareUploadResult) isUploadResult() {}
+
+type openstackUploadResult struct {
+	ImageID string `json:"image_id"`
+}
+
+func (openstackUploadResult) isUploadResult() {}
+
 type uploadRequest struct {
 	Provider  string         `json:"provider"`
 	ImageName string         `json:"image_name"`
@@ -68,6 +195,14 @@ func (u *uploadRequest) UnmarshalJSON(data []byte) error {
 		settings = new(azureUploadSettings)
 	case "aws":
 		settings = new(awsUploadSettings)
+	case "container":
+		settings = new(containerUploadSettings)
+	case "gcp":
+		settings = new(gcpUploadSettings)
+	case "vmware":
+		settings = new(vmwareUploadSettings)
+	case "openstack":
+		settings = new(openstackUploadSettings)
 	default:
 		return errors.New("unexpected provider name")
 	}
@@ -91,7 +226,10 @@ func (u *uploadRequest) UnmarshalJSON(data []byte) error {
 //
 // This also ignores any sensitive data passed into targets. Access keys may
 // be passed as input to composer, but should not be possible to be queried.
-func targetsToUploadResponses(targets []*target.Target, state common.ComposeState) []uploadResponse {
+//
+// Results the worker reported for a target, if any, are included as well.
+func targetsToUploadResponses(targets []*target.Target, status *composeStatus) []uploadResponse {
+	state := status.State
 	var uploads []uploadResponse
 	for _, t := range targets {
 		upload := uploadResponse{
@@ -124,8 +262,99 @@ func targetsToUploadResponses(targets []*target.Target, state common.ComposeStat
 		case *target.AzureTargetOptions:
 			upload.ProviderName = "azure"
 			upload.Settings = &azureUploadSettings{
-				Container: options.Container,
-				// StorageAccount and StorageAccessKey are intentionally not included.
+				Container:           options.Container,
+				ResourceGroup:       options.ResourceGroup,
+				Location:            options.Location,
+				Gallery:             options.Gallery,
+				GalleryImage:        options.GalleryImage,
+				GalleryImageVersion: options.GalleryImageVersion,
+				// StorageAccount, StorageAccessKey and the client credentials are intentionally not included.
+			}
+			if result := findTargetResult(status.TargetResults, t.Name); result != nil {
+				if resultOptions, ok := result.Options.(*target.AzureTargetResultOptions); ok {
+					upload.Result = &azureUploadResult{
+						ImageID:               resultOptions.ImageID,
+						GalleryImageVersionID: resultOptions.GalleryImageVersionID,
+					}
+				}
+			}
+			uploads = append(uploads, upload)
+		case *target.ContainerTargetOptions:
+			upload.ProviderName = "container"
+			upload.Settings = &containerUploadSettings{
+				URL:        options.URL,
+				Repository: options.Repository,
+				Tags:       options.Tags,
+				TLSVerify:  options.TLSVerify,
+				// Username and Password are intentionally not included.
+			}
+			if result := findTargetResult(status.TargetResults, t.Name); result != nil {
+				if resultOptions, ok := result.Options.(*target.ContainerTargetResultOptions); ok {
+					upload.Result = &containerUploadResult{
+						Digest: resultOptions.Digest,
+					}
+				}
+			}
+			uploads = append(uploads, upload)
+		case *target.GCPTargetOptions:
+			upload.ProviderName = "gcp"
+			upload.Settings = &gcpUploadSettings{
+				Region:  options.Region,
+				Project: options.Project,
+				Bucket:  options.Bucket,
+				Object:  options.Object,
+				// Credentials are intentionally not included.
+			}
+			if result := findTargetResult(status.TargetResults, t.Name); result != nil {
+				if resultOptions, ok := result.Options.(*target.GCPTargetResultOptions); ok {
+					upload.Result = &gcpUploadResult{
+						ImageName: resultOptions.ImageName,
+						ProjectID: resultOptions.ProjectID,
+					}
+				}
+			}
+			uploads = append(uploads, upload)
+		case *target.VMwareTargetOptions:
+			upload.ProviderName = "vmware"
+			upload.Settings = &vmwareUploadSettings{
+				Host:       options.Host,
+				Datacenter: options.Datacenter,
+				Cluster:    options.Cluster,
+				Datastore:  options.Datastore,
+				Folder:     options.Folder,
+				TLSVerify:  options.TLSVerify,
+				// Username and Password are intentionally not included.
+				CPUs:            options.CPUs,
+				MemoryMB:        options.MemoryMB,
+				HardwareVersion: options.HardwareVersion,
+			}
+			if result := findTargetResult(status.TargetResults, t.Name); result != nil {
+				if resultOptions, ok := result.Options.(*target.VMwareTargetResultOptions); ok {
+					upload.Result = &vmwareUploadResult{
+						TemplateName: resultOptions.TemplateName,
+						TemplateID:   resultOptions.TemplateID,
+					}
+				}
+			}
+			uploads = append(uploads, upload)
+		case *target.OpenStackTargetOptions:
+			upload.ProviderName = "openstack"
+			upload.Settings = &openstackUploadSettings{
+				AuthURL:     options.AuthURL,
+				DomainName:  options.DomainName,
+				ProjectName: options.ProjectName,
+				ProjectID:   options.ProjectID,
+				Region:      options.Region,
+				Visibility:  options.Visibility,
+				Properties:  options.Properties,
+				// Username and Password are intentionally not included.
+			}
+			if result := findTargetResult(status.TargetResults, t.Name); result != nil {
+				if resultOptions, ok := result.Options.(*target.OpenStackTargetResultOptions); ok {
+					upload.Result = &openstackUploadResult{
+						ImageID: resultOptions.ImageID,
+					}
+				}
 			}
 			uploads = append(uploads, upload)
 		}
@@ -134,6 +363,16 @@ func targetsToUploadResponses(targets []*target.Target, state common.ComposeStat
 	return uploads
 }
 
+// Returns the first result in `results` reported for a target called `name`.
+func findTargetResult(results []*target.TargetResult, name string) *target.TargetResult {
+	for _, result := range results {
+		if result.Name == name {
+			return result
+		}
+	}
+	return nil
+}
+
 func uploadRequestToTarget(u uploadRequest, imageType distro.ImageType) *target.Target {
 	var t target.Target
 
@@ -160,6 +399,74 @@ func uploadRequestToTarget(u uploadRequest, imageType distro.ImageType) *target.
 			StorageAccount:   options.StorageAccount,
 			StorageAccessKey: options.StorageAccessKey,
 			Container:        options.Container,
+
+			TenantID:            options.TenantID,
+			ClientID:            options.ClientID,
+			ClientSecret:        options.ClientSecret,
+			SubscriptionID:      options.SubscriptionID,
+			ResourceGroup:       options.ResourceGroup,
+			Location:            options.Location,
+			Gallery:             options.Gallery,
+			GalleryImage:        options.GalleryImage,
+			GalleryImageVersion: options.GalleryImageVersion,
+		}
+	case *containerUploadSettings:
+		t.Name = "org.osbuild.container"
+		t.Options = &target.ContainerTargetOptions{
+			Filename:   imageType.Filename(),
+			URL:        options.URL,
+			Repository: options.Repository,
+			Tags:       options.Tags,
+			Username:   options.Username,
+			Password:   options.Password,
+			TLSVerify:  options.TLSVerify,
+		}
+	case *gcpUploadSettings:
+		t.Name = "org.osbuild.gcp"
+		object := options.Object
+		if object == "" {
+			object = u.ImageName + ".tar.gz"
+		}
+		t.Options = &target.GCPTargetOptions{
+			Filename:    imageType.Filename(),
+			Region:      options.Region,
+			Project:     options.Project,
+			Bucket:      options.Bucket,
+			Object:      object,
+			Credentials: options.Credentials,
+		}
+	case *vmwareUploadSettings:
+		t.Name = "org.osbuild.vmware"
+		t.Options = &target.VMwareTargetOptions{
+			Filename:        imageType.Filename(),
+			Host:            options.Host,
+			Username:        options.Username,
+			Password:        options.Password,
+			Datacenter:      options.Datacenter,
+			Cluster:         options.Cluster,
+			Datastore:       options.Datastore,
+			Folder:          options.Folder,
+			TLSVerify:       options.TLSVerify,
+			CPUs:            options.CPUs,
+			MemoryMB:        options.MemoryMB,
+			HardwareVersion: options.HardwareVersion,
+		}
+	case *openstackUploadSettings:
+		t.Name = "org.osbuild.openstack"
+		// composeHandler rejects image types without a disk format
+		diskFormat, _ := target.OpenStackDiskFormat(imageType.Filename())
+		t.Options = &target.OpenStackTargetOptions{
+			Filename:    imageType.Filename(),
+			DiskFormat:  diskFormat,
+			AuthURL:     options.AuthURL,
+			Username:    options.Username,
+			Password:    options.Password,
+			DomainName:  options.DomainName,
+			ProjectName: options.ProjectName,
+			ProjectID:   options.ProjectID,
+			Region:      options.Region,
+			Visibility:  options.Visibility,
+			Properties:  options.Properties,
 		}
 	}
 
@@ -23,8 +23,9 @@ type RequestJobJSONBody struct {
 
 // UpdateJobJSONBody defines parameters for UpdateJob.
 type UpdateJobJSONBody struct {
-	Result interface{} `json:"result"`
-	Status string      `json:"status"`
+	Result        interface{}  `json:"result"`
+	Status        string       `json:"status"`
+	TargetResults *interface{} `json:"target_results,omitempty"`
 }
 
 // RequestJobRequestBody defines body for RequestJob for application/json ContentType.
@@ -28,7 +28,8 @@ type Client struct {
 type Job interface {
 	Id() uuid.UUID
 	OSBuildArgs() (distro.Manifest, []*target.Target, error)
-	Update(status common.ImageBuildState, result *osbuild.Result) error
+	OSTreeStaticDelta() (*OSTreeStaticDelta, error)
+	Update(status common.ImageBuildState, result *osbuild.Result, targetResults []*target.TargetResult) error
 	Canceled() (bool, error)
 	UploadArtifact(name string, reader io.Reader) error
 }
@@ -141,25 +142,50 @@ func (j *job) Id() uuid.UUID {
 }
 
 func (j *job) OSBuildArgs() (distro.Manifest, []*target.Target, error) {
+	args, err := j.osbuildJob()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return args.Manifest, args.Targets, nil
+}
+
+// OSTreeStaticDelta returns the static delta the job should generate, or nil
+func (j *job) OSTreeStaticDelta() (*OSTreeStaticDelta, error) {
+	args, err := j.osbuildJob()
+	if err != nil {
+		return nil, err
+	}
+
+	return args.OSTreeStaticDelta, nil
+}
+
+func (j *job) osbuildJob() (*OSBuildJob, error) {
 	if j.jobType != "osbuild" {
-		return nil, nil, errors.New("not an osbuild job")
+		return nil, errors.New("not an osbuild job")
 	}
 
 	var args OSBuildJob
 	err := json.Unmarshal(j.args, &args)
 	if err != nil {
-		return nil, nil, fmt.Errorf("error parsing osbuild job arguments: %v", err)
+		return nil, fmt.Errorf("error parsing osbuild job arguments: %v", err)
 	}
 
-	return args.Manifest, args.Targets, nil
+	return &args, nil
 }
 
-func (j *job) Update(status common.ImageBuildState, result *osbuild.Result) error {
-	var buf bytes.Buffer
-	err := json.NewEncoder(&buf).Encode(api.UpdateJobJSONRequestBody{
+func (j *job) Update(status common.ImageBuildState, result *osbuild.Result, targetResults []*target.TargetResult) error {
+	body := api.UpdateJobJSONRequestBody{
 		Result: result,
 		Status: status.ToString(),
-	})
+	}
+	if len(targetResults) > 0 {
+		var results interface{} = targetResults
+		body.TargetResults = &results
+	}
+
+	var buf bytes.Buffer
+	err := json.NewEncoder(&buf).Encode(body)
 	if err != nil {
 		panic(err)
 	}
@@ -17,10 +17,27 @@ import (
 type OSBuildJob struct {
 	Manifest distro.Manifest  `json:"manifest"`
 	Targets  []*target.Target `json:"targets,omitempty"`
+
+	// Generate a static delta to the built OSTree commit as an
+	// additional artifact
+	OSTreeStaticDelta *OSTreeStaticDelta `json:"ostree_static_delta,omitempty"`
+
+	// The values of the blueprint variables the manifest was built with
+	Variables map[string]string `json:"variables,omitempty"`
+}
+
+// OSTreeStaticDelta describes a static delta from the commit From to the
+// commit in the artifact Filename. From is pulled from the repository at
+// URL.
+type OSTreeStaticDelta struct {
+	Filename string `json:"filename"`
+	From     string `json:"from"`
+	URL      string `json:"url"`
 }
 
 type OSBuildJobResult struct {
-	OSBuildOutput *osbuild.Result `json:"osbuild_output,omitempty"`
+	OSBuildOutput *osbuild.Result        `json:"osbuild_output,omitempty"`
+	TargetResults []*target.TargetResult `json:"target_results,omitempty"`
 }
 
 //
@@ -44,8 +61,9 @@ type getJobResponse struct {
 }
 
 type updateJobRequest struct {
-	Status common.ImageBuildState `json:"status"`
-	Result *osbuild.Result        `json:"result"`
+	Status        common.ImageBuildState `json:"status"`
+	Result        *osbuild.Result        `json:"result"`
+	TargetResults []*target.TargetResult `json:"target_results,omitempty"`
 }
 
 type updateJobResponse struct {
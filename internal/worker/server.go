@@ -12,6 +12,7 @@ import (
 	"net/http"
 	"os"
 	"path"
+	"path/filepath"
 	"sync"
 	"time"
 
@@ -89,11 +90,14 @@ func (s *Server) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
 }
 
 func (s *Server) Enqueue(arch string, manifest distro.Manifest, targets []*target.Target) (uuid.UUID, error) {
-	job := OSBuildJob{
+	return s.EnqueueOSBuild(arch, &OSBuildJob{
 		Manifest: manifest,
 		Targets:  targets,
-	}
+	})
+}
 
+// EnqueueOSBuild enqueues an osbuild job for `arch`
+func (s *Server) EnqueueOSBuild(arch string, job *OSBuildJob) (uuid.UUID, error) {
 	return s.jobs.Enqueue("osbuild:"+arch, job, nil)
 }
 
@@ -128,6 +132,16 @@ func (s *Server) JobStatus(id uuid.UUID) (*JobStatus, error) {
 	}, nil
 }
 
+// JobArgs returns the job the compose with `id` was enqueued with.
+func (s *Server) JobArgs(id uuid.UUID) (*OSBuildJob, error) {
+	var job OSBuildJob
+	err := s.jobs.JobArgs(id, &job)
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
 func (s *Server) Cancel(id uuid.UUID) error {
 	return s.jobs.CancelJob(id)
 }
@@ -172,6 +186,49 @@ func (s *Server) DeleteArtifacts(id uuid.UUID) error {
 	return os.RemoveAll(path.Join(s.artifactsDir, id.String()))
 }
 
+// Returns the combined size of all artifacts for job `id` in bytes.
+func (s *Server) ArtifactsSize(id uuid.UUID) (int64, error) {
+	if s.artifactsDir == "" {
+		return 0, nil
+	}
+
+	var size int64
+	err := filepath.Walk(path.Join(s.artifactsDir, id.String()), func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+
+	return size, nil
+}
+
+// Deletes job `id` and all its artifacts. The job must be finished or
+// canceled.
+func (s *Server) DeleteJob(id uuid.UUID) error {
+	status, err := s.JobStatus(id)
+	if err != nil {
+		return err
+	}
+
+	if status.Finished.IsZero() && !status.Canceled {
+		return jobqueue.ErrNotFinished
+	}
+
+	err = os.RemoveAll(path.Join(s.artifactsDir, id.String()))
+	if err != nil {
+		return err
+	}
+
+	return s.jobs.DeleteJob(id)
+}
+
 func (s *Server) RequestOSBuildJob(ctx context.Context, arch string) (uuid.UUID, uuid.UUID, *OSBuildJob, error) {
 	token := uuid.New()
 
@@ -225,6 +282,10 @@ func (s *Server) FinishJob(token uuid.UUID, result *OSBuildJobResult) error {
 
 	err := s.jobs.FinishJob(jobId, result)
 	if err != nil {
+		// The job might have been deleted while it was running
+		if s.artifactsDir != "" {
+			_ = os.RemoveAll(path.Join(s.artifactsDir, "tmp", token.String()))
+		}
 		return fmt.Errorf("error finishing job: %v", err)
 	}
 
@@ -333,7 +394,7 @@ func (h *apiHandlers) UpdateJob(ctx echo.Context, idstr string) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "setting status of a job to waiting or running is not supported")
 	}
 
-	err = h.server.FinishJob(token, &OSBuildJobResult{OSBuildOutput: body.Result})
+	err = h.server.FinishJob(token, &OSBuildJobResult{OSBuildOutput: body.Result, TargetResults: body.TargetResults})
 	if err != nil {
 		switch err {
 		case ErrTokenNotExist:
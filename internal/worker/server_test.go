@@ -3,14 +3,19 @@ package worker_test
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"os"
+	"path"
 	"testing"
 
 	"github.com/stretchr/testify/require"
 
 	"github.com/osbuild/osbuild-composer/internal/distro"
 	"github.com/osbuild/osbuild-composer/internal/distro/fedoratest"
+	"github.com/osbuild/osbuild-composer/internal/jobqueue"
 	"github.com/osbuild/osbuild-composer/internal/jobqueue/testjobqueue"
+	"github.com/osbuild/osbuild-composer/internal/target"
 	"github.com/osbuild/osbuild-composer/internal/test"
 	"github.com/osbuild/osbuild-composer/internal/worker"
 )
@@ -100,3 +105,88 @@ func TestCancel(t *testing.T) {
 	test.TestRoute(t, server, false, "GET", fmt.Sprintf("/api/worker/v1/jobs/%s", token), `{}`, http.StatusOK,
 		`{"canceled":true}`)
 }
+
+func TestDeleteJob(t *testing.T) {
+	distroStruct := fedoratest.New()
+	arch, err := distroStruct.GetArch("x86_64")
+	if err != nil {
+		t.Fatalf("error getting arch from distro")
+	}
+	imageType, err := arch.GetImageType("qcow2")
+	if err != nil {
+		t.Fatalf("error getting image type from arch")
+	}
+	manifest, err := imageType.Manifest(nil, distro.ImageOptions{Size: imageType.Size(0)}, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("error creating osbuild manifest")
+	}
+	artifactsDir, err := ioutil.TempDir("", "worker-server-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(artifactsDir)
+	server := worker.NewServer(nil, testjobqueue.New(), artifactsDir)
+
+	jobId, err := server.Enqueue(arch.Name(), manifest, nil)
+	require.NoError(t, err)
+
+	token, _, _, err := server.RequestOSBuildJob(context.Background(), arch.Name())
+	require.NoError(t, err)
+
+	// running jobs cannot be deleted
+	err = server.DeleteJob(jobId)
+	require.Equal(t, jobqueue.ErrNotFinished, err)
+
+	err = os.MkdirAll(path.Join(artifactsDir, "tmp", token.String()), 0700)
+	require.NoError(t, err)
+	err = ioutil.WriteFile(path.Join(artifactsDir, "tmp", token.String(), "disk.qcow2"), make([]byte, 42), 0600)
+	require.NoError(t, err)
+	err = server.FinishJob(token, &worker.OSBuildJobResult{})
+	require.NoError(t, err)
+
+	size, err := server.ArtifactsSize(jobId)
+	require.NoError(t, err)
+	require.Equal(t, int64(42), size)
+
+	err = server.DeleteJob(jobId)
+	require.NoError(t, err)
+	_, err = server.JobStatus(jobId)
+	require.Equal(t, jobqueue.ErrNotExist, err)
+	_, err = os.Stat(path.Join(artifactsDir, jobId.String()))
+	require.True(t, os.IsNotExist(err))
+
+	size, err = server.ArtifactsSize(jobId)
+	require.NoError(t, err)
+	require.Zero(t, size)
+}
+
+func TestUpdateJobTargetResults(t *testing.T) {
+	distroStruct := fedoratest.New()
+	arch, err := distroStruct.GetArch("x86_64")
+	if err != nil {
+		t.Fatalf("error getting arch from distro")
+	}
+	imageType, err := arch.GetImageType("qcow2")
+	if err != nil {
+		t.Fatalf("error getting image type from arch")
+	}
+	manifest, err := imageType.Manifest(nil, distro.ImageOptions{Size: imageType.Size(0)}, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("error creating osbuild manifest")
+	}
+	server := worker.NewServer(nil, testjobqueue.New(), "")
+
+	jobId, err := server.Enqueue(arch.Name(), manifest, nil)
+	require.NoError(t, err)
+
+	token, _, _, err := server.RequestOSBuildJob(context.Background(), arch.Name())
+	require.NoError(t, err)
+
+	test.TestRoute(t, server, false, "PATCH", fmt.Sprintf("/api/worker/v1/jobs/%s", token),
+		`{"status":"FINISHED","result":{"success":true},"target_results":[{"name":"org.osbuild.container","options":{"digest":"sha256:abcdef"}}]}`,
+		http.StatusOK, `{}`)
+
+	status, err := server.JobStatus(jobId)
+	require.NoError(t, err)
+	require.Equal(t, []*target.TargetResult{
+		target.NewContainerTargetResult(&target.ContainerTargetResultOptions{Digest: "sha256:abcdef"}),
+	}, status.Result.TargetResults)
+}
@@ -56,9 +56,14 @@ BuildRequires:  krb5-devel
 
 Requires: %{name}-worker = %{version}-%{release}
 Requires: systemd
-Requires: osbuild >= 18
-Requires: osbuild-ostree >= 18
+# 22 added the org.osbuild.bootiso assembler and the org.osbuild.anaconda,
+# org.osbuild.kickstart, org.osbuild.lorax-script and org.osbuild.ostree.pull
+# stages, which edge installer images are built with
+Requires: osbuild >= 22
+Requires: osbuild-ostree >= 22
 Requires: qemu-img
+Recommends: git-core
+Recommends: ostree
 
 Provides: weldr
 
@@ -138,6 +143,7 @@ install -m 0644 -vp distribution/osbuild-remote-worker.socket   %{buildroot}%{_u
 install -m 0644 -vp distribution/osbuild-remote-worker@.service %{buildroot}%{_unitdir}/
 install -m 0644 -vp distribution/osbuild-worker@.service        %{buildroot}%{_unitdir}/
 install -m 0644 -vp distribution/osbuild-composer-koji.socket   %{buildroot}%{_unitdir}/
+install -m 0644 -vp distribution/osbuild-composer-ostree.socket %{buildroot}%{_unitdir}/
 install -m 0755 -vd                                             %{buildroot}%{_unitdir}
 install -m 0644 -vp distribution/osbuild-composer.{service,socket} %{buildroot}%{_unitdir}/
 install -m 0644 -vp distribution/osbuild-*worker*.{service,socket} %{buildroot}%{_unitdir}/
@@ -207,13 +213,13 @@ export GOPATH=$PWD/_build:%{gopath}
 %endif
 
 %post
-%systemd_post osbuild-composer.service osbuild-composer.socket osbuild-remote-worker.socket
+%systemd_post osbuild-composer.service osbuild-composer.socket osbuild-remote-worker.socket osbuild-composer-ostree.socket
 
 %preun
-%systemd_preun osbuild-composer.service osbuild-composer.socket osbuild-remote-worker.socket
+%systemd_preun osbuild-composer.service osbuild-composer.socket osbuild-remote-worker.socket osbuild-composer-ostree.socket
 
 %postun
-%systemd_postun_with_restart osbuild-composer.service osbuild-composer.socket osbuild-remote-worker.socket
+%systemd_postun_with_restart osbuild-composer.service osbuild-composer.socket osbuild-remote-worker.socket osbuild-composer-ostree.socket
 
 %files
 %license LICENSE
@@ -224,6 +230,7 @@ export GOPATH=$PWD/_build:%{gopath}
 %{_unitdir}/osbuild-composer.service
 %{_unitdir}/osbuild-composer.socket
 %{_unitdir}/osbuild-remote-worker.socket
+%{_unitdir}/osbuild-composer-ostree.socket
 %{_sysusersdir}/osbuild-composer.conf
 
 %package worker
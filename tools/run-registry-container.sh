@@ -0,0 +1,90 @@
+#!/bin/bash
+set -eu
+
+SHARE_DIR=/tmp/osbuild-composer-registry-test
+
+registry_stop () {
+  echo "Shutting down the registry container, please wait..."
+
+  ${CONTAINER_RUNTIME} stop org.osbuild.registry || true
+  ${CONTAINER_RUNTIME} rm org.osbuild.registry || true
+
+  rm -rf "${SHARE_DIR}" || true
+}
+
+registry_clean_up_bad_start ()  {
+  # remember the exit code, so we can report it later
+  EXIT_CODE=$?
+  echo "Start failed, removing the container."
+
+  registry_stop
+
+  exit $EXIT_CODE
+}
+
+registry_start() {
+  trap registry_clean_up_bad_start EXIT
+
+  # create a share directory which holds the htpasswd file of the registry
+  mkdir "${SHARE_DIR}"
+
+  # osbuild/osbuildpass - the only user allowed to push and pull
+  ${CONTAINER_RUNTIME} run --rm --entrypoint htpasswd \
+    docker.io/library/httpd:2 -Bbn osbuild osbuildpass > "${SHARE_DIR}/htpasswd"
+
+  ${CONTAINER_RUNTIME} run -d --name org.osbuild.registry \
+    -v "${SHARE_DIR}:/auth:z" \
+    -p 5000:5000 \
+    -e REGISTRY_AUTH=htpasswd \
+    -e REGISTRY_AUTH_HTPASSWD_REALM=osbuild \
+    -e REGISTRY_AUTH_HTPASSWD_PATH=/auth/htpasswd \
+    docker.io/library/registry:2
+
+  # wait for the registry to start answering
+  for _ in $(seq 30); do
+    if curl --silent --output /dev/null http://localhost:5000/v2/; then
+      break
+    fi
+    sleep 1
+  done
+
+  echo "The registry is running at http://localhost:5000, to stop it use:"
+  echo "$0 stop"
+
+  trap - EXIT
+}
+
+# check arguments
+if [[ $# -ne 1 || ( "$1" != "start" && "$1" != "stop" ) ]]; then
+  cat <<DOC
+usage: $0 start|stop
+
+start - starts the registry container
+stop  - stops and removes the registry container
+DOC
+  exit 3
+fi
+
+# this script must be run as root
+if [ $UID != 0 ]; then
+  echo This script must be run as root.
+  exit 1
+fi
+
+# decide whether podman or docker should be used
+if which podman 2>/dev/null >&2; then
+  CONTAINER_RUNTIME=podman
+elif which docker 2>/dev/null >&2; then
+  CONTAINER_RUNTIME=docker
+else
+  echo No container runtime found, install podman or docker.
+  exit 2
+fi
+
+if [ "$1" == "start" ]; then
+  registry_start
+fi
+
+if [ "$1" == "stop" ]; then
+  registry_stop
+fi